@@ -7,10 +7,13 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/BlakeLiAFK/letsync/internal/agent/challenge"
 	"github.com/BlakeLiAFK/letsync/internal/agent/deployer"
+	"github.com/BlakeLiAFK/letsync/internal/agent/keygen"
 	"github.com/BlakeLiAFK/letsync/internal/agent/poller"
 	"github.com/BlakeLiAFK/letsync/internal/agent/reloader"
 )
@@ -18,6 +21,18 @@ import (
 // Version 构建时注入的版本号
 var Version = "dev"
 
+// challengeInterval HTTP-01 验证令牌轮询间隔（签发期间需要快速响应）
+const challengeInterval = 5 * time.Second
+
+// http01Agent 当前是否有证书由本 Agent 放置 HTTP-01 验证文件
+var http01Agent atomic.Bool
+
+// csrRetryInterval 服务器未在签发且证书仍未签发时，重新提交 CSR 的最小间隔
+const csrRetryInterval = time.Hour
+
+// csrSubmittedAt 按证书 ID 记录上次提交 CSR 的时间
+var csrSubmittedAt = make(map[int]time.Time)
+
 func main() {
 	// 命令行参数
 	verbose := flag.Bool("v", false, "详细日志输出")
@@ -60,6 +75,11 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
+	// HTTP-01 委托验证令牌轮询
+	responder := challenge.NewResponder()
+	stop := make(chan struct{})
+	go runChallenges(poll, responder, stop, *verbose)
+
 	// 首次运行
 	pollInterval := runOnce(poll, deploy, reload, localIP, *verbose)
 	if pollInterval <= 0 {
@@ -80,6 +100,8 @@ func main() {
 			}
 		case <-quit:
 			log.Println("正在关闭...")
+			close(stop)
+			responder.Close()
 			return
 		}
 	}
@@ -102,8 +124,38 @@ func runOnce(poll *poller.Poller, deploy *deployer.Deployer, reload *reloader.Re
 	var syncs []poller.SyncStatus
 	reloadNeeded := make(map[string]bool) // 按 reload 命令分组
 
+	hasHTTP01Agent := false
+	for _, certInfo := range config.Certs {
+		if certInfo.HTTP01Agent {
+			hasHTTP01Agent = true
+		}
+	}
+	http01Agent.Store(hasHTTP01Agent)
+
 	// 处理每个证书
 	for _, certInfo := range config.Certs {
+		// 本地私钥模式：确保私钥存在，且服务器持有与之匹配的 CSR
+		if certInfo.AgentKey {
+			ready, err := ensureAgentKey(poll, deploy, &certInfo)
+			if err != nil {
+				log.Printf("处理证书 %s 本地私钥失败: %v", certInfo.Domain, err)
+				syncs = append(syncs, poller.SyncStatus{
+					CertID:      certInfo.ID,
+					Fingerprint: "",
+					Status:      "failed",
+				})
+				continue
+			}
+			if !ready {
+				syncs = append(syncs, poller.SyncStatus{
+					CertID:      certInfo.ID,
+					Fingerprint: "",
+					Status:      "pending",
+				})
+				continue
+			}
+		}
+
 		// 检查是否需要更新
 		if !deploy.NeedsUpdate(&certInfo) {
 			if verbose {
@@ -179,6 +231,102 @@ func runOnce(poll *poller.Poller, deploy *deployer.Deployer, reload *reloader.Re
 	return config.PollInterval
 }
 
+// runChallenges 轮询服务器下发的 HTTP-01 验证令牌，放置后向服务器确认
+func runChallenges(poll *poller.Poller, responder *challenge.Responder, stop <-chan struct{}, verbose bool) {
+	ticker := time.NewTicker(challengeInterval)
+	defer ticker.Stop()
+
+	// 配置中没有委托验证的证书时降低频率，仍能及时发现新开启的委托
+	idleTicks := 0
+
+	for {
+		select {
+		case <-ticker.C:
+			if !http01Agent.Load() {
+				idleTicks++
+				if idleTicks < 12 {
+					continue
+				}
+			}
+			idleTicks = 0
+
+			challenges, err := poll.GetChallenges()
+			if err != nil {
+				if verbose {
+					log.Printf("获取验证令牌失败: %v", err)
+				}
+				continue
+			}
+
+			for _, ch := range responder.Sync(challenges) {
+				if err := poll.ConfirmChallenge(ch.CertID, ch.Token); err != nil {
+					log.Printf("确认验证令牌失败 (%s): %v", ch.Domain, err)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// ensureAgentKey 确保本地私钥存在并已向服务器提交匹配的 CSR
+// 返回 true 表示服务器上的证书已使用本地私钥签发，可以继续部署
+func ensureAgentKey(poll *poller.Poller, deploy *deployer.Deployer, certInfo *poller.CertInfo) (bool, error) {
+	key, err := deploy.EnsureLocalKey(certInfo)
+	if err != nil {
+		return false, err
+	}
+
+	fingerprint, err := deploy.LocalKeyFingerprint(key)
+	if err != nil {
+		return false, err
+	}
+
+	submit := func() error {
+		csrPEM, err := keygen.CreateCSR(key, certInfo.Domains)
+		if err != nil {
+			return err
+		}
+		if err := poll.SubmitCSR(certInfo.ID, csrPEM); err != nil {
+			return fmt.Errorf("提交 CSR 失败: %w", err)
+		}
+		csrSubmittedAt[certInfo.ID] = time.Now()
+		return nil
+	}
+
+	if fingerprint != certInfo.CSRKeyFingerprint {
+		if err := submit(); err != nil {
+			return false, err
+		}
+		log.Printf("证书 %s 已提交本地生成的 CSR，等待服务器签发", certInfo.Domain)
+		return false, nil
+	}
+
+	// CSR 已提交但尚未按本地私钥签发（未签发，或仍是改为本地私钥前由服务器私钥签发的证书）
+	if certInfo.CertKeyFingerprint != fingerprint {
+		if certInfo.Issuing {
+			return false, nil
+		}
+		// 签发失败或服务器重启中断了签发，间隔一段时间后重新提交同一 CSR
+		if time.Since(csrSubmittedAt[certInfo.ID]) < csrRetryInterval {
+			if certInfo.LastError != "" {
+				return false, fmt.Errorf("服务器签发失败: %s", certInfo.LastError)
+			}
+			return false, nil
+		}
+		if certInfo.LastError != "" {
+			log.Printf("警告: 证书 %s 签发失败: %s，重新提交 CSR", certInfo.Domain, certInfo.LastError)
+		}
+		if err := submit(); err != nil {
+			return false, err
+		}
+		log.Printf("证书 %s 已重新提交 CSR，等待服务器签发", certInfo.Domain)
+		return false, nil
+	}
+
+	return true, nil
+}
+
 // getLocalIP 获取本机 IP
 func getLocalIP() string {
 	addrs, err := net.InterfaceAddrs()
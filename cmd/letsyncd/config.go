@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/dnsprovider"
+	"github.com/BlakeLiAFK/letsync/internal/server/service"
+	"github.com/BlakeLiAFK/letsync/internal/server/store"
+)
+
+// openStore 初始化数据库和安全配置，供子命令使用
+func openStore(dataDir string) error {
+	if err := store.InitDB(dataDir); err != nil {
+		return fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	if err := service.NewSettingsService().InitSecuritySettings(); err != nil {
+		return fmt.Errorf("初始化安全配置失败: %w", err)
+	}
+	return nil
+}
+
+// runApply letsyncd apply -f config.yaml：计算配置与数据库的差异并应用
+func runApply(args []string) int {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	dataDir := fs.String("d", "./data", "数据目录路径")
+	file := fs.String("f", "", "配置文件路径，- 表示从标准输入读取")
+	dryRun := fs.Bool("dry-run", false, "只显示变更计划，不应用")
+	prune := fs.Bool("prune", false, "删除配置中未列出的工作区、DNS 提供商、证书、Agent 和绑定")
+	execAllow := fs.String("exec-allow", os.Getenv(dnsprovider.EnvExecAllow), "exec DNS 提供商允许调用的程序或目录，多个以 : 分隔，为空时禁用")
+	fs.Parse(args)
+	dnsprovider.SetExecAllowlist(*execAllow)
+
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "用法: letsyncd apply -f config.yaml [-d ./data] [-dry-run] [-prune]")
+		return 2
+	}
+
+	spec, err := service.LoadConfigFile(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := openStore(*dataDir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	configService := service.NewConfigService()
+	plan, err := configService.Plan(spec, *prune)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "配置无效: %v\n", err)
+		return 1
+	}
+
+	for _, w := range plan.Warnings {
+		fmt.Fprintf(os.Stderr, "警告: %s\n", w)
+	}
+	if len(plan.Changes) == 0 {
+		fmt.Println("配置与数据库一致，无需变更")
+		return 0
+	}
+	for _, c := range plan.Changes {
+		fmt.Println(c.String())
+	}
+	fmt.Printf("\n计划: 创建 %d，更新 %d，删除 %d\n",
+		plan.Count(service.ConfigCreate), plan.Count(service.ConfigUpdate), plan.Count(service.ConfigDelete))
+	if *dryRun {
+		return 0
+	}
+
+	if err := configService.Apply(plan); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, "所有变更已回滚，修正后重新执行 apply 即可")
+		return 1
+	}
+	for _, c := range plan.Changes {
+		if c.Result != "" {
+			fmt.Printf("%s %s\n", c.Name, c.Result)
+		}
+	}
+	fmt.Println("已应用")
+	return 0
+}
+
+// runExport letsyncd export：导出当前配置为 YAML
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dataDir := fs.String("d", "./data", "数据目录路径")
+	output := fs.String("o", "", "输出文件路径，默认输出到标准输出")
+	secrets := fs.Bool("secrets", false, "导出 DNS 提供商密钥明文（默认导出为 env: 引用）")
+	fs.Parse(args)
+
+	if err := openStore(*dataDir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	spec, err := service.NewConfigService().Export(*secrets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "导出配置失败: %v\n", err)
+		return 1
+	}
+	data, err := spec.Marshal()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "导出配置失败: %v\n", err)
+		return 1
+	}
+
+	if *output == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	// 可能包含密钥，仅所有者可读
+	if err := os.WriteFile(*output, data, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "写入文件失败: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/BlakeLiAFK/letsync"
 	"github.com/BlakeLiAFK/letsync/internal/server/api"
+	"github.com/BlakeLiAFK/letsync/internal/server/dnsprovider"
 	"github.com/BlakeLiAFK/letsync/internal/server/middleware" //nolint:all
 	"github.com/BlakeLiAFK/letsync/internal/server/scheduler"
 	"github.com/BlakeLiAFK/letsync/internal/server/service"
@@ -25,11 +26,22 @@ import (
 var Version = "dev"
 
 func main() {
+	// 子命令：声明式配置
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "apply":
+			os.Exit(runApply(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		}
+	}
+
 	// 解析命令行参数
 	dataDir := flag.String("d", "./data", "数据目录路径")
 	port := flag.Int("p", 0, "临时指定端口 (仅首次启动)")
 	addrF := flag.String("a", "0.0.0.0", "临时指定地址 (仅首次启动)")
 	version := flag.Bool("v", false, "显示版本信息")
+	execAllow := flag.String("exec-allow", os.Getenv(dnsprovider.EnvExecAllow), "exec DNS 提供商允许调用的程序或目录，多个以 : 分隔，为空时禁用")
 	flag.Parse()
 
 	// 显示版本信息
@@ -38,6 +50,8 @@ func main() {
 		os.Exit(0)
 	}
 
+	dnsprovider.SetExecAllowlist(*execAllow)
+
 	// 初始化数据库
 	if err := store.InitDB(*dataDir); err != nil {
 		log.Fatalf("初始化数据库失败: %v", err)
@@ -49,6 +63,11 @@ func main() {
 		log.Fatalf("初始化安全配置失败: %v", err)
 	}
 
+	// 上次未完成的批量任务标记为中断
+	if err := service.NewCertBatchService(*dataDir).MarkInterrupted(); err != nil {
+		log.Printf("更新批量任务状态失败: %v", err)
+	}
+
 	// 获取服务器配置
 	host := settings.Get("server.host")
 	if host == "" {
@@ -77,19 +96,46 @@ func main() {
 	// 初始化 handlers
 	authHandler := api.NewAuthHandler()
 	certHandler := api.NewCertHandler(*dataDir)
+	certBatchHandler := api.NewCertBatchHandler(*dataDir)
 	agentHandler := api.NewAgentHandler()
-	agentEndpoint := api.NewAgentEndpoint()
+	agentEndpoint := api.NewAgentEndpoint(*dataDir)
 	dnsHandler := api.NewDNSProviderHandler()
 	notifyHandler := api.NewNotificationHandler()
 	settingsHandler := api.NewSettingsHandler()
 	taskLogHandler := api.NewTaskLogHandler()
 	workspaceHandler := api.NewWorkspaceHandler()
+	challengeHandler := api.NewACMEChallengeHandler()
+	acmeServerHandler := api.NewACMEServerHandler()
 
 	// 公开接口
 	r.GET("/api/auth/status", authHandler.Status)
 	r.POST("/api/auth/setup", authHandler.SetupPassword)
 	r.POST("/api/auth/login", authHandler.Login)
 
+	// HTTP-01 验证文件 (proxy 模式，由前置代理转发)
+	r.GET("/.well-known/acme-challenge/:token", challengeHandler.Serve)
+
+	// 内置 ACME 服务端 (私有 CA 工作区，JWS 签名认证)
+	acmeGroup := r.Group("/acme/:workspace")
+	acmeGroup.Use(acmeServerHandler.RequireWorkspace())
+	{
+		acmeGroup.GET("/directory", acmeServerHandler.Directory)
+		acmeGroup.HEAD("/new-nonce", acmeServerHandler.NewNonce)
+		acmeGroup.GET("/new-nonce", acmeServerHandler.NewNonce)
+		acmeGroup.POST("/new-account", acmeServerHandler.NewAccount)
+		acmeGroup.POST("/account/:id", acmeServerHandler.Account)
+		acmeGroup.POST("/account/:id/orders", acmeServerHandler.Orders)
+		acmeGroup.POST("/new-order", acmeServerHandler.NewOrder)
+		acmeGroup.POST("/order/:id", acmeServerHandler.Order)
+		acmeGroup.POST("/order/:id/finalize", acmeServerHandler.Finalize)
+		acmeGroup.POST("/authz/:id", acmeServerHandler.Authorization)
+		acmeGroup.POST("/chall/:id", acmeServerHandler.Challenge)
+		acmeGroup.POST("/cert/:id", acmeServerHandler.Certificate)
+		acmeGroup.POST("/revoke-cert", acmeServerHandler.RevokeCert)
+		acmeGroup.POST("/key-change", acmeServerHandler.KeyChange)
+		acmeGroup.GET("/crl", acmeServerHandler.CRL)
+	}
+
 	// Agent 连接端点 (签名认证)
 	agentGroup := r.Group("/agent/:uuid/:signature")
 	agentGroup.Use(agentEndpoint.VerifyAgent())
@@ -97,6 +143,9 @@ func main() {
 		agentGroup.GET("/config", agentEndpoint.GetConfig)
 		agentGroup.GET("/certs", agentEndpoint.GetCerts)
 		agentGroup.GET("/cert/:cert_id", agentEndpoint.GetCert)
+		agentGroup.POST("/cert/:cert_id/csr", agentEndpoint.SubmitCSR)
+		agentGroup.GET("/challenges", agentEndpoint.GetChallenges)
+		agentGroup.POST("/challenges/confirm", agentEndpoint.ConfirmChallenge)
 		agentGroup.POST("/heartbeat", agentEndpoint.Heartbeat)
 		agentGroup.POST("/status", agentEndpoint.Status)
 	}
@@ -112,11 +161,17 @@ func main() {
 		apiGroup.GET("/certs", certHandler.List)
 		apiGroup.GET("/certs/stats", certHandler.Stats)
 		apiGroup.POST("/certs", certHandler.Create)
+		apiGroup.POST("/certs/import", certHandler.Import)
+		apiGroup.GET("/certs/batch", certBatchHandler.List)
+		apiGroup.POST("/certs/batch", certBatchHandler.Create)
+		apiGroup.GET("/certs/batch/:id", certBatchHandler.Get)
 		apiGroup.GET("/certs/:id", certHandler.Get)
 		apiGroup.PUT("/certs/:id", certHandler.Edit)
 		apiGroup.DELETE("/certs/:id", certHandler.Delete)
 		apiGroup.POST("/certs/:id/issue", certHandler.Issue)
 		apiGroup.POST("/certs/:id/renew", certHandler.Renew)
+		apiGroup.POST("/certs/:id/revoke", certHandler.Revoke)
+		apiGroup.POST("/certs/:id/import", certHandler.Import)
 		// 下载接口添加频率限制
 		apiGroup.GET("/certs/:id/download/:type", middleware.DownloadRateLimit(), certHandler.Download)
 
@@ -128,6 +183,7 @@ func main() {
 		sseGroup.Use(middleware.SSEAuth())
 		{
 			sseGroup.GET("/certs/:id/logs/stream", taskLogHandler.LogsStream)
+			sseGroup.GET("/certs/batch/:id/stream", certBatchHandler.Stream)
 		}
 
 		// Agent
@@ -145,9 +201,12 @@ func main() {
 		// DNS 提供商
 		apiGroup.GET("/dns-providers", dnsHandler.List)
 		apiGroup.POST("/dns-providers", dnsHandler.Create)
+		apiGroup.GET("/dns-providers/types", dnsHandler.Types)
 		apiGroup.GET("/dns-providers/:id", dnsHandler.Get)
 		apiGroup.PUT("/dns-providers/:id", dnsHandler.Update)
 		apiGroup.DELETE("/dns-providers/:id", dnsHandler.Delete)
+		apiGroup.POST("/dns-providers/:id/test", dnsHandler.Test)
+		apiGroup.POST("/dns-providers/:id/cleanup", dnsHandler.Cleanup)
 
 		// 通知
 		apiGroup.GET("/notifications", notifyHandler.List)
@@ -173,6 +232,7 @@ func main() {
 		apiGroup.PUT("/workspaces/:id", workspaceHandler.Update)
 		apiGroup.DELETE("/workspaces/:id", workspaceHandler.Delete)
 		apiGroup.POST("/workspaces/:id/default", workspaceHandler.SetDefault)
+		apiGroup.GET("/workspaces/:id/ca/:type", workspaceHandler.DownloadCA)
 	}
 
 	// 静态文件服务 (嵌入的前端)
@@ -0,0 +1,219 @@
+package challenge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlakeLiAFK/letsync/internal/agent/poller"
+)
+
+// 验证文件路径前缀
+const challengePath = "/.well-known/acme-challenge/"
+
+// Responder 在本机放置 HTTP-01 验证令牌
+// 配置了 webroot 时写入文件，由现有 Web 服务器提供；否则在指定端口启动临时 HTTP 服务
+type Responder struct {
+	mu      sync.Mutex
+	placed  map[string]poller.Challenge // certID/token -> 已放置的令牌
+	servers map[int]*tokenServer        // 端口 -> 临时 HTTP 服务
+}
+
+// tokenServer 临时 HTTP 验证服务
+type tokenServer struct {
+	server *http.Server
+	mu     sync.RWMutex
+	tokens map[string]string // token -> keyAuth
+}
+
+func NewResponder() *Responder {
+	return &Responder{
+		placed:  make(map[string]poller.Challenge),
+		servers: make(map[int]*tokenServer),
+	}
+}
+
+func challengeKey(ch poller.Challenge) string {
+	return fmt.Sprintf("%d/%s", ch.CertID, ch.Token)
+}
+
+// Sync 按服务器下发的令牌列表放置新令牌、清理过期令牌
+// 返回已放置但服务器尚未确认的令牌
+func (r *Responder) Sync(challenges []poller.Challenge) []poller.Challenge {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := make(map[string]bool)
+	var unconfirmed []poller.Challenge
+
+	for _, ch := range challenges {
+		key := challengeKey(ch)
+		current[key] = true
+
+		if _, ok := r.placed[key]; !ok {
+			if err := r.place(ch); err != nil {
+				log.Printf("放置验证令牌失败 (%s): %v", ch.Domain, err)
+				continue
+			}
+			r.placed[key] = ch
+			log.Printf("已放置 HTTP-01 验证令牌: %s", ch.Domain)
+		}
+
+		if !ch.Confirmed {
+			unconfirmed = append(unconfirmed, ch)
+		}
+	}
+
+	// 清理服务器已移除的令牌
+	for key, ch := range r.placed {
+		if current[key] {
+			continue
+		}
+		r.remove(ch)
+		delete(r.placed, key)
+	}
+
+	return unconfirmed
+}
+
+// Close 清理所有令牌并关闭临时服务
+func (r *Responder) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, ch := range r.placed {
+		r.remove(ch)
+		delete(r.placed, key)
+	}
+}
+
+// place 放置单个令牌
+func (r *Responder) place(ch poller.Challenge) error {
+	if !validToken(ch.Token) {
+		return fmt.Errorf("无效的令牌")
+	}
+
+	if ch.Webroot != "" {
+		dir := filepath.Join(ch.Webroot, filepath.FromSlash(challengePath))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建目录失败: %w", err)
+		}
+		// Web 服务器需要能读取验证文件
+		if err := os.WriteFile(filepath.Join(dir, ch.Token), []byte(ch.KeyAuth), 0644); err != nil {
+			return fmt.Errorf("写入验证文件失败: %w", err)
+		}
+		return nil
+	}
+
+	srv, err := r.serverFor(port(ch))
+	if err != nil {
+		return err
+	}
+	srv.mu.Lock()
+	srv.tokens[ch.Token] = ch.KeyAuth
+	srv.mu.Unlock()
+	return nil
+}
+
+// remove 移除单个令牌，端口上没有令牌时关闭临时服务
+func (r *Responder) remove(ch poller.Challenge) {
+	if ch.Webroot != "" {
+		path := filepath.Join(ch.Webroot, filepath.FromSlash(challengePath), ch.Token)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("删除验证文件失败: %v", err)
+		}
+		return
+	}
+
+	p := port(ch)
+	srv, ok := r.servers[p]
+	if !ok {
+		return
+	}
+
+	srv.mu.Lock()
+	delete(srv.tokens, ch.Token)
+	empty := len(srv.tokens) == 0
+	srv.mu.Unlock()
+
+	if empty {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		srv.server.Shutdown(ctx)
+		cancel()
+		delete(r.servers, p)
+		log.Printf("HTTP-01 验证服务已停止 (端口 %d)", p)
+	}
+}
+
+// serverFor 获取或启动指定端口的临时 HTTP 服务
+func (r *Responder) serverFor(p int) (*tokenServer, error) {
+	if srv, ok := r.servers[p]; ok {
+		return srv, nil
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", p))
+	if err != nil {
+		return nil, fmt.Errorf("监听端口 %d 失败: %w", p, err)
+	}
+
+	srv := &tokenServer{tokens: make(map[string]string)}
+	srv.server = &http.Server{
+		Handler:           srv,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go srv.server.Serve(listener)
+
+	r.servers[p] = srv
+	log.Printf("HTTP-01 验证服务已启动 (端口 %d)", p)
+	return srv, nil
+}
+
+// ServeHTTP 提供验证文件
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet || !strings.HasPrefix(req.URL.Path, challengePath) {
+		http.NotFound(w, req)
+		return
+	}
+
+	token := strings.TrimPrefix(req.URL.Path, challengePath)
+	s.mu.RLock()
+	keyAuth, ok := s.tokens[token]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(keyAuth))
+}
+
+// port 获取验证端口，默认 80
+func port(ch poller.Challenge) int {
+	if ch.Port > 0 {
+		return ch.Port
+	}
+	return 80
+}
+
+// validToken 令牌只能包含 base64url 字符，防止路径穿越
+func validToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, c := range token {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -1,14 +1,19 @@
 package deployer
 
 import (
+	"crypto"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/hex"
+	"encoding/pem"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/BlakeLiAFK/letsync/internal/agent/keygen"
 	"github.com/BlakeLiAFK/letsync/internal/agent/poller"
+	pkgcrypto "github.com/BlakeLiAFK/letsync/internal/pkg/crypto"
 )
 
 // Deployer 证书部署器
@@ -152,13 +157,26 @@ func (d *Deployer) Deploy(certInfo *poller.CertInfo, certData *poller.CertData)
 		fm.Fullchain = "fullchain.pem"
 	}
 
+	// 私钥不由服务器下发时只部署证书和证书链
+	filenames := []string{fm.Cert, fm.Key, fm.Fullchain}
+	if certInfo.ExternalKey {
+		filenames = []string{fm.Cert, fm.Fullchain}
+	}
+
 	// 验证所有文件名
-	for _, filename := range []string{fm.Cert, fm.Key, fm.Fullchain} {
+	for _, filename := range filenames {
 		if err := d.validateFilename(filename); err != nil {
 			return fmt.Errorf("文件名验证失败: %w", err)
 		}
 	}
 
+	// 本地私钥模式下确认证书与本地私钥匹配，避免部署旧 CSR 签发的证书
+	if certInfo.AgentKey {
+		if err := d.verifyLocalKey(certInfo, certData.CertPEM); err != nil {
+			return err
+		}
+	}
+
 	// 确保目录存在，使用更严格的权限
 	if err := os.MkdirAll(certInfo.DeployPath, 0750); err != nil {
 		return fmt.Errorf("创建目录失败: %w", err)
@@ -167,9 +185,11 @@ func (d *Deployer) Deploy(certInfo *poller.CertInfo, certData *poller.CertData)
 	// 写入证书文件
 	files := map[string]string{
 		fm.Cert:      certData.CertPEM,
-		fm.Key:       certData.KeyPEM,
 		fm.Fullchain: certData.FullchainPEM,
 	}
+	if !certInfo.ExternalKey {
+		files[fm.Key] = certData.KeyPEM
+	}
 
 	for filename, content := range files {
 		if content == "" {
@@ -190,6 +210,84 @@ func (d *Deployer) Deploy(certInfo *poller.CertInfo, certData *poller.CertData)
 	return nil
 }
 
+// EnsureLocalKey 读取部署目录中的本地私钥，不存在时生成并写入
+func (d *Deployer) EnsureLocalKey(certInfo *poller.CertInfo) (crypto.Signer, error) {
+	if err := d.validatePath(certInfo.DeployPath); err != nil {
+		return nil, fmt.Errorf("部署路径验证失败: %w", err)
+	}
+
+	keyFile := certInfo.FileMapping.Key
+	if keyFile == "" {
+		keyFile = "key.pem"
+	}
+	if err := d.validateFilename(keyFile); err != nil {
+		return nil, fmt.Errorf("文件名验证失败: %w", err)
+	}
+
+	path := filepath.Join(certInfo.DeployPath, keyFile)
+	if data, err := os.ReadFile(path); err == nil {
+		key, err := keygen.ParseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("解析本地私钥 %s 失败: %w", path, err)
+		}
+		return key, nil
+	}
+
+	key, err := keygen.GenerateKey(certInfo.KeyType)
+	if err != nil {
+		return nil, fmt.Errorf("生成私钥失败: %w", err)
+	}
+	keyPEM, err := keygen.EncodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(certInfo.DeployPath, 0750); err != nil {
+		return nil, fmt.Errorf("创建目录失败: %w", err)
+	}
+	if err := os.WriteFile(path, keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("写入私钥 %s 失败: %w", path, err)
+	}
+
+	return key, nil
+}
+
+// LocalKeyFingerprint 获取本地私钥的公钥指纹
+func (d *Deployer) LocalKeyFingerprint(key crypto.Signer) (string, error) {
+	return pkgcrypto.PublicKeyFingerprint(key.Public())
+}
+
+// verifyLocalKey 校验证书公钥与本地私钥一致
+func (d *Deployer) verifyLocalKey(certInfo *poller.CertInfo, certPEM string) error {
+	key, err := d.EnsureLocalKey(certInfo)
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return fmt.Errorf("证书内容无效")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("解析证书失败: %w", err)
+	}
+
+	certFingerprint, err := pkgcrypto.PublicKeyFingerprint(cert.PublicKey)
+	if err != nil {
+		return err
+	}
+	keyFingerprint, err := d.LocalKeyFingerprint(key)
+	if err != nil {
+		return err
+	}
+	if certFingerprint != keyFingerprint {
+		return fmt.Errorf("证书公钥与本地私钥不匹配，等待服务器按新 CSR 签发")
+	}
+
+	return nil
+}
+
 // GetLocalFingerprint 获取本地证书指纹
 func (d *Deployer) GetLocalFingerprint(deployPath, certFilename string) string {
 	if certFilename == "" {
@@ -26,6 +26,17 @@ type CertInfo struct {
 	DeployPath  string      `json:"deploy_path"`
 	FileMapping FileMapping `json:"file_mapping"`
 	ReloadCmd   string      `json:"reload_cmd"`
+	ExternalKey bool        `json:"external_key"` // 私钥不由服务器下发（自带 CSR 或 Agent 本地生成）
+	HTTP01Agent bool        `json:"http01_agent"` // 由 Agent 放置 HTTP-01 验证文件
+
+	// Agent 本地生成私钥时使用
+	AgentKey           bool     `json:"agent_key"`
+	Domains            []string `json:"domains"`
+	KeyType            string   `json:"key_type"`
+	CSRKeyFingerprint  string   `json:"csr_key_fingerprint"`  // 服务器当前 CSR 的公钥指纹
+	CertKeyFingerprint string   `json:"cert_key_fingerprint"` // 服务器当前证书的公钥指纹，未签发为空
+	Issuing            bool     `json:"issuing"`              // 服务器正在签发
+	LastError          string   `json:"last_error"`           // 服务器最近一次签发失败的原因
 }
 
 // FileMapping 文件映射
@@ -42,6 +53,17 @@ type CertData struct {
 	FullchainPEM string `json:"fullchain_pem"`
 }
 
+// Challenge 需要放置的 HTTP-01 验证令牌
+type Challenge struct {
+	CertID    int    `json:"cert_id"`
+	Domain    string `json:"domain"`
+	Token     string `json:"token"`
+	KeyAuth   string `json:"key_auth"`
+	Webroot   string `json:"webroot"`   // 写入 {webroot}/.well-known/acme-challenge/{token}
+	Port      int    `json:"port"`      // 未配置 webroot 时监听的端口
+	Confirmed bool   `json:"confirmed"` // 服务器是否已收到确认
+}
+
 // SyncStatus 同步状态
 type SyncStatus struct {
 	CertID      int    `json:"cert_id"`
@@ -136,6 +158,78 @@ func (p *Poller) GetCert(certID int) (*CertData, error) {
 	return &data, nil
 }
 
+// SubmitCSR 提交本地生成的 CSR
+func (p *Poller) SubmitCSR(certID int, csrPEM []byte) error {
+	jsonData, err := json.Marshal(map[string]string{
+		"csr": string(csrPEM),
+	})
+	if err != nil {
+		return fmt.Errorf("序列化失败: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/cert/%d/csr", p.baseURL, certID)
+	resp, err := p.client.Post(url, "application/json", bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		body, _ := readResponseBody(resp)
+		return fmt.Errorf("服务器返回错误 %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// GetChallenges 获取需要放置的 HTTP-01 验证令牌
+func (p *Poller) GetChallenges() ([]Challenge, error) {
+	resp, err := p.client.Get(p.baseURL + "/challenges")
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := readResponseBody(resp)
+		return nil, fmt.Errorf("服务器返回错误 %d: %s", resp.StatusCode, string(body))
+	}
+
+	limitedReader := io.LimitReader(resp.Body, maxResponseSize)
+	var data struct {
+		Challenges []Challenge `json:"challenges"`
+	}
+	if err := json.NewDecoder(limitedReader).Decode(&data); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+
+	return data.Challenges, nil
+}
+
+// ConfirmChallenge 确认验证令牌已放置
+func (p *Poller) ConfirmChallenge(certID int, token string) error {
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"cert_id": certID,
+		"token":   token,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化失败: %w", err)
+	}
+
+	resp, err := p.client.Post(p.baseURL+"/challenges/confirm", "application/json", bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := readResponseBody(resp)
+		return fmt.Errorf("服务器返回错误 %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
 // SendHeartbeat 发送心跳
 func (p *Poller) SendHeartbeat(ip string) error {
 	// 使用 json.Marshal 而不是字符串拼接，避免注入
@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	gocrypto "crypto"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
@@ -127,3 +128,14 @@ func CertFingerprint(certPEM []byte) (string, error) {
 	hash := sha256.Sum256(cert.Raw)
 	return "sha256:" + hex.EncodeToString(hash[:]), nil
 }
+
+// PublicKeyFingerprint 计算公钥指纹（SPKI 的 SHA256），用于比对 CSR/证书与本地私钥
+func PublicKeyFingerprint(pub gocrypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(der)
+	return "sha256:" + hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+// ACMEChallengeHandler 在主路由上提供 HTTP-01 验证文件（proxy 模式）
+type ACMEChallengeHandler struct {
+	challenges *service.ChallengeService
+}
+
+func NewACMEChallengeHandler() *ACMEChallengeHandler {
+	return &ACMEChallengeHandler{
+		challenges: service.NewChallengeService(),
+	}
+}
+
+// Serve 返回令牌对应的 keyAuthorization
+func (h *ACMEChallengeHandler) Serve(c *gin.Context) {
+	keyAuth, ok := h.challenges.GetProxyToken(c.Param("token"))
+	if !ok {
+		c.String(http.StatusNotFound, "not found")
+		return
+	}
+
+	c.Data(http.StatusOK, "text/plain", []byte(keyAuth))
+}
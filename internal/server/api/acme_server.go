@@ -0,0 +1,529 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/middleware"
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/BlakeLiAFK/letsync/internal/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+// ACMEServerHandler 内置 ACME 服务端 (RFC 8555)，供 Caddy、Traefik、cert-manager 等客户端向私有 CA 申请证书
+// 请求使用 JWS 签名认证，错误使用 application/problem+json 格式，与管理 API 不同
+type ACMEServerHandler struct {
+	acmeServer       *service.ACMEServerService
+	workspaceService *service.WorkspaceService
+}
+
+func NewACMEServerHandler() *ACMEServerHandler {
+	return &ACMEServerHandler{
+		acmeServer:       service.NewACMEServerService(),
+		workspaceService: service.NewWorkspaceService(),
+	}
+}
+
+// RequireWorkspace 校验工作区为已开放 ACME 服务端的私有 CA，并为所有响应添加 Replay-Nonce
+func (h *ACMEServerHandler) RequireWorkspace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("workspace"), 10, 64)
+		if err == nil {
+			workspace, err := h.workspaceService.Get(uint(id))
+			if err == nil && workspace.IsPrivateCA() && workspace.ACMEServer {
+				c.Set("workspace_id", uint(id))
+				c.Header("Replay-Nonce", h.acmeServer.NewNonce())
+				c.Header("Link", fmt.Sprintf("<%s/directory>;rel=\"index\"", acmeBaseURL(c)))
+				c.Header("Cache-Control", "no-store")
+				c.Next()
+				return
+			}
+		}
+
+		acmeError(c, &service.ACMEProblem{
+			Type:   "urn:ietf:params:acme:error:malformed",
+			Detail: "ACME 服务端未开放",
+			Status: http.StatusNotFound,
+		})
+		c.Abort()
+	}
+}
+
+// Directory ACME 目录
+func (h *ACMEServerHandler) Directory(c *gin.Context) {
+	base := acmeBaseURL(c)
+	c.JSON(http.StatusOK, gin.H{
+		"newNonce":   base + "/new-nonce",
+		"newAccount": base + "/new-account",
+		"newOrder":   base + "/new-order",
+		"revokeCert": base + "/revoke-cert",
+		"keyChange":  base + "/key-change",
+		"meta": gin.H{
+			"externalAccountRequired": false,
+		},
+	})
+}
+
+// NewNonce 获取 nonce（由 RequireWorkspace 写入响应头）
+func (h *ACMEServerHandler) NewNonce(c *gin.Context) {
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// NewAccount 注册账号，公钥已注册时返回已有账号
+func (h *ACMEServerHandler) NewAccount(c *gin.Context) {
+	req := h.verify(c, service.ACMEKeyJWK)
+	if req == nil {
+		return
+	}
+
+	var payload struct {
+		Contact            []string `json:"contact"`
+		OnlyReturnExisting bool     `json:"onlyReturnExisting"`
+	}
+	if !decodePayload(c, req.Payload, &payload) {
+		return
+	}
+
+	account, created, err := h.acmeServer.NewAccount(c.GetUint("workspace_id"), req.JWK, payload.Contact, payload.OnlyReturnExisting)
+	if err != nil {
+		acmeError(c, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.Header("Location", accountURL(c, account.ID))
+	c.JSON(status, accountJSON(c, account))
+}
+
+// Account 查询、更新或停用账号
+func (h *ACMEServerHandler) Account(c *gin.Context) {
+	req := h.verify(c, service.ACMEKeyKID)
+	if req == nil {
+		return
+	}
+	if c.Param("id") != strconv.FormatUint(uint64(req.Account.ID), 10) {
+		acmeError(c, &service.ACMEProblem{
+			Type:   "urn:ietf:params:acme:error:unauthorized",
+			Detail: "无权访问该账号",
+			Status: http.StatusForbidden,
+		})
+		return
+	}
+
+	if len(req.Payload) > 0 {
+		var payload struct {
+			Contact []string `json:"contact"`
+			Status  string   `json:"status"`
+		}
+		if !decodePayload(c, req.Payload, &payload) {
+			return
+		}
+		if err := h.acmeServer.UpdateAccount(req.Account, payload.Contact, payload.Status); err != nil {
+			acmeError(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, accountJSON(c, req.Account))
+}
+
+// Orders 账号的订单列表
+func (h *ACMEServerHandler) Orders(c *gin.Context) {
+	req := h.verify(c, service.ACMEKeyKID)
+	if req == nil {
+		return
+	}
+
+	ids, err := h.acmeServer.ListOrders(req.Account)
+	if err != nil {
+		acmeError(c, err)
+		return
+	}
+	orders := make([]string, 0, len(ids))
+	for _, id := range ids {
+		orders = append(orders, fmt.Sprintf("%s/order/%d", acmeBaseURL(c), id))
+	}
+	c.JSON(http.StatusOK, gin.H{"orders": orders})
+}
+
+// NewOrder 创建订单（忽略 notBefore/notAfter，有效期由工作区配置决定）
+func (h *ACMEServerHandler) NewOrder(c *gin.Context) {
+	req := h.verify(c, service.ACMEKeyKID)
+	if req == nil {
+		return
+	}
+
+	var payload struct {
+		Identifiers []model.ACMEIdentifier `json:"identifiers"`
+	}
+	if !decodePayload(c, req.Payload, &payload) {
+		return
+	}
+
+	order, err := h.acmeServer.NewOrder(req.Account, payload.Identifiers)
+	if err != nil {
+		acmeError(c, err)
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("%s/order/%d", acmeBaseURL(c), order.ID))
+	c.JSON(http.StatusCreated, orderJSON(c, order))
+}
+
+// Order 查询订单
+func (h *ACMEServerHandler) Order(c *gin.Context) {
+	req := h.verify(c, service.ACMEKeyKID)
+	if req == nil {
+		return
+	}
+	id, ok := acmeID(c)
+	if !ok {
+		return
+	}
+
+	order, err := h.acmeServer.GetOrder(req.Account, id)
+	if err != nil {
+		acmeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, orderJSON(c, order))
+}
+
+// Finalize 提交 CSR，私有 CA 直接签发，响应中的订单已为 valid
+func (h *ACMEServerHandler) Finalize(c *gin.Context) {
+	req := h.verify(c, service.ACMEKeyKID)
+	if req == nil {
+		return
+	}
+	id, ok := acmeID(c)
+	if !ok {
+		return
+	}
+
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if !decodePayload(c, req.Payload, &payload) {
+		return
+	}
+	csr, err := base64.RawURLEncoding.DecodeString(payload.CSR)
+	if err != nil {
+		acmeError(c, &service.ACMEProblem{
+			Type:   "urn:ietf:params:acme:error:badCSR",
+			Detail: "CSR 必须为 base64url 编码的 DER",
+			Status: http.StatusBadRequest,
+		})
+		return
+	}
+
+	order, err := h.acmeServer.Finalize(req.Account, id, csr)
+	if err != nil {
+		acmeError(c, err)
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("%s/order/%d", acmeBaseURL(c), order.ID))
+	c.JSON(http.StatusOK, orderJSON(c, order))
+}
+
+// Authorization 查询授权
+func (h *ACMEServerHandler) Authorization(c *gin.Context) {
+	req := h.verify(c, service.ACMEKeyKID)
+	if req == nil {
+		return
+	}
+	id, ok := acmeID(c)
+	if !ok {
+		return
+	}
+
+	authz, err := h.acmeServer.GetAuthorization(req.Account, id)
+	if err != nil {
+		acmeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, authorizationJSON(c, authz))
+}
+
+// Challenge 查询验证；payload 为 {} 时表示客户端已准备好，开始验证
+func (h *ACMEServerHandler) Challenge(c *gin.Context) {
+	req := h.verify(c, service.ACMEKeyKID)
+	if req == nil {
+		return
+	}
+	id, ok := acmeID(c)
+	if !ok {
+		return
+	}
+
+	var challenge *model.ACMEChallenge
+	var authz *model.ACMEAuthorization
+	var err error
+	if len(req.Payload) > 0 {
+		challenge, authz, err = h.acmeServer.StartChallenge(req.Account, id)
+	} else {
+		challenge, authz, err = h.acmeServer.GetChallenge(req.Account, id)
+	}
+	if err != nil {
+		acmeError(c, err)
+		return
+	}
+
+	c.Writer.Header().Add("Link", fmt.Sprintf("<%s/authz/%d>;rel=\"up\"", acmeBaseURL(c), authz.ID))
+	if challenge.Status == "pending" || challenge.Status == "processing" {
+		c.Header("Retry-After", "1") // 验证通常在数秒内完成，提示客户端尽快轮询
+	}
+	c.JSON(http.StatusOK, challengeJSON(c, challenge))
+}
+
+// RevokeCert 吊销证书，可使用账号或证书私钥签名
+func (h *ACMEServerHandler) RevokeCert(c *gin.Context) {
+	req := h.verify(c, service.ACMEKeyAny)
+	if req == nil {
+		return
+	}
+
+	var payload struct {
+		Certificate string `json:"certificate"`
+		Reason      int    `json:"reason"`
+	}
+	if !decodePayload(c, req.Payload, &payload) {
+		return
+	}
+	der, err := base64.RawURLEncoding.DecodeString(payload.Certificate)
+	if err != nil || len(der) == 0 {
+		acmeError(c, &service.ACMEProblem{
+			Type:   "urn:ietf:params:acme:error:malformed",
+			Detail: "certificate 必须为 base64url 编码的 DER",
+			Status: http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := h.acmeServer.Revoke(c.GetUint("workspace_id"), req, der, payload.Reason); err != nil {
+		acmeError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// KeyChange 更换账号公钥，payload 为新公钥签名的内层 JWS
+func (h *ACMEServerHandler) KeyChange(c *gin.Context) {
+	req := h.verify(c, service.ACMEKeyKID)
+	if req == nil {
+		return
+	}
+
+	conflictID, err := h.acmeServer.ChangeKey(req.Account, req.Payload, acmeOrigin(c)+c.Request.URL.Path, accountURL(c, req.Account.ID))
+	if err != nil {
+		if conflictID != 0 {
+			c.Header("Location", accountURL(c, conflictID))
+		}
+		acmeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, accountJSON(c, req.Account))
+}
+
+// CRL 下载证书吊销列表 (DER)，无需认证
+func (h *ACMEServerHandler) CRL(c *gin.Context) {
+	data, err := h.acmeServer.CRL(c.GetUint("workspace_id"))
+	if err != nil {
+		acmeError(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/pkix-crl", data)
+}
+
+// Certificate 下载证书链
+func (h *ACMEServerHandler) Certificate(c *gin.Context) {
+	req := h.verify(c, service.ACMEKeyKID)
+	if req == nil {
+		return
+	}
+	id, ok := acmeID(c)
+	if !ok {
+		return
+	}
+
+	data, err := h.acmeServer.GetCertificate(req.Account, id)
+	if err != nil {
+		acmeError(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/pem-certificate-chain", data)
+}
+
+// verify 验证 JWS 请求，失败时已写入错误响应并返回 nil
+func (h *ACMEServerHandler) verify(c *gin.Context, mode service.ACMEKeyMode) *service.ACMERequest {
+	if c.ContentType() != "application/jose+json" {
+		acmeError(c, &service.ACMEProblem{
+			Type:   "urn:ietf:params:acme:error:malformed",
+			Detail: "Content-Type 必须为 application/jose+json",
+			Status: http.StatusUnsupportedMediaType,
+		})
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64<<10))
+	if err != nil {
+		acmeError(c, err)
+		return nil
+	}
+
+	req, err := h.acmeServer.VerifyRequest(c.GetUint("workspace_id"), body, acmeOrigin(c)+c.Request.URL.Path, acmeBaseURL(c)+"/account/", mode)
+	if err != nil {
+		acmeError(c, err)
+		return nil
+	}
+	return req
+}
+
+// acmeOrigin 客户端访问的地址
+// 开启 security.behind_proxy 且请求来自可信代理时，按反向代理设置的 X-Forwarded-Proto/X-Forwarded-Host 生成，
+// 否则忽略这两个请求头，避免客户端伪造目录和签名校验使用的地址
+func acmeOrigin(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	host := c.Request.Host
+	if !middleware.FromTrustedProxy(c) {
+		return scheme + "://" + host
+	}
+
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	if forwarded := c.GetHeader("X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	return scheme + "://" + host
+}
+
+// acmeBaseURL 工作区 ACME 服务端的根地址
+func acmeBaseURL(c *gin.Context) string {
+	return acmeOrigin(c) + "/acme/" + c.Param("workspace")
+}
+
+func accountURL(c *gin.Context, id uint) string {
+	return fmt.Sprintf("%s/account/%d", acmeBaseURL(c), id)
+}
+
+// acmeID 解析路径中的资源 ID
+func acmeID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		acmeError(c, &service.ACMEProblem{
+			Type:   "urn:ietf:params:acme:error:malformed",
+			Detail: "无效的 ID",
+			Status: http.StatusNotFound,
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// decodePayload 解析 JWS payload，失败时写入错误响应
+func decodePayload(c *gin.Context, payload []byte, v interface{}) bool {
+	if len(payload) == 0 {
+		return true
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		acmeError(c, &service.ACMEProblem{
+			Type:   "urn:ietf:params:acme:error:malformed",
+			Detail: fmt.Sprintf("解析请求内容失败: %v", err),
+			Status: http.StatusBadRequest,
+		})
+		return false
+	}
+	return true
+}
+
+// acmeError 写入 ACME 错误响应
+func acmeError(c *gin.Context, err error) {
+	problem := service.ToACMEProblem(err)
+	data, _ := json.Marshal(problem)
+	c.Data(problem.Status, "application/problem+json", data)
+}
+
+func accountJSON(c *gin.Context, account *model.ACMEAccount) gin.H {
+	contact := account.GetContact()
+	if contact == nil {
+		contact = []string{}
+	}
+	return gin.H{
+		"status":  account.Status,
+		"contact": contact,
+		"orders":  accountURL(c, account.ID) + "/orders",
+	}
+}
+
+func orderJSON(c *gin.Context, order *model.ACMEOrder) gin.H {
+	base := acmeBaseURL(c)
+	authzs := make([]string, 0, len(order.Authorizations))
+	for _, authz := range order.Authorizations {
+		authzs = append(authzs, fmt.Sprintf("%s/authz/%d", base, authz.ID))
+	}
+
+	result := gin.H{
+		"status":         order.Status,
+		"expires":        order.Expires.UTC().Format(time.RFC3339),
+		"identifiers":    order.GetIdentifiers(),
+		"authorizations": authzs,
+		"finalize":       fmt.Sprintf("%s/order/%d/finalize", base, order.ID),
+	}
+	if order.Status == "valid" {
+		result["certificate"] = fmt.Sprintf("%s/cert/%d", base, order.ID)
+	}
+	if order.Error != "" {
+		result["error"] = json.RawMessage(order.Error)
+	}
+	return result
+}
+
+func authorizationJSON(c *gin.Context, authz *model.ACMEAuthorization) gin.H {
+	challenges := make([]gin.H, 0, len(authz.Challenges))
+	for i := range authz.Challenges {
+		challenges = append(challenges, challengeJSON(c, &authz.Challenges[i]))
+	}
+
+	result := gin.H{
+		"status":     authz.Status,
+		"expires":    authz.Expires.UTC().Format(time.RFC3339),
+		"identifier": model.ACMEIdentifier{Type: authz.Type, Value: authz.Value},
+		"challenges": challenges,
+	}
+	if authz.Wildcard {
+		result["wildcard"] = true
+	}
+	return result
+}
+
+func challengeJSON(c *gin.Context, challenge *model.ACMEChallenge) gin.H {
+	result := gin.H{
+		"type":   challenge.Type,
+		"url":    fmt.Sprintf("%s/chall/%d", acmeBaseURL(c), challenge.ID),
+		"status": challenge.Status,
+		"token":  challenge.Token,
+	}
+	if challenge.Validated != nil {
+		result["validated"] = challenge.Validated.UTC().Format(time.RFC3339)
+	}
+	if challenge.Error != "" {
+		result["error"] = json.RawMessage(challenge.Error)
+	}
+	return result
+}
@@ -87,8 +87,12 @@ func (h *AgentHandler) Get(c *gin.Context) {
 			"deploy_path": binding.DeployPath,
 			"file_mapping": binding.GetFileMapping(),
 			"reload_cmd":  binding.ReloadCmd,
+			"agent_key":   binding.AgentKey,
 			"sync_status": binding.SyncStatus,
 			"last_sync":   binding.LastSync,
+
+			"challenge_webroot": binding.ChallengeWebroot,
+			"challenge_port":    binding.ChallengePort,
 		}
 
 		if binding.Certificate != nil {
@@ -270,6 +274,11 @@ func (h *AgentHandler) AddCert(c *gin.Context) {
 		DeployPath  string            `json:"deploy_path" binding:"required"`
 		FileMapping model.FileMapping `json:"file_mapping"`
 		ReloadCmd   string            `json:"reload_cmd"`
+		AgentKey    bool              `json:"agent_key"` // 私钥由 Agent 本地生成
+
+		// HTTP-01 委托验证：webroot 优先，否则 Agent 监听端口
+		ChallengeWebroot string `json:"challenge_webroot"`
+		ChallengePort    int    `json:"challenge_port"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -293,21 +302,39 @@ func (h *AgentHandler) AddCert(c *gin.Context) {
 		req.FileMapping.Fullchain = "fullchain.pem"
 	}
 
-	binding, err := h.agentService.AddCertBinding(uint(id), req.CertID, req.DeployPath, req.FileMapping, req.ReloadCmd)
+	binding, err := h.agentService.AddCertBinding(uint(id), req.CertID, req.DeployPath, req.FileMapping, req.ReloadCmd, req.AgentKey)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(http.StatusBadRequest, gin.H{
 			"error": gin.H{
-				"code":    "INTERNAL_ERROR",
-				"message": "添加绑定失败",
+				"code":    "INVALID_REQUEST",
+				"message": "添加绑定失败: " + err.Error(),
 			},
 		})
 		return
 	}
 
+	if req.ChallengeWebroot != "" || req.ChallengePort != 0 {
+		if err := h.agentService.SetBindingChallenge(binding.ID, req.ChallengeWebroot, req.ChallengePort); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "INVALID_REQUEST",
+					"message": "设置验证方式失败: " + err.Error(),
+				},
+			})
+			return
+		}
+		binding.ChallengeWebroot = req.ChallengeWebroot
+		binding.ChallengePort = req.ChallengePort
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"id":          binding.ID,
 		"cert_id":     binding.CertID,
 		"deploy_path": binding.DeployPath,
+		"agent_key":   binding.AgentKey,
+
+		"challenge_webroot": binding.ChallengeWebroot,
+		"challenge_port":    binding.ChallengePort,
 	})
 }
 
@@ -328,6 +355,10 @@ func (h *AgentHandler) UpdateCert(c *gin.Context) {
 		DeployPath  string            `json:"deploy_path"`
 		FileMapping model.FileMapping `json:"file_mapping"`
 		ReloadCmd   string            `json:"reload_cmd"`
+		AgentKey    bool              `json:"agent_key"`
+
+		ChallengeWebroot string `json:"challenge_webroot"`
+		ChallengePort    int    `json:"challenge_port"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -340,11 +371,21 @@ func (h *AgentHandler) UpdateCert(c *gin.Context) {
 		return
 	}
 
-	if err := h.agentService.UpdateCertBinding(uint(bindingID), req.DeployPath, req.FileMapping, req.ReloadCmd); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	if err := h.agentService.UpdateCertBinding(uint(bindingID), req.DeployPath, req.FileMapping, req.ReloadCmd, req.AgentKey); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"error": gin.H{
-				"code":    "INTERNAL_ERROR",
-				"message": "更新失败",
+				"code":    "INVALID_REQUEST",
+				"message": "更新失败: " + err.Error(),
+			},
+		})
+		return
+	}
+
+	if err := h.agentService.SetBindingChallenge(uint(bindingID), req.ChallengeWebroot, req.ChallengePort); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "更新失败: " + err.Error(),
 			},
 		})
 		return
@@ -1,8 +1,11 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/BlakeLiAFK/letsync/internal/server/model"
@@ -13,13 +16,19 @@ import (
 type AgentEndpoint struct {
 	agentService *service.AgentService
 	certService  *service.CertService
+	acmeService  *service.ACMEService
+	challenges   *service.ChallengeService
+	taskLog      *service.TaskLogService
 	logger       *service.LogService
 }
 
-func NewAgentEndpoint() *AgentEndpoint {
+func NewAgentEndpoint(dataDir string) *AgentEndpoint {
 	return &AgentEndpoint{
 		agentService: service.NewAgentService(),
 		certService:  service.NewCertService(),
+		acmeService:  service.NewACMEService(dataDir),
+		challenges:   service.NewChallengeService(),
+		taskLog:      service.NewTaskLogService(),
 		logger:       service.NewLogService(),
 	}
 }
@@ -74,14 +83,33 @@ func (e *AgentEndpoint) GetConfig(c *gin.Context) {
 		}
 
 		cert := binding.Certificate
-		certs = append(certs, gin.H{
+		item := gin.H{
 			"id":           cert.ID,
 			"domain":       cert.Domain,
 			"fingerprint":  cert.Fingerprint,
 			"deploy_path":  binding.DeployPath,
 			"file_mapping": binding.GetFileMapping(),
 			"reload_cmd":   binding.ReloadCmd,
-		})
+			"external_key": cert.UsesCSR() || binding.AgentKey, // 私钥不由服务器下发，仅部署证书文件
+			"agent_key":    binding.AgentKey,
+			"http01_agent": cert.UsesChallenge("http-01") && cert.HTTP01Mode == "agent", // 需要轮询 HTTP-01 验证令牌
+		}
+
+		// Agent 本地生成私钥时，下发生成 CSR 所需的信息
+		if binding.AgentKey {
+			keyType := "EC256"
+			if cert.Workspace != nil && cert.Workspace.KeyType != "" {
+				keyType = cert.Workspace.KeyType
+			}
+			item["domains"] = append([]string{cert.Domain}, cert.GetSANList()...)
+			item["key_type"] = keyType
+			item["csr_key_fingerprint"] = service.CSRKeyFingerprint(cert.CSRPEM)
+			item["cert_key_fingerprint"] = service.CertKeyFingerprint(cert.CertPEM)
+			item["issuing"] = e.acmeService.IsIssuing(cert.ID)
+			item["last_error"] = cert.LastError
+		}
+
+		certs = append(certs, item)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -184,6 +212,200 @@ func (e *AgentEndpoint) GetCert(c *gin.Context) {
 	})
 }
 
+// SubmitCSR 提交 Agent 本地生成的 CSR，服务器据此异步申请证书
+func (e *AgentEndpoint) SubmitCSR(c *gin.Context) {
+	agent, _ := e.getAgentFromContext(c)
+	if agent == nil {
+		return
+	}
+
+	certID, err := strconv.ParseUint(c.Param("cert_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "无效的证书 ID",
+			},
+		})
+		return
+	}
+
+	var req struct {
+		CSR string `json:"csr" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "参数错误",
+			},
+		})
+		return
+	}
+
+	// 只有私钥由该 Agent 持有的绑定才允许提交 CSR
+	binding, err := e.agentService.GetBinding(agent.ID, uint(certID))
+	if err != nil || !binding.AgentKey {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"code":    "FORBIDDEN",
+				"message": "该绑定未启用 Agent 本地私钥",
+			},
+		})
+		return
+	}
+
+	cert, err := e.certService.Get(uint(certID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": "证书不存在",
+			},
+		})
+		return
+	}
+
+	csrPEM := []byte(strings.TrimSpace(req.CSR))
+	csr, err := service.ParseCSR(csrPEM)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+
+	// CSR 中的域名必须与证书配置完全一致
+	if !sameDomains(service.CSRDomains(csr), append([]string{cert.Domain}, cert.GetSANList()...)) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "CSR 域名与证书配置不一致",
+			},
+		})
+		return
+	}
+
+	// 签发进行中时不保存新 CSR：相同 CSR 视为重复提交，返回进行中的任务；不同的 CSR 需等待签发结束后重新提交
+	release, ok := e.acmeService.ReserveIssue(cert.ID)
+	if !ok {
+		if !sameCSR(csrPEM, cert.CSRPEM) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": gin.H{
+					"code":    "CONFLICT",
+					"message": "证书正在签发，请稍后重新提交",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "相同 CSR 的申请任务正在进行",
+			"task_id": e.runningTaskID(cert.ID),
+		})
+		return
+	}
+
+	if err := e.certService.SetCSR(cert.ID, csrPEM); err != nil {
+		release()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "保存 CSR 失败",
+			},
+		})
+		return
+	}
+
+	taskID, err := e.taskLog.CreateTask(cert.ID, "issue")
+	if err != nil {
+		release()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "创建任务失败",
+			},
+		})
+		return
+	}
+
+	e.logger.Info("agent", fmt.Sprintf("Agent %s 提交 CSR: %s", agent.Name, cert.Domain), map[string]interface{}{
+		"agent_id": agent.ID,
+		"cert_id":  cert.ID,
+		"task_id":  taskID,
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "申请任务已启动",
+		"task_id": taskID,
+	})
+
+	go func() {
+		defer release()
+		if err := e.acmeService.IssueCertificateWithTaskID(cert.ID, taskID); err != nil {
+			e.logger.Error("agent", fmt.Sprintf("按 Agent CSR 申请证书失败: ID=%d", cert.ID), map[string]interface{}{
+				"error":   err.Error(),
+				"task_id": taskID,
+			})
+		}
+	}()
+}
+
+// sameCSR 两个 CSR 是否使用相同的公钥和域名
+func sameCSR(a, b []byte) bool {
+	fingerprint := service.CSRKeyFingerprint(a)
+	if fingerprint == "" || fingerprint != service.CSRKeyFingerprint(b) {
+		return false
+	}
+	csrA, errA := service.ParseCSR(a)
+	csrB, errB := service.ParseCSR(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return sameDomains(service.CSRDomains(csrA), service.CSRDomains(csrB))
+}
+
+// runningTaskID 证书进行中的申请或续期任务 ID，没有时返回空
+func (e *AgentEndpoint) runningTaskID(certID uint) string {
+	for _, taskType := range []string{"issue", "renew"} {
+		if task, err := e.taskLog.GetLatestTask(certID, taskType); err == nil && task != nil && task.Status == "running" {
+			return task.TaskID
+		}
+	}
+	return ""
+}
+
+// sameDomains 比较两组域名是否一致（忽略顺序和大小写）
+func sameDomains(a, b []string) bool {
+	normalize := func(list []string) []string {
+		seen := make(map[string]bool)
+		var out []string
+		for _, d := range list {
+			d = strings.ToLower(d)
+			if !seen[d] {
+				seen[d] = true
+				out = append(out, d)
+			}
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	na, nb := normalize(a), normalize(b)
+	if len(na) != len(nb) {
+		return false
+	}
+	for i := range na {
+		if na[i] != nb[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // Heartbeat 心跳上报
 func (e *AgentEndpoint) Heartbeat(c *gin.Context) {
 	agent, _ := e.getAgentFromContext(c)
@@ -260,6 +482,64 @@ func (e *AgentEndpoint) Status(c *gin.Context) {
 	})
 }
 
+// GetChallenges 获取需要本 Agent 放置的 HTTP-01 验证令牌
+func (e *AgentEndpoint) GetChallenges(c *gin.Context) {
+	agent, _ := e.getAgentFromContext(c)
+	if agent == nil {
+		return
+	}
+
+	challenges := e.challenges.ListForAgent(agent.ID)
+	if challenges == nil {
+		challenges = []service.AgentChallengeTask{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"challenges": challenges,
+	})
+}
+
+// ConfirmChallenge Agent 确认验证令牌已放置
+func (e *AgentEndpoint) ConfirmChallenge(c *gin.Context) {
+	agent, _ := e.getAgentFromContext(c)
+	if agent == nil {
+		return
+	}
+
+	var req struct {
+		CertID uint   `json:"cert_id" binding:"required"`
+		Token  string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "参数错误",
+			},
+		})
+		return
+	}
+
+	if err := e.challenges.Confirm(agent.ID, req.CertID, req.Token); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+
+	e.logger.Info("agent", fmt.Sprintf("Agent %s 已放置 HTTP-01 验证文件", agent.Name), map[string]interface{}{
+		"cert_id": req.CertID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "ok",
+	})
+}
+
 // getAgentFromContext 从上下文获取 Agent
 func (e *AgentEndpoint) getAgentFromContext(c *gin.Context) (*model.Agent, bool) {
 	agentInterface, exists := c.Get("agent")
@@ -2,7 +2,9 @@ package api
 
 import (
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -16,16 +18,18 @@ import (
 )
 
 type CertHandler struct {
-	certService *service.CertService
-	acmeService *service.ACMEService
-	logger      *service.LogService
+	certService      *service.CertService
+	acmeService      *service.ACMEService
+	workspaceService *service.WorkspaceService
+	logger           *service.LogService
 }
 
 func NewCertHandler(dataDir string) *CertHandler {
 	return &CertHandler{
-		certService: service.NewCertService(),
-		acmeService: service.NewACMEService(dataDir),
-		logger:      service.NewLogService(),
+		certService:      service.NewCertService(),
+		acmeService:      service.NewACMEService(dataDir),
+		workspaceService: service.NewWorkspaceService(),
+		logger:           service.NewLogService(),
 	}
 }
 
@@ -51,15 +55,20 @@ func (h *CertHandler) List(c *gin.Context) {
 		}
 
 		item := gin.H{
-			"id":             cert.ID,
-			"domain":         cert.Domain,
-			"san":            cert.GetSANList(),
-			"fingerprint":    cert.Fingerprint,
-			"issued_at":      cert.IssuedAt,
-			"expires_at":     cert.ExpiresAt,
-			"challenge_type": challengeType,
-			"workspace_id":   cert.WorkspaceID,
-			"status":         cert.Status,
+			"id":                cert.ID,
+			"domain":            cert.Domain,
+			"san":               cert.GetSANList(),
+			"fingerprint":       cert.Fingerprint,
+			"issued_at":         cert.IssuedAt,
+			"expires_at":        cert.ExpiresAt,
+			"challenge_type":    challengeType,
+			"http01_mode":       cert.HTTP01Mode,
+			"challenge_alias":   cert.ChallengeAlias,
+			"domain_challenges": cert.GetDomainChallenges(),
+			"workspace_id":      cert.WorkspaceID,
+			"uses_csr":          cert.UsesCSR(),
+			"source":            cert.Source,
+			"status":            cert.Status,
 		}
 
 		if cert.DNSProvider != nil {
@@ -73,6 +82,7 @@ func (h *CertHandler) List(c *gin.Context) {
 			item["workspace"] = gin.H{
 				"id":   cert.Workspace.ID,
 				"name": cert.Workspace.Name,
+				"type": cert.Workspace.Type,
 			}
 		}
 
@@ -116,39 +126,61 @@ func (h *CertHandler) Get(c *gin.Context) {
 
 	// 解析证书获取详细信息
 	certInfo := h.parseCertificateInfo(cert.CertPEM)
+	if certInfo != nil {
+		certInfo["chain"] = h.parseChainInfo(cert.CaPEM)
+	}
 
 	// 构建工作区信息
 	var workspaceInfo gin.H
 	if cert.Workspace != nil {
 		workspaceInfo = gin.H{
-			"id":       cert.Workspace.ID,
-			"name":     cert.Workspace.Name,
-			"ca_url":   cert.Workspace.CaURL,
-			"email":    cert.Workspace.Email,
-			"key_type": cert.Workspace.KeyType,
+			"id":              cert.Workspace.ID,
+			"name":            cert.Workspace.Name,
+			"type":            cert.Workspace.Type,
+			"ca_url":          cert.Workspace.CaURL,
+			"email":           cert.Workspace.Email,
+			"key_type":        cert.Workspace.KeyType,
+			"profile":         cert.Workspace.Profile,
+			"preferred_chain": cert.Workspace.PreferredChain,
 		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":              cert.ID,
-		"domain":          cert.Domain,
-		"san":             cert.GetSANList(),
-		"cert_pem":        string(cert.CertPEM),
-		"key_pem":         string(cert.KeyPEM),
-		"ca_pem":          string(cert.CaPEM),
-		"fullchain_pem":   string(cert.FullchainPEM),
-		"fingerprint":     cert.Fingerprint,
-		"issued_at":       cert.IssuedAt,
-		"expires_at":      cert.ExpiresAt,
-		"challenge_type":  challengeType,
-		"dns_provider_id": cert.DNSProviderID,
-		"workspace_id":    cert.WorkspaceID,
-		"workspace":       workspaceInfo,
-		"status":          cert.Status,
-		"agents":          agents,
-		"created_at":      cert.CreatedAt,
-		"updated_at":      cert.UpdatedAt,
-		"cert_info":       certInfo,
+		"id":                cert.ID,
+		"domain":            cert.Domain,
+		"san":               cert.GetSANList(),
+		"cert_pem":          string(cert.CertPEM),
+		"key_pem":           string(cert.KeyPEM),
+		"ca_pem":            string(cert.CaPEM),
+		"fullchain_pem":     string(cert.FullchainPEM),
+		"csr_pem":           string(cert.CSRPEM),
+		"uses_csr":          cert.UsesCSR(),
+		"source":            cert.Source,
+		"profile":           cert.Profile,
+		"preferred_chain":   cert.PreferredChain,
+		"fingerprint":       cert.Fingerprint,
+		"issued_at":         cert.IssuedAt,
+		"expires_at":        cert.ExpiresAt,
+		"challenge_type":    challengeType,
+		"http01_mode":       cert.HTTP01Mode,
+		"http01_webroot":    cert.HTTP01Webroot,
+		"dns_provider_id":   cert.DNSProviderID,
+		"challenge_alias":   cert.ChallengeAlias,
+		"domain_challenges": cert.GetDomainChallenges(),
+		"workspace_id":      cert.WorkspaceID,
+		"workspace":         workspaceInfo,
+		"status":            cert.Status,
+		"agents":            agents,
+		"created_at":        cert.CreatedAt,
+		"updated_at":        cert.UpdatedAt,
+		"cert_info":         certInfo,
+		"renewal_info": gin.H{
+			"window_start":    cert.ARIWindowStart,
+			"window_end":      cert.ARIWindowEnd,
+			"renew_at":        cert.ARIRenewAt,
+			"next_check_at":   cert.ARINextCheckAt,
+			"explanation_url": cert.ARIExplanationURL,
+		},
 	})
 }
 
@@ -203,8 +235,12 @@ func (h *CertHandler) parseCertificateInfo(certPEM []byte) gin.H {
 	}
 	serialFormatted := strings.ToUpper(strings.Join(serialParts, ":"))
 
-	// 获取 DNS 名称
+	// 获取 DNS 名称和 IP 地址
 	dnsNames := certInfo.DNSNames
+	ipAddresses := make([]string, 0, len(certInfo.IPAddresses))
+	for _, ip := range certInfo.IPAddresses {
+		ipAddresses = append(ipAddresses, ip.String())
+	}
 
 	// 计算剩余天数
 	daysRemaining := int(certInfo.NotAfter.Sub(certInfo.NotBefore).Hours() / 24)
@@ -214,24 +250,62 @@ func (h *CertHandler) parseCertificateInfo(certPEM []byte) gin.H {
 	}
 
 	return gin.H{
-		"issuer":           issuer,
-		"issuer_org":       strings.Join(certInfo.Issuer.Organization, ", "),
-		"issuer_cn":        certInfo.Issuer.CommonName,
-		"subject":          certInfo.Subject.CommonName,
-		"serial_number":    serialFormatted,
-		"signature_algo":   sigAlgo,
-		"key_type":         keyType,
-		"key_size":         keySize,
-		"not_before":       certInfo.NotBefore,
-		"not_after":        certInfo.NotAfter,
-		"dns_names":        dnsNames,
-		"validity_days":    daysRemaining,
-		"days_left":        daysLeft,
-		"version":          certInfo.Version,
-		"is_ca":            certInfo.IsCA,
+		"issuer":         issuer,
+		"issuer_org":     strings.Join(certInfo.Issuer.Organization, ", "),
+		"issuer_cn":      certInfo.Issuer.CommonName,
+		"subject":        certInfo.Subject.CommonName,
+		"serial_number":  serialFormatted,
+		"signature_algo": sigAlgo,
+		"key_type":       keyType,
+		"key_size":       keySize,
+		"not_before":     certInfo.NotBefore,
+		"not_after":      certInfo.NotAfter,
+		"dns_names":      dnsNames,
+		"ip_addresses":   ipAddresses,
+		"validity_days":  daysRemaining,
+		"days_left":      daysLeft,
+		"version":        certInfo.Version,
+		"is_ca":          certInfo.IsCA,
 	}
 }
 
+// parseChainInfo 解析 CA 证书链，按顺序返回各级证书的主题和颁发者
+func (h *CertHandler) parseChainInfo(caPEM []byte) []gin.H {
+	chain := []gin.H{}
+	if len(caPEM) == 0 {
+		return chain
+	}
+
+	certs, err := certcrypto.ParsePEMBundle(caPEM)
+	if err != nil {
+		return chain
+	}
+
+	for _, cert := range certs {
+		chain = append(chain, gin.H{
+			"subject":   cert.Subject.CommonName,
+			"issuer":    cert.Issuer.CommonName,
+			"not_after": cert.NotAfter,
+		})
+	}
+
+	return chain
+}
+
+// invalidDomainRequest 返回参数错误，域名相关错误附带出错字段
+func invalidDomainRequest(c *gin.Context, err error) {
+	body := gin.H{
+		"code":    "INVALID_REQUEST",
+		"message": err.Error(),
+	}
+	var domainErr *service.DomainError
+	if errors.As(err, &domainErr) {
+		body["message"] = domainErr.Message
+		body["field"] = domainErr.Field
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": body})
+}
+
 // now 返回当前时间（方便测试）
 func now() time.Time {
 	return time.Now()
@@ -240,11 +314,19 @@ func now() time.Time {
 // Create 添加证书记录（不立即申请）
 func (h *CertHandler) Create(c *gin.Context) {
 	var req struct {
-		Domain        string   `json:"domain" binding:"required"`
-		SAN           []string `json:"san"`
-		ChallengeType string   `json:"challenge_type"`  // dns-01 或 http-01，默认 dns-01
-		DNSProviderID uint     `json:"dns_provider_id"` // DNS-01 时必填
-		WorkspaceID   *uint    `json:"workspace_id"`    // 工作区 ID，为空则使用全局配置
+		Domain           string                  `json:"domain"`
+		SAN              []string                `json:"san"`
+		ChallengeType    string                  `json:"challenge_type"`    // dns-01、http-01 或 tls-alpn-01，默认 dns-01
+		HTTP01Mode       string                  `json:"http01_mode"`       // HTTP-01 放置方式: 空为服务器监听端口, agent, webroot, proxy
+		HTTP01Webroot    string                  `json:"http01_webroot"`    // webroot 模式写入的目录
+		DNSProviderID    uint                    `json:"dns_provider_id"`   // DNS-01 时必填
+		ChallengeAlias   string                  `json:"challenge_alias"`   // DNS-01 验证别名，为空则直接写入证书域名
+		DomainChallenges []model.DomainChallenge `json:"domain_challenges"` // 按域名覆盖的验证配置
+		IncludeApex      bool                    `json:"include_apex"`      // 申请通配符时自动加入对应的主域名
+		WorkspaceID      *uint                   `json:"workspace_id"`      // 工作区 ID，为空则使用全局配置
+		CSR              string                  `json:"csr"`               // 自带 CSR（PEM），提供时域名以 CSR 为准
+		Profile          string                  `json:"profile"`           // ACME 证书 Profile，为空则使用工作区配置
+		PreferredChain   string                  `json:"preferred_chain"`   // 首选证书链（根证书 CN），为空则使用工作区配置
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -257,25 +339,82 @@ func (h *CertHandler) Create(c *gin.Context) {
 		return
 	}
 
+	// 自带 CSR 时从 CSR 中提取域名
+	var csrPEM []byte
+	if strings.TrimSpace(req.CSR) != "" {
+		csrPEM = []byte(strings.TrimSpace(req.CSR))
+		domain, san, err := h.domainsFromCSR(csrPEM)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "INVALID_REQUEST",
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+		req.Domain = domain
+		req.SAN = san
+	}
+
+	// 规范化域名（IDN 转 punycode、小写、去重）并检查数量上限；自带 CSR 时域名以 CSR 为准，不自动加入主域名
+	domain, san, err := service.NormalizeDomains(req.Domain, req.SAN, service.DomainOptions{
+		IncludeApex: req.IncludeApex && csrPEM == nil,
+		MaxNames:    h.workspaceService.MaxNames(req.WorkspaceID),
+	})
+	if err != nil {
+		invalidDomainRequest(c, err)
+		return
+	}
+	req.Domain, req.SAN = domain, san
+
 	// 验证方式默认为 dns-01
 	challengeType := req.ChallengeType
 	if challengeType == "" {
 		challengeType = "dns-01"
 	}
 
-	// 验证参数
-	if challengeType == "dns-01" && req.DNSProviderID == 0 {
+	// 验证参数（私有 CA 直接签发，不需要域名验证）
+	var domainChallenges []model.DomainChallenge
+	if h.workspaceService.IsPrivateCA(req.WorkspaceID) {
+		req.DNSProviderID, req.ChallengeAlias = 0, ""
+	} else {
+		domainChallenges, err = service.NormalizeDomainChallenges(req.DomainChallenges, append([]string{req.Domain}, req.SAN...), challengeType, req.DNSProviderID)
+		if err == nil {
+			err = service.ValidateChallenge(challengeType, req.DNSProviderID, req.HTTP01Mode, req.HTTP01Webroot, domainChallenges)
+		}
+	}
+	if err != nil {
+		invalidDomainRequest(c, err)
+		return
+	}
+
+	alias, err := service.NormalizeChallengeAlias(challengeType, req.ChallengeAlias)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": gin.H{
 				"code":    "INVALID_REQUEST",
-				"message": "DNS-01 验证方式需要选择 DNS 提供商",
+				"message": err.Error(),
 			},
 		})
 		return
 	}
 
-	// 先创建证书记录，状态为 pending
-	cert, err := h.certService.CreatePendingWithChallenge(req.Domain, req.SAN, req.DNSProviderID, challengeType, req.WorkspaceID)
+	// 创建证书记录，状态为 pending
+	cert, err := h.certService.CreatePending(service.CertConfig{
+		Domain:           req.Domain,
+		SAN:              req.SAN,
+		ChallengeType:    challengeType,
+		HTTP01Mode:       req.HTTP01Mode,
+		HTTP01Webroot:    req.HTTP01Webroot,
+		DNSProviderID:    req.DNSProviderID,
+		ChallengeAlias:   alias,
+		DomainChallenges: domainChallenges,
+		WorkspaceID:      req.WorkspaceID,
+		Profile:          req.Profile,
+		PreferredChain:   req.PreferredChain,
+		CSRPEM:           csrPEM,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{
@@ -290,11 +429,151 @@ func (h *CertHandler) Create(c *gin.Context) {
 		"id":             cert.ID,
 		"domain":         cert.Domain,
 		"challenge_type": cert.ChallengeType,
+		"http01_mode":    cert.HTTP01Mode,
 		"workspace_id":   cert.WorkspaceID,
+		"uses_csr":       cert.UsesCSR(),
+		"profile":        cert.Profile,
 		"status":         cert.Status,
 	})
 }
 
+// domainsFromCSR 解析 CSR 并返回主域名和 SAN 列表
+func (h *CertHandler) domainsFromCSR(csrPEM []byte) (string, []string, error) {
+	csr, err := service.ParseCSR(csrPEM)
+	if err != nil {
+		return "", nil, err
+	}
+	domains := service.CSRDomains(csr)
+	return domains[0], domains[1:], nil
+}
+
+// Import 导入外部签发的证书（商业 CA 或其他工具），只跟踪到期和下发 Agent，不通过 ACME 续期
+// 路径带证书 ID 时替换已导入的证书，保留 Agent 绑定
+func (h *CertHandler) Import(c *gin.Context) {
+	var id uint64
+	if c.Param("id") != "" {
+		var err error
+		id, err = strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "INVALID_REQUEST",
+					"message": "无效的证书 ID",
+				},
+			})
+			return
+		}
+	}
+
+	var req struct {
+		Cert        string `json:"cert"`         // 证书 PEM，可直接粘贴完整链
+		Key         string `json:"key"`          // 私钥 PEM（不支持加密私钥）
+		Chain       string `json:"chain"`        // 中间证书 PEM，可选
+		PKCS12      string `json:"pkcs12"`       // PKCS#12 (PFX) 文件的 Base64 编码，提供时忽略 cert/key/chain
+		Password    string `json:"password"`     // PKCS#12 密码
+		WorkspaceID *uint  `json:"workspace_id"` // 工作区 ID，仅用于分组
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "参数错误",
+			},
+		})
+		return
+	}
+
+	var imported *service.ImportedCert
+	var err error
+	if strings.TrimSpace(req.PKCS12) != "" {
+		var data []byte
+		data, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(req.PKCS12), ""))
+		if err != nil {
+			err = fmt.Errorf("PKCS#12 内容不是有效的 Base64 编码")
+		} else {
+			imported, err = service.ParseImportPKCS12(data, req.Password)
+		}
+	} else {
+		imported, err = service.ParseImportPEM([]byte(req.Cert), []byte(req.Key), []byte(req.Chain))
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+
+	var cert *model.Certificate
+	if id > 0 {
+		if _, err := h.certService.Get(uint(id)); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{
+					"code":    "NOT_FOUND",
+					"message": "证书不存在",
+				},
+			})
+			return
+		}
+		if err := h.certService.Reimport(uint(id), imported); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "INVALID_REQUEST",
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+		cert, err = h.certService.Get(uint(id))
+	} else {
+		cert, err = h.certService.Import(imported, req.WorkspaceID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+
+	certInfo := h.parseCertificateInfo(cert.CertPEM)
+	if certInfo != nil {
+		certInfo["chain"] = h.parseChainInfo(cert.CaPEM)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":           cert.ID,
+		"domain":       cert.Domain,
+		"san":          cert.GetSANList(),
+		"source":       cert.Source,
+		"fingerprint":  cert.Fingerprint,
+		"issued_at":    cert.IssuedAt,
+		"expires_at":   cert.ExpiresAt,
+		"workspace_id": cert.WorkspaceID,
+		"status":       cert.Status,
+		"cert_info":    certInfo,
+	})
+}
+
+// rejectImported 导入的证书不能通过 ACME 申请、续期或修改申请配置
+func rejectImported(c *gin.Context, cert *model.Certificate) bool {
+	if !cert.IsImported() {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": service.ErrImportedCert.Error(),
+		},
+	})
+	return true
+}
+
 // Issue 申请证书（从 pending 状态申请）- 异步模式
 func (h *CertHandler) Issue(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
@@ -319,17 +598,38 @@ func (h *CertHandler) Issue(c *gin.Context) {
 		})
 		return
 	}
+	if rejectImported(c, cert) {
+		return
+	}
 
-	// 验证方式
-	challengeType := cert.ChallengeType
-	if challengeType == "" {
-		challengeType = "dns-01"
+	// 私钥由 Agent 生成的证书需等待 Agent 提交 CSR
+	if !cert.UsesCSR() && h.certService.HasAgentKeyBinding(cert.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "该证书私钥由 Agent 生成，请等待 Agent 提交 CSR",
+			},
+		})
+		return
+	}
+
+	// 定时续期、Agent 提交 CSR 或批量任务正在签发该证书时不重复发起
+	release, ok := h.acmeService.ReserveIssue(cert.ID)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": gin.H{
+				"code":    "CONFLICT",
+				"message": "证书正在签发或续期，请稍后再试",
+			},
+		})
+		return
 	}
 
 	// 创建任务日志记录
 	taskLogService := service.NewTaskLogService()
 	taskID, err := taskLogService.CreateTask(uint(id), "issue")
 	if err != nil {
+		release()
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{
 				"code":    "INTERNAL_ERROR",
@@ -346,64 +646,19 @@ func (h *CertHandler) Issue(c *gin.Context) {
 		"cert_id": cert.ID,
 	})
 
-	// 异步执行申请操作
+	// 异步执行申请操作，按证书当前配置申请并保存
 	go func() {
-		h.issueCertificateAsync(uint(id), taskID, cert, challengeType, taskLogService)
+		defer release()
+		if err := h.acmeService.IssueCertificateWithTaskID(uint(id), taskID); err != nil {
+			h.logger.Error("cert", fmt.Sprintf("申请证书失败: ID=%d", id), map[string]interface{}{
+				"error":   err.Error(),
+				"task_id": taskID,
+			})
+			// 任务状态由 IssueCertificateWithTaskID 内部更新
+		}
 	}()
 }
 
-// issueCertificateAsync 异步执行证书申请
-func (h *CertHandler) issueCertificateAsync(certID uint, taskID string, cert *model.Certificate, challengeType string, taskLogService *service.TaskLogService) {
-	// 调用 ACME 服务申请证书
-	resource, err := h.acmeService.RequestCertificateWithChallenge(service.CertRequest{
-		Domain:        cert.Domain,
-		SAN:           cert.GetSANList(),
-		ChallengeType: challengeType,
-		DNSProviderID: cert.DNSProviderID,
-		WorkspaceID:   cert.WorkspaceID,
-		CertID:        certID,
-		TaskType:      "issue",
-	})
-	if err != nil {
-		taskLogService.ErrorWithTaskID(taskID, certID, "issue", fmt.Sprintf("申请证书失败: %v", err), nil)
-		h.logger.Error("cert", fmt.Sprintf("申请证书失败: ID=%d", certID), map[string]interface{}{
-			"error": err.Error(),
-		})
-		taskLogService.CompleteTaskWithTaskID(taskID, certID, "issue", "failed")
-		return
-	}
-
-	// 解析证书获取有效期
-	certInfo, err := certcrypto.ParsePEMCertificate(resource.Certificate)
-	if err != nil {
-		taskLogService.ErrorWithTaskID(taskID, certID, "issue", fmt.Sprintf("解析证书失败: %v", err), nil)
-		taskLogService.CompleteTaskWithTaskID(taskID, certID, "issue", "failed")
-		return
-	}
-
-	// 更新证书
-	taskLogService.InfoWithTaskID(taskID, certID, "issue", "正在保存证书到数据库...", nil)
-
-	fullchain := append(resource.Certificate, resource.IssuerCertificate...)
-	err = h.certService.Update(
-		cert.ID,
-		resource.Certificate,
-		resource.PrivateKey,
-		resource.IssuerCertificate,
-		fullchain,
-		certInfo.NotBefore,
-		certInfo.NotAfter,
-	)
-	if err != nil {
-		taskLogService.ErrorWithTaskID(taskID, certID, "issue", fmt.Sprintf("保存证书到数据库失败: %v", err), nil)
-		taskLogService.CompleteTaskWithTaskID(taskID, certID, "issue", "failed")
-		return
-	}
-
-	taskLogService.InfoWithTaskID(taskID, certID, "issue", "证书已成功保存到数据库", nil)
-	taskLogService.CompleteTaskWithTaskID(taskID, certID, "issue", "completed")
-}
-
 // Edit 编辑证书配置
 func (h *CertHandler) Edit(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
@@ -418,11 +673,20 @@ func (h *CertHandler) Edit(c *gin.Context) {
 	}
 
 	var req struct {
-		Domain        string   `json:"domain" binding:"required"`
-		SAN           []string `json:"san"`
-		ChallengeType string   `json:"challenge_type"`  // dns-01 或 http-01
-		DNSProviderID uint     `json:"dns_provider_id"` // DNS-01 时必填
-		WorkspaceID   *uint    `json:"workspace_id"`    // 工作区 ID，为空则使用全局配置
+		Domain           string                   `json:"domain"`
+		SAN              []string                 `json:"san"`
+		ChallengeType    string                   `json:"challenge_type"`    // dns-01、http-01 或 tls-alpn-01
+		HTTP01Mode       string                   `json:"http01_mode"`       // HTTP-01 放置方式: 空为服务器监听端口, agent, webroot, proxy
+		HTTP01Webroot    string                   `json:"http01_webroot"`    // webroot 模式写入的目录
+		DNSProviderID    uint                     `json:"dns_provider_id"`   // DNS-01 时必填
+		ChallengeAlias   string                   `json:"challenge_alias"`   // DNS-01 验证别名，为空则直接写入证书域名
+		DomainChallenges *[]model.DomainChallenge `json:"domain_challenges"` // 按域名覆盖的验证配置，不传则保留原配置
+		IncludeApex      bool                     `json:"include_apex"`      // 申请通配符时自动加入对应的主域名
+		WorkspaceID      *uint                    `json:"workspace_id"`      // 工作区 ID，为空则使用全局配置
+		CSR              string                   `json:"csr"`               // 更换自带 CSR（PEM），为空则保持不变
+		ClearCSR         bool                     `json:"clear_csr"`         // 删除自带 CSR，改回由服务器生成私钥
+		Profile          string                   `json:"profile"`           // ACME 证书 Profile，为空则使用工作区配置
+		PreferredChain   string                   `json:"preferred_chain"`   // 首选证书链（根证书 CN），为空则使用工作区配置
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -435,24 +699,132 @@ func (h *CertHandler) Edit(c *gin.Context) {
 		return
 	}
 
+	existing, err := h.certService.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": "证书不存在",
+			},
+		})
+		return
+	}
+	if rejectImported(c, existing) {
+		return
+	}
+
+	if req.ClearCSR && strings.TrimSpace(req.CSR) != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "csr 和 clear_csr 不能同时指定",
+			},
+		})
+		return
+	}
+
+	// 使用自带 CSR 的证书，域名始终以 CSR 为准
+	csrPEM := existing.CSRPEM
+	if strings.TrimSpace(req.CSR) != "" {
+		csrPEM = []byte(strings.TrimSpace(req.CSR))
+	}
+	if req.ClearCSR {
+		csrPEM = nil
+		// 未传入域名时沿用 CSR 中的域名
+		if req.Domain == "" {
+			req.Domain, req.SAN = existing.Domain, existing.GetSANList()
+		}
+	}
+	if len(csrPEM) > 0 {
+		domain, san, err := h.domainsFromCSR(csrPEM)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "INVALID_REQUEST",
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+		req.Domain = domain
+		req.SAN = san
+	}
+
+	// 规范化域名（IDN 转 punycode、小写、去重）并检查数量上限；自带 CSR 时域名以 CSR 为准，不自动加入主域名
+	domain, san, err := service.NormalizeDomains(req.Domain, req.SAN, service.DomainOptions{
+		IncludeApex: req.IncludeApex && len(csrPEM) == 0,
+		MaxNames:    h.workspaceService.MaxNames(req.WorkspaceID),
+	})
+	if err != nil {
+		invalidDomainRequest(c, err)
+		return
+	}
+	req.Domain, req.SAN = domain, san
+
 	// 验证方式
 	challengeType := req.ChallengeType
 	if challengeType == "" {
 		challengeType = "dns-01"
 	}
 
-	// 验证参数
-	if challengeType == "dns-01" && req.DNSProviderID == 0 {
+	// 未传入按域名配置时保留原配置，去掉已不在证书中的域名
+	var overrides []model.DomainChallenge
+	if req.DomainChallenges != nil {
+		overrides = *req.DomainChallenges
+	} else {
+		domainSet := make(map[string]bool)
+		for _, d := range append([]string{req.Domain}, req.SAN...) {
+			domainSet[d] = true
+		}
+		for _, o := range existing.GetDomainChallenges() {
+			if domainSet[o.Domain] {
+				overrides = append(overrides, o)
+			}
+		}
+	}
+
+	// 验证参数（私有 CA 直接签发，不需要域名验证）
+	var domainChallenges []model.DomainChallenge
+	if h.workspaceService.IsPrivateCA(req.WorkspaceID) {
+		req.DNSProviderID, req.ChallengeAlias = 0, ""
+	} else {
+		domainChallenges, err = service.NormalizeDomainChallenges(overrides, append([]string{req.Domain}, req.SAN...), challengeType, req.DNSProviderID)
+		if err == nil {
+			err = service.ValidateChallenge(challengeType, req.DNSProviderID, req.HTTP01Mode, req.HTTP01Webroot, domainChallenges)
+		}
+	}
+	if err != nil {
+		invalidDomainRequest(c, err)
+		return
+	}
+
+	alias, err := service.NormalizeChallengeAlias(challengeType, req.ChallengeAlias)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": gin.H{
 				"code":    "INVALID_REQUEST",
-				"message": "DNS-01 验证方式需要选择 DNS 提供商",
+				"message": err.Error(),
 			},
 		})
 		return
 	}
 
-	if err := h.certService.UpdateConfigWithChallenge(uint(id), req.Domain, req.SAN, req.DNSProviderID, challengeType, req.WorkspaceID); err != nil {
+	// 未更换或删除自带 CSR 时保留原有 CSR
+	if err := h.certService.UpdateConfig(uint(id), service.CertConfig{
+		Domain:           req.Domain,
+		SAN:              req.SAN,
+		ChallengeType:    challengeType,
+		HTTP01Mode:       req.HTTP01Mode,
+		HTTP01Webroot:    req.HTTP01Webroot,
+		DNSProviderID:    req.DNSProviderID,
+		ChallengeAlias:   alias,
+		DomainChallenges: domainChallenges,
+		WorkspaceID:      req.WorkspaceID,
+		Profile:          req.Profile,
+		PreferredChain:   req.PreferredChain,
+		CSRPEM:           csrPEM,
+		KeepCSR:          strings.TrimSpace(req.CSR) == "" && !req.ClearCSR,
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{
 				"code":    "INTERNAL_ERROR",
@@ -468,7 +840,9 @@ func (h *CertHandler) Edit(c *gin.Context) {
 		"domain":         cert.Domain,
 		"san":            cert.GetSANList(),
 		"challenge_type": cert.ChallengeType,
+		"http01_mode":    cert.HTTP01Mode,
 		"workspace_id":   cert.WorkspaceID,
+		"profile":        cert.Profile,
 		"status":         cert.Status,
 	})
 }
@@ -525,11 +899,26 @@ func (h *CertHandler) Renew(c *gin.Context) {
 		})
 		return
 	}
+	if rejectImported(c, cert) {
+		return
+	}
+
+	release, ok := h.acmeService.ReserveIssue(cert.ID)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": gin.H{
+				"code":    "CONFLICT",
+				"message": "证书正在签发或续期，请稍后再试",
+			},
+		})
+		return
+	}
 
 	// 创建任务记录
 	taskLogService := service.NewTaskLogService()
 	taskID, err := taskLogService.CreateTask(uint(id), "renew")
 	if err != nil {
+		release()
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{
 				"code":    "INTERNAL_ERROR",
@@ -548,6 +937,7 @@ func (h *CertHandler) Renew(c *gin.Context) {
 
 	// 异步执行续期操作
 	go func() {
+		defer release()
 		_, err := h.acmeService.RenewCertificateWithTaskID(uint(id), taskID)
 		if err != nil {
 			h.logger.Error("cert", fmt.Sprintf("证书续期失败: ID=%d", id), map[string]interface{}{
@@ -559,6 +949,58 @@ func (h *CertHandler) Renew(c *gin.Context) {
 	}()
 }
 
+// Revoke 吊销证书，reason 为 RFC 5280 吊销原因，默认 0 (unspecified)
+func (h *CertHandler) Revoke(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "无效的证书 ID",
+			},
+		})
+		return
+	}
+
+	var req struct {
+		Reason int `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "INVALID_REQUEST",
+					"message": "参数错误",
+				},
+			})
+			return
+		}
+	}
+
+	cert, err := h.certService.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": "证书不存在",
+			},
+		})
+		return
+	}
+
+	if err := h.acmeService.Revoke(cert.ID, req.Reason); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "证书已吊销"})
+}
+
 // Stats 获取证书统计
 func (h *CertHandler) Stats(c *gin.Context) {
 	stats := h.certService.GetStats()
@@ -599,6 +1041,15 @@ func (h *CertHandler) Download(c *gin.Context) {
 		data = cert.CertPEM
 		filename = "cert.pem"
 	case "key":
+		if cert.UsesCSR() {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{
+					"code":    "NOT_FOUND",
+					"message": "该证书使用自带 CSR，私钥不在服务器上",
+				},
+			})
+			return
+		}
 		data = cert.KeyPEM
 		filename = "key.pem"
 	case "fullchain":
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+type CertBatchHandler struct {
+	batchService *service.CertBatchService
+	taskLog      *TaskLogHandler
+}
+
+func NewCertBatchHandler(dataDir string) *CertBatchHandler {
+	return &CertBatchHandler{
+		batchService: service.NewCertBatchService(dataDir),
+		taskLog:      NewTaskLogHandler(),
+	}
+}
+
+// Create 创建批量操作任务，dry_run 时只返回符合条件的证书
+func (h *CertBatchHandler) Create(c *gin.Context) {
+	var req struct {
+		service.CertBatchParams
+		DryRun bool `json:"dry_run"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "参数错误",
+			},
+		})
+		return
+	}
+
+	if req.DryRun {
+		certs, err := h.batchService.Match(req.Filter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "INVALID_REQUEST",
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+
+		result := make([]gin.H, len(certs))
+		for i, cert := range certs {
+			result[i] = gin.H{
+				"id":              cert.ID,
+				"domain":          cert.Domain,
+				"san":             cert.GetSANList(),
+				"status":          cert.Status,
+				"source":          cert.Source,
+				"challenge_type":  cert.ChallengeType,
+				"workspace_id":    cert.WorkspaceID,
+				"dns_provider_id": cert.DNSProviderID,
+				"expires_at":      cert.ExpiresAt,
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"data": result, "total": len(result)})
+		return
+	}
+
+	job, err := h.batchService.Start(req.CertBatchParams)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// List 获取最近的批量操作任务
+func (h *CertBatchHandler) List(c *gin.Context) {
+	limit := 20
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	jobs, err := h.batchService.List(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "获取列表失败",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": jobs})
+}
+
+// Get 获取批量操作任务及每个证书的结果
+func (h *CertBatchHandler) Get(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "无效的 ID",
+			},
+		})
+		return
+	}
+
+	job, err := h.batchService.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": "批量任务不存在",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// Stream 通过 SSE 推送批量任务进度
+func (h *CertBatchHandler) Stream(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "无效的 ID",
+			},
+		})
+		return
+	}
+
+	job, err := h.batchService.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": "批量任务不存在",
+			},
+		})
+		return
+	}
+
+	h.taskLog.streamTask(c, job.TaskID)
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/BlakeLiAFK/letsync/internal/server/dnsprovider"
 	"github.com/BlakeLiAFK/letsync/internal/server/service"
 )
 
@@ -44,6 +45,11 @@ func (h *DNSProviderHandler) List(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": data})
 }
 
+// Types 获取支持的提供商类型及配置字段说明
+func (h *DNSProviderHandler) Types(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.dnsService.Types()})
+}
+
 // Get 获取 DNS 提供商详情
 func (h *DNSProviderHandler) Get(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
@@ -94,19 +100,12 @@ func (h *DNSProviderHandler) Create(c *gin.Context) {
 		return
 	}
 
-	// 验证类型
-	validTypes := map[string]bool{
-		"cloudflare": true,
-		"aliyun":     true,
-		"dnspod":     true,
-		"route53":    true,
-		"godaddy":    true,
-	}
-	if !validTypes[req.Type] {
+	// 验证类型和配置字段
+	if err := dnsprovider.Validate(req.Type, req.Config, false); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": gin.H{
 				"code":    "INVALID_REQUEST",
-				"message": "不支持的提供商类型",
+				"message": err.Error(),
 			},
 		})
 		return
@@ -159,10 +158,20 @@ func (h *DNSProviderHandler) Update(c *gin.Context) {
 		return
 	}
 
+	if _, err := h.dnsService.Get(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": "DNS 提供商不存在",
+			},
+		})
+		return
+	}
+
 	if err := h.dnsService.Update(uint(id), req.Name, req.Type, req.Config); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(http.StatusBadRequest, gin.H{
 			"error": gin.H{
-				"code":    "INTERNAL_ERROR",
+				"code":    "INVALID_REQUEST",
 				"message": err.Error(),
 			},
 		})
@@ -201,3 +210,109 @@ func (h *DNSProviderHandler) Delete(c *gin.Context) {
 		"message": "删除成功",
 	})
 }
+
+// Cleanup 清理残留的 _acme-challenge TXT 记录
+func (h *DNSProviderHandler) Cleanup(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "无效的 ID",
+			},
+		})
+		return
+	}
+
+	// 未指定域名时清理使用该提供商的全部证书域名
+	var req struct {
+		Domains []string `json:"domains"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "INVALID_REQUEST",
+					"message": "参数错误",
+				},
+			})
+			return
+		}
+	}
+
+	if _, err := h.dnsService.Get(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": "DNS 提供商不存在",
+			},
+		})
+		return
+	}
+
+	result, err := h.dnsService.Cleanup(uint(id), req.Domains)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Test 测试 DNS 提供商凭据
+func (h *DNSProviderHandler) Test(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "无效的 ID",
+			},
+		})
+		return
+	}
+
+	var req struct {
+		Domains   []string `json:"domains"`
+		WriteTest bool     `json:"write_test"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "INVALID_REQUEST",
+					"message": "参数错误",
+				},
+			})
+			return
+		}
+	}
+
+	if _, err := h.dnsService.Get(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": "DNS 提供商不存在",
+			},
+		})
+		return
+	}
+
+	result, err := h.dnsService.Test(uint(id), req.Domains, req.WriteTest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
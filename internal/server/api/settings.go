@@ -33,22 +33,29 @@ func (h *SettingsHandler) GetAll(c *gin.Context) {
 
 	// 白名单：允许返回给前端的配置项
 	allowedKeys := map[string]bool{
-		"acme.email":                      true,
-		"acme.ca_url":                     true,
-		"acme.key_type":                   true,
-		"acme.challenge_timeout":          true,
-		"acme.http_port":                  true,
-		"scheduler.renew_before_days":     true,
-		"security.cors_allowed_origins":   true,
-		"security.jwt_expires_hours":      true,
-		"security.behind_proxy":           true,
-		"security.trusted_proxies":        true,
-		"security.password_min_length":    true,
+		"acme.email":                          true,
+		"acme.ca_url":                         true,
+		"acme.key_type":                       true,
+		"acme.challenge_timeout":              true,
+		"acme.http_port":                      true,
+		"acme.tls_port":                       true,
+		"acme.max_concurrent":                 true,
+		"scheduler.renew_before_days":         true,
+		"scheduler.renew_lifetime_percent":    true,
+		"scheduler.ari_enabled":               true,
+		"acme.profile":                        true,
+		"acme.preferred_chain":                true,
+		"acme.max_names":                      true,
+		"security.cors_allowed_origins":       true,
+		"security.jwt_expires_hours":          true,
+		"security.behind_proxy":               true,
+		"security.trusted_proxies":            true,
+		"security.password_min_length":        true,
 		"security.password_require_uppercase": true,
 		"security.password_require_lowercase": true,
 		"security.password_require_number":    true,
 		"security.password_require_special":   true,
-		"security.download_rate_limit":    true,
+		"security.download_rate_limit":        true,
 	}
 
 	// 按分类组织
@@ -93,22 +100,29 @@ func (h *SettingsHandler) GetByCategory(c *gin.Context) {
 
 	// 白名单：允许返回给前端的配置项
 	allowedKeys := map[string]bool{
-		"acme.email":                      true,
-		"acme.ca_url":                     true,
-		"acme.key_type":                   true,
-		"acme.challenge_timeout":          true,
-		"acme.http_port":                  true,
-		"scheduler.renew_before_days":     true,
-		"security.cors_allowed_origins":   true,
-		"security.jwt_expires_hours":      true,
-		"security.behind_proxy":           true,
-		"security.trusted_proxies":        true,
-		"security.password_min_length":    true,
+		"acme.email":                          true,
+		"acme.ca_url":                         true,
+		"acme.key_type":                       true,
+		"acme.challenge_timeout":              true,
+		"acme.http_port":                      true,
+		"acme.tls_port":                       true,
+		"acme.max_concurrent":                 true,
+		"scheduler.renew_before_days":         true,
+		"scheduler.renew_lifetime_percent":    true,
+		"scheduler.ari_enabled":               true,
+		"acme.profile":                        true,
+		"acme.preferred_chain":                true,
+		"acme.max_names":                      true,
+		"security.cors_allowed_origins":       true,
+		"security.jwt_expires_hours":          true,
+		"security.behind_proxy":               true,
+		"security.trusted_proxies":            true,
+		"security.password_min_length":        true,
 		"security.password_require_uppercase": true,
 		"security.password_require_lowercase": true,
 		"security.password_require_number":    true,
 		"security.password_require_special":   true,
-		"security.download_rate_limit":    true,
+		"security.download_rate_limit":        true,
 	}
 
 	result := make(map[string]interface{})
@@ -143,22 +157,29 @@ func (h *SettingsHandler) Update(c *gin.Context) {
 
 	// 白名单：只允许修改这些配置项
 	allowedKeys := map[string]bool{
-		"acme.email":                      true,
-		"acme.ca_url":                     true,
-		"acme.key_type":                   true,
-		"acme.challenge_timeout":          true,
-		"acme.http_port":                  true,
-		"scheduler.renew_before_days":     true,
-		"security.cors_allowed_origins":   true,
-		"security.jwt_expires_hours":      true,
-		"security.behind_proxy":           true,
-		"security.trusted_proxies":        true,
-		"security.password_min_length":    true,
+		"acme.email":                          true,
+		"acme.ca_url":                         true,
+		"acme.key_type":                       true,
+		"acme.challenge_timeout":              true,
+		"acme.http_port":                      true,
+		"acme.tls_port":                       true,
+		"acme.max_concurrent":                 true,
+		"scheduler.renew_before_days":         true,
+		"scheduler.renew_lifetime_percent":    true,
+		"scheduler.ari_enabled":               true,
+		"acme.profile":                        true,
+		"acme.preferred_chain":                true,
+		"acme.max_names":                      true,
+		"security.cors_allowed_origins":       true,
+		"security.jwt_expires_hours":          true,
+		"security.behind_proxy":               true,
+		"security.trusted_proxies":            true,
+		"security.password_min_length":        true,
 		"security.password_require_uppercase": true,
 		"security.password_require_lowercase": true,
 		"security.password_require_number":    true,
 		"security.password_require_special":   true,
-		"security.download_rate_limit":    true,
+		"security.download_rate_limit":        true,
 	}
 
 	// 过滤掉不在白名单中的配置
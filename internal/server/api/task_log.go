@@ -56,7 +56,11 @@ func (h *TaskLogHandler) LogsStream(c *gin.Context) {
 
 	// EventSource 不支持设置 Authorization 头，所以使用查询参数传递 token
 	// 但这里通过 JWT 中间件已经验证过了，所以直接继续
+	h.streamTask(c, taskID)
+}
 
+// streamTask 推送任务的历史日志，并持续推送新日志直到任务结束或客户端断开
+func (h *TaskLogHandler) streamTask(c *gin.Context, taskID string) {
 	// 设置 SSE 响应头
 	h.setupSSEHeaders(c)
 
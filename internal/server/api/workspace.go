@@ -3,6 +3,7 @@ package api
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/BlakeLiAFK/letsync/internal/server/model"
@@ -62,30 +63,43 @@ func (h *WorkspaceHandler) Get(c *gin.Context) {
 	certCount := h.workspaceService.GetCertCount(uint(id))
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":          workspace.ID,
-		"name":        workspace.Name,
-		"description": workspace.Description,
-		"ca_url":      workspace.CaURL,
-		"email":       workspace.Email,
-		"key_type":    workspace.KeyType,
-		"is_default":  workspace.IsDefault,
-		"cert_count":  certCount,
-		"created_at":  workspace.CreatedAt,
-		"updated_at":  workspace.UpdatedAt,
+		"id":                 workspace.ID,
+		"name":               workspace.Name,
+		"description":        workspace.Description,
+		"ca_url":             workspace.CaURL,
+		"email":              workspace.Email,
+		"key_type":           workspace.KeyType,
+		"profile":            workspace.Profile,
+		"preferred_chain":    workspace.PreferredChain,
+		"max_names":          workspace.MaxNames,
+		"type":               workspace.Type,
+		"cert_validity_days": workspace.CertValidityDays,
+		"ca":                 h.workspaceService.CAInfo(workspace),
+		"acme_server":        workspace.ACMEServer,
+		"is_default":         workspace.IsDefault,
+		"cert_count":         certCount,
+		"created_at":         workspace.CreatedAt,
+		"updated_at":         workspace.UpdatedAt,
 	})
 }
 
 // Create 创建工作区
 func (h *WorkspaceHandler) Create(c *gin.Context) {
 	var req struct {
-		Name        string `json:"name" binding:"required"`
-		Description string `json:"description"`
-		CaURL       string `json:"ca_url" binding:"required"`
-		Email       string `json:"email" binding:"required"`
-		KeyType     string `json:"key_type"`
+		Name             string `json:"name" binding:"required"`
+		Description      string `json:"description"`
+		Type             string `json:"type"` // acme（默认）或 private_ca
+		CaURL            string `json:"ca_url"`
+		Email            string `json:"email"`
+		KeyType          string `json:"key_type"`
+		Profile          string `json:"profile"`            // ACME 证书 Profile，可选
+		PreferredChain   string `json:"preferred_chain"`    // 首选证书链（根证书 CN），可选
+		MaxNames         int    `json:"max_names"`          // 单张证书最多域名数，0 使用全局配置
+		CertValidityDays int    `json:"cert_validity_days"` // 私有 CA 签发证书有效期（天），0 使用默认值
+		ACMEServer       bool   `json:"acme_server"`        // 私有 CA 是否开放内置 ACME 服务端
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Type != "private_ca" && (req.CaURL == "" || req.Email == "")) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": gin.H{
 				"code":    "INVALID_REQUEST",
@@ -95,6 +109,16 @@ func (h *WorkspaceHandler) Create(c *gin.Context) {
 		return
 	}
 
+	if req.Type != "" && req.Type != "acme" && req.Type != "private_ca" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "不支持的工作区类型",
+			},
+		})
+		return
+	}
+
 	// 验证密钥类型
 	validKeyTypes := map[string]bool{
 		"EC256":   true,
@@ -112,7 +136,27 @@ func (h *WorkspaceHandler) Create(c *gin.Context) {
 		return
 	}
 
-	workspace, err := h.workspaceService.Create(req.Name, req.Description, req.CaURL, req.Email, req.KeyType)
+	if req.MaxNames < 0 || req.CertValidityDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "max_names 和 cert_validity_days 不能为负数",
+			},
+		})
+		return
+	}
+
+	var workspace *model.Workspace
+	var err error
+	if req.Type == "private_ca" {
+		workspace, err = h.workspaceService.CreatePrivateCA(req.Name, req.Description, req.KeyType, req.MaxNames, req.CertValidityDays)
+		if err == nil && req.ACMEServer {
+			err = h.workspaceService.SetACMEServer(workspace.ID, true)
+			workspace.ACMEServer = true
+		}
+	} else {
+		workspace, err = h.workspaceService.Create(req.Name, req.Description, req.CaURL, req.Email, req.KeyType, strings.TrimSpace(req.Profile), strings.TrimSpace(req.PreferredChain), req.MaxNames)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{
@@ -124,11 +168,18 @@ func (h *WorkspaceHandler) Create(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":       workspace.ID,
-		"name":     workspace.Name,
-		"ca_url":   workspace.CaURL,
-		"email":    workspace.Email,
-		"key_type": workspace.KeyType,
+		"id":                 workspace.ID,
+		"name":               workspace.Name,
+		"ca_url":             workspace.CaURL,
+		"email":              workspace.Email,
+		"key_type":           workspace.KeyType,
+		"profile":            workspace.Profile,
+		"preferred_chain":    workspace.PreferredChain,
+		"max_names":          workspace.MaxNames,
+		"type":               workspace.Type,
+		"cert_validity_days": workspace.CertValidityDays,
+		"ca":                 h.workspaceService.CAInfo(workspace),
+		"acme_server":        workspace.ACMEServer,
 	})
 }
 
@@ -146,11 +197,16 @@ func (h *WorkspaceHandler) Update(c *gin.Context) {
 	}
 
 	var req struct {
-		Name        string `json:"name" binding:"required"`
-		Description string `json:"description"`
-		CaURL       string `json:"ca_url" binding:"required"`
-		Email       string `json:"email" binding:"required"`
-		KeyType     string `json:"key_type"`
+		Name             string `json:"name" binding:"required"`
+		Description      string `json:"description"`
+		CaURL            string `json:"ca_url"`
+		Email            string `json:"email"`
+		KeyType          string `json:"key_type"`
+		Profile          string `json:"profile"`            // ACME 证书 Profile，可选
+		PreferredChain   string `json:"preferred_chain"`    // 首选证书链（根证书 CN），可选
+		MaxNames         int    `json:"max_names"`          // 单张证书最多域名数，0 使用全局配置
+		CertValidityDays int    `json:"cert_validity_days"` // 私有 CA 签发证书有效期（天），0 使用默认值
+		ACMEServer       bool   `json:"acme_server"`        // 私有 CA 是否开放内置 ACME 服务端
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -163,7 +219,41 @@ func (h *WorkspaceHandler) Update(c *gin.Context) {
 		return
 	}
 
-	if err := h.workspaceService.Update(uint(id), req.Name, req.Description, req.CaURL, req.Email, req.KeyType); err != nil {
+	if req.MaxNames < 0 || req.CertValidityDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "max_names 和 cert_validity_days 不能为负数",
+			},
+		})
+		return
+	}
+
+	workspace, err := h.workspaceService.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": "工作区不存在",
+			},
+		})
+		return
+	}
+
+	// 工作区类型创建后不可修改，私有 CA 没有 ACME 相关配置
+	if workspace.IsPrivateCA() {
+		req.CaURL, req.Email, req.Profile, req.PreferredChain = "", "", "", ""
+	} else if req.CaURL == "" || req.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "参数错误：CA URL 和邮箱为必填项",
+			},
+		})
+		return
+	}
+
+	if err := h.workspaceService.Update(uint(id), req.Name, req.Description, req.CaURL, req.Email, req.KeyType, strings.TrimSpace(req.Profile), strings.TrimSpace(req.PreferredChain), req.MaxNames); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{
 				"code":    "INTERNAL_ERROR",
@@ -173,6 +263,22 @@ func (h *WorkspaceHandler) Update(c *gin.Context) {
 		return
 	}
 
+	if workspace.IsPrivateCA() {
+		err := h.workspaceService.SetCertValidityDays(uint(id), req.CertValidityDays)
+		if err == nil {
+			err = h.workspaceService.SetACMEServer(uint(id), req.ACMEServer)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"code":    "INTERNAL_ERROR",
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "更新成功",
 	})
@@ -239,3 +345,54 @@ func (h *WorkspaceHandler) GetPresets(c *gin.Context) {
 	presets := model.GetWorkspacePresets()
 	c.JSON(http.StatusOK, gin.H{"data": presets})
 }
+
+// DownloadCA 下载私有 CA 证书（root、intermediate 或 chain），用于分发到客户端信任库
+func (h *WorkspaceHandler) DownloadCA(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "无效的 ID",
+			},
+		})
+		return
+	}
+
+	workspace, err := h.workspaceService.Get(uint(id))
+	if err != nil || !workspace.IsPrivateCA() {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"code":    "NOT_FOUND",
+				"message": "私有 CA 工作区不存在",
+			},
+		})
+		return
+	}
+
+	var data []byte
+	var filename string
+	switch c.Param("type") {
+	case "root":
+		data = workspace.CARootCert
+		filename = "ca-root.pem"
+	case "intermediate":
+		data = workspace.CAIntermediateCert
+		filename = "ca-intermediate.pem"
+	case "chain":
+		data = append(append([]byte{}, workspace.CAIntermediateCert...), workspace.CARootCert...)
+		filename = "ca-chain.pem"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "类型必须为 root、intermediate 或 chain",
+			},
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header("Content-Type", "application/x-pem-file")
+	c.Data(http.StatusOK, "application/x-pem-file", data)
+}
@@ -0,0 +1,25 @@
+package dnsprovider
+
+import "strings"
+
+// Cleaner 可直接删除 TXT 记录的提供商
+// 能清理非本服务创建、或进程重启后 lego 已无法追踪的残留 _acme-challenge 记录
+type Cleaner interface {
+	// CleanupTXT 删除 fqdn 上的全部 TXT 记录，返回删除数量
+	CleanupTXT(fqdn string) (int, error)
+}
+
+// NewCleaner 获取提供商的原生清理实现，不支持时返回 nil
+func NewCleaner(providerType string, config Config) Cleaner {
+	t, ok := Get(providerType)
+	if !ok || t.cleaner == nil {
+		return nil
+	}
+	return t.cleaner(config)
+}
+
+// ChallengeFQDN 获取域名对应的 _acme-challenge 记录名（通配符与主域名共用同一记录）
+func ChallengeFQDN(domain string) string {
+	domain = strings.TrimSuffix(strings.TrimPrefix(domain, "*."), ".")
+	return "_acme-challenge." + domain
+}
@@ -0,0 +1,133 @@
+package dnsprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/dns01"
+)
+
+// cloudflareAPI Cloudflare API 客户端，用于清理残留记录和列出区域
+type cloudflareAPI struct {
+	client *http.Client
+	token  string
+	key    string
+	email  string
+}
+
+func newCloudflareAPI(config Config) *cloudflareAPI {
+	c := &cloudflareAPI{client: &http.Client{Timeout: 30 * time.Second}}
+	if token := config.String("api_token"); token != "" {
+		c.token = token
+	} else {
+		c.key = config.String("api_key")
+		c.email = config.String("email")
+	}
+	return c
+}
+
+// cloudflareResponse Cloudflare API 通用响应
+type cloudflareResponse struct {
+	Success bool            `json:"success"`
+	Result  json.RawMessage `json:"result"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// CleanupTXT 删除 Cloudflare 上的 TXT 记录
+func (c *cloudflareAPI) CleanupTXT(fqdn string) (int, error) {
+	name := dns01.UnFqdn(fqdn)
+
+	// 按 SOA 查找所属 Zone，支持 co.uk 等多级后缀
+	zone, err := dns01.FindZoneByFqdn(dns01.ToFqdn(name))
+	if err != nil {
+		return 0, fmt.Errorf("查找 DNS 区域失败: %w", err)
+	}
+
+	var zones []struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(http.MethodGet, "/zones?name="+url.QueryEscape(dns01.UnFqdn(zone)), &zones); err != nil {
+		return 0, fmt.Errorf("获取 Zone 失败: %w", err)
+	}
+	if len(zones) == 0 {
+		return 0, fmt.Errorf("Zone 不存在: %s", dns01.UnFqdn(zone))
+	}
+	zoneID := zones[0].ID
+
+	var records []struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(http.MethodGet, fmt.Sprintf("/zones/%s/dns_records?type=TXT&name=%s", zoneID, url.QueryEscape(name)), &records); err != nil {
+		return 0, fmt.Errorf("获取 DNS 记录失败: %w", err)
+	}
+
+	removed := 0
+	for _, record := range records {
+		if err := c.do(http.MethodDelete, fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, record.ID), nil); err != nil {
+			return removed, fmt.Errorf("删除 DNS 记录失败: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// ListZones 列出凭据可管理的全部区域
+func (c *cloudflareAPI) ListZones() ([]string, error) {
+	var names []string
+	for page := 1; ; page++ {
+		var zones []struct {
+			Name string `json:"name"`
+		}
+		if err := c.do(http.MethodGet, fmt.Sprintf("/zones?per_page=50&page=%d", page), &zones); err != nil {
+			return nil, err
+		}
+		for _, zone := range zones {
+			names = append(names, zone.Name)
+		}
+		if len(zones) < 50 {
+			return names, nil
+		}
+	}
+}
+
+// do 调用 Cloudflare API，result 不为 nil 时解析响应的 result 字段
+func (c *cloudflareAPI) do(method, path string, result interface{}) error {
+	req, err := http.NewRequest(method, "https://api.cloudflare.com/client/v4"+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else {
+		req.Header.Set("X-Auth-Key", c.key)
+		req.Header.Set("X-Auth-Email", c.email)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body cloudflareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("解析响应失败 (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if !body.Success {
+		if len(body.Errors) > 0 {
+			return fmt.Errorf("%s", body.Errors[0].Message)
+		}
+		return fmt.Errorf("cloudflare API error (HTTP %d)", resp.StatusCode)
+	}
+
+	if result != nil {
+		return json.Unmarshal(body.Result, result)
+	}
+	return nil
+}
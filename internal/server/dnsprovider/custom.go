@@ -0,0 +1,132 @@
+package dnsprovider
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-acme/lego/v4/providers/dns/exec"
+	"github.com/go-acme/lego/v4/providers/dns/httpreq"
+)
+
+// 对接内部 DNS 系统的通用提供商
+func init() {
+	Register(&Type{
+		Type: "exec",
+		Name: "外部程序",
+		Help: "调用服务器上的程序处理记录，程序须在启动 letsyncd 时通过 -exec-allow 或 LETSYNC_EXEC_ALLOW 允许：默认模式参数为 present|cleanup <FQDN> <记录值>，RAW 模式参数为 present|cleanup -- <域名> <token> <keyAuth>；退出码非 0 视为失败",
+		Fields: []Field{
+			{Key: "program", Label: "程序路径", Type: "string", Required: true, Help: "可执行文件的绝对路径，不经过 shell 执行", legoField: "Program"},
+			{Key: "mode", Label: "参数模式", Type: "select", Default: "default", Options: []string{"default", "RAW"}},
+		},
+		validate: func(config Config) error {
+			return checkProgram(config.String("program"))
+		},
+		build: legoProvider(exec.NewDefaultConfig, exec.NewDNSProviderConfig, func(c *exec.Config, config Config) error {
+			if err := checkProgram(c.Program); err != nil {
+				return err
+			}
+			if config.String("mode") == "RAW" {
+				c.Mode = "RAW"
+			}
+			return nil
+		}),
+	})
+
+	Register(&Type{
+		Type: "httpreq",
+		Name: "HTTP 请求",
+		Help: "向 {endpoint}/present 和 {endpoint}/cleanup 发送 POST JSON：默认模式为 {\"fqdn\",\"value\"}，RAW 模式为 {\"domain\",\"token\",\"keyAuth\"}；返回非 2xx 视为失败",
+		Fields: []Field{
+			{Key: "endpoint", Label: "接口地址", Type: "string", Required: true, Help: "例如 https://dns-api.internal/acme", legoField: "Endpoint"},
+			{Key: "mode", Label: "请求模式", Type: "select", Default: "default", Options: []string{"default", "RAW"}},
+			{Key: "username", Label: "Basic Auth 用户名", Type: "string", legoField: "Username"},
+			{Key: "password", Label: "Basic Auth 密码", Type: "string", Secret: true, legoField: "Password"},
+		},
+		validate: func(config Config) error {
+			u, err := url.Parse(config.String("endpoint"))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("接口地址必须是 http:// 或 https:// URL")
+			}
+			return nil
+		},
+		build: legoProvider(httpreq.NewDefaultConfig, httpreq.NewDNSProviderConfig, func(c *httpreq.Config, config Config) error {
+			if config.String("mode") == "RAW" {
+				c.Mode = "RAW"
+			}
+			return nil
+		}),
+	})
+}
+
+// EnvExecAllow 允许 exec 类型调用的程序或目录，多个路径以系统路径分隔符分隔（同 PATH）
+const EnvExecAllow = "LETSYNC_EXEC_ALLOW"
+
+// exec 类型可调用的程序或目录，只能在启动时由服务端设置，不能通过 API 修改
+var (
+	execAllowed      []string
+	execAllowedMutex sync.RWMutex
+)
+
+// SetExecAllowlist 设置 exec 类型允许调用的程序或目录，为空时禁用 exec 类型
+func SetExecAllowlist(list string) {
+	var paths []string
+	for _, path := range filepath.SplitList(list) {
+		path = strings.TrimSpace(path)
+		if path == "" || !filepath.IsAbs(path) {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		paths = append(paths, filepath.Clean(path))
+	}
+
+	execAllowedMutex.Lock()
+	defer execAllowedMutex.Unlock()
+	execAllowed = paths
+}
+
+// execAllows 程序（已解析符号链接）是否为允许的程序或位于允许的目录下
+func execAllows(program string) bool {
+	execAllowedMutex.RLock()
+	defer execAllowedMutex.RUnlock()
+
+	for _, allowed := range execAllowed {
+		if program == allowed {
+			return true
+		}
+		if rel, err := filepath.Rel(allowed, program); err == nil && rel != "." && rel != ".." &&
+			!strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkProgram 检查外部程序为绝对路径的可执行文件，且在服务端允许的范围内
+func checkProgram(program string) error {
+	if !filepath.IsAbs(program) {
+		return fmt.Errorf("程序路径必须是绝对路径")
+	}
+
+	resolved, err := filepath.EvalSymlinks(program)
+	if err != nil {
+		return fmt.Errorf("程序不存在: %w", err)
+	}
+	if !execAllows(resolved) {
+		return fmt.Errorf("程序 %s 不在允许范围内，需要在启动 letsyncd 时通过 -exec-allow 或 %s 允许", program, EnvExecAllow)
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return fmt.Errorf("程序不存在: %w", err)
+	}
+	if info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("%s 不是可执行文件", program)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package dnsprovider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExecAllowlist(t *testing.T) {
+	t.Cleanup(func() { SetExecAllowlist("") })
+
+	dir := t.TempDir()
+	hooks := filepath.Join(dir, "hooks")
+	other := filepath.Join(dir, "hooks-other")
+	for _, d := range []string{hooks, other} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	allowed := filepath.Join(hooks, "dns.sh")
+	outside := filepath.Join(other, "dns.sh")
+	for _, p := range []string{allowed, outside} {
+		if err := os.WriteFile(p, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(hooks, "escape.sh")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未设置时禁用
+	SetExecAllowlist("")
+	if err := checkProgram(allowed); err == nil {
+		t.Fatal("exec 未启用时应拒绝所有程序")
+	}
+
+	SetExecAllowlist(hooks)
+	if err := checkProgram(allowed); err != nil {
+		t.Fatalf("允许目录下的程序被拒绝: %v", err)
+	}
+	if err := checkProgram(outside); err == nil {
+		t.Fatal("前缀相同的其他目录不应被允许")
+	}
+	if err := checkProgram(link); err == nil {
+		t.Fatal("指向允许目录外的符号链接不应被允许")
+	}
+	if err := checkProgram("/bin/sh"); err == nil {
+		t.Fatal("允许目录外的程序不应被允许")
+	}
+
+	// 也可以直接指定程序
+	SetExecAllowlist(outside)
+	if err := checkProgram(outside); err != nil {
+		t.Fatalf("指定的程序被拒绝: %v", err)
+	}
+	if err := checkProgram(allowed); err == nil {
+		t.Fatal("未指定的程序不应被允许")
+	}
+}
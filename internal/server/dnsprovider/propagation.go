@@ -0,0 +1,210 @@
+package dnsprovider
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/miekg/dns"
+)
+
+// 传播检查范围
+const (
+	PropagationAuthoritative = "authoritative" // 只要求权威 DNS 查到记录（lego 默认行为）
+	PropagationRecursive     = "recursive"     // 同时要求递归 DNS 查到记录
+)
+
+// DefaultPollingInterval 未设置 propagation_interval 时的轮询间隔
+const DefaultPollingInterval = 5 * time.Second
+
+// propagationFields 所有提供商通用的传播检查设置，注册时追加到字段列表末尾
+var propagationFields = []Field{
+	{Key: "propagation_resolvers", Label: "递归 DNS", Type: "string", Help: "检查传播时使用的递归 DNS，逗号分隔，如 10.0.0.53:53；为空使用默认公共 DNS"},
+	{Key: "propagation_check", Label: "传播检查范围", Type: "select", Default: PropagationAuthoritative, Options: []string{PropagationAuthoritative, PropagationRecursive}, Help: "authoritative 只要求权威 DNS 查到记录；recursive 还要求上面的每个递归 DNS 都能查到"},
+	{Key: "propagation_timeout", Label: "传播超时 (秒)", Type: "int", Help: "为空使用系统设置 acme.challenge_timeout"},
+	{Key: "propagation_interval", Label: "轮询间隔 (秒)", Type: "int", Help: "为空使用 5 秒"},
+	{Key: "propagation_skip", Label: "跳过传播检查", Type: "bool", Help: "写入记录后等待一个轮询间隔即通知 CA 验证，适用于本机无法查询权威 DNS 的环境"},
+}
+
+// Propagation 提供商的传播检查设置
+type Propagation struct {
+	Resolvers []string      // 检查传播使用的递归 DNS
+	Recursive bool          // 同时要求递归 DNS 查到记录
+	Timeout   time.Duration // 为 0 使用系统设置
+	Interval  time.Duration // 为 0 使用默认值
+	Skip      bool          // 跳过传播检查
+}
+
+// PropagationSettings 读取提供商的传播检查设置
+func PropagationSettings(providerType string, config Config) Propagation {
+	return Propagation{
+		Resolvers: Nameservers(providerType, config),
+		Recursive: config.String("propagation_check") == PropagationRecursive,
+		Timeout:   configSeconds(config, "propagation_timeout"),
+		Interval:  configSeconds(config, "propagation_interval"),
+		Skip:      config.Bool("propagation_skip"),
+	}
+}
+
+// validatePropagation 校验通用传播检查设置
+func validatePropagation(config Config) error {
+	for _, f := range propagationFields {
+		if f.Type != "int" || config.String(f.Key) == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(config.String(f.Key)); err != nil || n <= 0 {
+			return fmt.Errorf("%s 必须是正整数", f.Label)
+		}
+	}
+	for _, ns := range configResolvers(config) {
+		host, port, err := net.SplitHostPort(ns)
+		if _, perr := strconv.Atoi(port); err != nil || host == "" || perr != nil {
+			return fmt.Errorf("无效的递归 DNS 地址: %s", ns)
+		}
+	}
+	return nil
+}
+
+// configResolvers 解析配置的递归 DNS，省略端口时使用 53
+func configResolvers(config Config) []string {
+	var resolvers []string
+	for _, ns := range strings.FieldsFunc(config.String("propagation_resolvers"), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n'
+	}) {
+		if _, _, err := net.SplitHostPort(ns); err != nil {
+			ns = net.JoinHostPort(strings.Trim(ns, "[]"), "53")
+		}
+		resolvers = append(resolvers, ns)
+	}
+	return resolvers
+}
+
+// configSeconds 读取以秒为单位的时长，未设置或无效时为 0
+func configSeconds(config Config, key string) time.Duration {
+	n, err := strconv.Atoi(config.String(key))
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// Check 按设置检查 TXT 记录传播，check 为 lego 默认的权威 DNS 检查
+// 设置了递归 DNS 时使用这些递归 DNS 查找权威 DNS，不修改 lego 的全局递归 DNS，并发签发的其它证书不受影响
+func (p Propagation) Check(fqdn, value string, check dns01.PreCheckFunc) (bool, error) {
+	if p.Skip {
+		// 给提供商留出一个轮询间隔生效后再通知 CA
+		interval := p.Interval
+		if interval <= 0 {
+			interval = DefaultPollingInterval
+		}
+		time.Sleep(interval)
+		return true, nil
+	}
+	if len(p.Resolvers) == 0 {
+		return check(fqdn, value)
+	}
+
+	// 先通过递归 DNS 跟随 CNAME
+	if r, err := queryResolvers(fqdn, dns.TypeTXT, p.Resolvers); err == nil && r.Rcode == dns.RcodeSuccess {
+		fqdn = followCNAME(r, fqdn)
+	}
+	if p.Recursive {
+		if ok, err := checkRecursive(fqdn, value, p.Resolvers); !ok || err != nil {
+			return false, err
+		}
+	}
+	return checkAuthoritative(fqdn, value, p.Resolvers)
+}
+
+// queryResolvers 依次向递归 DNS 查询，返回第一个成功的响应
+func queryResolvers(name string, qtype uint16, resolvers []string) (*dns.Msg, error) {
+	client := &dns.Client{Timeout: 10 * time.Second}
+	m := new(dns.Msg).SetQuestion(dns.Fqdn(name), qtype)
+	var lastErr error
+	for _, ns := range resolvers {
+		r, _, err := client.Exchange(m, ns)
+		if err == nil {
+			return r, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("查询 %s 失败: %w", name, lastErr)
+}
+
+// followCNAME 返回响应中 fqdn 的 CNAME 目标，没有时返回 fqdn
+func followCNAME(r *dns.Msg, fqdn string) string {
+	for _, rr := range r.Answer {
+		if cn, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cn.Hdr.Name, dns.Fqdn(fqdn)) {
+			return cn.Target
+		}
+	}
+	return fqdn
+}
+
+// checkAuthoritative 通过递归 DNS 找到区域的权威 DNS，要求每个权威 DNS 都能查到 TXT 记录
+func checkAuthoritative(fqdn, value string, resolvers []string) (bool, error) {
+	zone, err := dns01.FindZoneByFqdnCustom(dns.Fqdn(fqdn), resolvers)
+	if err != nil {
+		return false, fmt.Errorf("查找 %s 所属区域失败: %w", fqdn, err)
+	}
+	r, err := queryResolvers(zone, dns.TypeNS, resolvers)
+	if err != nil {
+		return false, err
+	}
+	var authoritative []string
+	for _, rr := range r.Answer {
+		if ns, ok := rr.(*dns.NS); ok {
+			authoritative = append(authoritative, net.JoinHostPort(strings.TrimSuffix(ns.Ns, "."), "53"))
+		}
+	}
+	if len(authoritative) == 0 {
+		return false, fmt.Errorf("未找到区域 %s 的权威 DNS", zone)
+	}
+
+	client := &dns.Client{Timeout: 10 * time.Second}
+	for _, ns := range authoritative {
+		m := new(dns.Msg).SetQuestion(dns.Fqdn(fqdn), dns.TypeTXT)
+		m.RecursionDesired = false
+		r, _, err := client.Exchange(m, ns)
+		if err != nil {
+			return false, fmt.Errorf("查询权威 DNS %s 失败: %w", ns, err)
+		}
+		if r.Rcode != dns.RcodeSuccess {
+			return false, fmt.Errorf("权威 DNS %s 返回 %s", ns, dns.RcodeToString[r.Rcode])
+		}
+		if !hasTXT(r, value) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// hasTXT 响应中是否包含指定值的 TXT 记录
+func hasTXT(r *dns.Msg, value string) bool {
+	for _, rr := range r.Answer {
+		if txt, ok := rr.(*dns.TXT); ok && strings.Join(txt.Txt, "") == value {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRecursive 要求每个递归 DNS 都能查到 TXT 记录，CNAME 由递归 DNS 跟随
+func checkRecursive(fqdn, value string, resolvers []string) (bool, error) {
+	client := &dns.Client{Timeout: 10 * time.Second}
+	for _, ns := range resolvers {
+		m := new(dns.Msg).SetQuestion(dns.Fqdn(fqdn), dns.TypeTXT)
+		r, _, err := client.Exchange(m, ns)
+		if err != nil {
+			return false, fmt.Errorf("查询递归 DNS %s 失败: %w", ns, err)
+		}
+
+		if !hasTXT(r, value) {
+			return false, fmt.Errorf("递归 DNS %s 尚未查到 %s 的 TXT 记录", ns, fqdn)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,447 @@
+package dnsprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/go-acme/lego/v4/providers/dns/alidns"
+	"github.com/go-acme/lego/v4/providers/dns/azuredns"
+	"github.com/go-acme/lego/v4/providers/dns/baiducloud"
+	"github.com/go-acme/lego/v4/providers/dns/bunny"
+	"github.com/go-acme/lego/v4/providers/dns/cloudflare"
+	"github.com/go-acme/lego/v4/providers/dns/desec"
+	"github.com/go-acme/lego/v4/providers/dns/digitalocean"
+	"github.com/go-acme/lego/v4/providers/dns/dnsimple"
+	"github.com/go-acme/lego/v4/providers/dns/duckdns"
+	"github.com/go-acme/lego/v4/providers/dns/dynu"
+	"github.com/go-acme/lego/v4/providers/dns/gandiv5"
+	"github.com/go-acme/lego/v4/providers/dns/gcloud"
+	"github.com/go-acme/lego/v4/providers/dns/godaddy"
+	"github.com/go-acme/lego/v4/providers/dns/hetzner"
+	"github.com/go-acme/lego/v4/providers/dns/huaweicloud"
+	"github.com/go-acme/lego/v4/providers/dns/inwx"
+	"github.com/go-acme/lego/v4/providers/dns/ionos"
+	"github.com/go-acme/lego/v4/providers/dns/linode"
+	"github.com/go-acme/lego/v4/providers/dns/namecheap"
+	"github.com/go-acme/lego/v4/providers/dns/namesilo"
+	"github.com/go-acme/lego/v4/providers/dns/netcup"
+	"github.com/go-acme/lego/v4/providers/dns/ovh"
+	"github.com/go-acme/lego/v4/providers/dns/pdns"
+	"github.com/go-acme/lego/v4/providers/dns/porkbun"
+	"github.com/go-acme/lego/v4/providers/dns/route53"
+	"github.com/go-acme/lego/v4/providers/dns/scaleway"
+	"github.com/go-acme/lego/v4/providers/dns/tencentcloud"
+	"github.com/go-acme/lego/v4/providers/dns/volcengine"
+	"github.com/go-acme/lego/v4/providers/dns/vultr"
+	"github.com/go-acme/lego/v4/providers/dns/westcn"
+	"golang.org/x/oauth2/google"
+	gdns "google.golang.org/api/dns/v1"
+)
+
+func init() {
+	// 最早支持的提供商，类型名和字段名保持不变以兼容已保存的配置
+	Register(&Type{
+		Type: "cloudflare",
+		Name: "Cloudflare",
+		Help: "推荐使用 API Token（需要 Zone:Read 和 DNS:Edit 权限），也可使用 Global API Key + 邮箱",
+		Fields: []Field{
+			{Key: "api_token", Label: "API Token", Type: "string", Secret: true, Help: "与 Global API Key 二选一", legoField: "AuthToken"},
+			{Key: "api_key", Label: "Global API Key", Type: "string", Secret: true, legoField: "AuthKey"},
+			{Key: "email", Label: "Cloudflare 邮箱", Type: "string", Help: "使用 Global API Key 时必填", legoField: "AuthEmail"},
+		},
+		Nameservers: []string{"1.1.1.1:53", "8.8.8.8:53", "223.5.5.5:53"},
+		cleaner:     func(config Config) Cleaner { return newCloudflareAPI(config) },
+		zones:       func(config Config) ZoneLister { return newCloudflareAPI(config) },
+		validate: func(config Config) error {
+			if config.String("api_token") == "" && (config.String("api_key") == "" || config.String("email") == "") {
+				return errors.New("请填写 API Token，或 Global API Key 和邮箱")
+			}
+			return nil
+		},
+		build: legoProvider(cloudflare.NewDefaultConfig, cloudflare.NewDNSProviderConfig, func(c *cloudflare.Config, config Config) error {
+			c.TTL = 120 // DNS 记录 TTL 设置为 2 分钟
+			// 优先使用 API Token
+			if c.AuthToken != "" {
+				c.AuthKey = ""
+				c.AuthEmail = ""
+			}
+			return nil
+		}),
+	})
+
+	Register(&Type{
+		Type: "aliyun",
+		Name: "阿里云 DNS",
+		Fields: []Field{
+			{Key: "access_key_id", Label: "Access Key ID", Type: "string", Required: true, legoField: "APIKey"},
+			{Key: "access_key_secret", Label: "Access Key Secret", Type: "string", Secret: true, Required: true, legoField: "SecretKey"},
+			{Key: "region_id", Label: "Region", Type: "string", Help: "默认 cn-hangzhou", legoField: "RegionID"},
+		},
+		Nameservers: []string{"223.5.5.5:53", "223.6.6.6:53", "8.8.8.8:53"},
+		zones:       newAliyunZones,
+		build:       legoProvider(alidns.NewDefaultConfig, alidns.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "dnspod",
+		Name: "DNSPod（腾讯云）",
+		Help: "使用腾讯云 API 密钥（SecretId/SecretKey）",
+		Fields: []Field{
+			{Key: "api_id", Label: "SecretId", Type: "string", Required: true, legoField: "SecretID"},
+			{Key: "api_token", Label: "SecretKey", Type: "string", Secret: true, Required: true, legoField: "SecretKey"},
+		},
+		Nameservers: []string{"119.29.29.29:53", "223.5.5.5:53", "8.8.8.8:53"},
+		zones:       newDNSPodZones,
+		build:       legoProvider(tencentcloud.NewDefaultConfig, tencentcloud.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "route53",
+		Name: "AWS Route53",
+		Fields: []Field{
+			{Key: "access_key_id", Label: "Access Key ID", Type: "string", Required: true, legoField: "AccessKeyID"},
+			{Key: "secret_access_key", Label: "Secret Access Key", Type: "string", Secret: true, Required: true, legoField: "SecretAccessKey"},
+			{Key: "region", Label: "Region", Type: "string", Default: "us-east-1", legoField: "Region"},
+			{Key: "hosted_zone_id", Label: "Hosted Zone ID", Type: "string", Help: "为空时按域名自动查找", legoField: "HostedZoneID"},
+			{Key: "assume_role_arn", Label: "Assume Role ARN", Type: "string", legoField: "AssumeRoleArn"},
+		},
+		zones: newRoute53Zones,
+		build: legoProvider(route53.NewDefaultConfig, route53.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "godaddy",
+		Name: "GoDaddy",
+		Fields: []Field{
+			{Key: "api_key", Label: "API Key", Type: "string", Secret: true, Required: true, legoField: "APIKey"},
+			{Key: "api_secret", Label: "API Secret", Type: "string", Secret: true, Required: true, legoField: "APISecret"},
+		},
+		zones: newGoDaddyZones,
+		build: legoProvider(godaddy.NewDefaultConfig, godaddy.NewDNSProviderConfig, nil),
+	})
+
+	// 其他 lego 提供商，按名称排序
+	Register(&Type{
+		Type: "azuredns",
+		Name: "Azure DNS",
+		Help: "填写服务主体（Client ID/Secret）时使用客户端密钥认证，否则使用托管标识等默认认证链",
+		Fields: []Field{
+			{Key: "subscription_id", Label: "Subscription ID", Type: "string", Required: true, legoField: "SubscriptionID"},
+			{Key: "resource_group", Label: "Resource Group", Type: "string", Required: true, legoField: "ResourceGroup"},
+			{Key: "tenant_id", Label: "Tenant ID", Type: "string", legoField: "TenantID"},
+			{Key: "client_id", Label: "Client ID", Type: "string", legoField: "ClientID"},
+			{Key: "client_secret", Label: "Client Secret", Type: "string", Secret: true, legoField: "ClientSecret"},
+			{Key: "environment", Label: "环境", Type: "select", Default: "public", Options: []string{"public", "china", "usgovernment"}},
+			{Key: "zone_name", Label: "Zone 名称", Type: "string", Help: "为空时自动发现订阅下的 DNS 区域", legoField: "ZoneName"},
+			{Key: "private_zone", Label: "私有 DNS 区域", Type: "bool", legoField: "PrivateZone"},
+		},
+		zones: newAzureZones,
+		build: legoProvider(azuredns.NewDefaultConfig, azuredns.NewDNSProviderConfig, func(c *azuredns.Config, config Config) error {
+			c.Environment = azureEnvironment(config)
+			if c.ClientID != "" && c.ClientSecret != "" && c.TenantID != "" {
+				c.AuthMethod = "env"
+			}
+			return nil
+		}),
+	})
+
+	Register(&Type{
+		Type: "baiducloud",
+		Name: "百度智能云 DNS",
+		Fields: []Field{
+			{Key: "access_key_id", Label: "Access Key ID", Type: "string", Required: true, legoField: "AccessKeyID"},
+			{Key: "secret_access_key", Label: "Secret Access Key", Type: "string", Secret: true, Required: true, legoField: "SecretAccessKey"},
+		},
+		Nameservers: []string{"180.76.76.76:53", "223.5.5.5:53", "8.8.8.8:53"},
+		build:       legoProvider(baiducloud.NewDefaultConfig, baiducloud.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "bunny",
+		Name: "Bunny DNS",
+		Fields: []Field{
+			{Key: "api_key", Label: "API Key", Type: "string", Secret: true, Required: true, legoField: "APIKey"},
+		},
+		build: legoProvider(bunny.NewDefaultConfig, bunny.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "desec",
+		Name: "deSEC",
+		Fields: []Field{
+			{Key: "token", Label: "Token", Type: "string", Secret: true, Required: true, legoField: "Token"},
+		},
+		build: legoProvider(desec.NewDefaultConfig, desec.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "digitalocean",
+		Name: "DigitalOcean",
+		Fields: []Field{
+			{Key: "auth_token", Label: "API Token", Type: "string", Secret: true, Required: true, legoField: "AuthToken"},
+		},
+		zones: newDigitalOceanZones,
+		build: legoProvider(digitalocean.NewDefaultConfig, digitalocean.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "dnsimple",
+		Name: "DNSimple",
+		Fields: []Field{
+			{Key: "access_token", Label: "Access Token", Type: "string", Secret: true, Required: true, legoField: "AccessToken"},
+		},
+		build: legoProvider(dnsimple.NewDefaultConfig, dnsimple.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "duckdns",
+		Name: "Duck DNS",
+		Fields: []Field{
+			{Key: "token", Label: "Token", Type: "string", Secret: true, Required: true, legoField: "Token"},
+		},
+		build: legoProvider(duckdns.NewDefaultConfig, duckdns.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "dynu",
+		Name: "Dynu",
+		Fields: []Field{
+			{Key: "api_key", Label: "API Key", Type: "string", Secret: true, Required: true, legoField: "APIKey"},
+		},
+		build: legoProvider(dynu.NewDefaultConfig, dynu.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "gandiv5",
+		Name: "Gandi",
+		Fields: []Field{
+			{Key: "personal_access_token", Label: "Personal Access Token", Type: "string", Secret: true, Required: true, legoField: "PersonalAccessToken"},
+		},
+		build: legoProvider(gandiv5.NewDefaultConfig, gandiv5.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "gcloud",
+		Name: "Google Cloud DNS",
+		Help: "服务账号需要 DNS Administrator 角色",
+		Fields: []Field{
+			{Key: "service_account_key", Label: "服务账号密钥 (JSON)", Type: "textarea", Secret: true, Required: true},
+			{Key: "project", Label: "Project ID", Type: "string", Help: "为空时从服务账号密钥读取", legoField: "Project"},
+			{Key: "zone_id", Label: "Zone ID", Type: "string", Help: "为空时按域名自动查找", legoField: "ZoneID"},
+		},
+		zones: newGCloudZones,
+		build: legoProvider(gcloud.NewDefaultConfig, gcloud.NewDNSProviderConfig, func(c *gcloud.Config, config Config) error {
+			project, client, err := gcloudClient(config)
+			if err != nil {
+				return err
+			}
+			c.Project = project
+			c.HTTPClient = client
+			return nil
+		}),
+	})
+
+	Register(&Type{
+		Type: "hetzner",
+		Name: "Hetzner",
+		Help: "使用 Hetzner Console 的 API Token；旧版 DNS Console 使用 API Key",
+		Fields: []Field{
+			{Key: "api_token", Label: "API Token", Type: "string", Secret: true, legoField: "APIToken"},
+			{Key: "api_key", Label: "API Key (旧版)", Type: "string", Secret: true, legoField: "APIKey"},
+		},
+		validate: func(config Config) error {
+			if config.String("api_token") == "" && config.String("api_key") == "" {
+				return errors.New("请填写 API Token 或 API Key")
+			}
+			return nil
+		},
+		build: legoProvider(hetzner.NewDefaultConfig, hetzner.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "huaweicloud",
+		Name: "华为云 DNS",
+		Fields: []Field{
+			{Key: "access_key_id", Label: "Access Key ID", Type: "string", Required: true, legoField: "AccessKeyID"},
+			{Key: "secret_access_key", Label: "Secret Access Key", Type: "string", Secret: true, Required: true, legoField: "SecretAccessKey"},
+			{Key: "region", Label: "Region", Type: "string", Default: "cn-north-4", legoField: "Region"},
+		},
+		build: legoProvider(huaweicloud.NewDefaultConfig, huaweicloud.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "inwx",
+		Name: "INWX",
+		Fields: []Field{
+			{Key: "username", Label: "用户名", Type: "string", Required: true, legoField: "Username"},
+			{Key: "password", Label: "密码", Type: "string", Secret: true, Required: true, legoField: "Password"},
+			{Key: "shared_secret", Label: "两步验证密钥", Type: "string", Secret: true, Help: "启用两步验证时填写", legoField: "SharedSecret"},
+			{Key: "sandbox", Label: "沙盒环境", Type: "bool", legoField: "Sandbox"},
+		},
+		build: legoProvider(inwx.NewDefaultConfig, inwx.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "ionos",
+		Name: "IONOS",
+		Help: "API Key 格式为 prefix.secret",
+		Fields: []Field{
+			{Key: "api_key", Label: "API Key", Type: "string", Secret: true, Required: true, legoField: "APIKey"},
+		},
+		build: legoProvider(ionos.NewDefaultConfig, ionos.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "linode",
+		Name: "Linode (Akamai)",
+		Fields: []Field{
+			{Key: "token", Label: "Personal Access Token", Type: "string", Secret: true, Required: true, legoField: "Token"},
+		},
+		build: legoProvider(linode.NewDefaultConfig, linode.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "namecheap",
+		Name: "Namecheap",
+		Help: "需要在 Namecheap 开启 API 访问并将服务器出口 IP 加入白名单",
+		Fields: []Field{
+			{Key: "api_user", Label: "API 用户名", Type: "string", Required: true, legoField: "APIUser"},
+			{Key: "api_key", Label: "API Key", Type: "string", Secret: true, Required: true, legoField: "APIKey"},
+			{Key: "client_ip", Label: "客户端 IP", Type: "string", Help: "为空时自动检测出口 IP", legoField: "ClientIP"},
+		},
+		build: legoProvider(namecheap.NewDefaultConfig, namecheap.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "namesilo",
+		Name: "NameSilo",
+		Help: "NameSilo 记录生效较慢，建议将验证超时设置为 20 分钟以上",
+		Fields: []Field{
+			{Key: "api_key", Label: "API Key", Type: "string", Secret: true, Required: true, legoField: "APIKey"},
+		},
+		build: legoProvider(namesilo.NewDefaultConfig, namesilo.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "netcup",
+		Name: "netcup",
+		Fields: []Field{
+			{Key: "customer_number", Label: "客户编号", Type: "string", Required: true, legoField: "Customer"},
+			{Key: "api_key", Label: "API Key", Type: "string", Secret: true, Required: true, legoField: "Key"},
+			{Key: "api_password", Label: "API 密码", Type: "string", Secret: true, Required: true, legoField: "Password"},
+		},
+		build: legoProvider(netcup.NewDefaultConfig, netcup.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "ovh",
+		Name: "OVHcloud",
+		Fields: []Field{
+			{Key: "endpoint", Label: "API Endpoint", Type: "select", Default: "ovh-eu", Options: []string{"ovh-eu", "ovh-ca", "ovh-us", "kimsufi-eu", "kimsufi-ca", "soyoustart-eu", "soyoustart-ca"}, legoField: "APIEndpoint"},
+			{Key: "application_key", Label: "Application Key", Type: "string", Required: true, legoField: "ApplicationKey"},
+			{Key: "application_secret", Label: "Application Secret", Type: "string", Secret: true, Required: true, legoField: "ApplicationSecret"},
+			{Key: "consumer_key", Label: "Consumer Key", Type: "string", Secret: true, Required: true, legoField: "ConsumerKey"},
+		},
+		build: legoProvider(ovh.NewDefaultConfig, ovh.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "pdns",
+		Name: "PowerDNS",
+		Fields: []Field{
+			{Key: "api_url", Label: "API 地址", Type: "string", Required: true, Help: "例如 http://pdns.example.com:8081", legoField: "Host"},
+			{Key: "api_key", Label: "API Key", Type: "string", Secret: true, Required: true, legoField: "APIKey"},
+			{Key: "server_name", Label: "Server Name", Type: "string", Default: "localhost", legoField: "ServerName"},
+			{Key: "api_version", Label: "API 版本", Type: "int", Help: "为空时自动检测", legoField: "APIVersion"},
+		},
+		build: legoProvider(pdns.NewDefaultConfig, pdns.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "porkbun",
+		Name: "Porkbun",
+		Fields: []Field{
+			{Key: "api_key", Label: "API Key", Type: "string", Secret: true, Required: true, legoField: "APIKey"},
+			{Key: "secret_api_key", Label: "Secret API Key", Type: "string", Secret: true, Required: true, legoField: "SecretAPIKey"},
+		},
+		build: legoProvider(porkbun.NewDefaultConfig, porkbun.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "scaleway",
+		Name: "Scaleway",
+		Fields: []Field{
+			{Key: "secret_key", Label: "Secret Key", Type: "string", Secret: true, Required: true, legoField: "Token"},
+			{Key: "access_key", Label: "Access Key", Type: "string", legoField: "AccessKey"},
+			{Key: "project_id", Label: "Project ID", Type: "string", legoField: "ProjectID"},
+		},
+		build: legoProvider(scaleway.NewDefaultConfig, scaleway.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "volcengine",
+		Name: "火山引擎 DNS",
+		Fields: []Field{
+			{Key: "access_key", Label: "Access Key", Type: "string", Required: true, legoField: "AccessKey"},
+			{Key: "secret_key", Label: "Secret Key", Type: "string", Secret: true, Required: true, legoField: "SecretKey"},
+			{Key: "region", Label: "Region", Type: "string", Default: "cn-north-1", legoField: "Region"},
+		},
+		build: legoProvider(volcengine.NewDefaultConfig, volcengine.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "vultr",
+		Name: "Vultr",
+		Fields: []Field{
+			{Key: "api_key", Label: "API Key", Type: "string", Secret: true, Required: true, legoField: "APIKey"},
+		},
+		build: legoProvider(vultr.NewDefaultConfig, vultr.NewDNSProviderConfig, nil),
+	})
+
+	Register(&Type{
+		Type: "westcn",
+		Name: "西部数码",
+		Fields: []Field{
+			{Key: "username", Label: "用户名", Type: "string", Required: true, legoField: "Username"},
+			{Key: "api_password", Label: "API 密码", Type: "string", Secret: true, Required: true, legoField: "Password"},
+		},
+		build: legoProvider(westcn.NewDefaultConfig, westcn.NewDNSProviderConfig, nil),
+	})
+}
+
+// azureEnvironment Azure 云环境
+func azureEnvironment(config Config) cloud.Configuration {
+	switch config.String("environment") {
+	case "china":
+		return cloud.AzureChina
+	case "usgovernment":
+		return cloud.AzureGovernment
+	default:
+		return cloud.AzurePublic
+	}
+}
+
+// gcloudClient 根据服务账号密钥创建 HTTP 客户端，未填写 Project ID 时从密钥读取
+func gcloudClient(config Config) (string, *http.Client, error) {
+	saKey := []byte(config.String("service_account_key"))
+	project := config.String("project")
+	if project == "" {
+		var key struct {
+			ProjectID string `json:"project_id"`
+		}
+		if err := json.Unmarshal(saKey, &key); err != nil || key.ProjectID == "" {
+			return "", nil, errors.New("服务账号密钥中没有 project_id，请填写 Project ID")
+		}
+		project = key.ProjectID
+	}
+
+	jwtConfig, err := google.JWTConfigFromJSON(saKey, gdns.NdevClouddnsReadwriteScope)
+	if err != nil {
+		return "", nil, fmt.Errorf("解析服务账号密钥失败: %w", err)
+	}
+	return project, jwtConfig.Client(context.Background()), nil
+}
@@ -0,0 +1,340 @@
+package dnsprovider
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge"
+)
+
+// Field 提供商配置字段说明，前端据此渲染表单
+type Field struct {
+	Key      string   `json:"key"`
+	Label    string   `json:"label"`
+	Type     string   `json:"type"` // string, textarea, int, bool, select
+	Secret   bool     `json:"secret"`
+	Required bool     `json:"required"`
+	Default  string   `json:"default,omitempty"`
+	Options  []string `json:"options,omitempty"` // select 可选值
+	Help     string   `json:"help,omitempty"`
+
+	legoField string // 对应 lego Config 结构体字段名
+}
+
+// Options 创建 Provider 时的通用参数
+type Options struct {
+	PropagationTimeout time.Duration
+	PollingInterval    time.Duration
+}
+
+// Config 解密后的提供商配置
+type Config map[string]interface{}
+
+// String 读取字符串字段并去除首尾空白，数字等类型转换为字符串
+func (c Config) String(key string) string {
+	switch v := c[key].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case nil:
+		return ""
+	default:
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+}
+
+// Bool 读取布尔字段，兼容 "true" 字符串
+func (c Config) Bool(key string) bool {
+	switch v := c[key].(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(strings.TrimSpace(v))
+		return b
+	default:
+		return false
+	}
+}
+
+// builder 根据配置创建 lego Provider
+type builder struct {
+	newConfig func() any // 创建带默认值的 lego Config 结构体，legoField 对应其中的字段
+	create    func(t *Type, config Config, opts Options) (challenge.Provider, error)
+}
+
+// Type DNS 提供商类型
+type Type struct {
+	Type   string  `json:"type"`
+	Name   string  `json:"name"`
+	Fields []Field `json:"fields"`
+	Help   string  `json:"help,omitempty"`
+
+	// ZoneListing 凭据测试时能否列出可管理的区域，不支持时需使用写入测试
+	ZoneListing bool `json:"zone_listing"`
+
+	// Nameservers 检查 TXT 记录传播时优先使用的公共 DNS
+	Nameservers []string `json:"-"`
+
+	nameservers func(config Config) []string // 按配置决定检查传播使用的 DNS（如自建权威服务器）
+	validate    func(config Config) error
+	cleaner     func(config Config) Cleaner    // 原生清理残留记录，为 nil 时只能清理本服务创建的记录
+	zones       func(config Config) ZoneLister // 列出可管理的区域，用于验证凭据
+	build       *builder
+}
+
+// 默认公共 DNS
+var defaultNameservers = []string{"8.8.8.8:53", "1.1.1.1:53", "223.5.5.5:53"}
+
+var (
+	registry      = make(map[string]*Type)
+	registryOrder []string
+	registryMutex sync.RWMutex
+)
+
+// Register 注册提供商类型，重复注册会覆盖
+func Register(t *Type) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, ok := registry[t.Type]; !ok {
+		registryOrder = append(registryOrder, t.Type)
+	}
+	t.Fields = append(t.Fields, propagationFields...)
+	t.ZoneListing = t.zones != nil
+	registry[t.Type] = t
+}
+
+// Get 获取提供商类型
+func Get(providerType string) (*Type, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	t, ok := registry[providerType]
+	return t, ok
+}
+
+// List 按注册顺序列出所有提供商类型
+func List() []*Type {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	types := make([]*Type, 0, len(registryOrder))
+	for _, name := range registryOrder {
+		types = append(types, registry[name])
+	}
+	return types
+}
+
+// Validate 校验提供商类型和配置
+// partial 为 true 时（编辑时未修改的字段）不检查必填项
+func Validate(providerType string, config Config, partial bool) error {
+	t, ok := Get(providerType)
+	if !ok {
+		return fmt.Errorf("不支持的 DNS 提供商类型: %s", providerType)
+	}
+	return t.Validate(config, partial)
+}
+
+// Validate 校验配置字段
+func (t *Type) Validate(config Config, partial bool) error {
+	known := make(map[string]bool, len(t.Fields))
+	for _, f := range t.Fields {
+		known[f.Key] = true
+
+		value := config.String(f.Key)
+		if value == "" {
+			if f.Required && !partial && f.Default == "" {
+				return fmt.Errorf("缺少必填字段: %s", f.Label)
+			}
+			continue
+		}
+
+		switch f.Type {
+		case "int":
+			if _, err := strconv.Atoi(value); err != nil {
+				return fmt.Errorf("%s 必须是整数", f.Label)
+			}
+		case "bool":
+			if _, err := strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("%s 必须是布尔值", f.Label)
+			}
+		case "select":
+			valid := false
+			for _, opt := range f.Options {
+				if opt == value {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return fmt.Errorf("%s 可选值: %s", f.Label, strings.Join(f.Options, ", "))
+			}
+		}
+	}
+
+	for key := range config {
+		if !known[key] {
+			return fmt.Errorf("未知的配置字段: %s", key)
+		}
+	}
+
+	if err := validatePropagation(config); err != nil {
+		return err
+	}
+
+	if t.validate != nil && !partial {
+		return t.validate(config)
+	}
+	return nil
+}
+
+// New 创建 lego DNS Provider
+func New(providerType string, config Config, opts Options) (challenge.Provider, error) {
+	t, ok := Get(providerType)
+	if !ok {
+		return nil, fmt.Errorf("不支持的 DNS 提供商类型: %s", providerType)
+	}
+
+	// 补全默认值
+	merged := make(Config, len(config))
+	for k, v := range config {
+		merged[k] = v
+	}
+	for _, f := range t.Fields {
+		if f.Default != "" && merged.String(f.Key) == "" {
+			merged[f.Key] = f.Default
+		}
+	}
+
+	// 提供商单独设置的传播超时和轮询间隔优先
+	p := PropagationSettings(providerType, merged)
+	if p.Timeout > 0 {
+		opts.PropagationTimeout = p.Timeout
+	}
+	if p.Interval > 0 {
+		opts.PollingInterval = p.Interval
+	}
+
+	return t.build.create(t, merged, opts)
+}
+
+// Nameservers 获取提供商检查传播时使用的 DNS 服务器，优先使用配置的递归 DNS
+func Nameservers(providerType string, config Config) []string {
+	if resolvers := configResolvers(config); len(resolvers) > 0 {
+		return resolvers
+	}
+	t, ok := Get(providerType)
+	if !ok {
+		return defaultNameservers
+	}
+	if t.nameservers != nil {
+		return t.nameservers(config)
+	}
+	if len(t.Nameservers) > 0 {
+		return t.Nameservers
+	}
+	return defaultNameservers
+}
+
+// legoProvider 通用的 lego Provider 构造方式
+// 按字段的 legoField 通过反射写入 Config 结构体，并统一设置传播超时和轮询间隔；
+// adjust 用于处理无法直接映射的字段，可为 nil
+func legoProvider[C any, P challenge.Provider](newConfig func() *C, newProvider func(*C) (P, error), adjust func(*C, Config) error) *builder {
+	create := func(t *Type, config Config, opts Options) (challenge.Provider, error) {
+		cfg := newConfig()
+		v := reflect.ValueOf(cfg).Elem()
+
+		for _, f := range t.Fields {
+			if f.legoField == "" {
+				continue
+			}
+			value := config.String(f.Key)
+			if value == "" {
+				continue
+			}
+			if err := setField(v, f.legoField, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Label, err)
+			}
+		}
+
+		if opts.PropagationTimeout > 0 {
+			setDuration(v, "PropagationTimeout", opts.PropagationTimeout)
+		}
+		if opts.PollingInterval > 0 {
+			setDuration(v, "PollingInterval", opts.PollingInterval)
+		}
+
+		if adjust != nil {
+			if err := adjust(cfg, config); err != nil {
+				return nil, err
+			}
+		}
+
+		provider, err := newProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	}
+	return &builder{
+		newConfig: func() any { return newConfig() },
+		create:    create,
+	}
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	urlType      = reflect.TypeOf(&url.URL{})
+)
+
+// setField 按目标字段类型转换并写入配置值
+func setField(v reflect.Value, name, value string) error {
+	field := v.FieldByName(name)
+	if !field.IsValid() || !field.CanSet() {
+		return fmt.Errorf("lego 配置不存在字段 %s", name)
+	}
+
+	switch {
+	case field.Type() == durationType:
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("必须是秒数")
+		}
+		field.SetInt(int64(time.Duration(seconds) * time.Second))
+	case field.Type() == urlType:
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("无效的 URL")
+		}
+		field.Set(reflect.ValueOf(u))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("必须是布尔值")
+		}
+		field.SetBool(b)
+	case field.CanInt():
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("必须是整数")
+		}
+		field.SetInt(n)
+	default:
+		return fmt.Errorf("不支持的字段类型 %s", field.Type())
+	}
+	return nil
+}
+
+// setDuration 设置时长字段，结构体没有该字段时忽略
+func setDuration(v reflect.Value, name string, d time.Duration) {
+	field := v.FieldByName(name)
+	if field.IsValid() && field.CanSet() && field.Type() == durationType {
+		field.SetInt(int64(d))
+	}
+}
@@ -0,0 +1,67 @@
+package dnsprovider
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestLegoFields 检查每个字段的 legoField 都是 lego Config 中存在且类型可写入的字段，
+// 避免 lego 升级改名后只在创建 Provider 时才报错
+func TestLegoFields(t *testing.T) {
+	for _, typ := range List() {
+		t.Run(typ.Type, func(t *testing.T) {
+			if typ.build == nil {
+				t.Fatal("未设置 Provider 构造方式")
+			}
+			cfg := reflect.ValueOf(typ.build.newConfig())
+			if cfg.Kind() != reflect.Pointer || cfg.Elem().Kind() != reflect.Struct {
+				t.Fatalf("lego 配置应为结构体指针，实际为 %s", cfg.Type())
+			}
+			v := cfg.Elem()
+
+			for _, f := range typ.Fields {
+				if f.legoField == "" {
+					continue
+				}
+				field := v.FieldByName(f.legoField)
+				if !field.IsValid() || !field.CanSet() {
+					t.Errorf("%s: %s 不存在字段 %s", f.Key, v.Type(), f.legoField)
+					continue
+				}
+
+				value := sampleValue(field)
+				if f.Default != "" {
+					value = f.Default
+				} else if len(f.Options) > 0 {
+					value = f.Options[0]
+				}
+				if err := setField(v, f.legoField, value); err != nil {
+					t.Errorf("%s: 写入 %s.%s (%s) 失败: %v", f.Key, v.Type(), f.legoField, field.Type(), err)
+				}
+
+				switch {
+				case field.Kind() == reflect.Bool && f.Type != "bool":
+					t.Errorf("%s: %s 为布尔值，表单类型应为 bool，实际为 %s", f.Key, f.legoField, f.Type)
+				case field.CanInt() && field.Type() != durationType && f.Type != "int":
+					t.Errorf("%s: %s 为整数，表单类型应为 int，实际为 %s", f.Key, f.legoField, f.Type)
+				}
+			}
+		})
+	}
+}
+
+// sampleValue 按 lego 字段类型给出一个可解析的示例值
+func sampleValue(field reflect.Value) string {
+	switch {
+	case field.Type() == durationType:
+		return "60"
+	case field.Type() == urlType:
+		return "https://dns.example.com"
+	case field.Kind() == reflect.Bool:
+		return "true"
+	case field.CanInt():
+		return "1"
+	default:
+		return "example"
+	}
+}
@@ -0,0 +1,117 @@
+package dnsprovider
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/go-acme/lego/v4/providers/dns/rfc2136"
+	"github.com/miekg/dns"
+)
+
+// TSIG 支持的算法
+var tsigAlgorithms = []string{"hmac-sha256", "hmac-sha512", "hmac-sha384", "hmac-sha224", "hmac-sha1"}
+
+func init() {
+	Register(&Type{
+		Type: "rfc2136",
+		Name: "RFC 2136 (BIND/Knot/PowerDNS 动态更新)",
+		Help: "通过 DNS 动态更新 (RFC 2136) 写入 TXT 记录，适用于自建 BIND、Knot 等权威服务器；验证传播时直接查询该服务器",
+		Fields: []Field{
+			{Key: "nameserver", Label: "权威 DNS 服务器", Type: "string", Required: true, Help: "接受动态更新的服务器，如 ns1.example.com:53，省略端口时使用 53", legoField: "Nameserver"},
+			{Key: "tsig_key", Label: "TSIG 密钥名", Type: "string", Help: "服务器未要求签名时可留空", legoField: "TSIGKey"},
+			{Key: "tsig_algorithm", Label: "TSIG 算法", Type: "select", Default: "hmac-sha256", Options: tsigAlgorithms, legoField: "TSIGAlgorithm"},
+			{Key: "tsig_secret", Label: "TSIG 密钥 (Base64)", Type: "string", Secret: true, legoField: "TSIGSecret"},
+		},
+		nameservers: func(config Config) []string {
+			return []string{rfc2136Nameserver(config)}
+		},
+		validate: func(config Config) error {
+			if (config.String("tsig_key") == "") != (config.String("tsig_secret") == "") {
+				return fmt.Errorf("TSIG 密钥名和密钥需要同时填写")
+			}
+			return nil
+		},
+		cleaner: newRFC2136Cleaner,
+		build:   legoProvider(rfc2136.NewDefaultConfig, rfc2136.NewDNSProviderConfig, nil),
+	})
+}
+
+// rfc2136Nameserver 获取带端口的服务器地址
+func rfc2136Nameserver(config Config) string {
+	nameserver := config.String("nameserver")
+	if _, _, err := net.SplitHostPort(nameserver); err != nil {
+		nameserver = net.JoinHostPort(nameserver, "53")
+	}
+	return nameserver
+}
+
+// rfc2136Cleaner 通过动态更新删除 TXT 记录
+type rfc2136Cleaner struct {
+	nameserver string
+	key        string
+	algorithm  string
+	secret     string
+}
+
+func newRFC2136Cleaner(config Config) Cleaner {
+	algorithm := config.String("tsig_algorithm")
+	if algorithm == "" {
+		algorithm = "hmac-sha256"
+	}
+	return &rfc2136Cleaner{
+		nameserver: rfc2136Nameserver(config),
+		key:        config.String("tsig_key"),
+		algorithm:  algorithm,
+		secret:     config.String("tsig_secret"),
+	}
+}
+
+// CleanupTXT 删除 fqdn 上的全部 TXT 记录
+func (c *rfc2136Cleaner) CleanupTXT(fqdn string) (int, error) {
+	fqdn = dns.Fqdn(fqdn)
+	client := &dns.Client{Timeout: 10 * time.Second}
+
+	// 先查询现有记录，没有则无需更新
+	query := new(dns.Msg).SetQuestion(fqdn, dns.TypeTXT)
+	answer, _, err := client.Exchange(query, c.nameserver)
+	if err != nil {
+		return 0, fmt.Errorf("查询 TXT 记录失败: %w", err)
+	}
+	count := 0
+	for _, rr := range answer.Answer {
+		if _, ok := rr.(*dns.TXT); ok {
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	zone, err := dns01.FindZoneByFqdnCustom(fqdn, []string{c.nameserver})
+	if err != nil {
+		return 0, fmt.Errorf("查找 DNS 区域失败: %w", err)
+	}
+
+	m := new(dns.Msg).SetUpdate(zone)
+	m.RemoveRRset([]dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: fqdn, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+	}})
+
+	if c.key != "" && c.secret != "" {
+		key := dns.CanonicalName(c.key)
+		m.SetTsig(key, dns.Fqdn(c.algorithm), 300, time.Now().Unix())
+		client.TsigSecret = map[string]string{key: c.secret}
+	}
+
+	reply, _, err := client.Exchange(m, c.nameserver)
+	if err != nil {
+		return 0, fmt.Errorf("发送动态更新失败: %w", err)
+	}
+	if reply != nil && reply.Rcode != dns.RcodeSuccess {
+		return 0, fmt.Errorf("服务器拒绝动态更新: %s", dns.RcodeToString[reply.Rcode])
+	}
+
+	return count, nil
+}
@@ -0,0 +1,272 @@
+package dnsprovider
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/miekg/dns"
+)
+
+const (
+	testZone       = "example.test."
+	testTSIGKey    = "letsync-key."
+	testTSIGSecret = "c2VjcmV0LXRzaWctc2VjcmV0LWZvci10ZXN0cw=="
+)
+
+// tsigDNS 内存中的权威 DNS 服务器，只接受带有效 TSIG 签名的动态更新
+type tsigDNS struct {
+	addr string
+
+	mu       sync.Mutex
+	records  map[string][]string // fqdn -> TXT 记录
+	updates  int                 // 成功的动态更新次数
+	rejected int                 // 签名无效被拒绝的更新次数
+}
+
+func startTSIGDNS(t *testing.T) *tsigDNS {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动 DNS 服务器失败: %v", err)
+	}
+
+	s := &tsigDNS{
+		addr:    conn.LocalAddr().String(),
+		records: make(map[string][]string),
+	}
+
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        conn,
+		Handler:           s,
+		TsigSecret:        map[string]string{testTSIGKey: testTSIGSecret},
+		NotifyStartedFunc: func() { close(started) },
+		// 默认只接受查询，动态更新会被回复 NOTIMP
+		MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction {
+			if opcode := int(dh.Bits>>11) & 0xF; opcode == dns.OpcodeUpdate {
+				return dns.MsgAccept
+			}
+			return dns.DefaultMsgAcceptFunc(dh)
+		},
+	}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	return s
+}
+
+// set 直接写入 TXT 记录，模拟残留记录
+func (s *tsigDNS) set(fqdn string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[dns.Fqdn(fqdn)] = values
+}
+
+func (s *tsigDNS) txt(fqdn string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.records[dns.Fqdn(fqdn)]...)
+}
+
+func (s *tsigDNS) counts() (updates, rejected int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updates, s.rejected
+}
+
+func (s *tsigDNS) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	s.mu.Lock()
+	switch {
+	case len(r.Question) != 1:
+		m.Rcode = dns.RcodeFormatError
+	case r.Opcode == dns.OpcodeUpdate:
+		if r.IsTsig() == nil || w.TsigStatus() != nil {
+			s.rejected++
+			m.Rcode = dns.RcodeNotAuth
+		} else {
+			m.Rcode = s.update(r)
+		}
+	default:
+		m.Answer = s.answer(r.Question[0])
+	}
+	s.mu.Unlock()
+
+	// 签名的请求需要签名应答，否则客户端无法校验
+	if tsig := r.IsTsig(); tsig != nil && w.TsigStatus() == nil {
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+	}
+	w.WriteMsg(m)
+}
+
+// update 处理 TXT 记录的添加和删除，调用方持有锁
+func (s *tsigDNS) update(r *dns.Msg) int {
+	if !strings.EqualFold(r.Question[0].Name, testZone) {
+		return dns.RcodeNotZone
+	}
+
+	for _, rr := range r.Ns {
+		hdr := rr.Header()
+		if hdr.Rrtype != dns.TypeTXT {
+			continue
+		}
+		name := strings.ToLower(hdr.Name)
+
+		switch hdr.Class {
+		case dns.ClassANY: // 删除整个记录集
+			delete(s.records, name)
+		case dns.ClassNONE: // 删除指定记录
+			value := strings.Join(rr.(*dns.TXT).Txt, "")
+			var kept []string
+			for _, v := range s.records[name] {
+				if v != value {
+					kept = append(kept, v)
+				}
+			}
+			if len(kept) == 0 {
+				delete(s.records, name)
+			} else {
+				s.records[name] = kept
+			}
+		default: // 添加记录
+			s.records[name] = append(s.records[name], strings.Join(rr.(*dns.TXT).Txt, ""))
+		}
+	}
+	s.updates++
+	return dns.RcodeSuccess
+}
+
+// answer 应答 SOA 和 TXT 查询，调用方持有锁
+func (s *tsigDNS) answer(q dns.Question) []dns.RR {
+	name := strings.ToLower(q.Name)
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 60}
+
+	switch q.Qtype {
+	case dns.TypeSOA:
+		if name == testZone {
+			return []dns.RR{&dns.SOA{Hdr: hdr, Ns: "ns." + testZone, Mbox: "hostmaster." + testZone, Serial: 1, Minttl: 60}}
+		}
+	case dns.TypeTXT:
+		var rrs []dns.RR
+		for _, value := range s.records[name] {
+			rrs = append(rrs, &dns.TXT{Hdr: hdr, Txt: []string{value}})
+		}
+		return rrs
+	}
+	return nil
+}
+
+func rfc2136Config(addr, secret string) Config {
+	return Config{
+		"nameserver":     addr,
+		"tsig_key":       strings.TrimSuffix(testTSIGKey, "."),
+		"tsig_algorithm": "hmac-sha256",
+		"tsig_secret":    secret,
+	}
+}
+
+// TestRFC2136PresentCleanUp 通过 TSIG 签名的动态更新写入和删除验证记录
+func TestRFC2136PresentCleanUp(t *testing.T) {
+	t.Setenv("RFC2136_SEQUENCE_INTERVAL", "0")
+	server := startTSIGDNS(t)
+
+	p, err := New("rfc2136", rfc2136Config(server.addr, testTSIGSecret), Options{})
+	if err != nil {
+		t.Fatalf("创建提供商失败: %v", err)
+	}
+
+	const domain, token, keyAuth = "www.example.test", "token", "token.thumbprint"
+	fqdn := ChallengeFQDN(domain)
+	value := dns01.GetChallengeInfo(domain, keyAuth).Value
+
+	if err := p.Present(domain, token, keyAuth); err != nil {
+		t.Fatalf("Present 失败: %v", err)
+	}
+	if got := server.txt(fqdn); len(got) != 1 || got[0] != value {
+		t.Fatalf("写入后 TXT 记录为 %v，期望 [%s]", got, value)
+	}
+
+	// 同名的其他记录（如并发订单）不受 CleanUp 影响
+	server.set(fqdn, value, "other")
+	if err := p.CleanUp(domain, token, keyAuth); err != nil {
+		t.Fatalf("CleanUp 失败: %v", err)
+	}
+	if got := server.txt(fqdn); len(got) != 1 || got[0] != "other" {
+		t.Fatalf("删除后 TXT 记录为 %v，期望 [other]", got)
+	}
+
+	if updates, rejected := server.counts(); updates != 2 || rejected != 0 {
+		t.Fatalf("动态更新 %d 次、拒绝 %d 次，期望 2 次、0 次", updates, rejected)
+	}
+}
+
+// TestRFC2136WrongSecret TSIG 密钥错误时服务器拒绝更新
+func TestRFC2136WrongSecret(t *testing.T) {
+	t.Setenv("RFC2136_SEQUENCE_INTERVAL", "0")
+	server := startTSIGDNS(t)
+
+	p, err := New("rfc2136", rfc2136Config(server.addr, "d3Jvbmctc2VjcmV0"), Options{})
+	if err != nil {
+		t.Fatalf("创建提供商失败: %v", err)
+	}
+	if err := p.Present("www.example.test", "token", "token.thumbprint"); err == nil {
+		t.Fatal("TSIG 密钥错误时 Present 应失败")
+	}
+	if got := server.txt(ChallengeFQDN("www.example.test")); len(got) != 0 {
+		t.Fatalf("TSIG 密钥错误时不应写入记录，实际为 %v", got)
+	}
+	if _, rejected := server.counts(); rejected == 0 {
+		t.Fatal("服务器未收到签名无效的更新")
+	}
+}
+
+// TestRFC2136Cleaner 清理器删除记录名下的整个 TXT 记录集
+func TestRFC2136Cleaner(t *testing.T) {
+	server := startTSIGDNS(t)
+	fqdn := ChallengeFQDN("example.test")
+	server.set(fqdn, "stale-1", "stale-2")
+
+	cleaner := NewCleaner("rfc2136", rfc2136Config(server.addr, testTSIGSecret))
+	if cleaner == nil {
+		t.Fatal("rfc2136 应支持原生清理")
+	}
+
+	removed, err := cleaner.CleanupTXT(fqdn)
+	if err != nil {
+		t.Fatalf("清理失败: %v", err)
+	}
+	if removed != 2 {
+		t.Fatalf("删除 %d 条记录，期望 2 条", removed)
+	}
+	if got := server.txt(fqdn); len(got) != 0 {
+		t.Fatalf("清理后仍有记录 %v", got)
+	}
+
+	// 没有记录时不发送更新
+	removed, err = cleaner.CleanupTXT(fqdn)
+	if err != nil || removed != 0 {
+		t.Fatalf("再次清理返回 %d, %v，期望 0, nil", removed, err)
+	}
+	if updates, rejected := server.counts(); updates != 1 || rejected != 0 {
+		t.Fatalf("动态更新 %d 次、拒绝 %d 次，期望 1 次、0 次", updates, rejected)
+	}
+
+	// 密钥错误时报告服务器拒绝
+	server.set(fqdn, "stale")
+	bad := NewCleaner("rfc2136", rfc2136Config(server.addr, "d3Jvbmctc2VjcmV0"))
+	if _, err := bad.CleanupTXT(fqdn); err == nil {
+		t.Fatal("TSIG 密钥错误时清理应失败")
+	}
+	if got := server.txt(fqdn); len(got) != 1 {
+		t.Fatalf("清理失败时记录应保留，实际为 %v", got)
+	}
+}
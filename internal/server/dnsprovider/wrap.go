@@ -0,0 +1,64 @@
+package dnsprovider
+
+import (
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/challenge/dns01"
+)
+
+// wrapped 替换了 Present/CleanUp 的 Provider
+type wrapped struct {
+	inner   challenge.Provider
+	present func(domain, token, keyAuth string) error
+	cleanup func(domain, token, keyAuth string) error
+}
+
+func (p *wrapped) Present(domain, token, keyAuth string) error {
+	return p.present(domain, token, keyAuth)
+}
+
+func (p *wrapped) CleanUp(domain, token, keyAuth string) error {
+	return p.cleanup(domain, token, keyAuth)
+}
+
+// Timeout 沿用内部 Provider 的传播超时，未实现时使用 lego 默认值
+func (p *wrapped) Timeout() (timeout, interval time.Duration) {
+	if t, ok := p.inner.(challenge.ProviderTimeout); ok {
+		return t.Timeout()
+	}
+	return dns01.DefaultPropagationTimeout, dns01.DefaultPollingInterval
+}
+
+// sequential lego 用于判断 Provider 是否需要逐个处理授权的接口
+type sequential interface {
+	Sequential() time.Duration
+}
+
+// wrappedSequential 保留内部 Provider 的串行要求
+type wrappedSequential struct {
+	*wrapped
+}
+
+func (p *wrappedSequential) Sequential() time.Duration {
+	return p.inner.(sequential).Sequential()
+}
+
+// Wrap 替换 Provider 的 Present/CleanUp，保留内部 Provider 的传播超时和串行要求
+func Wrap(inner challenge.Provider, present, cleanup func(domain, token, keyAuth string) error) challenge.Provider {
+	w := &wrapped{inner: inner, present: present, cleanup: cleanup}
+	if _, ok := inner.(sequential); ok {
+		return &wrappedSequential{w}
+	}
+	return w
+}
+
+// Alias 将 challenge 记录写入 _acme-challenge.<alias>
+// 用于 _acme-challenge.<域名> 通过 CNAME 委派到专用验证区域的场景，
+// TXT 记录值只取决于 keyAuth，写入别名后 CA 沿 CNAME 即可查到
+func Alias(p challenge.Provider, alias string) challenge.Provider {
+	return Wrap(p,
+		func(_, token, keyAuth string) error { return p.Present(alias, token, keyAuth) },
+		func(_, token, keyAuth string) error { return p.CleanUp(alias, token, keyAuth) },
+	)
+}
@@ -0,0 +1,102 @@
+package dnsprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ZoneLister 可列出凭据可管理区域的提供商，用于测试凭据
+type ZoneLister interface {
+	// ListZones 返回区域名称（不带末尾的点）
+	ListZones() ([]string, error)
+}
+
+// NewZoneLister 获取提供商的区域列表实现，不支持时返回 nil
+func NewZoneLister(providerType string, config Config) ZoneLister {
+	t, ok := Get(providerType)
+	if !ok || t.zones == nil {
+		return nil
+	}
+	return t.zones(config)
+}
+
+// zoneListerFunc 函数形式的 ZoneLister
+type zoneListerFunc func() ([]string, error)
+
+func (f zoneListerFunc) ListZones() ([]string, error) { return f() }
+
+var zonesClient = &http.Client{Timeout: 30 * time.Second}
+
+// getJSON 发送 GET 请求并解析 JSON 响应，非 2xx 视为失败
+func getJSON(rawURL string, header http.Header, result interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := zonesClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, body)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func newDigitalOceanZones(config Config) ZoneLister {
+	return zoneListerFunc(func() ([]string, error) {
+		header := http.Header{}
+		header.Set("Authorization", "Bearer "+config.String("auth_token"))
+
+		var names []string
+		next := "https://api.digitalocean.com/v2/domains?per_page=200"
+		for next != "" {
+			var resp struct {
+				Domains []struct {
+					Name string `json:"name"`
+				} `json:"domains"`
+				Links struct {
+					Pages struct {
+						Next string `json:"next"`
+					} `json:"pages"`
+				} `json:"links"`
+			}
+			if err := getJSON(next, header, &resp); err != nil {
+				return nil, err
+			}
+			for _, d := range resp.Domains {
+				names = append(names, d.Name)
+			}
+			next = resp.Links.Pages.Next
+		}
+		return names, nil
+	})
+}
+
+func newGoDaddyZones(config Config) ZoneLister {
+	return zoneListerFunc(func() ([]string, error) {
+		header := http.Header{}
+		header.Set("Authorization", fmt.Sprintf("sso-key %s:%s", config.String("api_key"), config.String("api_secret")))
+
+		var domains []struct {
+			Domain string `json:"domain"`
+		}
+		if err := getJSON("https://api.godaddy.com/v1/domains?statuses=ACTIVE&limit=1000", header, &domains); err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(domains))
+		for _, d := range domains {
+			names = append(names, d.Domain)
+		}
+		return names, nil
+	})
+}
@@ -0,0 +1,259 @@
+package dnsprovider
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/dns/armdns"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	alidns "github.com/go-acme/alidns-20150109/v4/client"
+	dnspod "github.com/go-acme/tencentclouddnspod/v20210323"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
+	gdns "google.golang.org/api/dns/v1"
+	"google.golang.org/api/option"
+)
+
+// 以下提供商通过各自的 SDK 列出区域，认证方式与 lego 创建 Provider 时一致
+
+func newRoute53Zones(config Config) ZoneLister {
+	return zoneListerFunc(func() ([]string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), zonesClient.Timeout)
+		defer cancel()
+
+		// Route53 是全局服务，未填写 Region 时使用 us-east-1
+		region := config.String("region")
+		if region == "" {
+			region = "us-east-1"
+		}
+		cfg, err := awsconfig.LoadDefaultConfig(ctx,
+			awsconfig.WithRegion(region),
+			awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+				config.String("access_key_id"), config.String("secret_access_key"), "")),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if arn := config.String("assume_role_arn"); arn != "" {
+			cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), arn))
+		}
+		client := route53.NewFromConfig(cfg)
+
+		// 指定了 Hosted Zone 时凭据可能只有该区域的权限
+		if id := config.String("hosted_zone_id"); id != "" {
+			out, err := client.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: aws.String(id)})
+			if err != nil {
+				return nil, err
+			}
+			return []string{strings.TrimSuffix(aws.ToString(out.HostedZone.Name), ".")}, nil
+		}
+
+		var names []string
+		paginator := route53.NewListHostedZonesPaginator(client, &route53.ListHostedZonesInput{})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, zone := range page.HostedZones {
+				if zone.Config != nil && zone.Config.PrivateZone {
+					continue
+				}
+				names = append(names, strings.TrimSuffix(aws.ToString(zone.Name), "."))
+			}
+		}
+		return names, nil
+	})
+}
+
+func newAliyunZones(config Config) ZoneLister {
+	return zoneListerFunc(func() ([]string, error) {
+		region := config.String("region_id")
+		if region == "" {
+			region = "cn-hangzhou"
+		}
+		cfg := new(openapi.Config).
+			SetRegionId(region).
+			SetAccessKeyId(config.String("access_key_id")).
+			SetAccessKeySecret(config.String("access_key_secret")).
+			SetReadTimeout(int(zonesClient.Timeout.Milliseconds()))
+		client, err := alidns.NewClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for page := int64(1); ; page++ {
+			req := new(alidns.DescribeDomainsRequest).SetPageNumber(page).SetPageSize(100)
+			resp, err := alidns.DescribeDomains(client, req)
+			if err != nil {
+				return nil, err
+			}
+			if resp.Body == nil || resp.Body.Domains == nil {
+				break
+			}
+			for _, d := range resp.Body.Domains.Domain {
+				if d.DomainName != nil {
+					names = append(names, *d.DomainName)
+				}
+			}
+			if len(resp.Body.Domains.Domain) == 0 || int64(len(names)) >= derefInt64(resp.Body.TotalCount) {
+				break
+			}
+		}
+		return names, nil
+	})
+}
+
+func newDNSPodZones(config Config) ZoneLister {
+	return zoneListerFunc(func() ([]string, error) {
+		cpf := profile.NewClientProfile()
+		cpf.HttpProfile.Endpoint = "dnspod.tencentcloudapi.com"
+		cpf.HttpProfile.ReqTimeout = int(zonesClient.Timeout.Seconds())
+		client, err := dnspod.NewClient(common.NewCredential(config.String("api_id"), config.String("api_token")), "", cpf)
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for offset := int64(0); ; {
+			req := dnspod.NewDescribeDomainListRequest()
+			req.Offset = &offset
+			req.Limit = common.Int64Ptr(3000)
+			resp, err := dnspod.DescribeDomainList(client, req)
+			if err != nil {
+				// 账号下没有域名时接口返回错误码而不是空列表
+				if strings.Contains(err.Error(), "ResourceNotFound.NoDataOfDomain") {
+					return []string{}, nil
+				}
+				return nil, err
+			}
+			items := resp.Response.DomainList
+			for _, d := range items {
+				if d.Name != nil {
+					names = append(names, *d.Name)
+				}
+			}
+			offset += int64(len(items))
+			total := uint64(0)
+			if resp.Response.DomainCountInfo != nil && resp.Response.DomainCountInfo.AllTotal != nil {
+				total = *resp.Response.DomainCountInfo.AllTotal
+			}
+			if len(items) == 0 || uint64(offset) >= total {
+				break
+			}
+		}
+		return names, nil
+	})
+}
+
+func newGCloudZones(config Config) ZoneLister {
+	return zoneListerFunc(func() ([]string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), zonesClient.Timeout)
+		defer cancel()
+
+		project, client, err := gcloudClient(config)
+		if err != nil {
+			return nil, err
+		}
+		svc, err := gdns.NewService(ctx, option.WithHTTPClient(client))
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		err = svc.ManagedZones.List(project).Pages(ctx, func(page *gdns.ManagedZonesListResponse) error {
+			for _, zone := range page.ManagedZones {
+				if zone.Visibility == "private" {
+					continue
+				}
+				names = append(names, strings.TrimSuffix(zone.DnsName, "."))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return names, nil
+	})
+}
+
+func newAzureZones(config Config) ZoneLister {
+	return zoneListerFunc(func() ([]string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), zonesClient.Timeout)
+		defer cancel()
+
+		env := azureEnvironment(config)
+		clientOptions := azcore.ClientOptions{Cloud: env}
+		var cred azcore.TokenCredential
+		var err error
+		if config.String("tenant_id") != "" && config.String("client_id") != "" && config.String("client_secret") != "" {
+			cred, err = azidentity.NewClientSecretCredential(config.String("tenant_id"), config.String("client_id"), config.String("client_secret"),
+				&azidentity.ClientSecretCredentialOptions{ClientOptions: clientOptions})
+		} else {
+			cred, err = azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{ClientOptions: clientOptions})
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		options := &arm.ClientOptions{ClientOptions: clientOptions}
+		subscription, group := config.String("subscription_id"), config.String("resource_group")
+
+		var names []string
+		if config.Bool("private_zone") {
+			client, err := armprivatedns.NewPrivateZonesClient(subscription, cred, options)
+			if err != nil {
+				return nil, err
+			}
+			pager := client.NewListByResourceGroupPager(group, nil)
+			for pager.More() {
+				page, err := pager.NextPage(ctx)
+				if err != nil {
+					return nil, err
+				}
+				for _, zone := range page.Value {
+					if zone.Name != nil {
+						names = append(names, *zone.Name)
+					}
+				}
+			}
+			return names, nil
+		}
+
+		client, err := armdns.NewZonesClient(subscription, cred, options)
+		if err != nil {
+			return nil, err
+		}
+		pager := client.NewListByResourceGroupPager(group, nil)
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, zone := range page.Value {
+				if zone.Name != nil {
+					names = append(names, *zone.Name)
+				}
+			}
+		}
+		return names, nil
+	})
+}
+
+func derefInt64(p *int64) int64 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
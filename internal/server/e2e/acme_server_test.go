@@ -0,0 +1,168 @@
+package e2e
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// acmeClient 直接构造 JWS 请求的最小 ACME 客户端，用于测试 lego 不支持的接口
+type acmeClient struct {
+	t         *testing.T
+	http      *http.Client
+	directory map[string]interface{}
+	key       crypto.Signer
+	kid       string
+}
+
+func newACMEClient(t *testing.T, directoryURL string) *acmeClient {
+	t.Helper()
+
+	c := &acmeClient{
+		t: t,
+		// 测试服务器使用自签名证书
+		http: &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}},
+		key:  newECKey(t),
+	}
+	resp, err := c.http.Get(directoryURL)
+	if err != nil {
+		t.Fatalf("获取 ACME 目录失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&c.directory); err != nil {
+		t.Fatalf("解析 ACME 目录失败: %v", err)
+	}
+	return c
+}
+
+func newECKey(t *testing.T) crypto.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	return key
+}
+
+// url 目录中的地址
+func (c *acmeClient) url(name string) string {
+	url, _ := c.directory[name].(string)
+	if url == "" {
+		c.t.Fatalf("ACME 目录缺少 %s", name)
+	}
+	return url
+}
+
+// Nonce 实现 jose.NonceSource
+func (c *acmeClient) Nonce() (string, error) {
+	resp, err := c.http.Head(c.url("newNonce"))
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("Replay-Nonce"), nil
+}
+
+// sign 使用 key 签名；kid 为空时在请求头中携带 jwk，nonce 为 nil 时不带 nonce（keyChange 内层 JWS）
+func sign(t *testing.T, key crypto.Signer, kid, url string, nonce jose.NonceSource, payload []byte) []byte {
+	t.Helper()
+
+	opts := &jose.SignerOptions{NonceSource: nonce, ExtraHeaders: map[jose.HeaderKey]interface{}{"url": url}}
+	if kid != "" {
+		opts.ExtraHeaders[jose.HeaderKey("kid")] = kid
+	} else {
+		opts.EmbedJWK = true
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, opts)
+	if err != nil {
+		t.Fatalf("创建签名失败: %v", err)
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	return []byte(jws.FullSerialize())
+}
+
+// post 发送 JWS 请求，返回响应和响应内容
+func (c *acmeClient) post(url string, key crypto.Signer, kid string, payload []byte) (*http.Response, string) {
+	c.t.Helper()
+
+	resp, err := c.http.Post(url, "application/jose+json", strings.NewReader(string(sign(c.t, key, kid, url, c, payload))))
+	if err != nil {
+		c.t.Fatalf("请求 %s 失败: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+// register 使用 key 注册或查找账号，账号 URL 在 Location 响应头中
+func (c *acmeClient) register(key crypto.Signer, onlyReturnExisting bool) (*http.Response, string) {
+	c.t.Helper()
+
+	payload, _ := json.Marshal(map[string]interface{}{"termsOfServiceAgreed": true, "onlyReturnExisting": onlyReturnExisting})
+	return c.post(c.url("newAccount"), key, "", payload)
+}
+
+// TestACMEServerKeyChange 账号更换公钥后只能使用新公钥签名
+func TestACMEServerKeyChange(t *testing.T) {
+	h := newHarness(t)
+	if h.external {
+		t.Skip("只测试内置 ACME 服务端")
+	}
+
+	c := newACMEClient(t, h.caURL)
+	resp, body := c.register(c.key, false)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("注册账号返回 %d: %s", resp.StatusCode, body)
+	}
+	c.kid = resp.Header.Get("Location")
+
+	newKey := newECKey(t)
+	keyChangeURL := c.url("keyChange")
+	oldJWK, _ := json.Marshal(jose.JSONWebKey{Key: c.key.Public()})
+	inner, _ := json.Marshal(map[string]interface{}{"account": c.kid, "oldKey": json.RawMessage(oldJWK)})
+
+	// 内层 JWS 的 url 必须与外层一致
+	resp, body = c.post(keyChangeURL, c.key, c.kid, sign(t, newKey, "", c.kid, nil, inner))
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "malformed") {
+		t.Errorf("内层 url 不一致时返回 %d: %s", resp.StatusCode, body)
+	}
+
+	resp, body = c.post(keyChangeURL, c.key, c.kid, sign(t, newKey, "", keyChangeURL, nil, inner))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("更换公钥返回 %d: %s", resp.StatusCode, body)
+	}
+
+	// 旧公钥不能再签名，新公钥可以
+	if resp, body := c.post(c.kid, c.key, c.kid, []byte("")); resp.StatusCode == http.StatusOK {
+		t.Errorf("旧公钥签名的请求应失败: %s", body)
+	}
+	if resp, body := c.post(c.kid, newKey, c.kid, []byte("")); resp.StatusCode != http.StatusOK {
+		t.Errorf("新公钥签名的请求返回 %d: %s", resp.StatusCode, body)
+	}
+	resp, body = c.register(newKey, true)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Location") != c.kid {
+		t.Errorf("按新公钥查找账号返回 %d (%s): %s", resp.StatusCode, resp.Header.Get("Location"), body)
+	}
+
+	// 新公钥已被其他账号使用时返回 409 和该账号地址
+	otherKey := newECKey(t)
+	resp, _ = c.register(otherKey, false)
+	other := resp.Header.Get("Location")
+	newJWK, _ := json.Marshal(jose.JSONWebKey{Key: newKey.Public()})
+	inner, _ = json.Marshal(map[string]interface{}{"account": c.kid, "oldKey": json.RawMessage(newJWK)})
+	resp, body = c.post(keyChangeURL, newKey, c.kid, sign(t, otherKey, "", keyChangeURL, nil, inner))
+	if resp.StatusCode != http.StatusConflict || resp.Header.Get("Location") != other {
+		t.Errorf("公钥冲突时返回 %d (%s): %s", resp.StatusCode, resp.Header.Get("Location"), body)
+	}
+}
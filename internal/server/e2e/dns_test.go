@@ -0,0 +1,190 @@
+package e2e
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// fakeDNS 内存中的权威 DNS 服务器，接受 RFC 2136 动态更新并应答 SOA/TXT 查询
+// 同时充当 rfc2136 提供商的更新目标和 ACME 服务端验证 dns-01 使用的 DNS
+type fakeDNS struct {
+	addr string
+
+	mu      sync.Mutex
+	zones   map[string]bool     // 区域 -> 是否接受动态更新
+	records map[string][]string // fqdn -> TXT 记录
+	updates int                 // 成功的动态更新次数
+	server  *dns.Server
+}
+
+// startFakeDNS 在 addr 上启动 DNS 服务器，addr 为空时使用随机端口
+func startFakeDNS(t *testing.T, addr string) *fakeDNS {
+	t.Helper()
+
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Fatalf("启动 DNS 服务器失败: %v", err)
+	}
+
+	f := &fakeDNS{
+		addr:    conn.LocalAddr().String(),
+		zones:   make(map[string]bool),
+		records: make(map[string][]string),
+	}
+
+	started := make(chan struct{})
+	f.server = &dns.Server{
+		PacketConn:        conn,
+		Handler:           f,
+		NotifyStartedFunc: func() { close(started) },
+		// 默认只接受查询，动态更新会被回复 NOTIMP
+		MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction {
+			if opcode := int(dh.Bits>>11) & 0xF; opcode == dns.OpcodeUpdate {
+				return dns.MsgAccept
+			}
+			return dns.DefaultMsgAcceptFunc(dh)
+		},
+	}
+	go f.server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { f.server.Shutdown() })
+
+	return f
+}
+
+// addZone 添加区域，writable 为 false 时拒绝动态更新
+func (f *fakeDNS) addZone(zone string, writable bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.zones[dns.Fqdn(strings.ToLower(zone))] = writable
+}
+
+// recordCount 当前 TXT 记录总数
+func (f *fakeDNS) recordCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, values := range f.records {
+		n += len(values)
+	}
+	return n
+}
+
+// updateCount 成功的动态更新次数
+func (f *fakeDNS) updateCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.updates
+}
+
+func (f *fakeDNS) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	f.mu.Lock()
+	if len(r.Question) == 1 {
+		if r.Opcode == dns.OpcodeUpdate {
+			m.Rcode = f.update(r)
+		} else {
+			m.Answer = f.answer(r.Question[0])
+		}
+	} else {
+		m.Rcode = dns.RcodeFormatError
+	}
+	f.mu.Unlock()
+
+	w.WriteMsg(m)
+}
+
+// update 处理动态更新，调用方持有锁
+func (f *fakeDNS) update(r *dns.Msg) int {
+	zone := strings.ToLower(r.Question[0].Name)
+	if writable, ok := f.zones[zone]; !ok {
+		return dns.RcodeNotZone
+	} else if !writable {
+		return dns.RcodeRefused
+	}
+
+	for _, rr := range r.Ns {
+		hdr := rr.Header()
+		name := strings.ToLower(hdr.Name)
+		if hdr.Rrtype != dns.TypeTXT && hdr.Rrtype != dns.TypeANY {
+			continue
+		}
+
+		switch hdr.Class {
+		case dns.ClassANY: // 删除整个记录集
+			delete(f.records, name)
+		case dns.ClassNONE: // 删除指定记录
+			txt, ok := rr.(*dns.TXT)
+			if !ok {
+				continue
+			}
+			value := strings.Join(txt.Txt, "")
+			var kept []string
+			for _, v := range f.records[name] {
+				if v != value {
+					kept = append(kept, v)
+				}
+			}
+			if len(kept) == 0 {
+				delete(f.records, name)
+			} else {
+				f.records[name] = kept
+			}
+		default: // 添加记录
+			txt, ok := rr.(*dns.TXT)
+			if !ok {
+				continue
+			}
+			value := strings.Join(txt.Txt, "")
+			exists := false
+			for _, v := range f.records[name] {
+				exists = exists || v == value
+			}
+			if !exists {
+				f.records[name] = append(f.records[name], value)
+			}
+		}
+	}
+	f.updates++
+	return dns.RcodeSuccess
+}
+
+// answer 应答 SOA 和 TXT 查询，调用方持有锁
+func (f *fakeDNS) answer(q dns.Question) []dns.RR {
+	name := strings.ToLower(q.Name)
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 60}
+
+	switch q.Qtype {
+	case dns.TypeSOA:
+		if _, ok := f.zones[name]; ok {
+			return []dns.RR{&dns.SOA{
+				Hdr:     hdr,
+				Ns:      "ns." + name,
+				Mbox:    "hostmaster." + name,
+				Serial:  1,
+				Refresh: 3600,
+				Retry:   600,
+				Expire:  86400,
+				Minttl:  60,
+			}}
+		}
+	case dns.TypeTXT:
+		var rrs []dns.RR
+		for _, value := range f.records[name] {
+			rrs = append(rrs, &dns.TXT{Hdr: hdr, Txt: []string{value}})
+		}
+		return rrs
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+// Package e2e 端到端测试：以私有 CA 工作区的内置 ACME 服务端作为本地 CA，
+// 配合内存中的 RFC 2136 DNS 服务器，完整走通证书申请、定时续期、失败重试和吊销流程。
+// 测试不访问外部网络，可离线运行：
+//
+//	go test ./internal/server/e2e/
+//
+// 设置 LETSYNC_E2E_ACME_URL 时改为连接外部 ACME 服务器（如 Pebble、step-ca），
+// LEGO_CA_CERTIFICATES 需指向其 HTTPS 根证书；DNS 验证仍使用本地 DNS 服务器，
+// 可通过 LETSYNC_E2E_DNS_ADDR 固定监听地址，供外部 CA 查询（如 Pebble 的 -dnsserver）。
+package e2e
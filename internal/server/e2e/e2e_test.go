@@ -0,0 +1,260 @@
+package e2e
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/BlakeLiAFK/letsync/internal/server/scheduler"
+	"github.com/BlakeLiAFK/letsync/internal/server/service"
+	"github.com/BlakeLiAFK/letsync/internal/server/store"
+)
+
+// TestIssueDNS01 通配符和根域名通过 rfc2136 提供商完成 dns-01 验证
+func TestIssueDNS01(t *testing.T) {
+	h := newHarness(t)
+
+	cert := h.createCert("*."+testZone, []string{testZone}, "dns-01")
+	taskID, err := h.issue(cert.ID)
+	if err != nil {
+		t.Fatalf("签发证书失败: %v\n%s", err, h.taskLogText(taskID))
+	}
+
+	status, err := h.taskLog.GetTaskStatusByTaskID(taskID)
+	if err != nil || status == nil {
+		t.Fatalf("查询任务状态失败: %v", err)
+	}
+	if status.Status != "completed" || status.EndTime == nil {
+		t.Errorf("任务状态为 %s，期望 completed", status.Status)
+	}
+	h.assertTaskLogs(taskID, "info",
+		"开始执行任务",
+		"使用 DNS 提供商: fake-dns (rfc2136)",
+		"证书申请成功",
+	)
+
+	cert = h.cert(cert.ID)
+	if cert.Status != "valid" {
+		t.Errorf("证书状态为 %s，期望 valid", cert.Status)
+	}
+	if cert.Fingerprint == "" || len(cert.KeyPEM) == 0 {
+		t.Error("证书指纹或私钥未保存")
+	}
+	leaf := h.verifyCert(cert, "*."+testZone, testZone)
+	if !cert.ExpiresAt.Equal(leaf.NotAfter) {
+		t.Errorf("到期时间 %v 与证书 %v 不一致", cert.ExpiresAt, leaf.NotAfter)
+	}
+
+	// 验证记录已写入并全部清理
+	if h.dns.updateCount() == 0 {
+		t.Error("未收到 DNS 动态更新")
+	}
+	if n := h.dns.recordCount(); n != 0 {
+		t.Errorf("验证结束后仍有 %d 条 TXT 记录", n)
+	}
+	var tracked int64
+	store.GetDB().Model(&model.DNSChallengeRecord{}).Count(&tracked)
+	if tracked != 0 {
+		t.Errorf("验证结束后仍有 %d 条待清理的 challenge 记录", tracked)
+	}
+}
+
+// TestIssueHTTP01IPAddress IP 证书通过 http-01 验证，直接调用 RequestCertificateWithChallenge
+func TestIssueHTTP01IPAddress(t *testing.T) {
+	h := newHarness(t)
+	if h.external {
+		t.Skip("外部 ACME 服务器无法连接本地 http-01 端口")
+	}
+
+	resource, err := h.acme.RequestCertificateWithChallenge(service.CertRequest{
+		Domain:        "127.0.0.1",
+		ChallengeType: "http-01",
+		WorkspaceID:   &h.workspace.ID,
+	})
+	if err != nil {
+		t.Fatalf("签发证书失败: %v", err)
+	}
+	if len(resource.PrivateKey) == 0 || len(resource.IssuerCertificate) == 0 {
+		t.Error("缺少私钥或中间证书")
+	}
+
+	leaf := h.verifyCert(&model.Certificate{FullchainPEM: resource.Certificate}, "127.0.0.1")
+	if len(leaf.IPAddresses) != 1 || !leaf.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("证书 IP 为 %v，期望 127.0.0.1", leaf.IPAddresses)
+	}
+	if leaf.Subject.CommonName != "" {
+		t.Errorf("IP 证书不应设置 CN，实际为 %s", leaf.Subject.CommonName)
+	}
+}
+
+// TestIssueFailure DNS 服务器拒绝动态更新时签发失败，错误写入任务日志
+func TestIssueFailure(t *testing.T) {
+	h := newHarness(t)
+
+	cert := h.createCert("app."+readonlyZone, nil, "dns-01")
+	taskID, err := h.issue(cert.ID)
+	if err == nil {
+		t.Fatal("期望签发失败")
+	}
+
+	status, _ := h.taskLog.GetTaskStatusByTaskID(taskID)
+	if status == nil || status.Status != "failed" {
+		t.Errorf("任务状态为 %v，期望 failed", status)
+	}
+	h.assertTaskLogs(taskID, "error", "证书申请失败", "REFUSED")
+
+	cert = h.cert(cert.ID)
+	if cert.Status == "valid" || len(cert.CertPEM) > 0 {
+		t.Errorf("签发失败的证书不应保存，状态为 %s", cert.Status)
+	}
+}
+
+// TestSchedulerRenew 定时任务只续期到达续期时间的证书
+func TestSchedulerRenew(t *testing.T) {
+	h := newHarness(t)
+
+	due := h.mustIssue("www."+testZone, "api."+testZone)
+	fresh := h.mustIssue("fresh." + testZone)
+
+	// 30 天有效期已过去 25 天，超过 67%
+	now := time.Now()
+	h.backdate(due.ID, now.AddDate(0, 0, -25), now.AddDate(0, 0, 5))
+
+	scheduler.NewScheduler(h.dataDir).RunNow()
+	status := h.waitTask(due.ID, "renew")
+	if status.Status != "completed" {
+		t.Fatalf("续期任务状态为 %s，期望 completed\n%s", status.Status, h.taskLogText(status.TaskID))
+	}
+	h.assertTaskLogs(status.TaskID, "info", "开始申请证书: www."+testZone, "证书续期成功")
+
+	renewed := h.cert(due.ID)
+	if renewed.Fingerprint == due.Fingerprint {
+		t.Error("续期后证书指纹未变化")
+	}
+	if !renewed.ExpiresAt.After(now.AddDate(0, 0, 5)) {
+		t.Errorf("续期后到期时间为 %v", renewed.ExpiresAt)
+	}
+	if renewed.RenewFailCount != 0 || renewed.NextRetryAt != nil || renewed.LastRenewAttempt == nil {
+		t.Errorf("续期状态异常: fail_count=%d next_retry=%v last_attempt=%v",
+			renewed.RenewFailCount, renewed.NextRetryAt, renewed.LastRenewAttempt)
+	}
+	h.verifyCert(renewed, "www."+testZone, "api."+testZone)
+
+	// 未到续期时间的证书不续期
+	if task, _ := h.taskLog.GetLatestTask(fresh.ID, "renew"); task != nil {
+		t.Errorf("未到期的证书被续期，任务状态 %s", task.Status)
+	}
+	if h.cert(fresh.ID).Fingerprint != fresh.Fingerprint {
+		t.Error("未到期的证书被替换")
+	}
+}
+
+// TestSchedulerRenewFailure 续期失败时保留原证书，记录失败次数并安排重试
+func TestSchedulerRenewFailure(t *testing.T) {
+	h := newHarness(t)
+
+	cert := h.mustIssue("www." + testZone)
+	now := time.Now()
+	h.backdate(cert.ID, now.AddDate(0, 0, -25), now.AddDate(0, 0, 5))
+
+	// 续期时 DNS 服务器拒绝更新
+	h.dns.addZone(testZone, false)
+
+	scheduler.NewScheduler(h.dataDir).RunNow()
+	status := h.waitTask(cert.ID, "renew")
+	if status.Status != "failed" {
+		t.Fatalf("续期任务状态为 %s，期望 failed", status.Status)
+	}
+	h.assertTaskLogs(status.TaskID, "error", "续期证书失败")
+
+	failed := h.cert(cert.ID)
+	if failed.Status != "valid" || failed.Fingerprint != cert.Fingerprint {
+		t.Error("续期失败后原证书应保持可用")
+	}
+	if failed.RenewFailCount != 1 {
+		t.Errorf("失败次数为 %d，期望 1", failed.RenewFailCount)
+	}
+	// 第一次失败 10 分钟后重试
+	if failed.NextRetryAt == nil || failed.NextRetryAt.Sub(now) < 9*time.Minute || failed.NextRetryAt.Sub(now) > 11*time.Minute {
+		t.Errorf("下次重试时间为 %v，期望约 10 分钟后", failed.NextRetryAt)
+	}
+
+	// 等待重试的证书不在常规续期范围内
+	candidates, err := h.certs.GetRenewalCandidates()
+	if err != nil {
+		t.Fatalf("查询续期候选失败: %v", err)
+	}
+	for _, c := range candidates {
+		if c.ID == cert.ID {
+			t.Error("等待重试的证书不应出现在续期候选中")
+		}
+	}
+}
+
+// TestRevoke 吊销后证书不再自动续期，重新续期后恢复；内置 ACME 服务端将吊销的证书发布在 CRL 中
+func TestRevoke(t *testing.T) {
+	h := newHarness(t)
+
+	cert := h.mustIssue("revoke." + testZone)
+	if err := h.acme.Revoke(cert.ID, 4); err != nil {
+		t.Fatalf("吊销证书失败: %v", err)
+	}
+	revoked := h.cert(cert.ID)
+	if revoked.Status != "revoked" || revoked.RevokedAt == nil || revoked.RevocationReason != 4 {
+		t.Errorf("吊销后状态为 %s (revoked_at=%v, reason=%d)", revoked.Status, revoked.RevokedAt, revoked.RevocationReason)
+	}
+	if err := h.acme.Revoke(cert.ID, 0); !errors.Is(err, service.ErrAlreadyRevoked) {
+		t.Errorf("重复吊销返回 %v，期望 ErrAlreadyRevoked", err)
+	}
+
+	// 吊销的证书即使到达续期时间也不自动续期
+	now := time.Now()
+	h.backdate(cert.ID, now.AddDate(0, 0, -25), now.AddDate(0, 0, 5))
+	candidates, err := h.certs.GetRenewalCandidates()
+	if err != nil {
+		t.Fatalf("查询续期候选失败: %v", err)
+	}
+	for _, c := range candidates {
+		if c.ID == cert.ID {
+			t.Error("吊销的证书不应出现在续期候选中")
+		}
+	}
+
+	if !h.external {
+		h.assertCRL(h.verifyCert(revoked, "revoke."+testZone), 4)
+	}
+
+	// 手动续期后恢复为有效证书
+	taskID, err := h.acme.RenewCertificate(cert.ID)
+	if err != nil {
+		t.Fatalf("续期证书失败: %v\n%s", err, h.taskLogText(taskID))
+	}
+	renewed := h.cert(cert.ID)
+	if renewed.Status != "valid" || renewed.RevokedAt != nil || renewed.Fingerprint == revoked.Fingerprint {
+		t.Errorf("续期后状态为 %s (revoked_at=%v)", renewed.Status, renewed.RevokedAt)
+	}
+}
+
+// TestRevokePrivateCA 私有 CA 直接签发的证书吊销后发布在 CA 的 CRL 中
+func TestRevokePrivateCA(t *testing.T) {
+	h := newHarness(t)
+	if h.external {
+		t.Skip("外部 ACME 服务器没有私有 CA 工作区")
+	}
+
+	cert, err := h.certs.CreatePending(service.CertConfig{Domain: "app." + testZone, WorkspaceID: &h.caID})
+	if err != nil {
+		t.Fatalf("创建证书失败: %v", err)
+	}
+	if taskID, err := h.issue(cert.ID); err != nil {
+		t.Fatalf("签发证书失败: %v\n%s", err, h.taskLogText(taskID))
+	}
+	cert = h.cert(cert.ID)
+
+	if err := h.acme.Revoke(cert.ID, 1); err != nil {
+		t.Fatalf("吊销证书失败: %v", err)
+	}
+	h.assertCRL(h.verifyCert(cert, "app."+testZone), 1)
+}
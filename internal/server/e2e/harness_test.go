@@ -0,0 +1,366 @@
+package e2e
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/api"
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/BlakeLiAFK/letsync/internal/server/service"
+	"github.com/BlakeLiAFK/letsync/internal/server/store"
+	"github.com/gin-gonic/gin"
+	"github.com/go-acme/lego/v4/certcrypto"
+)
+
+// 测试使用的 DNS 区域
+const (
+	testZone     = "e2e.internal"
+	readonlyZone = "readonly.internal" // 拒绝动态更新，用于失败场景
+)
+
+// harness 一次测试的完整运行环境：独立的数据目录和数据库、本地 CA、DNS 服务器
+type harness struct {
+	t        *testing.T
+	dataDir  string
+	dns      *fakeDNS
+	external bool   // 使用外部 ACME 服务器
+	caURL    string // ACME 目录地址
+
+	settings  *service.SettingsService
+	certs     *service.CertService
+	taskLog   *service.TaskLogService
+	acme      *service.ACMEService
+	workspace *model.Workspace   // 申请证书使用的 ACME 工作区
+	caID      uint               // 提供内置 ACME 服务端的私有 CA 工作区，使用外部 ACME 服务器时为 0
+	provider  *model.DNSProvider // 指向本地 DNS 服务器的 rfc2136 提供商
+	roots     *x509.CertPool     // 本地 CA 根证书，使用外部 ACME 服务器时为 nil
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	h := &harness{
+		t:        t,
+		dataDir:  t.TempDir(),
+		settings: service.NewSettingsService(),
+		certs:    service.NewCertService(),
+		taskLog:  service.NewTaskLogService(),
+	}
+
+	if err := store.InitDB(h.dataDir); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if db, err := store.GetDB().DB(); err == nil {
+			db.Close()
+		}
+	})
+	if err := h.settings.InitSecuritySettings(); err != nil {
+		t.Fatalf("初始化安全配置失败: %v", err)
+	}
+
+	h.dns = startFakeDNS(t, os.Getenv("LETSYNC_E2E_DNS_ADDR"))
+	h.dns.addZone(testZone, true)
+	h.dns.addZone(readonlyZone, false)
+
+	// http-01 验证：客户端监听与服务端连接使用同一个本地端口
+	httpPort := strconv.Itoa(freePort(t))
+	h.setSettings(map[string]string{
+		"acme.challenge_timeout":           "30",
+		"acme.http_port":                   httpPort,
+		"acme.server_http_port":            httpPort,
+		"acme.server_dns_resolver":         h.dns.addr,
+		"scheduler.renew_before_days":      "30",
+		"scheduler.renew_lifetime_percent": "67",
+		"scheduler.ari_enabled":            "true",
+	})
+	// rfc2136 提供商串行验证，默认每个域名之间等待 60 秒
+	t.Setenv("RFC2136_SEQUENCE_INTERVAL", "1")
+
+	caURL := os.Getenv("LETSYNC_E2E_ACME_URL")
+	h.external = caURL != ""
+	if !h.external {
+		caURL = h.startACMEServer()
+	}
+	h.caURL = caURL
+
+	workspace, err := service.NewWorkspaceService().Create("e2e", "端到端测试", caURL, "e2e@example.com", "EC256", "", "", 0)
+	if err != nil {
+		t.Fatalf("创建工作区失败: %v", err)
+	}
+	h.workspace = workspace
+
+	provider, err := service.NewDNSProviderService().Create("fake-dns", "rfc2136", map[string]interface{}{
+		"nameserver":           h.dns.addr,
+		"propagation_skip":     true,
+		"propagation_interval": "1",
+	})
+	if err != nil {
+		t.Fatalf("创建 DNS 提供商失败: %v", err)
+	}
+	h.provider = provider
+
+	h.acme = service.NewACMEService(h.dataDir)
+	return h
+}
+
+// startACMEServer 创建开放 ACME 服务端的私有 CA 工作区并通过 HTTPS 提供服务，返回目录地址
+func (h *harness) startACMEServer() string {
+	t := h.t
+	workspaces := service.NewWorkspaceService()
+
+	ca, err := workspaces.CreatePrivateCA("e2e-ca", "端到端测试 CA", "EC256", 0, 30)
+	if err != nil {
+		t.Fatalf("创建私有 CA 失败: %v", err)
+	}
+	if err := workspaces.SetACMEServer(ca.ID, true); err != nil {
+		t.Fatalf("开放 ACME 服务端失败: %v", err)
+	}
+	h.caID = ca.ID
+	h.roots = x509.NewCertPool()
+	h.roots.AppendCertsFromPEM(ca.CARootCert)
+
+	handler := api.NewACMEServerHandler()
+	r := gin.New()
+	acmeGroup := r.Group("/acme/:workspace")
+	acmeGroup.Use(handler.RequireWorkspace())
+	{
+		acmeGroup.GET("/directory", handler.Directory)
+		acmeGroup.HEAD("/new-nonce", handler.NewNonce)
+		acmeGroup.GET("/new-nonce", handler.NewNonce)
+		acmeGroup.POST("/new-account", handler.NewAccount)
+		acmeGroup.POST("/account/:id", handler.Account)
+		acmeGroup.POST("/account/:id/orders", handler.Orders)
+		acmeGroup.POST("/new-order", handler.NewOrder)
+		acmeGroup.POST("/order/:id", handler.Order)
+		acmeGroup.POST("/order/:id/finalize", handler.Finalize)
+		acmeGroup.POST("/authz/:id", handler.Authorization)
+		acmeGroup.POST("/chall/:id", handler.Challenge)
+		acmeGroup.POST("/cert/:id", handler.Certificate)
+		acmeGroup.POST("/revoke-cert", handler.RevokeCert)
+		acmeGroup.POST("/key-change", handler.KeyChange)
+		acmeGroup.GET("/crl", handler.CRL)
+	}
+
+	srv := httptest.NewTLSServer(r)
+	t.Cleanup(srv.Close)
+
+	// lego 只接受 HTTPS 目录，通过 LEGO_CA_CERTIFICATES 信任测试服务器的自签名证书
+	path := filepath.Join(h.dataDir, "acme-server.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("写入测试服务器证书失败: %v", err)
+	}
+	t.Setenv("LEGO_CA_CERTIFICATES", path)
+
+	return fmt.Sprintf("%s/acme/%d/directory", srv.URL, ca.ID)
+}
+
+func (h *harness) setSettings(values map[string]string) {
+	for key, value := range values {
+		if err := h.settings.Set(key, value); err != nil {
+			h.t.Fatalf("设置 %s 失败: %v", key, err)
+		}
+	}
+}
+
+// createCert 创建待签发的证书，dns-01 使用本地 DNS 提供商
+func (h *harness) createCert(domain string, san []string, challengeType string) *model.Certificate {
+	h.t.Helper()
+
+	var providerID uint
+	if challengeType == "dns-01" {
+		providerID = h.provider.ID
+	}
+	cert, err := h.certs.CreatePending(service.CertConfig{
+		Domain:        domain,
+		SAN:           san,
+		ChallengeType: challengeType,
+		DNSProviderID: providerID,
+		WorkspaceID:   &h.workspace.ID,
+	})
+	if err != nil {
+		h.t.Fatalf("创建证书失败: %v", err)
+	}
+	return cert
+}
+
+// issue 按证书配置签发，返回任务 ID
+func (h *harness) issue(certID uint) (string, error) {
+	h.t.Helper()
+
+	taskID, err := h.taskLog.CreateTask(certID, "issue")
+	if err != nil {
+		h.t.Fatalf("创建任务失败: %v", err)
+	}
+	return taskID, h.acme.IssueCertificateWithTaskID(certID, taskID)
+}
+
+// mustIssue 签发证书并要求成功
+func (h *harness) mustIssue(domain string, san ...string) *model.Certificate {
+	h.t.Helper()
+
+	cert := h.createCert(domain, san, "dns-01")
+	taskID, err := h.issue(cert.ID)
+	if err != nil {
+		h.t.Fatalf("签发证书失败: %v\n%s", err, h.taskLogText(taskID))
+	}
+	return h.cert(cert.ID)
+}
+
+// cert 从数据库重新读取证书
+func (h *harness) cert(id uint) *model.Certificate {
+	h.t.Helper()
+
+	cert, err := h.certs.Get(id)
+	if err != nil {
+		h.t.Fatalf("读取证书失败: %v", err)
+	}
+	return cert
+}
+
+// backdate 修改证书的签发和到期时间，使其进入续期窗口
+func (h *harness) backdate(certID uint, issuedAt, expiresAt time.Time) {
+	h.t.Helper()
+
+	if err := store.GetDB().Model(&model.Certificate{}).Where("id = ?", certID).Updates(map[string]interface{}{
+		"issued_at":  issuedAt,
+		"expires_at": expiresAt,
+	}).Error; err != nil {
+		h.t.Fatalf("修改证书有效期失败: %v", err)
+	}
+}
+
+// waitTask 等待证书最新的指定类型任务结束
+func (h *harness) waitTask(certID uint, taskType string) *model.TaskLogStatus {
+	h.t.Helper()
+
+	deadline := time.Now().Add(90 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := h.taskLog.GetLatestTask(certID, taskType)
+		if err != nil {
+			h.t.Fatalf("查询任务状态失败: %v", err)
+		}
+		if status != nil && status.Status != "running" {
+			return status
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	h.t.Fatalf("等待证书 %d 的 %s 任务超时", certID, taskType)
+	return nil
+}
+
+// taskLogText 任务日志全文，用于断言和失败时输出
+func (h *harness) taskLogText(taskID string) string {
+	var lines []string
+	for _, log := range h.taskLog.GetTaskLogs(taskID) {
+		lines = append(lines, fmt.Sprintf("[%s] %s", log.Level, log.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// assertTaskLogs 断言任务日志按顺序包含指定内容
+func (h *harness) assertTaskLogs(taskID string, level string, messages ...string) {
+	h.t.Helper()
+
+	logs := h.taskLog.GetTaskLogs(taskID)
+	i := 0
+	for _, log := range logs {
+		if i < len(messages) && strings.Contains(log.Message, messages[i]) && (level == "" || log.Level == level) {
+			i++
+		}
+	}
+	if i < len(messages) {
+		h.t.Errorf("任务日志缺少 %q:\n%s", messages[i], h.taskLogText(taskID))
+	}
+}
+
+// verifyCert 校验证书链和证书中的域名，本地 CA 时同时校验链到根证书
+func (h *harness) verifyCert(cert *model.Certificate, names ...string) *x509.Certificate {
+	h.t.Helper()
+
+	certs, err := certcrypto.ParsePEMBundle(cert.FullchainPEM)
+	if err != nil {
+		h.t.Fatalf("解析证书链失败: %v", err)
+	}
+	leaf := certs[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	for _, name := range names {
+		host := strings.Replace(name, "*", "wildcard", 1)
+		if err := leaf.VerifyHostname(host); err != nil {
+			h.t.Errorf("证书不包含 %s: %v", name, err)
+		}
+		if h.roots == nil {
+			continue
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{
+			DNSName:       host,
+			Roots:         h.roots,
+			Intermediates: intermediates,
+		}); err != nil {
+			h.t.Errorf("证书链校验失败 (%s): %v", name, err)
+		}
+	}
+	return leaf
+}
+
+// assertCRL 内置 ACME 服务端的 CRL 包含指定证书及吊销原因，且由中间证书签名
+func (h *harness) assertCRL(leaf *x509.Certificate, reason int) {
+	h.t.Helper()
+
+	crlURL := strings.TrimSuffix(h.caURL, "/directory") + "/crl"
+	resp, err := newACMEClient(h.t, h.caURL).http.Get(crlURL)
+	if err != nil {
+		h.t.Fatalf("获取 CRL 失败: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		h.t.Fatalf("解析 CRL 失败 (%d): %v", resp.StatusCode, err)
+	}
+
+	ca, err := service.NewWorkspaceService().LoadPrivateCA(h.caID)
+	if err != nil {
+		h.t.Fatalf("加载私有 CA 失败: %v", err)
+	}
+	if err := crl.CheckSignatureFrom(ca.Intermediate); err != nil {
+		h.t.Errorf("CRL 签名无效: %v", err)
+	}
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			if entry.ReasonCode != reason {
+				h.t.Errorf("CRL 中的吊销原因为 %d，期望 %d", entry.ReasonCode, reason)
+			}
+			return
+		}
+	}
+	h.t.Errorf("CRL 不包含证书 %X", leaf.SerialNumber)
+}
+
+// freePort 获取一个空闲的本地 TCP 端口
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("获取空闲端口失败: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
@@ -13,14 +13,12 @@ import (
 
 var settingsSvc = service.NewSettingsService()
 
-// GetRealIP 获取真实客户端 IP (支持反向代理)
-func GetRealIP(c *gin.Context) string {
+// FromTrustedProxy 请求是否来自可信的反向代理
+// 未开启 security.behind_proxy 或直接连接的地址不在可信代理列表中时，不能信任 X-Forwarded-* 请求头
+func FromTrustedProxy(c *gin.Context) bool {
 	// 检查是否部署在反向代理后
-	behindProxy := settingsSvc.GetBool("security.behind_proxy")
-	if !behindProxy {
-		// 不在反向代理后，直接返回 RemoteAddr
-		ip, _, _ := net.SplitHostPort(c.Request.RemoteAddr)
-		return ip
+	if !settingsSvc.GetBool("security.behind_proxy") {
+		return false
 	}
 
 	// 获取可信代理列表
@@ -29,25 +27,23 @@ func GetRealIP(c *gin.Context) string {
 		trustedProxiesStr = "127.0.0.1,::1"
 	}
 
-	trustedProxies := strings.Split(trustedProxiesStr, ",")
-	for i := range trustedProxies {
-		trustedProxies[i] = strings.TrimSpace(trustedProxies[i])
+	// 验证直接连接 IP 是否为可信代理
+	remoteIP, _, _ := net.SplitHostPort(c.Request.RemoteAddr)
+	for _, trusted := range strings.Split(trustedProxiesStr, ",") {
+		if remoteIP == strings.TrimSpace(trusted) {
+			return true
+		}
 	}
+	return false
+}
 
+// GetRealIP 获取真实客户端 IP (支持反向代理)
+func GetRealIP(c *gin.Context) string {
 	// 获取直接连接 IP
 	remoteIP, _, _ := net.SplitHostPort(c.Request.RemoteAddr)
 
-	// 验证是否来自可信代理
-	isTrusted := false
-	for _, trusted := range trustedProxies {
-		if remoteIP == trusted {
-			isTrusted = true
-			break
-		}
-	}
-
-	// 如果不是来自可信代理，直接返回 RemoteAddr
-	if !isTrusted {
+	// 不在反向代理后或不是来自可信代理，直接返回 RemoteAddr
+	if !FromTrustedProxy(c) {
 		return remoteIP
 	}
 
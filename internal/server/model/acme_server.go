@@ -0,0 +1,102 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ACMEAccount 内置 ACME 服务端的客户端账号 (RFC 8555)
+type ACMEAccount struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint      `json:"workspace_id" gorm:"uniqueIndex:idx_acme_account_key;not null"`
+	Thumbprint  string    `json:"thumbprint" gorm:"uniqueIndex:idx_acme_account_key;not null"` // 账号公钥 JWK 的 SHA-256 指纹
+	JWK         string    `json:"-" gorm:"type:text;not null"`                                 // 账号公钥 (JWK JSON)
+	Contact     string    `json:"contact" gorm:"type:text"`                                    // 联系方式 (JSON 数组)
+	Status      string    `json:"status" gorm:"default:valid"`                                 // valid, deactivated
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GetContact 获取联系方式列表
+func (a *ACMEAccount) GetContact() []string {
+	var list []string
+	if a.Contact != "" {
+		json.Unmarshal([]byte(a.Contact), &list)
+	}
+	return list
+}
+
+// SetContact 设置联系方式列表
+func (a *ACMEAccount) SetContact(list []string) {
+	data, _ := json.Marshal(list)
+	a.Contact = string(data)
+}
+
+// ACMEIdentifier 订单标识符，type 为 dns 或 ip
+type ACMEIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// ACMEOrder 内置 ACME 服务端的证书订单
+type ACMEOrder struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint      `json:"workspace_id" gorm:"index;not null"`
+	AccountID   uint      `json:"account_id" gorm:"index;not null"`
+	Identifiers string    `json:"identifiers" gorm:"type:text;not null"` // 标识符 (JSON 数组)
+	Status      string    `json:"status" gorm:"default:pending"`         // pending, ready, processing, valid, invalid
+	Expires     time.Time `json:"expires"`
+	CertPEM     []byte    `json:"-" gorm:"type:blob"`       // 签发的证书链 (叶证书 + 中间证书)
+	CertSerial  string    `json:"cert_serial" gorm:"index"` // 叶证书序列号 (十六进制)，用于吊销时查找订单
+	Error       string    `json:"error" gorm:"type:text"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	RevokedAt        *time.Time `json:"revoked_at"`        // 证书吊销时间，未吊销为空
+	RevocationReason int        `json:"revocation_reason"` // 吊销原因 (RFC 5280 CRLReason)
+
+	Authorizations []ACMEAuthorization `json:"-" gorm:"foreignKey:OrderID"`
+}
+
+// GetIdentifiers 获取标识符列表
+func (o *ACMEOrder) GetIdentifiers() []ACMEIdentifier {
+	var list []ACMEIdentifier
+	if o.Identifiers != "" {
+		json.Unmarshal([]byte(o.Identifiers), &list)
+	}
+	return list
+}
+
+// SetIdentifiers 设置标识符列表
+func (o *ACMEOrder) SetIdentifiers(list []ACMEIdentifier) {
+	data, _ := json.Marshal(list)
+	o.Identifiers = string(data)
+}
+
+// ACMEAuthorization 订单中单个标识符的授权，通配符授权的值为去掉 *. 的基础域名
+type ACMEAuthorization struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	OrderID   uint      `json:"order_id" gorm:"index;not null"`
+	Type      string    `json:"type" gorm:"not null"` // dns, ip
+	Value     string    `json:"value" gorm:"not null"`
+	Wildcard  bool      `json:"wildcard"`
+	Status    string    `json:"status" gorm:"default:pending"` // pending, valid, invalid
+	Expires   time.Time `json:"expires"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Challenges []ACMEChallenge `json:"-" gorm:"foreignKey:AuthorizationID"`
+}
+
+// ACMEChallenge 授权的验证方式，客户端选择其中一个完成验证
+type ACMEChallenge struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	AuthorizationID uint       `json:"authorization_id" gorm:"index;not null"`
+	Type            string     `json:"type" gorm:"not null"` // http-01, dns-01
+	Token           string     `json:"token" gorm:"not null"`
+	Status          string     `json:"status" gorm:"default:pending"` // pending, processing, valid, invalid
+	Validated       *time.Time `json:"validated"`
+	Error           string     `json:"error" gorm:"type:text"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+)
+
+// CertBatchJob 证书批量操作任务，进度通过任务日志 (TaskID) 推送
+type CertBatchJob struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	TaskID     string     `json:"task_id" gorm:"size:64;index"`  // 任务日志 ID，cert_id 为 0，task_type 为 batch
+	Action     string     `json:"action" gorm:"not null"`        // issue, renew, delete, set_workspace, set_dns_provider, attach_agent
+	Params     string     `json:"params" gorm:"type:text"`       // 操作参数 (JSON)
+	Status     string     `json:"status" gorm:"default:running"` // running, completed, failed（有失败项）, interrupted（服务重启中断）
+	Total      int        `json:"total"`
+	Succeeded  int        `json:"succeeded"`
+	Failed     int        `json:"failed"`
+	Skipped    int        `json:"skipped"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+
+	Items []CertBatchItem `json:"items,omitempty" gorm:"foreignKey:JobID"`
+}
+
+// CertBatchItem 批量操作中单个证书的执行结果
+type CertBatchItem struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	JobID     uint      `json:"job_id" gorm:"index;not null"`
+	CertID    uint      `json:"cert_id" gorm:"index"`
+	Domain    string    `json:"domain"`
+	Status    string    `json:"status" gorm:"default:pending"` // pending, running, success, failed, skipped
+	Message   string    `json:"message" gorm:"type:text"`
+	TaskID    string    `json:"task_id" gorm:"size:64"` // 签发/续期的任务 ID，可查看该证书的详细日志
+	UpdatedAt time.Time `json:"updated_at"`
+}
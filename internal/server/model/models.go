@@ -7,16 +7,33 @@ import (
 
 // Workspace ACME 工作区
 type Workspace struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	Name        string    `json:"name" gorm:"uniqueIndex;not null"` // 工作区名称
-	Description string    `json:"description"`                      // 描述
-	CaURL       string    `json:"ca_url" gorm:"not null"`           // ACME 目录 URL
-	Email       string    `json:"email" gorm:"not null"`            // 注册邮箱
-	KeyType     string    `json:"key_type" gorm:"default:EC256"`    // 密钥类型
-	AccountKey  []byte    `json:"-" gorm:"type:blob"`               // ACME 账号私钥（加密存储）
-	IsDefault   bool      `json:"is_default" gorm:"default:false"`  // 是否默认工作区
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	Name           string    `json:"name" gorm:"uniqueIndex;not null"` // 工作区名称
+	Description    string    `json:"description"`                      // 描述
+	CaURL          string    `json:"ca_url" gorm:"not null"`           // ACME 目录 URL
+	Email          string    `json:"email" gorm:"not null"`            // 注册邮箱
+	KeyType        string    `json:"key_type" gorm:"default:EC256"`    // 密钥类型
+	Profile        string    `json:"profile"`                          // 默认 ACME 证书 Profile（如 shortlived），为空则由 CA 决定
+	PreferredChain string    `json:"preferred_chain"`                  // 首选证书链（根证书 CN），为空则使用 CA 默认链
+	MaxNames       int       `json:"max_names"`                        // 单张证书最多包含的域名数，0 使用全局 acme.max_names
+	AccountKey     []byte    `json:"-" gorm:"type:blob"`               // ACME 账号私钥（加密存储）
+	IsDefault      bool      `json:"is_default" gorm:"default:false"`  // 是否默认工作区
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// 私有 CA (type 为 private_ca)，用于 *.internal 等非公网域名
+	Type               string `json:"type" gorm:"default:acme"` // 工作区类型: acme 通过 ACME CA 申请, private_ca 由内置私有 CA 签发
+	CertValidityDays   int    `json:"cert_validity_days"`       // 私有 CA 签发证书的有效期（天），0 使用默认 90 天
+	CARootCert         []byte `json:"-" gorm:"type:blob"`       // 根证书 PEM
+	CARootKey          []byte `json:"-" gorm:"type:blob"`       // 根证书私钥（加密存储）
+	CAIntermediateCert []byte `json:"-" gorm:"type:blob"`       // 中间证书 PEM，实际签发证书
+	CAIntermediateKey  []byte `json:"-" gorm:"type:blob"`       // 中间证书私钥（加密存储）
+	ACMEServer         bool   `json:"acme_server"`              // 是否开放内置 ACME 服务端，供 Caddy、cert-manager 等客户端直接申请
+}
+
+// IsPrivateCA 是否为内置私有 CA 工作区
+func (w *Workspace) IsPrivateCA() bool {
+	return w.Type == "private_ca"
 }
 
 // WorkspacePreset 工作区预设模板
@@ -38,27 +55,47 @@ func GetWorkspacePresets() []WorkspacePreset {
 
 // Certificate 证书表
 type Certificate struct {
-	ID            uint      `json:"id" gorm:"primaryKey"`
-	Domain        string    `json:"domain" gorm:"not null"`
-	SAN           string    `json:"san" gorm:"type:text"` // JSON 数组
-	CertPEM       []byte    `json:"-" gorm:"type:blob"`
-	KeyPEM        []byte    `json:"-" gorm:"type:blob"`
-	CaPEM         []byte    `json:"-" gorm:"type:blob"`
-	FullchainPEM  []byte    `json:"-" gorm:"type:blob"`
-	Fingerprint   string    `json:"fingerprint"`
-	IssuedAt      time.Time `json:"issued_at"`
-	ExpiresAt     time.Time `json:"expires_at"`
-	ChallengeType string    `json:"challenge_type" gorm:"default:dns-01"` // dns-01, http-01
-	DNSProviderID uint      `json:"dns_provider_id"`                      // DNS-01 时必填
-	WorkspaceID   *uint     `json:"workspace_id"`                         // 工作区 ID，为空则用全局配置
-	Status        string    `json:"status" gorm:"default:active"`         // active, expired, error
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	Domain           string    `json:"domain" gorm:"not null"`
+	SAN              string    `json:"san" gorm:"type:text"` // JSON 数组
+	CertPEM          []byte    `json:"-" gorm:"type:blob"`
+	KeyPEM           []byte    `json:"-" gorm:"type:blob"`
+	CaPEM            []byte    `json:"-" gorm:"type:blob"`
+	FullchainPEM     []byte    `json:"-" gorm:"type:blob"`
+	CSRPEM           []byte    `json:"-" gorm:"column:csr_pem;type:blob"` // 用户自带 CSR（私钥不交给服务器）
+	Fingerprint      string    `json:"fingerprint"`
+	IssuedAt         time.Time `json:"issued_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	ChallengeType    string    `json:"challenge_type" gorm:"default:dns-01"` // dns-01, http-01, tls-alpn-01
+	HTTP01Mode       string    `json:"http01_mode"`                          // HTTP-01 放置方式: 空为服务器监听端口, agent, webroot, proxy
+	HTTP01Webroot    string    `json:"http01_webroot"`                       // HTTP-01 webroot 模式写入的目录
+	DNSProviderID    uint      `json:"dns_provider_id"`                      // DNS-01 时必填
+	ChallengeAlias   string    `json:"challenge_alias"`                      // DNS-01 验证别名：TXT 写入 _acme-challenge.<别名>，需将 _acme-challenge.<域名> CNAME 到该记录
+	DomainChallenges string    `json:"-" gorm:"type:text"`                   // 按域名覆盖的验证配置 (JSON 数组)，未列出的域名使用证书级配置
+	WorkspaceID      *uint     `json:"workspace_id"`                         // 工作区 ID，为空则用全局配置
+	Profile          string    `json:"profile"`                              // ACME 证书 Profile，为空则使用工作区配置
+	PreferredChain   string    `json:"preferred_chain"`                      // 首选证书链（根证书 CN），为空则使用工作区配置
+	Source           string    `json:"source" gorm:"default:acme"`           // 证书来源: acme 由本系统申请, import 外部导入（只跟踪到期，不自动续期）
+	Status           string    `json:"status" gorm:"default:active"`         // active, expired, error, revoked
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 
 	// 续期重试相关
 	LastRenewAttempt *time.Time `json:"last_renew_attempt"` // 上次续期尝试时间
 	RenewFailCount   int        `json:"renew_fail_count"`   // 连续失败次数
 	NextRetryAt      *time.Time `json:"next_retry_at"`      // 下次重试时间
+	LastError        string     `json:"last_error"`         // 最近一次申请或续期失败的原因，签发成功后清空
+
+	// 吊销信息，重新签发后清空
+	RevokedAt        *time.Time `json:"revoked_at"`        // 吊销时间
+	RevocationReason int        `json:"revocation_reason"` // 吊销原因 (RFC 5280 CRLReason)
+
+	// ACME 续期信息 (ARI, RFC 9773)
+	ARIWindowStart    *time.Time `json:"ari_window_start"`    // CA 建议的续期窗口开始
+	ARIWindowEnd      *time.Time `json:"ari_window_end"`      // CA 建议的续期窗口结束
+	ARIRenewAt        *time.Time `json:"ari_renew_at"`        // 在窗口内选定的续期时间
+	ARINextCheckAt    *time.Time `json:"ari_next_check_at"`   // 下次查询 ARI 的时间 (Retry-After)
+	ARIExplanationURL string     `json:"ari_explanation_url"` // CA 提供的说明链接（如批量吊销公告）
 
 	// 关联
 	DNSProvider *DNSProvider `json:"dns_provider,omitempty" gorm:"foreignKey:DNSProviderID"`
@@ -81,16 +118,78 @@ func (c *Certificate) SetSANList(list []string) {
 	c.SAN = string(data)
 }
 
+// DomainChallenge 单个域名的验证配置，空字段沿用证书级配置
+type DomainChallenge struct {
+	Domain         string `json:"domain"`
+	ChallengeType  string `json:"challenge_type,omitempty"`
+	DNSProviderID  uint   `json:"dns_provider_id,omitempty"`
+	ChallengeAlias string `json:"challenge_alias,omitempty"`
+}
+
+// GetDomainChallenges 获取按域名覆盖的验证配置
+func (c *Certificate) GetDomainChallenges() []DomainChallenge {
+	if c.DomainChallenges == "" {
+		return []DomainChallenge{}
+	}
+	var list []DomainChallenge
+	json.Unmarshal([]byte(c.DomainChallenges), &list)
+	return list
+}
+
+// SetDomainChallenges 设置按域名覆盖的验证配置
+func (c *Certificate) SetDomainChallenges(list []DomainChallenge) {
+	if len(list) == 0 {
+		c.DomainChallenges = ""
+		return
+	}
+	data, _ := json.Marshal(list)
+	c.DomainChallenges = string(data)
+}
+
+// UsesChallenge 证书是否有域名使用指定的验证方式
+func (c *Certificate) UsesChallenge(challengeType string) bool {
+	if c.ChallengeType == challengeType || (c.ChallengeType == "" && challengeType == "dns-01") {
+		return true
+	}
+	for _, o := range c.GetDomainChallenges() {
+		if o.ChallengeType == challengeType {
+			return true
+		}
+	}
+	return false
+}
+
+// IsImported 是否为外部导入的证书（由其他 CA 或工具签发，不通过 ACME 申请和续期）
+func (c *Certificate) IsImported() bool {
+	return c.Source == "import"
+}
+
+// UsesCSR 是否使用用户自带 CSR 申请（服务器不持有私钥）
+func (c *Certificate) UsesCSR() bool {
+	return len(c.CSRPEM) > 0
+}
+
 // DNSProvider DNS 提供商配置
 type DNSProvider struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
 	Name      string    `json:"name" gorm:"not null;uniqueIndex"`
-	Type      string    `json:"type" gorm:"not null"` // cloudflare, aliyun, dnspod
+	Type      string    `json:"type" gorm:"not null"` // 见 dnsprovider 注册表
 	Config    string    `json:"-" gorm:"type:text"`   // AES 加密的 JSON
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// DNSChallengeRecord 已写入 DNS 提供商的 _acme-challenge 记录
+// 验证结束正常清理后删除；残留的记录由清理接口调用提供商的 CleanUp 删除
+type DNSChallengeRecord struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	DNSProviderID uint      `json:"dns_provider_id" gorm:"index;not null"`
+	Domain        string    `json:"domain" gorm:"not null"`
+	Token         string    `json:"-" gorm:"not null"`
+	KeyAuth       string    `json:"-" gorm:"type:text;not null"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
 // Agent 代理注册表
 type Agent struct {
 	ID           uint       `json:"id" gorm:"primaryKey"`
@@ -111,17 +210,20 @@ type Agent struct {
 
 // AgentCert Agent 证书绑定
 type AgentCert struct {
-	ID              uint       `json:"id" gorm:"primaryKey"`
-	AgentID         uint       `json:"agent_id" gorm:"index"`
-	CertID          uint       `json:"cert_id" gorm:"index"`
-	DeployPath      string     `json:"deploy_path" gorm:"not null"`
-	FileMapping     string     `json:"file_mapping" gorm:"type:text"` // JSON
-	ReloadCmd       string     `json:"reload_cmd"`
-	LastSync        *time.Time `json:"last_sync"`
-	LastFingerprint string     `json:"last_fingerprint"`
-	SyncStatus      string     `json:"sync_status" gorm:"default:pending"` // synced, pending, failed
-	CreatedAt       time.Time  `json:"created_at"`
-	UpdatedAt       time.Time  `json:"updated_at"`
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	AgentID          uint       `json:"agent_id" gorm:"index"`
+	CertID           uint       `json:"cert_id" gorm:"index"`
+	DeployPath       string     `json:"deploy_path" gorm:"not null"`
+	FileMapping      string     `json:"file_mapping" gorm:"type:text"` // JSON
+	ReloadCmd        string     `json:"reload_cmd"`
+	AgentKey         bool       `json:"agent_key" gorm:"default:false"` // 私钥由 Agent 本地生成，仅提交 CSR
+	ChallengeWebroot string     `json:"challenge_webroot"`              // HTTP-01 委托验证时写入的 webroot 目录
+	ChallengePort    int        `json:"challenge_port"`                 // 未配置 webroot 时 Agent 监听的验证端口 (默认 80)
+	LastSync         *time.Time `json:"last_sync"`
+	LastFingerprint  string     `json:"last_fingerprint"`
+	SyncStatus       string     `json:"sync_status" gorm:"default:pending"` // synced, pending, failed
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 
 	// 关联
 	Certificate *Certificate `json:"certificate,omitempty" gorm:"foreignKey:CertID"`
@@ -193,6 +295,15 @@ var DefaultSettings = []Setting{
 	{Key: "acme.ca_url", Value: "https://acme-v02.api.letsencrypt.org/directory", Type: "string", Category: "acme", Description: "CA 地址"},
 	{Key: "acme.challenge_timeout", Value: "300", Type: "int", Category: "acme", Description: "验证超时时间(秒)，DNS 传播通常需要 2-10 分钟"},
 	{Key: "acme.http_port", Value: "80", Type: "int", Category: "acme", Description: "HTTP-01 验证监听端口"},
+	{Key: "acme.tls_port", Value: "443", Type: "int", Category: "acme", Description: "TLS-ALPN-01 验证监听端口"},
+	{Key: "acme.max_concurrent", Value: "3", Type: "int", Category: "acme", Description: "同时进行的证书签发数量上限"},
+	{Key: "acme.preferred_chain", Value: "", Type: "string", Category: "acme", Description: "默认首选证书链（根证书 CN，如 ISRG Root X1），为空则使用 CA 默认链"},
+	{Key: "acme.profile", Value: "", Type: "string", Category: "acme", Description: "默认 ACME 证书 Profile（如 shortlived、tlsserver），为空则由 CA 决定"},
+	{Key: "acme.max_names", Value: "100", Type: "int", Category: "acme", Description: "单张证书最多包含的域名数（Let's Encrypt 为 100），工作区可单独设置"},
+	{Key: "acme.server_dns_resolver", Value: "", Type: "string", Category: "acme", Description: "内置 ACME 服务端验证 dns-01 使用的 DNS 服务器（如 10.0.0.53:53），为空使用系统 DNS"},
+	{Key: "acme.server_http_port", Value: "80", Type: "int", Category: "acme", Description: "内置 ACME 服务端验证 http-01 时连接客户端的端口（RFC 8555 规定为 80，仅测试环境修改）"},
 	{Key: "scheduler.renew_cron", Value: "0 3 * * *", Type: "string", Category: "scheduler", Description: "续期检查 cron"},
 	{Key: "scheduler.renew_before_days", Value: "30", Type: "int", Category: "scheduler", Description: "提前续期天数"},
+	{Key: "scheduler.renew_lifetime_percent", Value: "0", Type: "int", Category: "scheduler", Description: "有效期过去该百分比后续期（适配短期证书，如 67），0 表示使用提前续期天数"},
+	{Key: "scheduler.ari_enabled", Value: "true", Type: "bool", Category: "scheduler", Description: "按 CA 续期信息 (ARI) 安排续期，不支持时回退到提前续期天数"},
 }
@@ -1,13 +1,19 @@
 package scheduler
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
 	"github.com/BlakeLiAFK/letsync/internal/server/service"
 	"github.com/robfig/cron/v3"
 )
 
+// shortLivedLifetime 有效期不超过该时长的证书视为短期证书，按小时检查续期
+const shortLivedLifetime = 10 * 24 * time.Hour
+
 // 重试间隔策略（指数退避）
 var retryIntervals = []time.Duration{
 	10 * time.Minute,  // 第1次失败
@@ -70,10 +76,17 @@ func (s *Scheduler) Start() error {
 		return fmt.Errorf("添加重试任务失败: %w", err)
 	}
 
+	// ARI 续期窗口与短期证书检查任务（每小时）
+	_, err = s.cron.AddFunc("0 * * * *", s.checkHourly)
+	if err != nil {
+		return fmt.Errorf("添加每小时检查任务失败: %w", err)
+	}
+
 	s.cron.Start()
 	s.logger.Info("scheduler", "定时任务调度器已启动", map[string]interface{}{
-		"renew_cron": cronExpr,
-		"retry_cron": "*/10 * * * *",
+		"renew_cron":  cronExpr,
+		"retry_cron":  "*/10 * * * *",
+		"hourly_cron": "0 * * * *",
 	})
 
 	return nil
@@ -87,14 +100,11 @@ func (s *Scheduler) Stop() {
 
 // renewCerts 续期证书任务（每日主检查）
 func (s *Scheduler) renewCerts() {
-	s.logger.Info("scheduler", "开始检查需要续期的证书", nil)
+	s.checkImportedExpiry()
 
-	renewBeforeDays := s.settings.GetInt("scheduler.renew_before_days")
-	if renewBeforeDays <= 0 {
-		renewBeforeDays = 30
-	}
+	s.logger.Info("scheduler", "开始检查需要续期的证书", nil)
 
-	certs, err := s.certService.GetExpiringCerts(renewBeforeDays)
+	certs, err := s.dueCerts(false)
 	if err != nil {
 		s.logger.Error("scheduler", "获取即将过期证书失败", map[string]interface{}{
 			"error": err.Error(),
@@ -107,10 +117,152 @@ func (s *Scheduler) renewCerts() {
 		return
 	}
 
-	s.logger.Info("scheduler", fmt.Sprintf("发现 %d 个即将过期的证书", len(certs)), nil)
+	s.logger.Info("scheduler", fmt.Sprintf("发现 %d 个需要续期的证书", len(certs)), nil)
 
-	for _, cert := range certs {
-		s.renewOneCert(cert.ID, cert.Domain)
+	s.renewAll(certs)
+}
+
+// checkHourly 每小时检查 ARI 续期时间和短期证书
+// 其余证书由每日主检查处理，避免频繁查询
+func (s *Scheduler) checkHourly() {
+	certs, err := s.dueCerts(true)
+	if err != nil {
+		s.logger.Error("scheduler", "获取需要续期的证书失败", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if len(certs) == 0 {
+		return // 没有到期的，静默返回
+	}
+
+	s.logger.Info("scheduler", fmt.Sprintf("发现 %d 个到达续期时间的证书", len(certs)), nil)
+
+	s.renewAll(certs)
+}
+
+// dueCerts 获取需要续期的证书
+// 启用 ARI 时先刷新到期的续期窗口；hourly 为 true 时只返回 ARI 决定续期或短期证书
+func (s *Scheduler) dueCerts(hourly bool) ([]model.Certificate, error) {
+	certs, err := s.certService.GetRenewalCandidates()
+	if err != nil {
+		return nil, err
+	}
+
+	ariEnabled := s.settings.GetBool("scheduler.ari_enabled")
+	now := time.Now()
+
+	var due []model.Certificate
+	for i := range certs {
+		cert := &certs[i]
+		if cert.IsImported() {
+			continue // 导入的证书由外部续期，只提醒到期
+		}
+		if ariEnabled {
+			s.refreshRenewalInfo(cert, now)
+		}
+
+		if ariEnabled && cert.ARIRenewAt != nil {
+			if !now.Before(*cert.ARIRenewAt) {
+				due = append(due, *cert)
+			}
+			continue
+		}
+
+		if hourly && cert.ExpiresAt.Sub(cert.IssuedAt) > shortLivedLifetime {
+			continue
+		}
+
+		if renewAt := s.renewTime(cert); !renewAt.IsZero() && !now.Before(renewAt) {
+			due = append(due, *cert)
+		}
+	}
+
+	return due, nil
+}
+
+// checkImportedExpiry 检查外部导入的证书，在到期前 renew_before_days 天内每天提醒重新导入
+// 导入的多为一年期商业证书，不按有效期百分比计算，避免过早提醒
+func (s *Scheduler) checkImportedExpiry() {
+	certs, err := s.certService.GetImportedCerts()
+	if err != nil {
+		s.logger.Error("scheduler", "获取导入的证书失败", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	renewBeforeDays := s.settings.GetInt("scheduler.renew_before_days")
+	if renewBeforeDays <= 0 {
+		renewBeforeDays = 30
+	}
+
+	now := time.Now()
+	for i := range certs {
+		cert := &certs[i]
+		if cert.ExpiresAt.IsZero() || now.Before(cert.ExpiresAt.AddDate(0, 0, -renewBeforeDays)) {
+			continue
+		}
+
+		expiresAt := cert.ExpiresAt.Format("2006-01-02 15:04:05")
+		var message string
+		if now.After(cert.ExpiresAt) {
+			message = fmt.Sprintf("域名 %s 的导入证书已于 %s 过期，请尽快重新导入新证书", cert.Domain, expiresAt)
+		} else {
+			message = fmt.Sprintf("域名 %s 的导入证书将于 %s 过期（剩余 %d 天），该证书不会自动续期，请重新导入新证书",
+				cert.Domain, expiresAt, int(cert.ExpiresAt.Sub(now).Hours()/24))
+		}
+
+		s.logger.Warn("scheduler", message, map[string]interface{}{
+			"cert_id": cert.ID,
+		})
+		s.notifyService.Send("证书即将过期", message)
+	}
+}
+
+// renewTime 计算不使用 ARI 时的续期时间
+// 优先按有效期百分比计算（适配 6 天等短期证书），否则按提前续期天数
+func (s *Scheduler) renewTime(cert *model.Certificate) time.Time {
+	if cert.ExpiresAt.IsZero() {
+		return time.Time{}
+	}
+
+	percent := s.settings.GetInt("scheduler.renew_lifetime_percent")
+	lifetime := cert.ExpiresAt.Sub(cert.IssuedAt)
+	if percent > 0 && percent < 100 && !cert.IssuedAt.IsZero() && lifetime > 0 {
+		return cert.IssuedAt.Add(lifetime * time.Duration(percent) / 100)
+	}
+
+	renewBeforeDays := s.settings.GetInt("scheduler.renew_before_days")
+	if renewBeforeDays <= 0 {
+		renewBeforeDays = 30
+	}
+	renewAt := cert.ExpiresAt.AddDate(0, 0, -renewBeforeDays)
+	// 有效期短于提前续期天数的证书（如 6 天短期证书）在剩余三分之一有效期时续期，避免每次检查都续期
+	if !cert.IssuedAt.IsZero() && lifetime > 0 && !renewAt.After(cert.IssuedAt) {
+		return cert.ExpiresAt.Add(-lifetime / 3)
+	}
+	return renewAt
+}
+
+// refreshRenewalInfo 在到达下次检查时间时刷新证书的 ARI 续期窗口
+func (s *Scheduler) refreshRenewalInfo(cert *model.Certificate, now time.Time) {
+	if len(cert.CertPEM) == 0 {
+		return
+	}
+	if cert.ARINextCheckAt != nil && now.Before(*cert.ARINextCheckAt) {
+		return
+	}
+
+	if err := s.acmeService.RefreshRenewalInfo(cert); err != nil {
+		if errors.Is(err, service.ErrARIUnsupported) {
+			return
+		}
+		s.logger.Warn("scheduler", fmt.Sprintf("查询 ARI 续期信息失败: %s", cert.Domain), map[string]interface{}{
+			"cert_id": cert.ID,
+			"error":   err.Error(),
+		})
 	}
 }
 
@@ -130,9 +282,26 @@ func (s *Scheduler) checkRetry() {
 
 	s.logger.Info("scheduler", fmt.Sprintf("发现 %d 个需要重试的证书", len(certs)), nil)
 
+	s.renewAll(certs)
+}
+
+// renewAll 并行续期证书，实际并发数受签发池 (acme.max_concurrent) 限制
+func (s *Scheduler) renewAll(certs []model.Certificate) {
+	var wg sync.WaitGroup
 	for _, cert := range certs {
-		s.renewOneCert(cert.ID, cert.Domain)
+		// 其他定时任务、手动申请、Agent 提交 CSR 或批量任务正在签发该证书时跳过
+		release, ok := s.acmeService.ReserveIssue(cert.ID)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(certID uint, domain string) {
+			defer wg.Done()
+			defer release()
+			s.renewOneCert(certID, domain)
+		}(cert.ID, cert.Domain)
 	}
+	wg.Wait()
 }
 
 // renewOneCert 续期单个证书并处理重试逻辑
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/go-acme/lego/v4/acme"
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/challenge/dns01"
+)
+
+// domainChallenge 单个域名最终使用的验证方式
+type domainChallenge struct {
+	ChallengeType  string
+	DNSProviderID  uint
+	ChallengeAlias string
+}
+
+// dnsRoute 使用同一 DNS 提供商（及别名）的一组域名
+type dnsRoute struct {
+	DNSProviderID  uint
+	ChallengeAlias string
+	Domains        []string
+}
+
+// challengePlan 按证书级配置和按域名覆盖的配置，确定每个域名的验证方式
+// 返回域名（去掉通配符前缀）到验证方式的映射，以及用到的验证方式（按出现顺序）
+func challengePlan(req CertRequest, domains []string) (map[string]domainChallenge, []string, error) {
+	if len(domains) == 0 {
+		return nil, nil, fmt.Errorf("没有需要验证的域名")
+	}
+
+	certType := req.ChallengeType
+	if certType == "" {
+		certType = "dns-01"
+	}
+
+	overrides := make(map[string]model.DomainChallenge, len(req.DomainChallenges))
+	for _, o := range req.DomainChallenges {
+		overrides[strings.ToLower(o.Domain)] = o
+	}
+
+	plan := make(map[string]domainChallenge, len(domains))
+	var types []string
+	seenType := make(map[string]bool)
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		dc := domainChallenge{
+			ChallengeType:  certType,
+			DNSProviderID:  req.DNSProviderID,
+			ChallengeAlias: req.ChallengeAlias,
+		}
+		if o, ok := overrides[domain]; ok {
+			if o.ChallengeType != "" {
+				dc.ChallengeType = o.ChallengeType
+			}
+			// 别名属于管理别名区域的提供商，更换提供商时不沿用证书级别名
+			if o.DNSProviderID != 0 {
+				dc.DNSProviderID = o.DNSProviderID
+				dc.ChallengeAlias = ""
+			}
+			if o.ChallengeAlias != "" {
+				dc.ChallengeAlias = o.ChallengeAlias
+			}
+		}
+		if dc.ChallengeType != "dns-01" {
+			if strings.HasPrefix(domain, "*.") {
+				return nil, nil, fmt.Errorf("通配符域名 %s 只能使用 DNS-01 验证", domain)
+			}
+			dc.DNSProviderID = 0
+			dc.ChallengeAlias = ""
+		} else if IsIPAddress(domain) {
+			return nil, nil, fmt.Errorf("IP 地址 %s 不能使用 DNS-01 验证", domain)
+		} else if dc.DNSProviderID == 0 {
+			return nil, nil, fmt.Errorf("域名 %s 使用 DNS-01 验证，需要选择 DNS 提供商", domain)
+		}
+
+		// lego 调用 Provider 时传入的是不带通配符前缀的域名
+		key := strings.TrimPrefix(domain, "*.")
+		if prev, ok := plan[key]; ok && prev != dc {
+			return nil, nil, fmt.Errorf("%s 与 *.%s 共用验证记录，需要使用相同的验证配置", key, key)
+		}
+		plan[key] = dc
+
+		if !seenType[dc.ChallengeType] {
+			seenType[dc.ChallengeType] = true
+			types = append(types, dc.ChallengeType)
+		}
+	}
+
+	return plan, types, nil
+}
+
+// dnsRoutes 将使用 DNS-01 的域名按提供商和别名分组
+func dnsRoutes(plan map[string]domainChallenge, domains []string) []dnsRoute {
+	var routes []dnsRoute
+	index := make(map[domainChallenge]int)
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		key := strings.TrimPrefix(strings.ToLower(domain), "*.")
+		dc := plan[key]
+		if dc.ChallengeType != "dns-01" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		i, ok := index[dc]
+		if !ok {
+			i = len(routes)
+			index[dc] = i
+			routes = append(routes, dnsRoute{DNSProviderID: dc.DNSProviderID, ChallengeAlias: dc.ChallengeAlias})
+		}
+		routes[i].Domains = append(routes[i].Domains, key)
+	}
+	return routes
+}
+
+// challengeRouter 按域名把授权交给对应验证方式的 Prober 处理
+// lego 同一订单只按验证类型选择 Solver（优先 tls-alpn-01、http-01，最后 dns-01），
+// 混用验证方式时为每种方式准备独立的 SolverManager，分组依次验证
+type challengeRouter struct {
+	probers map[string]interface {
+		Solve(authorizations []acme.Authorization) error
+	}
+	types []string
+	plan  map[string]domainChallenge
+}
+
+func (r *challengeRouter) Solve(authorizations []acme.Authorization) error {
+	groups := make(map[string][]acme.Authorization)
+	for _, authz := range authorizations {
+		domain := strings.ToLower(authz.Identifier.Value)
+		dc, ok := r.plan[domain]
+		if !ok {
+			return fmt.Errorf("域名 %s 没有配置验证方式", domain)
+		}
+		groups[dc.ChallengeType] = append(groups[dc.ChallengeType], authz)
+	}
+
+	for _, t := range r.types {
+		if len(groups[t]) == 0 {
+			continue
+		}
+		if err := r.probers[t].Solve(groups[t]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dnsRouter 按域名把 DNS-01 记录交给对应的 DNS Provider
+type dnsRouter struct {
+	providers map[string]challenge.Provider // 不带通配符前缀的域名 -> Provider
+}
+
+// newDNSRouter 创建按域名分发的 DNS Provider，任一 Provider 要求串行时整体串行
+func newDNSRouter(providers map[string]challenge.Provider) challenge.Provider {
+	r := &dnsRouter{providers: providers}
+	for _, p := range providers {
+		if _, ok := p.(interface{ Sequential() time.Duration }); ok {
+			return &sequentialDNSRouter{r}
+		}
+	}
+	return r
+}
+
+func (r *dnsRouter) provider(domain string) (challenge.Provider, error) {
+	p, ok := r.providers[strings.ToLower(domain)]
+	if !ok {
+		return nil, fmt.Errorf("域名 %s 没有配置 DNS 提供商", domain)
+	}
+	return p, nil
+}
+
+func (r *dnsRouter) Present(domain, token, keyAuth string) error {
+	p, err := r.provider(domain)
+	if err != nil {
+		return err
+	}
+	return p.Present(domain, token, keyAuth)
+}
+
+func (r *dnsRouter) CleanUp(domain, token, keyAuth string) error {
+	p, err := r.provider(domain)
+	if err != nil {
+		return err
+	}
+	return p.CleanUp(domain, token, keyAuth)
+}
+
+// Timeout 取各 Provider 中最长的传播超时和轮询间隔
+func (r *dnsRouter) Timeout() (timeout, interval time.Duration) {
+	for _, p := range r.providers {
+		t, i := dns01.DefaultPropagationTimeout, dns01.DefaultPollingInterval
+		if pt, ok := p.(challenge.ProviderTimeout); ok {
+			t, i = pt.Timeout()
+		}
+		timeout = max(timeout, t)
+		interval = max(interval, i)
+	}
+	return timeout, interval
+}
+
+// sequentialDNSRouter 包含需要串行处理的 Provider
+type sequentialDNSRouter struct {
+	*dnsRouter
+}
+
+func (r *sequentialDNSRouter) Sequential() time.Duration {
+	var d time.Duration
+	for _, p := range r.providers {
+		if s, ok := p.(interface{ Sequential() time.Duration }); ok {
+			d = max(d, s.Sequential())
+		}
+	}
+	return d
+}
@@ -0,0 +1,897 @@
+package service
+
+import (
+	"context"
+	gocrypto "crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/BlakeLiAFK/letsync/internal/server/store"
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-jose/go-jose/v4"
+	"gorm.io/gorm"
+)
+
+// 内置 ACME 服务端 (RFC 8555)，使用私有 CA 工作区签发证书
+const (
+	acmeOrderLifetime     = 7 * 24 * time.Hour // 订单和授权的有效期
+	acmeNonceLifetime     = 10 * time.Minute   // 客户端通常获取后立即使用
+	acmeNonceCapacity     = 10000              // 最多保存的 nonce 数量，超出时淘汰最早生成的
+	acmeNonceSweep        = time.Minute
+	acmeValidationTimeout = 10 * time.Second
+	acmeCRLLifetime       = 24 * time.Hour // CRL 的 nextUpdate，客户端应在此之前重新获取
+)
+
+// ACME 账号密钥允许的签名算法
+var acmeSignatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.ES256, jose.ES384, jose.ES512, jose.EdDSA,
+}
+
+// ACMEProblem ACME 错误响应 (RFC 7807)，Type 为 urn:ietf:params:acme:error: 后的部分
+type ACMEProblem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func (p *ACMEProblem) Error() string {
+	return p.Detail
+}
+
+func acmeProblem(status int, errType, detail string) *ACMEProblem {
+	return &ACMEProblem{Type: "urn:ietf:params:acme:error:" + errType, Detail: detail, Status: status}
+}
+
+// ToACMEProblem 将错误转换为 ACME 错误响应，非 ACMEProblem 的错误视为服务端内部错误
+func ToACMEProblem(err error) *ACMEProblem {
+	var problem *ACMEProblem
+	if errors.As(err, &problem) {
+		return problem
+	}
+	return acmeProblem(http.StatusInternalServerError, "serverInternal", err.Error())
+}
+
+// ACMEKeyMode JWS 请求允许的签名方式
+type ACMEKeyMode int
+
+const (
+	ACMEKeyKID ACMEKeyMode = iota // 已注册账号，使用 kid 签名
+	ACMEKeyJWK                    // newAccount，使用 jwk 签名
+	ACMEKeyAny                    // revokeCert，使用账号 (kid) 或证书私钥 (jwk) 签名
+)
+
+// ACMERequest 已验证签名的 JWS 请求
+type ACMERequest struct {
+	Payload []byte
+	JWK     *jose.JSONWebKey   // 使用 jwk 签名时的公钥 (newAccount、revokeCert)
+	Account *model.ACMEAccount // 使用 kid 签名时的账号
+}
+
+// ACMEServerService 内置 ACME 服务端
+type ACMEServerService struct {
+	workspaces *WorkspaceService
+	settings   *SettingsService
+	logger     *LogService
+}
+
+func NewACMEServerService() *ACMEServerService {
+	return &ACMEServerService{
+		workspaces: NewWorkspaceService(),
+		settings:   NewSettingsService(),
+		logger:     NewLogService(),
+	}
+}
+
+// nonce 只保存在内存中，重启或被淘汰后客户端收到 badNonce 会自动重试
+// 未认证的请求也会生成 nonce，使用固定容量的环形缓冲区限制内存，过期的 nonce 由定时任务清理
+type nonceStore struct {
+	mutex   sync.Mutex
+	expires map[string]time.Time
+	ring    []string // 按生成顺序保存，写满后覆盖最早的 nonce
+	next    int
+}
+
+var (
+	acmeNonces         = &nonceStore{expires: make(map[string]time.Time), ring: make([]string, acmeNonceCapacity)}
+	acmeNonceSweepOnce sync.Once
+)
+
+// add 保存 nonce，缓冲区已满时淘汰最早生成的 nonce
+func (n *nonceStore) add(nonce string, expires time.Time) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if old := n.ring[n.next]; old != "" {
+		delete(n.expires, old)
+	}
+	n.ring[n.next] = nonce
+	n.next = (n.next + 1) % len(n.ring)
+	n.expires[nonce] = expires
+}
+
+// use 消费 nonce，每个 nonce 只能使用一次
+func (n *nonceStore) use(nonce string) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	expires, ok := n.expires[nonce]
+	delete(n.expires, nonce)
+	return ok && time.Now().Before(expires)
+}
+
+// sweep 删除过期的 nonce
+func (n *nonceStore) sweep() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	now := time.Now()
+	for nonce, expires := range n.expires {
+		if now.After(expires) {
+			delete(n.expires, nonce)
+		}
+	}
+}
+
+// NewNonce 生成一次性 nonce
+func (s *ACMEServerService) NewNonce() string {
+	acmeNonceSweepOnce.Do(func() {
+		go func() {
+			for range time.Tick(acmeNonceSweep) {
+				acmeNonces.sweep()
+			}
+		}()
+	})
+
+	nonce := randomToken()
+	acmeNonces.add(nonce, time.Now().Add(acmeNonceLifetime))
+	return nonce
+}
+
+// useNonce 消费 nonce，每个 nonce 只能使用一次
+func (s *ACMEServerService) useNonce(nonce string) bool {
+	return acmeNonces.use(nonce)
+}
+
+// VerifyRequest 验证 JWS 请求的签名、nonce 和 url
+// mode 决定使用 jwk 还是 kid（账号 URL，以 accountURL 为前缀）签名
+func (s *ACMEServerService) VerifyRequest(workspaceID uint, body []byte, url, accountURL string, mode ACMEKeyMode) (*ACMERequest, error) {
+	jws, err := jose.ParseSigned(string(body), acmeSignatureAlgorithms)
+	if err != nil {
+		return nil, acmeProblem(http.StatusBadRequest, "malformed", fmt.Sprintf("解析 JWS 失败: %v", err))
+	}
+	if len(jws.Signatures) != 1 {
+		return nil, acmeProblem(http.StatusBadRequest, "malformed", "JWS 必须只有一个签名")
+	}
+	header := jws.Signatures[0].Protected
+
+	if !s.useNonce(header.Nonce) {
+		return nil, acmeProblem(http.StatusBadRequest, "badNonce", "nonce 无效或已使用")
+	}
+	if headerURL, _ := header.ExtraHeaders["url"].(string); headerURL != url {
+		return nil, acmeProblem(http.StatusUnauthorized, "unauthorized", fmt.Sprintf("JWS 中的 url 与请求地址不一致: %s", headerURL))
+	}
+
+	req := &ACMERequest{}
+	var key interface{}
+	switch {
+	case mode == ACMEKeyJWK || (mode == ACMEKeyAny && header.KeyID == ""):
+		if header.JSONWebKey == nil || header.KeyID != "" {
+			return nil, acmeProblem(http.StatusBadRequest, "malformed", "该请求必须使用 jwk 签名")
+		}
+		if !header.JSONWebKey.IsPublic() || !header.JSONWebKey.Valid() {
+			return nil, acmeProblem(http.StatusBadRequest, "badPublicKey", "jwk 必须是有效的公钥")
+		}
+		req.JWK = header.JSONWebKey
+		key = header.JSONWebKey
+	default:
+		if header.KeyID == "" || header.JSONWebKey != nil {
+			return nil, acmeProblem(http.StatusBadRequest, "malformed", "该请求必须使用 kid 签名")
+		}
+		account, err := s.accountByURL(workspaceID, header.KeyID, accountURL)
+		if err != nil {
+			return nil, err
+		}
+		var jwk jose.JSONWebKey
+		if err := jwk.UnmarshalJSON([]byte(account.JWK)); err != nil {
+			return nil, fmt.Errorf("解析账号公钥失败: %w", err)
+		}
+		req.Account = account
+		key = &jwk
+	}
+
+	payload, err := jws.Verify(key)
+	if err != nil {
+		return nil, acmeProblem(http.StatusBadRequest, "malformed", "JWS 签名验证失败")
+	}
+	req.Payload = payload
+	return req, nil
+}
+
+// accountByURL 按 kid 查找有效账号
+func (s *ACMEServerService) accountByURL(workspaceID uint, kid, accountURL string) (*model.ACMEAccount, error) {
+	var id uint
+	if !strings.HasPrefix(kid, accountURL) {
+		return nil, acmeProblem(http.StatusBadRequest, "accountDoesNotExist", "账号不存在")
+	}
+	if _, err := fmt.Sscanf(strings.TrimPrefix(kid, accountURL), "%d", &id); err != nil {
+		return nil, acmeProblem(http.StatusBadRequest, "accountDoesNotExist", "账号不存在")
+	}
+
+	var account model.ACMEAccount
+	if err := store.GetDB().Where("id = ? AND workspace_id = ?", id, workspaceID).First(&account).Error; err != nil {
+		return nil, acmeProblem(http.StatusBadRequest, "accountDoesNotExist", "账号不存在")
+	}
+	if account.Status != "valid" {
+		return nil, acmeProblem(http.StatusUnauthorized, "unauthorized", "账号已停用")
+	}
+	return &account, nil
+}
+
+// NewAccount 按公钥查找或创建账号，返回账号和是否为新建
+func (s *ACMEServerService) NewAccount(workspaceID uint, jwk *jose.JSONWebKey, contact []string, onlyReturnExisting bool) (*model.ACMEAccount, bool, error) {
+	thumbprint, err := jwkThumbprint(jwk)
+	if err != nil {
+		return nil, false, acmeProblem(http.StatusBadRequest, "badPublicKey", err.Error())
+	}
+
+	var account model.ACMEAccount
+	err = store.GetDB().Where("workspace_id = ? AND thumbprint = ?", workspaceID, thumbprint).First(&account).Error
+	if err == nil {
+		if account.Status != "valid" {
+			return nil, false, acmeProblem(http.StatusUnauthorized, "unauthorized", "账号已停用")
+		}
+		return &account, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+	if onlyReturnExisting {
+		return nil, false, acmeProblem(http.StatusBadRequest, "accountDoesNotExist", "账号不存在")
+	}
+	if err := validateACMEContact(contact); err != nil {
+		return nil, false, err
+	}
+
+	data, err := jwk.MarshalJSON()
+	if err != nil {
+		return nil, false, err
+	}
+	account = model.ACMEAccount{
+		WorkspaceID: workspaceID,
+		Thumbprint:  thumbprint,
+		JWK:         string(data),
+		Status:      "valid",
+	}
+	account.SetContact(contact)
+	if err := store.GetDB().Create(&account).Error; err != nil {
+		return nil, false, err
+	}
+
+	s.logger.Info("acme_server", fmt.Sprintf("ACME 客户端注册账号: %d", account.ID), map[string]interface{}{
+		"workspace_id": workspaceID,
+		"contact":      contact,
+	})
+	return &account, true, nil
+}
+
+// UpdateAccount 更新联系方式或停用账号，contact 为 nil 时不修改
+func (s *ACMEServerService) UpdateAccount(account *model.ACMEAccount, contact []string, status string) error {
+	if status != "" && status != "deactivated" {
+		return acmeProblem(http.StatusBadRequest, "malformed", "只能将账号状态改为 deactivated")
+	}
+	if contact != nil {
+		if err := validateACMEContact(contact); err != nil {
+			return err
+		}
+		account.SetContact(contact)
+	}
+	if status != "" {
+		account.Status = status
+	}
+	return store.GetDB().Model(account).Updates(map[string]interface{}{
+		"contact": account.Contact,
+		"status":  account.Status,
+	}).Error
+}
+
+// validateACMEContact 只支持 mailto 联系方式
+func validateACMEContact(contact []string) error {
+	for _, c := range contact {
+		if !strings.HasPrefix(c, "mailto:") || strings.TrimPrefix(c, "mailto:") == "" {
+			return acmeProblem(http.StatusBadRequest, "unsupportedContact", fmt.Sprintf("不支持的联系方式: %s", c))
+		}
+	}
+	return nil
+}
+
+// ListOrders 获取账号的订单 ID
+func (s *ACMEServerService) ListOrders(account *model.ACMEAccount) ([]uint, error) {
+	var ids []uint
+	err := store.GetDB().Model(&model.ACMEOrder{}).Where("account_id = ?", account.ID).Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// NewOrder 创建订单，为每个标识符生成授权和验证
+// dns 标识符提供 http-01 和 dns-01（通配符只能 dns-01），ip 标识符只提供 http-01 (RFC 8738)
+func (s *ACMEServerService) NewOrder(account *model.ACMEAccount, identifiers []model.ACMEIdentifier) (*model.ACMEOrder, error) {
+	if len(identifiers) == 0 {
+		return nil, acmeProblem(http.StatusBadRequest, "malformed", "订单至少需要一个标识符")
+	}
+
+	seen := make(map[string]bool)
+	var normalized []model.ACMEIdentifier
+	for _, id := range identifiers {
+		if id.Type != "dns" && id.Type != "ip" {
+			return nil, acmeProblem(http.StatusBadRequest, "unsupportedIdentifier", fmt.Sprintf("不支持的标识符类型: %s", id.Type))
+		}
+		value, err := NormalizeDomain(id.Value)
+		if err != nil || (id.Type == "ip") != IsIPAddress(value) {
+			return nil, acmeProblem(http.StatusBadRequest, "rejectedIdentifier", fmt.Sprintf("无效的标识符: %s", id.Value))
+		}
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		normalized = append(normalized, model.ACMEIdentifier{Type: id.Type, Value: value})
+	}
+
+	if maxNames := s.workspaces.MaxNames(&account.WorkspaceID); len(normalized) > maxNames {
+		return nil, acmeProblem(http.StatusBadRequest, "rejectedIdentifier", fmt.Sprintf("标识符数量超过上限 %d", maxNames))
+	}
+
+	expires := time.Now().Add(acmeOrderLifetime)
+	order := &model.ACMEOrder{
+		WorkspaceID: account.WorkspaceID,
+		AccountID:   account.ID,
+		Status:      "pending",
+		Expires:     expires,
+	}
+	order.SetIdentifiers(normalized)
+	for _, id := range normalized {
+		authz := model.ACMEAuthorization{
+			Type:     id.Type,
+			Value:    strings.TrimPrefix(id.Value, "*."),
+			Wildcard: strings.HasPrefix(id.Value, "*."),
+			Status:   "pending",
+			Expires:  expires,
+		}
+		if !authz.Wildcard {
+			authz.Challenges = append(authz.Challenges, model.ACMEChallenge{Type: "http-01", Token: randomToken(), Status: "pending"})
+		}
+		if id.Type == "dns" {
+			authz.Challenges = append(authz.Challenges, model.ACMEChallenge{Type: "dns-01", Token: randomToken(), Status: "pending"})
+		}
+		order.Authorizations = append(order.Authorizations, authz)
+	}
+
+	if err := store.GetDB().Create(order).Error; err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("acme_server", fmt.Sprintf("ACME 客户端创建订单: %d", order.ID), map[string]interface{}{
+		"account_id":  account.ID,
+		"identifiers": normalized,
+	})
+	return order, nil
+}
+
+// GetOrder 获取账号的订单（包含授权），过期的订单标记为 invalid
+func (s *ACMEServerService) GetOrder(account *model.ACMEAccount, id uint) (*model.ACMEOrder, error) {
+	var order model.ACMEOrder
+	if err := store.GetDB().Preload("Authorizations").First(&order, id).Error; err != nil {
+		return nil, acmeProblem(http.StatusNotFound, "malformed", "订单不存在")
+	}
+	if order.AccountID != account.ID {
+		return nil, acmeProblem(http.StatusForbidden, "unauthorized", "无权访问该订单")
+	}
+
+	if (order.Status == "pending" || order.Status == "ready") && time.Now().After(order.Expires) {
+		order.Status = "invalid"
+		store.GetDB().Model(&order).Update("status", order.Status)
+	}
+	return &order, nil
+}
+
+// GetAuthorization 获取账号的授权（包含验证）
+func (s *ACMEServerService) GetAuthorization(account *model.ACMEAccount, id uint) (*model.ACMEAuthorization, error) {
+	var authz model.ACMEAuthorization
+	if err := store.GetDB().Preload("Challenges").First(&authz, id).Error; err != nil {
+		return nil, acmeProblem(http.StatusNotFound, "malformed", "授权不存在")
+	}
+	if _, err := s.GetOrder(account, authz.OrderID); err != nil {
+		return nil, err
+	}
+
+	if authz.Status == "pending" && time.Now().After(authz.Expires) {
+		authz.Status = "expired"
+		store.GetDB().Model(&authz).Update("status", authz.Status)
+	}
+	return &authz, nil
+}
+
+// GetChallenge 获取账号的验证及其所属授权
+func (s *ACMEServerService) GetChallenge(account *model.ACMEAccount, id uint) (*model.ACMEChallenge, *model.ACMEAuthorization, error) {
+	var challenge model.ACMEChallenge
+	if err := store.GetDB().First(&challenge, id).Error; err != nil {
+		return nil, nil, acmeProblem(http.StatusNotFound, "malformed", "验证不存在")
+	}
+	authz, err := s.GetAuthorization(account, challenge.AuthorizationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &challenge, authz, nil
+}
+
+// StartChallenge 客户端通知已准备好验证，后台异步校验，重复请求直接返回当前状态
+func (s *ACMEServerService) StartChallenge(account *model.ACMEAccount, id uint) (*model.ACMEChallenge, *model.ACMEAuthorization, error) {
+	challenge, authz, err := s.GetChallenge(account, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if challenge.Status != "pending" || authz.Status != "pending" {
+		return challenge, authz, nil
+	}
+
+	// 并发请求只有一个能把验证从 pending 改为 processing，其余直接返回当前状态
+	result := store.GetDB().Model(&model.ACMEChallenge{}).
+		Where("id = ? AND status = ?", challenge.ID, "pending").
+		Update("status", "processing")
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return s.GetChallenge(account, id)
+	}
+	challenge.Status = "processing"
+
+	keyAuth := challenge.Token + "." + account.Thumbprint
+	go s.validate(*challenge, *authz, keyAuth)
+
+	return challenge, authz, nil
+}
+
+// validate 校验验证结果，更新验证、授权和订单状态
+func (s *ACMEServerService) validate(challenge model.ACMEChallenge, authz model.ACMEAuthorization, keyAuth string) {
+	var err error
+	switch challenge.Type {
+	case "http-01":
+		err = s.validateHTTP01(authz.Value, challenge.Token, keyAuth)
+	case "dns-01":
+		err = s.validateDNS01(authz.Value, keyAuth)
+	default:
+		err = acmeProblem(http.StatusBadRequest, "malformed", fmt.Sprintf("不支持的验证方式: %s", challenge.Type))
+	}
+
+	name := authz.Value
+	if authz.Wildcard {
+		name = "*." + name
+	}
+
+	challengeUpdates := map[string]interface{}{"status": "valid"}
+	status := "valid"
+	if err != nil {
+		data, _ := json.Marshal(ToACMEProblem(err))
+		challengeUpdates = map[string]interface{}{"status": "invalid", "error": string(data)}
+		status = "invalid"
+		s.logger.Warn("acme_server", fmt.Sprintf("ACME 验证失败: %s (%s)", name, challenge.Type), map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else {
+		challengeUpdates["validated"] = time.Now()
+		s.logger.Info("acme_server", fmt.Sprintf("ACME 验证通过: %s (%s)", name, challenge.Type), nil)
+	}
+
+	db := store.GetDB()
+	db.Model(&model.ACMEChallenge{}).Where("id = ?", challenge.ID).Updates(challengeUpdates)
+	db.Model(&model.ACMEAuthorization{}).Where("id = ?", authz.ID).Update("status", status)
+	s.updateOrderStatus(authz.OrderID)
+}
+
+// updateOrderStatus 授权全部通过后订单变为 ready，任一授权失败则订单失败
+func (s *ACMEServerService) updateOrderStatus(orderID uint) {
+	var authzs []model.ACMEAuthorization
+	if err := store.GetDB().Where("order_id = ?", orderID).Find(&authzs).Error; err != nil {
+		return
+	}
+
+	status := "ready"
+	for _, authz := range authzs {
+		if authz.Status == "invalid" || authz.Status == "expired" {
+			status = "invalid"
+			break
+		}
+		if authz.Status != "valid" {
+			status = "pending"
+		}
+	}
+	if status != "pending" {
+		store.GetDB().Model(&model.ACMEOrder{}).Where("id = ? AND status = ?", orderID, "pending").Update("status", status)
+	}
+}
+
+// validateHTTP01 请求 http://<域名>/.well-known/acme-challenge/<token>，内容须与 keyAuth 一致
+func (s *ACMEServerService) validateHTTP01(host, token, keyAuth string) error {
+	port := s.settings.GetInt("acme.server_http_port")
+	if port == 0 {
+		port = 80
+	}
+	url := fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", net.JoinHostPort(host, fmt.Sprint(port)), token)
+
+	client := &http.Client{Timeout: acmeValidationTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return acmeProblem(http.StatusBadRequest, "connection", fmt.Sprintf("连接 %s 失败: %v", url, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return acmeProblem(http.StatusForbidden, "unauthorized", fmt.Sprintf("%s 返回状态码 %d", url, resp.StatusCode))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return acmeProblem(http.StatusBadRequest, "connection", fmt.Sprintf("读取 %s 失败: %v", url, err))
+	}
+	if strings.TrimSpace(string(body)) != keyAuth {
+		return acmeProblem(http.StatusForbidden, "incorrectResponse", fmt.Sprintf("%s 的内容与验证令牌不一致", url))
+	}
+	return nil
+}
+
+// validateDNS01 查询 _acme-challenge.<域名> 的 TXT 记录，须包含 keyAuth 的 SHA-256 摘要
+func (s *ACMEServerService) validateDNS01(domain, keyAuth string) error {
+	sum := sha256.Sum256([]byte(keyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	fqdn := "_acme-challenge." + domain
+
+	resolver := net.DefaultResolver
+	if server := s.settings.Get("acme.server_dns_resolver"); server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), acmeValidationTimeout)
+	defer cancel()
+	records, err := resolver.LookupTXT(ctx, fqdn)
+	if err != nil {
+		return acmeProblem(http.StatusBadRequest, "dns", fmt.Sprintf("查询 %s TXT 记录失败: %v", fqdn, err))
+	}
+	for _, record := range records {
+		if record == expected {
+			return nil
+		}
+	}
+	return acmeProblem(http.StatusForbidden, "incorrectResponse", fmt.Sprintf("%s 没有匹配的 TXT 记录", fqdn))
+}
+
+// Finalize 提交 CSR 签发证书，CSR 中的域名必须与订单标识符完全一致
+func (s *ACMEServerService) Finalize(account *model.ACMEAccount, orderID uint, csrDER []byte) (*model.ACMEOrder, error) {
+	order, err := s.GetOrder(account, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != "ready" {
+		return nil, acmeProblem(http.StatusForbidden, "orderNotReady", fmt.Sprintf("订单状态为 %s，不能提交 CSR", order.Status))
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, acmeProblem(http.StatusBadRequest, "badCSR", fmt.Sprintf("解析 CSR 失败: %v", err))
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, acmeProblem(http.StatusBadRequest, "badCSR", fmt.Sprintf("CSR 签名无效: %v", err))
+	}
+
+	var want, got []string
+	for _, id := range order.GetIdentifiers() {
+		want = append(want, id.Value)
+	}
+	for _, d := range CSRDomains(csr) {
+		got = append(got, strings.ToLower(d))
+	}
+	sort.Strings(want)
+	sort.Strings(got)
+	if strings.Join(want, ",") != strings.Join(got, ",") {
+		return nil, acmeProblem(http.StatusBadRequest, "badCSR", fmt.Sprintf("CSR 中的域名 %v 与订单不一致 %v", got, want))
+	}
+
+	ca, err := s.workspaces.LoadPrivateCA(order.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 并发提交时只有一个请求能把订单从 ready 改为 processing，避免重复签发
+	result := store.GetDB().Model(&model.ACMEOrder{}).
+		Where("id = ? AND status = ?", order.ID, "ready").
+		Update("status", "processing")
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, acmeProblem(http.StatusForbidden, "orderNotReady", "订单正在签发或已签发，不能重复提交 CSR")
+	}
+	order.Status = "processing"
+
+	resource, err := ca.Issue(nil, csr)
+	if err != nil {
+		data, _ := json.Marshal(acmeProblem(http.StatusInternalServerError, "serverInternal", err.Error()))
+		order.Status = "invalid"
+		order.Error = string(data)
+		store.GetDB().Model(order).Updates(map[string]interface{}{"status": order.Status, "error": order.Error})
+		return nil, err
+	}
+
+	leaf, err := certcrypto.ParsePEMCertificate(resource.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	order.Status = "valid"
+	order.CertPEM = append(append([]byte{}, resource.Certificate...), resource.IssuerCertificate...)
+	order.CertSerial = certSerial(leaf)
+	if err := store.GetDB().Model(order).Updates(map[string]interface{}{
+		"status":      order.Status,
+		"cert_pem":    order.CertPEM,
+		"cert_serial": order.CertSerial,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("acme_server", fmt.Sprintf("ACME 客户端签发证书: %s", strings.Join(want, ", ")), map[string]interface{}{
+		"account_id": account.ID,
+		"order_id":   order.ID,
+	})
+	return order, nil
+}
+
+// GetCertificate 获取已签发订单的证书链
+func (s *ACMEServerService) GetCertificate(account *model.ACMEAccount, orderID uint) ([]byte, error) {
+	order, err := s.GetOrder(account, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != "valid" || len(order.CertPEM) == 0 {
+		return nil, acmeProblem(http.StatusNotFound, "malformed", "证书不存在")
+	}
+	return order.CertPEM, nil
+}
+
+// Revoke 吊销内置 ACME 服务端签发的证书 (RFC 8555 7.6)
+// 请求可由签发该证书的账号、持有全部标识符有效授权的账号，或证书私钥 (jwk) 签名
+func (s *ACMEServerService) Revoke(workspaceID uint, req *ACMERequest, certDER []byte, reason int) error {
+	if !ValidRevocationReason(reason) {
+		return acmeProblem(http.StatusBadRequest, "badRevocationReason", fmt.Sprintf("不支持的吊销原因: %d", reason))
+	}
+
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return acmeProblem(http.StatusBadRequest, "malformed", fmt.Sprintf("解析证书失败: %v", err))
+	}
+
+	var order model.ACMEOrder
+	err = store.GetDB().Where("workspace_id = ? AND cert_serial = ? AND status = ?", workspaceID, certSerial(cert), "valid").First(&order).Error
+	if err != nil {
+		return acmeProblem(http.StatusNotFound, "malformed", "证书不是由该 CA 签发")
+	}
+	if leaf, err := certcrypto.ParsePEMCertificate(order.CertPEM); err != nil || !leaf.Equal(cert) {
+		return acmeProblem(http.StatusNotFound, "malformed", "证书不是由该 CA 签发")
+	}
+
+	if !s.canRevoke(req, &order, cert) {
+		return acmeProblem(http.StatusForbidden, "unauthorized", "无权吊销该证书")
+	}
+
+	now := time.Now()
+	result := store.GetDB().Model(&model.ACMEOrder{}).
+		Where("id = ? AND revoked_at IS NULL", order.ID).
+		Updates(map[string]interface{}{"revoked_at": &now, "revocation_reason": reason})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return acmeProblem(http.StatusBadRequest, "alreadyRevoked", "证书已吊销")
+	}
+
+	var names []string
+	for _, id := range order.GetIdentifiers() {
+		names = append(names, id.Value)
+	}
+	s.logger.Info("acme_server", fmt.Sprintf("ACME 客户端吊销证书: %s", strings.Join(names, ", ")), map[string]interface{}{
+		"order_id": order.ID,
+		"serial":   order.CertSerial,
+		"reason":   reason,
+	})
+	return nil
+}
+
+// canRevoke 请求方是否有权吊销证书
+func (s *ACMEServerService) canRevoke(req *ACMERequest, order *model.ACMEOrder, cert *x509.Certificate) bool {
+	if req.JWK != nil {
+		thumbprint, err := jwkThumbprint(req.JWK)
+		if err != nil {
+			return false
+		}
+		certThumbprint, err := jwkThumbprint(&jose.JSONWebKey{Key: cert.PublicKey})
+		return err == nil && thumbprint == certThumbprint
+	}
+
+	if req.Account.ID == order.AccountID {
+		return true
+	}
+
+	// 账号持有证书全部标识符的有效授权
+	var authzs []model.ACMEAuthorization
+	store.GetDB().
+		Joins("JOIN acme_orders ON acme_orders.id = acme_authorizations.order_id").
+		Where("acme_orders.account_id = ? AND acme_authorizations.status = ? AND acme_authorizations.expires > ?", req.Account.ID, "valid", time.Now()).
+		Find(&authzs)
+	valid := make(map[string]bool, len(authzs))
+	for _, authz := range authzs {
+		name := authz.Value
+		if authz.Wildcard {
+			name = "*." + name
+		}
+		valid[name] = true
+	}
+	for _, id := range order.GetIdentifiers() {
+		if !valid[id.Value] {
+			return false
+		}
+	}
+	return true
+}
+
+// CRL 生成工作区的证书吊销列表 (DER)，由中间证书签名，只包含未过期的已吊销证书
+// 包括 ACME 客户端吊销的证书和证书列表中吊销的私有 CA 证书
+func (s *ACMEServerService) CRL(workspaceID uint) ([]byte, error) {
+	ca, err := s.workspaces.LoadPrivateCA(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []model.ACMEOrder
+	if err := store.GetDB().Where("workspace_id = ? AND revoked_at IS NOT NULL", workspaceID).Order("id").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	var certs []model.Certificate
+	if err := store.GetDB().Where("workspace_id = ? AND revoked_at IS NOT NULL", workspaceID).Order("id").Find(&certs).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tpl := &x509.RevocationList{
+		Number:     big.NewInt(now.Unix()),
+		ThisUpdate: now,
+		NextUpdate: now.Add(acmeCRLLifetime),
+	}
+	add := func(certPEM []byte, revokedAt time.Time, reason int) {
+		leaf, err := certcrypto.ParsePEMCertificate(certPEM)
+		if err != nil || now.After(leaf.NotAfter) {
+			return
+		}
+		tpl.RevokedCertificateEntries = append(tpl.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   leaf.SerialNumber,
+			RevocationTime: revokedAt,
+			ReasonCode:     reason,
+		})
+	}
+	for _, order := range orders {
+		add(order.CertPEM, *order.RevokedAt, order.RevocationReason)
+	}
+	for _, cert := range certs {
+		add(cert.CertPEM, *cert.RevokedAt, cert.RevocationReason)
+	}
+
+	return x509.CreateRevocationList(rand.Reader, tpl, ca.Intermediate, ca.key)
+}
+
+// ChangeKey 更换账号公钥 (RFC 8555 7.3.5)，payload 为新公钥签名的内层 JWS
+// 新公钥已被其他账号使用时返回该账号 ID 和 409 错误
+func (s *ACMEServerService) ChangeKey(account *model.ACMEAccount, payload []byte, url, accountURL string) (uint, error) {
+	inner, err := jose.ParseSigned(string(payload), acmeSignatureAlgorithms)
+	if err != nil {
+		return 0, acmeProblem(http.StatusBadRequest, "malformed", fmt.Sprintf("解析内层 JWS 失败: %v", err))
+	}
+	if len(inner.Signatures) != 1 {
+		return 0, acmeProblem(http.StatusBadRequest, "malformed", "内层 JWS 必须只有一个签名")
+	}
+	header := inner.Signatures[0].Protected
+	if header.JSONWebKey == nil || header.KeyID != "" {
+		return 0, acmeProblem(http.StatusBadRequest, "malformed", "内层 JWS 必须使用新公钥 jwk 签名")
+	}
+	if !header.JSONWebKey.IsPublic() || !header.JSONWebKey.Valid() {
+		return 0, acmeProblem(http.StatusBadRequest, "badPublicKey", "jwk 必须是有效的公钥")
+	}
+	if header.Nonce != "" {
+		return 0, acmeProblem(http.StatusBadRequest, "malformed", "内层 JWS 不能包含 nonce")
+	}
+	if innerURL, _ := header.ExtraHeaders["url"].(string); innerURL != url {
+		return 0, acmeProblem(http.StatusBadRequest, "malformed", "内层 JWS 的 url 与外层不一致")
+	}
+	data, err := inner.Verify(header.JSONWebKey)
+	if err != nil {
+		return 0, acmeProblem(http.StatusBadRequest, "malformed", "内层 JWS 签名验证失败")
+	}
+
+	var keyChange struct {
+		Account string          `json:"account"`
+		OldKey  jose.JSONWebKey `json:"oldKey"`
+	}
+	if err := json.Unmarshal(data, &keyChange); err != nil {
+		return 0, acmeProblem(http.StatusBadRequest, "malformed", fmt.Sprintf("解析内层 JWS 内容失败: %v", err))
+	}
+	if keyChange.Account != accountURL {
+		return 0, acmeProblem(http.StatusBadRequest, "malformed", "account 与签名账号不一致")
+	}
+	if oldThumbprint, err := jwkThumbprint(&keyChange.OldKey); err != nil || oldThumbprint != account.Thumbprint {
+		return 0, acmeProblem(http.StatusBadRequest, "malformed", "oldKey 与账号当前公钥不一致")
+	}
+
+	thumbprint, err := jwkThumbprint(header.JSONWebKey)
+	if err != nil {
+		return 0, acmeProblem(http.StatusBadRequest, "badPublicKey", err.Error())
+	}
+	if thumbprint == account.Thumbprint {
+		return 0, acmeProblem(http.StatusBadRequest, "malformed", "新公钥与当前公钥相同")
+	}
+	var existing model.ACMEAccount
+	if err := store.GetDB().Where("workspace_id = ? AND thumbprint = ?", account.WorkspaceID, thumbprint).First(&existing).Error; err == nil {
+		return existing.ID, acmeProblem(http.StatusConflict, "malformed", "新公钥已被其他账号使用")
+	}
+
+	jwk, err := header.JSONWebKey.MarshalJSON()
+	if err != nil {
+		return 0, err
+	}
+	if err := store.GetDB().Model(account).Updates(map[string]interface{}{
+		"thumbprint": thumbprint,
+		"jwk":        string(jwk),
+	}).Error; err != nil {
+		return 0, err
+	}
+
+	s.logger.Info("acme_server", fmt.Sprintf("ACME 客户端更换账号公钥: %d", account.ID), nil)
+	return 0, nil
+}
+
+// certSerial 证书序列号的十六进制表示
+func certSerial(cert *x509.Certificate) string {
+	return fmt.Sprintf("%X", cert.SerialNumber)
+}
+
+// jwkThumbprint 计算 JWK 的 SHA-256 指纹 (RFC 7638)，即 keyAuthorization 中的账号部分
+func jwkThumbprint(jwk *jose.JSONWebKey) (string, error) {
+	sum, err := jwk.Thumbprint(gocrypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sum), nil
+}
+
+// randomToken 生成 base64url 编码的随机令牌
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
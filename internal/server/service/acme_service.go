@@ -5,33 +5,35 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"encoding/json"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	"io"
+	mrand "math/rand"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/BlakeLiAFK/letsync/internal/server/dnsprovider"
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/go-acme/lego/v4/acme"
+	"github.com/go-acme/lego/v4/acme/api"
 	"github.com/go-acme/lego/v4/certcrypto"
 	"github.com/go-acme/lego/v4/certificate"
 	"github.com/go-acme/lego/v4/challenge"
 	"github.com/go-acme/lego/v4/challenge/dns01"
 	"github.com/go-acme/lego/v4/challenge/http01"
+	"github.com/go-acme/lego/v4/challenge/resolver"
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
 	"github.com/go-acme/lego/v4/lego"
-	"github.com/go-acme/lego/v4/providers/dns/alidns"
-	"github.com/go-acme/lego/v4/providers/dns/cloudflare"
-	"github.com/go-acme/lego/v4/providers/dns/godaddy"
-	"github.com/go-acme/lego/v4/providers/dns/route53"
-	"github.com/go-acme/lego/v4/providers/dns/tencentcloud"
+	"github.com/go-acme/lego/v4/providers/http/webroot"
 	"github.com/go-acme/lego/v4/registration"
 )
 
-// 环境变量互斥锁，防止并发请求时环境变量污染
-var envMutex sync.Mutex
+// ErrARIUnsupported CA 未提供续期信息 (ARI) 接口
+var ErrARIUnsupported = errors.New("CA 不支持 ACME 续期信息 (ARI)")
 
 // ACMEService ACME 证书申请服务
 type ACMEService struct {
@@ -75,13 +77,21 @@ func NewACMEService(dataDir string) *ACMEService {
 
 // CertRequest 证书申请请求
 type CertRequest struct {
-	Domain        string
-	SAN           []string
-	ChallengeType string // dns-01 或 http-01
-	DNSProviderID uint   // DNS-01 时必填
-	WorkspaceID   *uint  // 工作区 ID，为空则用全局配置
-	CertID        uint   // 证书ID，用于记录任务日志
-	TaskType      string // 任务类型: issue 或 renew，用于日志记录
+	Domain           string
+	SAN              []string
+	ChallengeType    string                  // dns-01、http-01 或 tls-alpn-01
+	HTTP01Mode       string                  // HTTP-01 放置方式: 空为服务器监听端口, agent, webroot, proxy
+	HTTP01Webroot    string                  // HTTP-01 webroot 模式写入的目录
+	DNSProviderID    uint                    // DNS-01 时必填
+	ChallengeAlias   string                  // DNS-01 验证别名，TXT 记录写入 _acme-challenge.<别名>
+	DomainChallenges []model.DomainChallenge // 按域名覆盖的验证配置，未列出的域名使用证书级配置
+	WorkspaceID      *uint                   // 工作区 ID，为空则用全局配置
+	CertID           uint                    // 证书ID，用于记录任务日志
+	TaskType         string                  // 任务类型: issue 或 renew，用于日志记录
+	CSR              []byte                  // PEM 格式 CSR，提供时使用 ObtainForCSR，服务器不生成私钥
+	ReplacesCert     []byte                  // 被替换的旧证书 PEM，续期时用于 ARI replaces 字段
+	Profile          string                  // ACME 证书 Profile，为空则使用工作区或全局配置
+	PreferredChain   string                  // 首选证书链（根证书 CN），为空则使用工作区或全局配置
 }
 
 // RequestCertificate 申请证书 (兼容旧接口，默认 DNS-01)
@@ -108,23 +118,84 @@ func (s *ACMEService) RequestCertificateWithChallenge(req CertRequest) (*certifi
 	})
 
 	if req.CertID > 0 {
+		defer beginIssue(req.CertID)()
 		s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("开始申请证书: %s", req.Domain), map[string]interface{}{
 			"san": req.SAN,
 			"challenge_type": req.ChallengeType,
 		})
 	}
 
+	// 自带 CSR 时预先解析，域名以 CSR 为准
+	var csr *x509.CertificateRequest
+	if len(req.CSR) > 0 {
+		parsed, err := ParseCSR(req.CSR)
+		if err != nil {
+			if req.CertID > 0 {
+				s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("CSR 无效: %v", err), nil)
+			}
+			return nil, err
+		}
+		csr = parsed
+	}
+
+	// 私有 CA 工作区直接签发，不经过 ACME
+	if NewWorkspaceService().IsPrivateCA(req.WorkspaceID) {
+		return s.issueFromPrivateCA(req, csr, taskType)
+	}
+
 	// 获取超时配置 (默认 300 秒 = 5 分钟，DNS 传播通常需要 2-10 分钟)
 	timeout := s.settings.GetInt("acme.challenge_timeout")
 	if timeout <= 0 {
 		timeout = 300
 	}
 
+	// 构建域名列表
+	domains := []string{req.Domain}
+	domains = append(domains, req.SAN...)
+
+	// 确定每个域名的验证方式（自带 CSR 时以 CSR 中的域名为准）
+	challengeDomains := domains
+	if csr != nil {
+		challengeDomains = CSRDomains(csr)
+	}
+	plan, challengeTypes, err := challengePlan(req, challengeDomains)
+	if err != nil {
+		if req.CertID > 0 {
+			s.taskLog.Error(req.CertID, taskType, err.Error(), nil)
+		}
+		return nil, err
+	}
+
+	// 先等待内置验证服务的监听端口再占用签发名额，避免排队等待端口的任务占满名额阻塞其它任务
+	if ports := s.challengePorts(req, challengeTypes); len(ports) > 0 {
+		if req.CertID > 0 {
+			s.taskLog.Info(req.CertID, taskType, "等待验证端口空闲...", map[string]interface{}{
+				"ports": ports,
+			})
+		}
+		unlockPorts := lockPorts(ports)
+		defer unlockPorts()
+	}
+
+	// 等待签发名额，超出并发上限的任务排队执行
+	maxConcurrent := s.settings.GetInt("acme.max_concurrent")
+	if maxConcurrent <= 0 {
+		maxConcurrent = 3
+	}
+	if req.CertID > 0 {
+		s.taskLog.Info(req.CertID, taskType, "等待签发名额...", map[string]interface{}{
+			"max_concurrent": maxConcurrent,
+		})
+	}
+	globalIssuePool.acquire(maxConcurrent)
+	defer globalIssuePool.release()
+
 	// 创建 ACME 客户端
 	if req.CertID > 0 {
 		s.taskLog.Info(req.CertID, taskType, "正在创建 ACME 客户端...", nil)
 	}
-	client, err := s.createACMEClientWithWorkspace(req.WorkspaceID)
+	// 主域名为 IP 地址时不设置 CN，IP 只出现在 SAN 中（lego 会按 IP 类型提交标识符）
+	client, clientConfig, err := s.newACMEClient(req.WorkspaceID, csr == nil && IsIPAddress(req.Domain))
 	if err != nil {
 		if req.CertID > 0 {
 			s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("创建 ACME 客户端失败: %v", err), nil)
@@ -136,113 +207,41 @@ func (s *ACMEService) RequestCertificateWithChallenge(req CertRequest) (*certifi
 		s.taskLog.Info(req.CertID, taskType, "ACME 客户端创建成功", nil)
 	}
 
-	// 根据验证方式设置 Provider
-	switch req.ChallengeType {
-	case "http-01":
-		// HTTP-01 验证
-		if req.CertID > 0 {
-			s.taskLog.Info(req.CertID, taskType, "正在设置 HTTP-01 验证...", nil)
-		}
-		httpPort := s.settings.GetInt("acme.http_port")
-		if httpPort <= 0 {
-			httpPort = 80
-		}
-		// 使用内置 HTTP 服务器
-		httpProvider := http01.NewProviderServer("", fmt.Sprintf("%d", httpPort))
-		if err := client.Challenge.SetHTTP01Provider(httpProvider); err != nil {
-			if req.CertID > 0 {
-				s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("设置 HTTP-01 Provider 失败: %v", err), nil)
-			}
-			return nil, fmt.Errorf("设置 HTTP-01 Provider 失败: %w", err)
-		}
-		if req.CertID > 0 {
-			s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("HTTP-01 验证监听端口: %d", httpPort), nil)
-		}
-		s.logger.Info("acme", fmt.Sprintf("HTTP-01 验证监听端口: %d", httpPort), nil)
-
-	case "dns-01":
-		fallthrough
-	default:
-		// DNS-01 验证 (默认)
-		if req.CertID > 0 {
-			s.taskLog.Info(req.CertID, taskType, "正在设置 DNS-01 验证...", nil)
-		}
-		if req.DNSProviderID == 0 {
-			if req.CertID > 0 {
-				s.taskLog.Error(req.CertID, taskType, "DNS-01 验证需要选择 DNS 提供商", nil)
-			}
-			return nil, fmt.Errorf("DNS-01 验证需要选择 DNS 提供商")
-		}
-
-		provider, err := s.dnsProvider.Get(req.DNSProviderID)
+	// 只使用一种验证方式时直接设置客户端的 Provider；混用时每种方式使用独立的 SolverManager，按域名分组验证
+	managers := map[string]*resolver.SolverManager{challengeTypes[0]: client.Challenge}
+	if len(challengeTypes) > 1 {
+		routed, err := s.routeChallenges(client, clientConfig, challengeTypes, plan)
 		if err != nil {
 			if req.CertID > 0 {
-				s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("获取 DNS 提供商失败: %v", err), nil)
+				s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("设置验证方式失败: %v", err), nil)
 			}
-			return nil, err
+			return nil, fmt.Errorf("设置验证方式失败: %w", err)
 		}
-
+		managers = routed
 		if req.CertID > 0 {
-			s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("使用 DNS 提供商: %s (%s)", provider.Name, provider.Type), nil)
+			s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("按域名混用验证方式: %v", challengeTypes), nil)
 		}
+	}
 
-		config, err := s.dnsProvider.GetDecryptedConfig(req.DNSProviderID)
-		if err != nil {
-			if req.CertID > 0 {
-				s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("获取 DNS 配置失败: %v", err), nil)
+	// 根据验证方式设置 Provider
+	for _, challengeType := range challengeTypes {
+		switch challengeType {
+		case "http-01":
+			if err := s.setupHTTP01(managers[challengeType], req, taskType); err != nil {
+				return nil, err
 			}
-			return nil, fmt.Errorf("获取 DNS 配置失败: %w", err)
-		}
-
-		// 申请前清理旧的 ACME challenge 记录（避免 "记录已存在" 错误）
-		cleanupDomains := []string{req.Domain}
-		cleanupDomains = append(cleanupDomains, req.SAN...)
-		if err := s.cleanupACMEChallengeRecords(cleanupDomains, provider.Type, config); err != nil {
-			s.logger.Warn("acme", fmt.Sprintf("清理旧 ACME challenge 记录失败: %v", err), nil)
-		}
-
-		dnsProvider, err := s.createDNSProvider(provider.Type, config)
-		if err != nil {
-			if req.CertID > 0 {
-				s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("创建 DNS Provider 失败: %v", err), nil)
+		case "tls-alpn-01":
+			if err := s.setupTLSALPN01(managers[challengeType], req, taskType); err != nil {
+				return nil, err
 			}
-			return nil, fmt.Errorf("创建 DNS Provider 失败: %w", err)
-		}
-
-		// 根据 DNS 提供商选择最优的公共 DNS 服务器顺序
-		var publicDNS []string
-		switch provider.Type {
-		case "cloudflare":
-			// Cloudflare 优先使用自家 DNS
-			publicDNS = []string{"1.1.1.1:53", "8.8.8.8:53", "223.5.5.5:53"}
-		case "aliyun":
-			// 阿里云优先使用阿里 DNS
-			publicDNS = []string{"223.5.5.5:53", "223.6.6.6:53", "8.8.8.8:53"}
-		case "dnspod":
-			// DNSPod/腾讯云优先使用腾讯 DNS
-			publicDNS = []string{"119.29.29.29:53", "223.5.5.5:53", "8.8.8.8:53"}
 		default:
-			publicDNS = []string{"8.8.8.8:53", "1.1.1.1:53", "223.5.5.5:53"}
-		}
-		if err := client.Challenge.SetDNS01Provider(
-			dnsProvider,
-			dns01.AddDNSTimeout(time.Duration(timeout)*time.Second),
-			dns01.AddRecursiveNameservers(publicDNS),
-		); err != nil {
-			if req.CertID > 0 {
-				s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("设置 DNS-01 Provider 失败: %v", err), nil)
+			// DNS-01 验证 (默认)
+			if err := s.setupDNS01(managers[challengeType], req, taskType, dnsRoutes(plan, challengeDomains), timeout); err != nil {
+				return nil, err
 			}
-			return nil, fmt.Errorf("设置 DNS Provider 失败: %w", err)
-		}
-		if req.CertID > 0 {
-			s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("DNS-01 验证配置完成，超时时间: %d 秒", timeout), nil)
 		}
 	}
 
-	// 构建域名列表
-	domains := []string{req.Domain}
-	domains = append(domains, req.SAN...)
-
 	if req.CertID > 0 {
 		s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("准备申请证书，域名: %v", domains), nil)
 
@@ -266,17 +265,57 @@ func (s *ACMEService) RequestCertificateWithChallenge(req CertRequest) (*certifi
 		})
 	}
 
-	// 申请证书
-	if req.CertID > 0 {
-		s.taskLog.Info(req.CertID, taskType, "🔑 正在生成私钥和证书签名请求 (CSR)...", nil)
+	// 续期时声明替换的旧证书 (RFC 9773)，CA 不支持 ARI 时 lego 会忽略
+	var replacesCertID string
+	if len(req.ReplacesCert) > 0 {
+		if oldCert, err := certcrypto.ParsePEMCertificate(req.ReplacesCert); err == nil {
+			replacesCertID, _ = certificate.MakeARICertID(oldCert)
+		}
 	}
 
-	request := certificate.ObtainRequest{
-		Domains: domains,
-		Bundle:  true,
+	defaultProfile, defaultChain := s.orderDefaults(req.WorkspaceID)
+	profile := req.Profile
+	if profile == "" {
+		profile = defaultProfile
+	}
+	if profile != "" && req.CertID > 0 {
+		s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("使用证书 Profile: %s", profile), nil)
+	}
+	preferredChain := req.PreferredChain
+	if preferredChain == "" {
+		preferredChain = defaultChain
+	}
+	if preferredChain != "" && req.CertID > 0 {
+		s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("首选证书链: %s", preferredChain), nil)
 	}
 
-	certificates, err := client.Certificate.Obtain(request)
+	// 申请证书
+	var certificates *certificate.Resource
+	if csr != nil {
+		if req.CertID > 0 {
+			s.taskLog.Info(req.CertID, taskType, "🔑 使用自带 CSR 申请证书（私钥不经过服务器）", map[string]interface{}{
+				"csr_domains": CSRDomains(csr),
+			})
+		}
+		certificates, err = client.Certificate.ObtainForCSR(certificate.ObtainForCSRRequest{
+			CSR:            csr,
+			Bundle:         true,
+			PreferredChain: preferredChain,
+			Profile:        profile,
+			ReplacesCertID: replacesCertID,
+		})
+	} else {
+		if req.CertID > 0 {
+			s.taskLog.Info(req.CertID, taskType, "🔑 正在生成私钥和证书签名请求 (CSR)...", nil)
+		}
+		certificates, err = client.Certificate.Obtain(certificate.ObtainRequest{
+			Domains:        domains,
+			Bundle:         true,
+			PreferredChain: preferredChain,
+			Profile:        profile,
+			ReplacesCertID: replacesCertID,
+		})
+	}
 	if err != nil {
 		// 详细记录错误信息
 		errMsg := err.Error()
@@ -364,12 +403,241 @@ func (s *ACMEService) RequestCertificateWithChallenge(req CertRequest) (*certifi
 	return certificates, nil
 }
 
-// CheckHTTPPort 检查 HTTP 端口是否可用
-func (s *ACMEService) CheckHTTPPort() error {
+// routeChallenges 为混用的每种验证方式创建独立的 SolverManager，并替换客户端的签发器按域名分组验证
+func (s *ACMEService) routeChallenges(client *lego.Client, config *lego.Config, challengeTypes []string, plan map[string]domainChallenge) (map[string]*resolver.SolverManager, error) {
+	core, err := api.New(config.HTTPClient, config.UserAgent, config.CADirURL, config.User.GetRegistration().URI, config.User.GetPrivateKey())
+	if err != nil {
+		return nil, err
+	}
+
+	managers := make(map[string]*resolver.SolverManager, len(challengeTypes))
+	router := &challengeRouter{
+		probers: make(map[string]interface {
+			Solve(authorizations []acme.Authorization) error
+		}, len(challengeTypes)),
+		types: challengeTypes,
+		plan:  plan,
+	}
+	for _, challengeType := range challengeTypes {
+		manager := resolver.NewSolversManager(core)
+		managers[challengeType] = manager
+		router.probers[challengeType] = resolver.NewProber(manager)
+	}
+
+	client.Certificate = certificate.NewCertifier(core, router, certificate.CertifierOptions{
+		KeyType:             config.Certificate.KeyType,
+		Timeout:             config.Certificate.Timeout,
+		OverallRequestLimit: config.Certificate.OverallRequestLimit,
+		DisableCommonName:   config.Certificate.DisableCommonName,
+	})
+	return managers, nil
+}
+
+// challengePorts 返回本次签发的内置验证服务需要独占的监听端口
+func (s *ACMEService) challengePorts(req CertRequest, challengeTypes []string) []int {
+	var ports []int
+	for _, challengeType := range challengeTypes {
+		switch challengeType {
+		case "http-01":
+			if req.HTTP01Mode == "" {
+				ports = append(ports, s.httpPort())
+			}
+		case "tls-alpn-01":
+			ports = append(ports, s.tlsPort())
+		}
+	}
+	return ports
+}
+
+// setupHTTP01 设置 HTTP-01 Provider，使用内置端口时调用方需已持有端口锁
+func (s *ACMEService) setupHTTP01(manager *resolver.SolverManager, req CertRequest, taskType string) error {
+	if req.CertID > 0 {
+		s.taskLog.Info(req.CertID, taskType, "正在设置 HTTP-01 验证...", nil)
+	}
+	if req.HTTP01Mode != "" {
+		provider, desc, err := s.http01Provider(req, taskType)
+		if err == nil {
+			err = manager.SetHTTP01Provider(provider)
+		}
+		if err != nil {
+			if req.CertID > 0 {
+				s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("设置 HTTP-01 Provider 失败: %v", err), nil)
+			}
+			return fmt.Errorf("设置 HTTP-01 Provider 失败: %w", err)
+		}
+		if req.CertID > 0 {
+			s.taskLog.Info(req.CertID, taskType, desc, nil)
+		}
+		return nil
+	}
+
+	// 使用内置 HTTP 服务器，同一端口同时只能有一个签发任务监听（端口锁由调用方获取）
+	httpPort := s.httpPort()
+	httpProvider := http01.NewProviderServer("", fmt.Sprintf("%d", httpPort))
+	if err := manager.SetHTTP01Provider(httpProvider); err != nil {
+		if req.CertID > 0 {
+			s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("设置 HTTP-01 Provider 失败: %v", err), nil)
+		}
+		return fmt.Errorf("设置 HTTP-01 Provider 失败: %w", err)
+	}
+	if req.CertID > 0 {
+		s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("HTTP-01 验证监听端口: %d", httpPort), nil)
+	}
+	s.logger.Info("acme", fmt.Sprintf("HTTP-01 验证监听端口: %d", httpPort), nil)
+	return nil
+}
+
+// setupTLSALPN01 设置 TLS-ALPN-01 Provider（适用于 80 端口不可达但 443 可达的主机），调用方需已持有端口锁
+func (s *ACMEService) setupTLSALPN01(manager *resolver.SolverManager, req CertRequest, taskType string) error {
+	if req.CertID > 0 {
+		s.taskLog.Info(req.CertID, taskType, "正在设置 TLS-ALPN-01 验证...", nil)
+	}
+	if err := s.CheckTLSPort(); err != nil {
+		if req.CertID > 0 {
+			s.taskLog.Error(req.CertID, taskType, err.Error(), nil)
+		}
+		return err
+	}
+	// 使用内置 TLS 服务器，同一端口同时只能有一个签发任务监听（端口锁由调用方获取）
+	tlsPort := s.tlsPort()
+	tlsProvider := tlsalpn01.NewProviderServer("", fmt.Sprintf("%d", tlsPort))
+	if err := manager.SetTLSALPN01Provider(tlsProvider); err != nil {
+		if req.CertID > 0 {
+			s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("设置 TLS-ALPN-01 Provider 失败: %v", err), nil)
+		}
+		return fmt.Errorf("设置 TLS-ALPN-01 Provider 失败: %w", err)
+	}
+	if req.CertID > 0 {
+		s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("TLS-ALPN-01 验证监听端口: %d", tlsPort), nil)
+	}
+	s.logger.Info("acme", fmt.Sprintf("TLS-ALPN-01 验证监听端口: %d", tlsPort), nil)
+	return nil
+}
+
+// setupDNS01 设置 DNS-01 Provider，域名使用不同提供商时按域名分发
+func (s *ACMEService) setupDNS01(manager *resolver.SolverManager, req CertRequest, taskType string, routes []dnsRoute, timeout int) error {
+	if req.CertID > 0 {
+		s.taskLog.Info(req.CertID, taskType, "正在设置 DNS-01 验证...", nil)
+	}
+
+	var dnsProvider challenge.Provider
+	providers := make(map[string]challenge.Provider)
+	propagation := make(map[string]dnsprovider.Propagation)
+	for _, route := range routes {
+		provider, settings, err := s.routeDNSProvider(req, taskType, route)
+		if err != nil {
+			return err
+		}
+		dnsProvider = provider
+		for _, domain := range route.Domains {
+			providers[domain] = provider
+			propagation[domain] = settings
+		}
+	}
+	if len(routes) > 1 {
+		dnsProvider = newDNSRouter(providers)
+	}
+
+	if err := manager.SetDNS01Provider(
+		dnsProvider,
+		dns01.AddDNSTimeout(time.Duration(timeout)*time.Second),
+		// 按域名所属提供商的设置和递归 DNS 检查传播
+		dns01.WrapPreCheck(func(domain, fqdn, value string, check dns01.PreCheckFunc) (bool, error) {
+			return propagation[strings.TrimPrefix(strings.ToLower(domain), "*.")].Check(fqdn, value, check)
+		}),
+	); err != nil {
+		if req.CertID > 0 {
+			s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("设置 DNS-01 Provider 失败: %v", err), nil)
+		}
+		return fmt.Errorf("设置 DNS Provider 失败: %w", err)
+	}
+	if req.CertID > 0 {
+		// 提供商可单独设置传播超时，多个提供商时取最长
+		propagationTimeout := time.Duration(timeout) * time.Second
+		if pt, ok := dnsProvider.(challenge.ProviderTimeout); ok {
+			propagationTimeout, _ = pt.Timeout()
+		}
+		s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("DNS-01 验证配置完成，超时时间: %d 秒", int(propagationTimeout.Seconds())), nil)
+	}
+	return nil
+}
+
+// routeDNSProvider 创建一组域名使用的 DNS Provider，返回该提供商的传播检查设置
+func (s *ACMEService) routeDNSProvider(req CertRequest, taskType string, route dnsRoute) (challenge.Provider, dnsprovider.Propagation, error) {
+	provider, err := s.dnsProvider.Get(route.DNSProviderID)
+	if err != nil {
+		if req.CertID > 0 {
+			s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("获取 DNS 提供商失败: %v", err), nil)
+		}
+		return nil, dnsprovider.Propagation{}, err
+	}
+
+	if req.CertID > 0 {
+		s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("使用 DNS 提供商: %s (%s)", provider.Name, provider.Type), map[string]interface{}{
+			"domains": route.Domains,
+		})
+	}
+
+	config, err := s.dnsProvider.GetDecryptedConfig(route.DNSProviderID)
+	if err != nil {
+		if req.CertID > 0 {
+			s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("获取 DNS 配置失败: %v", err), nil)
+		}
+		return nil, dnsprovider.Propagation{}, fmt.Errorf("获取 DNS 配置失败: %w", err)
+	}
+
+	// 申请前清理旧的 ACME challenge 记录（避免 "记录已存在" 错误）
+	cleanupDomains := route.Domains
+	if route.ChallengeAlias != "" {
+		cleanupDomains = []string{route.ChallengeAlias}
+	}
+	if result, err := s.dnsProvider.Cleanup(route.DNSProviderID, cleanupDomains); err != nil {
+		s.logger.Warn("acme", fmt.Sprintf("清理旧 ACME challenge 记录失败: %v", err), nil)
+	} else {
+		for _, msg := range result.Errors {
+			s.logger.Warn("acme", fmt.Sprintf("清理旧 ACME challenge 记录失败: %s", msg), nil)
+		}
+		if result.Removed > 0 {
+			s.logger.Info("acme", fmt.Sprintf("已清理 %d 条旧的 ACME challenge 记录", result.Removed), nil)
+		}
+	}
+
+	dnsProvider, err := s.createDNSProvider(provider.Type, config)
+	if err != nil {
+		if req.CertID > 0 {
+			s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("创建 DNS Provider 失败: %v", err), nil)
+		}
+		return nil, dnsprovider.Propagation{}, fmt.Errorf("创建 DNS Provider 失败: %w", err)
+	}
+	// 记录写入的 TXT 记录，验证中断时仍可通过清理接口删除
+	dnsProvider = s.dnsProvider.Track(route.DNSProviderID, dnsProvider)
+	if route.ChallengeAlias != "" {
+		dnsProvider = dnsprovider.Alias(dnsProvider, route.ChallengeAlias)
+		if req.CertID > 0 {
+			s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("验证记录写入别名: %s", dnsprovider.ChallengeFQDN(route.ChallengeAlias)), nil)
+		}
+	}
+
+	// 传播检查使用提供商配置的递归 DNS，未配置时按 DNS 提供商选择最优的公共 DNS 服务器顺序
+	settings := dnsprovider.PropagationSettings(provider.Type, config)
+	if req.CertID > 0 && settings.Skip {
+		s.taskLog.Info(req.CertID, taskType, fmt.Sprintf("DNS 提供商 %s 已设置跳过传播检查", provider.Name), nil)
+	}
+	return dnsProvider, settings, nil
+}
+
+// httpPort 获取 HTTP-01 验证端口
+func (s *ACMEService) httpPort() int {
 	httpPort := s.settings.GetInt("acme.http_port")
 	if httpPort <= 0 {
 		httpPort = 80
 	}
+	return httpPort
+}
+
+// CheckHTTPPort 检查 HTTP 端口是否可用
+func (s *ACMEService) CheckHTTPPort() error {
+	httpPort := s.httpPort()
 
 	// 尝试监听端口
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", httpPort))
@@ -403,6 +671,81 @@ func (s *ACMEService) GetHTTPChallengeInfo() map[string]interface{} {
 	}
 }
 
+// http01Provider 按证书配置的放置方式创建 HTTP-01 Provider，返回 Provider 及日志说明
+func (s *ACMEService) http01Provider(req CertRequest, taskType string) (challenge.Provider, string, error) {
+	switch req.HTTP01Mode {
+	case "agent":
+		// 委托绑定的 Agent 放置验证文件
+		provider, err := s.agentHTTP01Provider(req.CertID, taskType)
+		if err != nil {
+			return nil, "", err
+		}
+		return provider, "HTTP-01 验证文件由绑定的 Agent 放置", nil
+	case "webroot":
+		// 写入本机 Web 服务器的 webroot
+		if req.HTTP01Webroot == "" {
+			return nil, "", fmt.Errorf("webroot 模式需要配置 webroot 目录")
+		}
+		provider, err := webroot.NewHTTPProvider(req.HTTP01Webroot)
+		if err != nil {
+			return nil, "", fmt.Errorf("webroot 目录不可用 (%s): %w", req.HTTP01Webroot, err)
+		}
+		return provider, fmt.Sprintf("HTTP-01 验证文件写入 webroot: %s", req.HTTP01Webroot), nil
+	case "proxy":
+		// 由主路由提供，前置代理转发 /.well-known/acme-challenge/
+		return NewProxyHTTP01Provider(), "HTTP-01 验证文件由本服务 /.well-known/acme-challenge/ 提供", nil
+	default:
+		return nil, "", fmt.Errorf("不支持的 HTTP-01 放置方式: %s", req.HTTP01Mode)
+	}
+}
+
+// agentHTTP01Provider 创建委托 Agent 放置验证文件的 Provider
+func (s *ACMEService) agentHTTP01Provider(certID uint, taskType string) (*AgentHTTP01Provider, error) {
+	if certID == 0 {
+		return nil, fmt.Errorf("Agent 放置验证文件需要指定证书")
+	}
+
+	timeout := s.settings.GetInt("acme.challenge_timeout")
+	if timeout <= 0 {
+		timeout = 300
+	}
+
+	return NewAgentHTTP01Provider(certID, taskType, time.Duration(timeout)*time.Second)
+}
+
+// tlsPort 获取 TLS-ALPN-01 验证端口
+func (s *ACMEService) tlsPort() int {
+	tlsPort := s.settings.GetInt("acme.tls_port")
+	if tlsPort <= 0 {
+		tlsPort = 443
+	}
+	return tlsPort
+}
+
+// CheckTLSPort 检查 TLS-ALPN-01 端口是否可用
+func (s *ACMEService) CheckTLSPort() error {
+	tlsPort := s.tlsPort()
+
+	// 尝试监听端口
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", tlsPort))
+	if err != nil {
+		return fmt.Errorf("TLS-ALPN-01 验证端口 %d 不可用: %w", tlsPort, err)
+	}
+	listener.Close()
+	return nil
+}
+
+// GetTLSALPNChallengeInfo 获取 TLS-ALPN-01 验证信息
+func (s *ACMEService) GetTLSALPNChallengeInfo() map[string]interface{} {
+	tlsPort := s.tlsPort()
+
+	return map[string]interface{}{
+		"port":      tlsPort,
+		"available": s.CheckTLSPort() == nil,
+		"note":      "TLS-ALPN-01 验证需要域名解析到本服务器，且 443 端口可从公网访问",
+	}
+}
+
 // RenewCertificate 续期证书
 func (s *ACMEService) RenewCertificate(certID uint) (string, error) {
 	// 创建任务日志记录
@@ -417,11 +760,41 @@ func (s *ACMEService) RenewCertificate(certID uint) (string, error) {
 
 // RenewCertificateWithTaskID 使用指定的任务 ID 续期证书（用于异步调用）
 func (s *ACMEService) RenewCertificateWithTaskID(certID uint, taskID string) (string, error) {
+	return taskID, s.obtainAndSave(certID, taskID, "renew")
+}
+
+// IssueCertificateWithTaskID 使用指定的任务 ID 按证书当前配置申请证书（用于手动申请、Agent 提交 CSR 和批量任务的异步签发）
+func (s *ACMEService) IssueCertificateWithTaskID(certID uint, taskID string) error {
+	return s.obtainAndSave(certID, taskID, "issue")
+}
+
+// ReserveIssue 证书没有进行中的申请或续期时占用，返回释放函数；已有签发进行中时返回 false
+func (s *ACMEService) ReserveIssue(certID uint) (func(), bool) {
+	return tryBeginIssue(certID)
+}
+
+// IsIssuing 证书是否有进行中的申请或续期
+func (s *ACMEService) IsIssuing(certID uint) bool {
+	return isIssuing(certID)
+}
+
+// obtainAndSave 按证书当前配置申请证书并保存，任务状态在此更新
+func (s *ACMEService) obtainAndSave(certID uint, taskID, taskType string) error {
+	action := "申请"
+	if taskType == "renew" {
+		action = "续期"
+	}
+
 	cert, err := s.certService.Get(certID)
 	if err != nil {
-		s.taskLog.ErrorWithTaskID(taskID, certID, "renew", fmt.Sprintf("获取证书失败: %v", err), nil)
-		s.taskLog.CompleteTaskWithTaskID(taskID, certID, "renew", "failed")
-		return taskID, err
+		s.taskLog.ErrorWithTaskID(taskID, certID, taskType, fmt.Sprintf("获取证书失败: %v", err), nil)
+		s.taskLog.CompleteTaskWithTaskID(taskID, certID, taskType, "failed")
+		return err
+	}
+	if cert.IsImported() {
+		s.taskLog.ErrorWithTaskID(taskID, certID, taskType, ErrImportedCert.Error(), nil)
+		s.taskLog.CompleteTaskWithTaskID(taskID, certID, taskType, "failed")
+		return ErrImportedCert
 	}
 
 	// 使用原证书的验证方式重新申请
@@ -430,35 +803,49 @@ func (s *ACMEService) RenewCertificateWithTaskID(certID uint, taskID string) (st
 		challengeType = "dns-01" // 默认 DNS-01
 	}
 
+	var replaces []byte
+	if taskType == "renew" {
+		replaces = cert.CertPEM
+	}
+
 	newCert, err := s.RequestCertificateWithChallenge(CertRequest{
-		Domain:        cert.Domain,
-		SAN:           cert.GetSANList(),
-		ChallengeType: challengeType,
-		DNSProviderID: cert.DNSProviderID,
-		WorkspaceID:   cert.WorkspaceID, // 传入工作区 ID
-		CertID:        certID,           // 传入 certID 用于日志记录
-		TaskType:      "renew",          // 续期任务
+		Domain:           cert.Domain,
+		SAN:              cert.GetSANList(),
+		ChallengeType:    challengeType,
+		HTTP01Mode:       cert.HTTP01Mode,
+		HTTP01Webroot:    cert.HTTP01Webroot,
+		DNSProviderID:    cert.DNSProviderID,
+		ChallengeAlias:   cert.ChallengeAlias,
+		DomainChallenges: cert.GetDomainChallenges(),
+		WorkspaceID:      cert.WorkspaceID, // 传入工作区 ID
+		CertID:           certID,           // 传入 certID 用于日志记录
+		TaskType:         taskType,
+		CSR:              cert.CSRPEM, // 自带 CSR 的证书继续使用同一 CSR
+		ReplacesCert:     replaces,
+		Profile:          cert.Profile,
+		PreferredChain:   cert.PreferredChain,
 	})
 	if err != nil {
-		s.taskLog.ErrorWithTaskID(taskID, certID, "renew", fmt.Sprintf("续期证书失败: %v", err), nil)
-		s.logger.Error("acme", fmt.Sprintf("续期证书失败: %s - %v", cert.Domain, err), nil)
+		s.taskLog.ErrorWithTaskID(taskID, certID, taskType, fmt.Sprintf("%s证书失败: %v", action, err), nil)
+		s.logger.Error("acme", fmt.Sprintf("%s证书失败: %s - %v", action, cert.Domain, err), nil)
+		s.certService.SetLastError(certID, err.Error())
 
 		// 标记任务失败
-		if compErr := s.taskLog.CompleteTaskWithTaskID(taskID, certID, "renew", "failed"); compErr != nil {
+		if compErr := s.taskLog.CompleteTaskWithTaskID(taskID, certID, taskType, "failed"); compErr != nil {
 			s.logger.Error("acme", "标记任务状态失败", map[string]interface{}{"cert_id": certID, "error": compErr})
 		}
-		return taskID, err
+		return err
 	}
 
 	// 解析证书获取有效期
 	certInfo, err := certcrypto.ParsePEMCertificate(newCert.Certificate)
 	if err != nil {
-		s.taskLog.ErrorWithTaskID(taskID, certID, "renew", fmt.Sprintf("解析证书失败: %v", err), nil)
+		s.taskLog.ErrorWithTaskID(taskID, certID, taskType, fmt.Sprintf("解析证书失败: %v", err), nil)
 		// 标记任务失败
-		if compErr := s.taskLog.CompleteTaskWithTaskID(taskID, certID, "renew", "failed"); compErr != nil {
+		if compErr := s.taskLog.CompleteTaskWithTaskID(taskID, certID, taskType, "failed"); compErr != nil {
 			s.logger.Error("acme", "标记任务状态失败", map[string]interface{}{"cert_id": certID, "error": compErr})
 		}
-		return taskID, fmt.Errorf("解析证书失败: %w", err)
+		return fmt.Errorf("解析证书失败: %w", err)
 	}
 
 	// 更新证书
@@ -471,24 +858,107 @@ func (s *ACMEService) RenewCertificateWithTaskID(certID uint, taskID string) (st
 		certInfo.NotBefore,
 		certInfo.NotAfter,
 	); err != nil {
-		s.taskLog.ErrorWithTaskID(taskID, certID, "renew", fmt.Sprintf("保存证书失败: %v", err), nil)
+		s.taskLog.ErrorWithTaskID(taskID, certID, taskType, fmt.Sprintf("保存证书失败: %v", err), nil)
 		s.logger.Error("acme", fmt.Sprintf("保存证书失败: %s - %v", cert.Domain, err), nil)
 		// 标记任务失败
-		if compErr := s.taskLog.CompleteTaskWithTaskID(taskID, certID, "renew", "failed"); compErr != nil {
+		if compErr := s.taskLog.CompleteTaskWithTaskID(taskID, certID, taskType, "failed"); compErr != nil {
 			s.logger.Error("acme", "标记任务状态失败", map[string]interface{}{"cert_id": certID, "error": compErr})
 		}
-		return taskID, err
+		return err
 	}
 
-	s.taskLog.InfoWithTaskID(taskID, certID, "renew", fmt.Sprintf("证书续期成功，有效期至: %s", certInfo.NotAfter.Format("2006-01-02 15:04:05")), nil)
-	s.logger.Info("acme", fmt.Sprintf("证书续期成功: %s", cert.Domain), nil)
+	s.taskLog.InfoWithTaskID(taskID, certID, taskType, fmt.Sprintf("证书%s成功，有效期至: %s", action, certInfo.NotAfter.Format("2006-01-02 15:04:05")), nil)
+	s.logger.Info("acme", fmt.Sprintf("证书%s成功: %s", action, cert.Domain), nil)
 
 	// 标记任务完成
-	if compErr := s.taskLog.CompleteTaskWithTaskID(taskID, certID, "renew", "completed"); compErr != nil {
+	if compErr := s.taskLog.CompleteTaskWithTaskID(taskID, certID, taskType, "completed"); compErr != nil {
 		s.logger.Error("acme", "标记任务状态失败", map[string]interface{}{"cert_id": certID, "error": compErr})
 	}
 
-	return taskID, nil
+	return nil
+}
+
+// RefreshRenewalInfo 查询证书的 ARI 续期窗口并保存到数据库，同时更新传入的 cert
+// CA 不支持 ARI 时返回 ErrARIUnsupported，调用方应回退到提前续期天数规则
+func (s *ACMEService) RefreshRenewalInfo(cert *model.Certificate) error {
+	if NewWorkspaceService().IsPrivateCA(cert.WorkspaceID) {
+		return ErrARIUnsupported
+	}
+
+	now := time.Now()
+
+	leaf, err := certcrypto.ParsePEMCertificate(cert.CertPEM)
+	if err != nil {
+		return fmt.Errorf("解析证书失败: %w", err)
+	}
+
+	client, err := s.createACMEClientWithWorkspace(cert.WorkspaceID)
+	if err != nil {
+		s.certService.SetARINextCheck(cert.ID, now.Add(time.Hour))
+		return fmt.Errorf("创建 ACME 客户端失败: %w", err)
+	}
+
+	info, err := client.Certificate.GetRenewalInfo(certificate.RenewalInfoRequest{Cert: leaf})
+	if err != nil {
+		if errors.Is(err, api.ErrNoARI) {
+			// CA 不支持 ARI，一天后再确认
+			next := now.Add(24 * time.Hour)
+			s.certService.SetARINextCheck(cert.ID, next)
+			cert.ARINextCheckAt = &next
+			return ErrARIUnsupported
+		}
+		s.certService.SetARINextCheck(cert.ID, now.Add(time.Hour))
+		return fmt.Errorf("查询续期信息失败: %w", err)
+	}
+
+	start := info.SuggestedWindow.Start
+	end := info.SuggestedWindow.End
+
+	// 窗口未变化时保持已选定的续期时间，否则在新窗口内随机选择 (RFC 9773 4.2)
+	var renewAt time.Time
+	if cert.ARIRenewAt != nil && cert.ARIWindowStart != nil && cert.ARIWindowEnd != nil &&
+		cert.ARIWindowStart.Equal(start) && cert.ARIWindowEnd.Equal(end) {
+		renewAt = *cert.ARIRenewAt
+	} else {
+		renewAt = start
+		if window := end.Sub(start); window > 0 {
+			renewAt = start.Add(time.Duration(mrand.Int63n(int64(window))))
+		}
+	}
+
+	// 按 Retry-After 安排下次查询，限制在 1-24 小时之间
+	retryAfter := info.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = 6 * time.Hour
+	}
+	if retryAfter < time.Hour {
+		retryAfter = time.Hour
+	}
+	if retryAfter > 24*time.Hour {
+		retryAfter = 24 * time.Hour
+	}
+	nextCheck := now.Add(retryAfter)
+
+	s.certService.UpdateRenewalInfo(cert.ID, start, end, renewAt, nextCheck, info.ExplanationURL)
+
+	cert.ARIWindowStart = &start
+	cert.ARIWindowEnd = &end
+	cert.ARIRenewAt = &renewAt
+	cert.ARINextCheckAt = &nextCheck
+	cert.ARIExplanationURL = info.ExplanationURL
+
+	return nil
+}
+
+// orderDefaults 获取工作区或全局配置的默认 ACME Profile 和首选证书链
+func (s *ACMEService) orderDefaults(workspaceID *uint) (profile, preferredChain string) {
+	if workspaceID != nil && *workspaceID > 0 {
+		if workspace, err := NewWorkspaceService().Get(*workspaceID); err == nil {
+			return workspace.Profile, workspace.PreferredChain
+		}
+		return "", ""
+	}
+	return s.settings.Get("acme.profile"), s.settings.Get("acme.preferred_chain")
 }
 
 // createACMEClient 创建 ACME 客户端（使用全局配置）
@@ -498,6 +968,13 @@ func (s *ACMEService) createACMEClient() (*lego.Client, error) {
 
 // createACMEClientWithWorkspace 创建 ACME 客户端（支持工作区配置）
 func (s *ACMEService) createACMEClientWithWorkspace(workspaceID *uint) (*lego.Client, error) {
+	client, _, err := s.newACMEClient(workspaceID, false)
+	return client, err
+}
+
+// newACMEClient 创建并注册 ACME 客户端，同时返回客户端配置（混用验证方式时用于构建签发器）
+// disableCommonName 为 true 时生成的 CSR 不设置 CN，只使用 SAN
+func (s *ACMEService) newACMEClient(workspaceID *uint, disableCommonName bool) (*lego.Client, *lego.Config, error) {
 	var email, caURL, keyType string
 
 	// 根据是否指定工作区获取配置
@@ -506,7 +983,7 @@ func (s *ACMEService) createACMEClientWithWorkspace(workspaceID *uint) (*lego.Cl
 		workspaceService := NewWorkspaceService()
 		workspace, err := workspaceService.Get(*workspaceID)
 		if err != nil {
-			return nil, fmt.Errorf("获取工作区配置失败: %w", err)
+			return nil, nil, fmt.Errorf("获取工作区配置失败: %w", err)
 		}
 		email = workspace.Email
 		caURL = workspace.CaURL
@@ -519,7 +996,7 @@ func (s *ACMEService) createACMEClientWithWorkspace(workspaceID *uint) (*lego.Cl
 	}
 
 	if email == "" {
-		return nil, fmt.Errorf("请先配置 ACME 邮箱")
+		return nil, nil, fmt.Errorf("请先配置 ACME 邮箱")
 	}
 	if caURL == "" {
 		caURL = "https://acme-v02.api.letsencrypt.org/directory"
@@ -528,7 +1005,7 @@ func (s *ACMEService) createACMEClientWithWorkspace(workspaceID *uint) (*lego.Cl
 	// 生成或加载私钥（按工作区隔离）
 	privateKey, err := s.loadOrCreateKeyForWorkspace(workspaceID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	user := &ACMEUser{
@@ -538,18 +1015,10 @@ func (s *ACMEService) createACMEClientWithWorkspace(workspaceID *uint) (*lego.Cl
 
 	config := lego.NewConfig(user)
 	config.CADirURL = caURL
+	config.Certificate.DisableCommonName = disableCommonName
 
 	// 设置密钥类型
-	switch keyType {
-	case "EC384":
-		config.Certificate.KeyType = certcrypto.EC384
-	case "RSA2048":
-		config.Certificate.KeyType = certcrypto.RSA2048
-	case "RSA4096":
-		config.Certificate.KeyType = certcrypto.RSA4096
-	default:
-		config.Certificate.KeyType = certcrypto.EC256
-	}
+	config.Certificate.KeyType = certKeyType(keyType)
 
 	// 设置客户端超时（从系统设置读取）
 	timeout := s.settings.GetInt("acme.challenge_timeout")
@@ -559,23 +1028,24 @@ func (s *ACMEService) createACMEClientWithWorkspace(workspaceID *uint) (*lego.Cl
 	// HTTP 客户端超时需要比 DNS 验证超时更长，留出余量
 	httpTimeout := timeout + 60
 	config.HTTPClient.Timeout = time.Duration(httpTimeout) * time.Second
-	config.HTTPClient.Transport = &http.Transport{
-		ResponseHeaderTimeout: time.Duration(httpTimeout) * time.Second,
+	// 沿用 lego 默认的 Transport，保留代理和 LEGO_CA_CERTIFICATES 指定的私有 CA 根证书 (step-ca、Pebble 等)
+	if transport, ok := config.HTTPClient.Transport.(*http.Transport); ok {
+		transport.ResponseHeaderTimeout = time.Duration(httpTimeout) * time.Second
 	}
 
 	client, err := lego.NewClient(config)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// 注册账户
 	reg, err := client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	user.Registration = reg
 
-	return client, nil
+	return client, config, nil
 }
 
 // loadOrCreateKey 加载或创建私钥（使用全局配置）
@@ -638,317 +1108,17 @@ func (s *ACMEService) loadOrCreateKeyForWorkspace(workspaceID *uint) (*ecdsa.Pri
 	return key, nil
 }
 
-// clearDNSEnvVars 清理 DNS 相关的环境变量
-func clearDNSEnvVars() {
-	envVars := []string{
-		// Cloudflare (正确的环境变量名)
-		"CLOUDFLARE_DNS_API_TOKEN", "CLOUDFLARE_ZONE_API_TOKEN",
-		"CLOUDFLARE_API_KEY", "CLOUDFLARE_EMAIL",
-		// Aliyun
-		"ALICLOUD_ACCESS_KEY", "ALICLOUD_SECRET_KEY",
-		// Tencent Cloud
-		"TENCENTCLOUD_SECRET_ID", "TENCENTCLOUD_SECRET_KEY",
-		// AWS
-		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_REGION",
-		// GoDaddy
-		"GODADDY_API_KEY", "GODADDY_API_SECRET",
-	}
-	for _, v := range envVars {
-		os.Unsetenv(v)
-	}
-}
-
-// createDNSProvider 创建 DNS Provider
-// 使用互斥锁保护环境变量设置，避免并发问题
+// createDNSProvider 通过提供商注册表创建 DNS Provider
+// 凭据通过 lego 的 Config 结构体传入，不读写进程环境变量，可并发调用
 func (s *ACMEService) createDNSProvider(providerType string, config map[string]interface{}) (challenge.Provider, error) {
 	// 获取系统配置的超时时间
 	timeout := s.settings.GetInt("acme.challenge_timeout")
 	if timeout <= 0 {
 		timeout = 300 // 默认 5 分钟
 	}
-	propagationTimeout := time.Duration(timeout) * time.Second
-	pollingInterval := 5 * time.Second // 轮询间隔 5 秒
-
-	envMutex.Lock()
-	defer envMutex.Unlock()
-
-	// 清理之前的环境变量
-	clearDNSEnvVars()
-
-	var provider challenge.Provider
-	var err error
-
-	switch providerType {
-	case "cloudflare":
-		// 使用 Config 结构体创建 provider，以支持自定义超时时间
-		// 参考: https://pkg.go.dev/github.com/go-acme/lego/v4/providers/dns/cloudflare
-		cfConfig := cloudflare.NewDefaultConfig()
-		cfConfig.PropagationTimeout = propagationTimeout
-		cfConfig.PollingInterval = pollingInterval
-		cfConfig.TTL = 120 // DNS 记录 TTL 设置为 2 分钟
-
-		if apiToken, ok := config["api_token"].(string); ok && apiToken != "" {
-			// 使用 API Token（推荐方式，需要 Zone:Read 和 DNS:Edit 权限）
-			cfConfig.AuthToken = strings.TrimSpace(apiToken)
-		} else {
-			// 兼容旧的 API Key + Email 方式
-			if apiKey, ok := config["api_key"].(string); ok {
-				cfConfig.AuthKey = strings.TrimSpace(apiKey)
-			}
-			if email, ok := config["email"].(string); ok {
-				cfConfig.AuthEmail = strings.TrimSpace(email)
-			}
-		}
-		provider, err = cloudflare.NewDNSProviderConfig(cfConfig)
 
-	case "aliyun":
-		// 阿里云 DNS
-		if accessKeyID, ok := config["access_key_id"].(string); ok {
-			os.Setenv("ALICLOUD_ACCESS_KEY", accessKeyID)
-		}
-		if accessKeySecret, ok := config["access_key_secret"].(string); ok {
-			os.Setenv("ALICLOUD_SECRET_KEY", accessKeySecret)
-		}
-		// 设置传播超时环境变量
-		os.Setenv("ALICLOUD_PROPAGATION_TIMEOUT", fmt.Sprintf("%d", timeout))
-		os.Setenv("ALICLOUD_POLLING_INTERVAL", "5")
-		provider, err = alidns.NewDNSProvider()
-
-	case "dnspod":
-		// DNSPod（腾讯云）使用 tencentcloud provider
-		if apiID, ok := config["api_id"].(string); ok {
-			os.Setenv("TENCENTCLOUD_SECRET_ID", apiID)
-		}
-		if apiToken, ok := config["api_token"].(string); ok {
-			os.Setenv("TENCENTCLOUD_SECRET_KEY", apiToken)
-		}
-		// 设置传播超时环境变量
-		os.Setenv("TENCENTCLOUD_PROPAGATION_TIMEOUT", fmt.Sprintf("%d", timeout))
-		os.Setenv("TENCENTCLOUD_POLLING_INTERVAL", "5")
-		provider, err = tencentcloud.NewDNSProvider()
-
-	case "route53":
-		// AWS Route53
-		if accessKeyID, ok := config["access_key_id"].(string); ok {
-			os.Setenv("AWS_ACCESS_KEY_ID", accessKeyID)
-		}
-		if secretAccessKey, ok := config["secret_access_key"].(string); ok {
-			os.Setenv("AWS_SECRET_ACCESS_KEY", secretAccessKey)
-		}
-		if region, ok := config["region"].(string); ok {
-			os.Setenv("AWS_REGION", region)
-		}
-		// 设置传播超时环境变量
-		os.Setenv("AWS_PROPAGATION_TIMEOUT", fmt.Sprintf("%d", timeout))
-		os.Setenv("AWS_POLLING_INTERVAL", "5")
-		provider, err = route53.NewDNSProvider()
-
-	case "godaddy":
-		// GoDaddy
-		if apiKey, ok := config["api_key"].(string); ok {
-			os.Setenv("GODADDY_API_KEY", apiKey)
-		}
-		if apiSecret, ok := config["api_secret"].(string); ok {
-			os.Setenv("GODADDY_API_SECRET", apiSecret)
-		}
-		// 设置传播超时环境变量
-		os.Setenv("GODADDY_PROPAGATION_TIMEOUT", fmt.Sprintf("%d", timeout))
-		os.Setenv("GODADDY_POLLING_INTERVAL", "5")
-		provider, err = godaddy.NewDNSProvider()
-
-	default:
-		return nil, fmt.Errorf("不支持的 DNS 提供商类型: %s", providerType)
-	}
-
-	// 创建 provider 后立即清理环境变量
-	clearDNSEnvVars()
-
-	return provider, err
-}
-
-// CloudflareRecord Cloudflare DNS 记录
-type CloudflareRecord struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	Type    string `json:"type"`
-	Content string `json:"content"`
-}
-
-// CloudflareListResponse Cloudflare API 响应
-type CloudflareListResponse struct {
-	Success bool               `json:"success"`
-	Result  []CloudflareRecord `json:"result"`
-	Errors  []struct {
-		Message string `json:"message"`
-	} `json:"errors"`
-}
-
-// CloudflareZoneResponse Cloudflare Zone API 响应
-type CloudflareZoneResponse struct {
-	Success bool `json:"success"`
-	Result  []struct {
-		ID   string `json:"id"`
-		Name string `json:"name"`
-	} `json:"result"`
-}
-
-// cleanupACMEChallengeRecords 清理指定域名的 ACME challenge DNS 记录
-func (s *ACMEService) cleanupACMEChallengeRecords(domains []string, providerType string, config map[string]interface{}) error {
-	if providerType != "cloudflare" {
-		// 暂时只支持 Cloudflare
-		return nil
-	}
-
-	// 获取认证信息
-	var authHeader string
-	var authEmail string
-	if apiToken, ok := config["api_token"].(string); ok && apiToken != "" {
-		authHeader = "Bearer " + strings.TrimSpace(apiToken)
-	} else if apiKey, ok := config["api_key"].(string); ok && apiKey != "" {
-		authHeader = strings.TrimSpace(apiKey)
-		if email, ok := config["email"].(string); ok {
-			authEmail = strings.TrimSpace(email)
-		}
-	} else {
-		return nil // 没有认证信息，跳过
-	}
-
-	client := &http.Client{Timeout: 30 * time.Second}
-
-	for _, domain := range domains {
-		// 获取根域名
-		rootDomain := extractRootDomain(domain)
-		challengeName := "_acme-challenge." + domain
-
-		// 获取 Zone ID
-		zoneID, err := s.getCloudflareZoneID(client, rootDomain, authHeader, authEmail)
-		if err != nil {
-			s.logger.Warn("acme", fmt.Sprintf("获取 Zone ID 失败 (%s): %v", rootDomain, err), nil)
-			continue
-		}
-
-		// 获取并删除 ACME challenge 记录
-		records, err := s.listCloudflareTXTRecords(client, zoneID, challengeName, authHeader, authEmail)
-		if err != nil {
-			s.logger.Warn("acme", fmt.Sprintf("获取 DNS 记录失败 (%s): %v", challengeName, err), nil)
-			continue
-		}
-
-		for _, record := range records {
-			if err := s.deleteCloudflareDNSRecord(client, zoneID, record.ID, authHeader, authEmail); err != nil {
-				s.logger.Warn("acme", fmt.Sprintf("删除 DNS 记录失败 (%s): %v", record.Name, err), nil)
-			} else {
-				s.logger.Info("acme", fmt.Sprintf("已删除旧的 ACME challenge 记录: %s", record.Name), nil)
-			}
-		}
-	}
-
-	return nil
-}
-
-// extractRootDomain 提取根域名
-func extractRootDomain(domain string) string {
-	parts := strings.Split(domain, ".")
-	if len(parts) >= 2 {
-		return parts[len(parts)-2] + "." + parts[len(parts)-1]
-	}
-	return domain
-}
-
-// getCloudflareZoneID 获取 Cloudflare Zone ID
-func (s *ACMEService) getCloudflareZoneID(client *http.Client, domain, authHeader, authEmail string) (string, error) {
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?name=%s", domain)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
-	}
-
-	s.setCFAuthHeaders(req, authHeader, authEmail)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	var zoneResp CloudflareZoneResponse
-	if err := decodeJSON(resp.Body, &zoneResp); err != nil {
-		return "", err
-	}
-
-	if !zoneResp.Success || len(zoneResp.Result) == 0 {
-		return "", fmt.Errorf("zone not found: %s", domain)
-	}
-
-	return zoneResp.Result[0].ID, nil
-}
-
-// listCloudflareTXTRecords 列出指定名称的 TXT 记录
-func (s *ACMEService) listCloudflareTXTRecords(client *http.Client, zoneID, name, authHeader, authEmail string) ([]CloudflareRecord, error) {
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records?type=TXT&name=%s", zoneID, name)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	s.setCFAuthHeaders(req, authHeader, authEmail)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var listResp CloudflareListResponse
-	if err := decodeJSON(resp.Body, &listResp); err != nil {
-		return nil, err
-	}
-
-	if !listResp.Success {
-		if len(listResp.Errors) > 0 {
-			return nil, fmt.Errorf(listResp.Errors[0].Message)
-		}
-		return nil, fmt.Errorf("cloudflare API error")
-	}
-
-	return listResp.Result, nil
-}
-
-// deleteCloudflareDNSRecord 删除 Cloudflare DNS 记录
-func (s *ACMEService) deleteCloudflareDNSRecord(client *http.Client, zoneID, recordID, authHeader, authEmail string) error {
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records/%s", zoneID, recordID)
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return err
-	}
-
-	s.setCFAuthHeaders(req, authHeader, authEmail)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("delete failed with status: %d", resp.StatusCode)
-	}
-
-	return nil
-}
-
-// setCFAuthHeaders 设置 Cloudflare 认证头
-func (s *ACMEService) setCFAuthHeaders(req *http.Request, authHeader, authEmail string) {
-	if strings.HasPrefix(authHeader, "Bearer ") {
-		req.Header.Set("Authorization", authHeader)
-	} else {
-		req.Header.Set("X-Auth-Key", authHeader)
-		req.Header.Set("X-Auth-Email", authEmail)
-	}
-	req.Header.Set("Content-Type", "application/json")
-}
-
-// decodeJSON 解码 JSON 响应
-func decodeJSON(r io.Reader, v interface{}) error {
-	return json.NewDecoder(r).Decode(v)
+	return dnsprovider.New(providerType, config, dnsprovider.Options{
+		PropagationTimeout: time.Duration(timeout) * time.Second,
+		PollingInterval:    dnsprovider.DefaultPollingInterval,
+	})
 }
@@ -2,18 +2,21 @@ package service
 
 import (
 	"fmt"
+	"path"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/BlakeLiAFK/letsync/internal/pkg/crypto"
 	"github.com/BlakeLiAFK/letsync/internal/server/model"
 	"github.com/BlakeLiAFK/letsync/internal/server/store"
+	"gorm.io/gorm"
 )
 
 // AgentService Agent 服务
 type AgentService struct {
 	settings *SettingsService
 	logger   *LogService
+	tx       *gorm.DB // 非空时所有读写在该事务中进行
 }
 
 func NewAgentService() *AgentService {
@@ -23,6 +26,18 @@ func NewAgentService() *AgentService {
 	}
 }
 
+// WithTx 返回在事务 tx 中读写的副本
+func (s *AgentService) WithTx(tx *gorm.DB) *AgentService {
+	c := *s
+	c.tx = tx
+	c.logger = s.logger.WithTx(tx)
+	return &c
+}
+
+func (s *AgentService) db() *gorm.DB {
+	return store.GetDBOr(s.tx)
+}
+
 // Create 创建 Agent
 func (s *AgentService) Create(name string, pollInterval int) (*model.Agent, error) {
 	if pollInterval <= 0 {
@@ -41,7 +56,7 @@ func (s *AgentService) Create(name string, pollInterval int) (*model.Agent, erro
 		Status:       "pending",
 	}
 
-	if err := store.GetDB().Create(agent).Error; err != nil {
+	if err := s.db().Create(agent).Error; err != nil {
 		return nil, err
 	}
 
@@ -56,7 +71,7 @@ func (s *AgentService) Create(name string, pollInterval int) (*model.Agent, erro
 // Get 获取 Agent
 func (s *AgentService) Get(id uint) (*model.Agent, error) {
 	var agent model.Agent
-	if err := store.GetDB().Preload("Certs.Certificate").First(&agent, id).Error; err != nil {
+	if err := s.db().Preload("Certs.Certificate.Workspace").First(&agent, id).Error; err != nil {
 		return nil, err
 	}
 	return &agent, nil
@@ -65,7 +80,7 @@ func (s *AgentService) Get(id uint) (*model.Agent, error) {
 // GetByUUID 根据 UUID 获取 Agent
 func (s *AgentService) GetByUUID(uuid string) (*model.Agent, error) {
 	var agent model.Agent
-	if err := store.GetDB().Where("uuid = ?", uuid).Preload("Certs.Certificate").First(&agent).Error; err != nil {
+	if err := s.db().Where("uuid = ?", uuid).Preload("Certs.Certificate").First(&agent).Error; err != nil {
 		return nil, err
 	}
 	return &agent, nil
@@ -74,7 +89,7 @@ func (s *AgentService) GetByUUID(uuid string) (*model.Agent, error) {
 // List 获取所有 Agent
 func (s *AgentService) List() ([]model.Agent, error) {
 	var agents []model.Agent
-	if err := store.GetDB().Find(&agents).Error; err != nil {
+	if err := s.db().Find(&agents).Error; err != nil {
 		return nil, err
 	}
 
@@ -96,17 +111,30 @@ func (s *AgentService) Update(id uint, name string, pollInterval int) error {
 		updates["poll_interval"] = pollInterval
 	}
 
-	return store.GetDB().Model(&model.Agent{}).Where("id = ?", id).Updates(updates).Error
+	return s.db().Model(&model.Agent{}).Where("id = ?", id).Updates(updates).Error
 }
 
 // Delete 删除 Agent
 func (s *AgentService) Delete(id uint) error {
-	// 先删除关联的证书绑定
-	if err := store.GetDB().Where("agent_id = ?", id).Delete(&model.AgentCert{}).Error; err != nil {
-		return err
-	}
-
-	return store.GetDB().Delete(&model.Agent{}, id).Error
+	return s.db().Transaction(func(tx *gorm.DB) error {
+		var keyCerts []uint
+		if err := tx.Model(&model.AgentCert{}).Where("agent_id = ? AND agent_key = ?", id, true).
+			Pluck("cert_id", &keyCerts).Error; err != nil {
+			return err
+		}
+
+		// 先删除关联的证书绑定
+		if err := tx.Where("agent_id = ?", id).Delete(&model.AgentCert{}).Error; err != nil {
+			return err
+		}
+		for _, certID := range keyCerts {
+			if err := releaseAgentKey(tx, certID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&model.Agent{}, id).Error
+	})
 }
 
 // RegenerateSignature 重新生成签名
@@ -122,7 +150,7 @@ func (s *AgentService) RegenerateSignature(id uint) (string, error) {
 	newSignature := crypto.GenerateSignature(newUUID, secret)
 
 	// 同时更新 UUID 和签名
-	if err := store.GetDB().Model(agent).Updates(map[string]interface{}{
+	if err := s.db().Model(agent).Updates(map[string]interface{}{
 		"uuid":      newUUID,
 		"signature": newSignature,
 	}).Error; err != nil {
@@ -144,7 +172,7 @@ func (s *AgentService) RegenerateSignature(id uint) (string, error) {
 func (s *AgentService) VerifySignature(uuid, signature string) (*model.Agent, error) {
 	// 先根据 UUID 查询 Agent
 	var agent model.Agent
-	if err := store.GetDB().Where("uuid = ?", uuid).First(&agent).Error; err != nil {
+	if err := s.db().Where("uuid = ?", uuid).First(&agent).Error; err != nil {
 		return nil, fmt.Errorf("签名验证失败")
 	}
 
@@ -160,7 +188,7 @@ func (s *AgentService) VerifySignature(uuid, signature string) (*model.Agent, er
 // UpdateHeartbeat 更新心跳
 func (s *AgentService) UpdateHeartbeat(uuid, ip, version string) error {
 	now := time.Now()
-	return store.GetDB().Model(&model.Agent{}).Where("uuid = ?", uuid).Updates(map[string]interface{}{
+	return s.db().Model(&model.Agent{}).Where("uuid = ?", uuid).Updates(map[string]interface{}{
 		"last_seen": &now,
 		"ip":        ip,
 		"version":   version,
@@ -182,17 +210,22 @@ func (s *AgentService) calculateStatus(agent *model.Agent) string {
 }
 
 // AddCertBinding 添加证书绑定
-func (s *AgentService) AddCertBinding(agentID, certID uint, deployPath string, fileMapping model.FileMapping, reloadCmd string) (*model.AgentCert, error) {
+func (s *AgentService) AddCertBinding(agentID, certID uint, deployPath string, fileMapping model.FileMapping, reloadCmd string, agentKey bool) (*model.AgentCert, error) {
+	if err := s.checkBindingKeyMode(certID, 0, agentKey); err != nil {
+		return nil, err
+	}
+
 	binding := &model.AgentCert{
 		AgentID:    agentID,
 		CertID:     certID,
 		DeployPath: deployPath,
 		ReloadCmd:  reloadCmd,
+		AgentKey:   agentKey,
 		SyncStatus: "pending",
 	}
 	binding.SetFileMapping(fileMapping)
 
-	if err := store.GetDB().Create(binding).Error; err != nil {
+	if err := s.db().Create(binding).Error; err != nil {
 		return nil, err
 	}
 
@@ -200,7 +233,17 @@ func (s *AgentService) AddCertBinding(agentID, certID uint, deployPath string, f
 }
 
 // UpdateCertBinding 更新证书绑定
-func (s *AgentService) UpdateCertBinding(bindingID uint, deployPath string, fileMapping model.FileMapping, reloadCmd string) error {
+func (s *AgentService) UpdateCertBinding(bindingID uint, deployPath string, fileMapping model.FileMapping, reloadCmd string, agentKey bool) error {
+	var existing model.AgentCert
+	if err := s.db().First(&existing, bindingID).Error; err != nil {
+		return err
+	}
+	if agentKey != existing.AgentKey {
+		if err := s.checkBindingKeyMode(existing.CertID, bindingID, agentKey); err != nil {
+			return err
+		}
+	}
+
 	binding := &model.AgentCert{ID: bindingID}
 	binding.SetFileMapping(fileMapping)
 
@@ -208,21 +251,118 @@ func (s *AgentService) UpdateCertBinding(bindingID uint, deployPath string, file
 		"deploy_path":  deployPath,
 		"file_mapping": binding.FileMapping,
 		"reload_cmd":   reloadCmd,
+		"agent_key":    agentKey,
 		"sync_status":  "pending",
 	}
 
-	return store.GetDB().Model(&model.AgentCert{}).Where("id = ?", bindingID).Updates(updates).Error
+	return s.db().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.AgentCert{}).Where("id = ?", bindingID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if existing.AgentKey && !agentKey {
+			return releaseAgentKey(tx, existing.CertID)
+		}
+		return nil
+	})
+}
+
+// SetBindingChallenge 设置绑定的 HTTP-01 委托验证方式（webroot 优先，否则监听端口）
+func (s *AgentService) SetBindingChallenge(bindingID uint, webroot string, port int) error {
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("无效的验证端口: %d", port)
+	}
+	if webroot != "" && !path.IsAbs(webroot) {
+		return fmt.Errorf("webroot 必须是绝对路径")
+	}
+
+	return s.db().Model(&model.AgentCert{}).Where("id = ?", bindingID).
+		Updates(map[string]interface{}{
+			"challenge_webroot": webroot,
+			"challenge_port":    port,
+		}).Error
+}
+
+// checkBindingKeyMode 检查绑定的私钥来源与证书的其他绑定是否冲突
+// 同一证书只能对应一把私钥：Agent 本地生成私钥时证书不能再有其他绑定（其他 Agent 拿不到该私钥），
+// 已有 Agent 持有私钥的证书也不能再添加由服务器下发私钥的绑定；导入的证书私钥已随证书导入，不能由 Agent 生成
+func (s *AgentService) checkBindingKeyMode(certID, excludeBindingID uint, agentKey bool) error {
+	if agentKey {
+		var cert model.Certificate
+		if err := s.db().Select("source").First(&cert, certID).Error; err == nil && cert.IsImported() {
+			return fmt.Errorf("导入的证书私钥已随证书导入，不能由 Agent 本地生成")
+		}
+	}
+
+	var others []model.AgentCert
+	if err := s.db().Select("agent_key").
+		Where("cert_id = ? AND id <> ?", certID, excludeBindingID).
+		Find(&others).Error; err != nil {
+		return err
+	}
+	for _, other := range others {
+		if other.AgentKey {
+			return fmt.Errorf("该证书的私钥由其他 Agent 本地生成，同一证书只能有一个私钥持有者")
+		}
+	}
+	if agentKey && len(others) > 0 {
+		return fmt.Errorf("该证书已绑定 %d 个使用服务器私钥的 Agent，Agent 本地生成私钥时证书不能有其他绑定", len(others))
+	}
+	return nil
+}
+
+// GetBinding 获取 Agent 对指定证书的绑定
+func (s *AgentService) GetBinding(agentID, certID uint) (*model.AgentCert, error) {
+	var binding model.AgentCert
+	if err := s.db().Where("agent_id = ? AND cert_id = ?", agentID, certID).First(&binding).Error; err != nil {
+		return nil, err
+	}
+	return &binding, nil
 }
 
 // DeleteCertBinding 删除证书绑定
 func (s *AgentService) DeleteCertBinding(bindingID uint) error {
-	return store.GetDB().Delete(&model.AgentCert{}, bindingID).Error
+	return s.db().Transaction(func(tx *gorm.DB) error {
+		var binding model.AgentCert
+		if err := tx.First(&binding, bindingID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&model.AgentCert{}, bindingID).Error; err != nil {
+			return err
+		}
+		if binding.AgentKey {
+			return releaseAgentKey(tx, binding.CertID)
+		}
+		return nil
+	})
+}
+
+// releaseAgentKey 证书不再有 Agent 本地生成私钥的绑定时，删除该 Agent 提交的 CSR，
+// 并安排定时任务尽快改用服务器生成的私钥重新签发（当前证书的私钥只在原 Agent 上，其他绑定无法部署）
+// 需要与绑定的删除或修改在同一事务中调用
+func releaseAgentKey(tx *gorm.DB, certID uint) error {
+	var count int64
+	if err := tx.Model(&model.AgentCert{}).Where("cert_id = ? AND agent_key = ?", certID, true).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if err := tx.Model(&model.Certificate{}).Where("id = ?", certID).
+		Update("csr_pem", nil).Error; err != nil {
+		return err
+	}
+	// 只有已签发的证书需要重新签发，未签发的证书等待手动申请
+	return tx.Model(&model.Certificate{}).
+		Where("id = ? AND status = ? AND LENGTH(cert_pem) > 0", certID, "valid").
+		Update("next_retry_at", time.Now()).Error
 }
 
 // UpdateSyncStatus 更新同步状态
 func (s *AgentService) UpdateSyncStatus(agentID, certID uint, fingerprint, status string) error {
 	now := time.Now()
-	return store.GetDB().Model(&model.AgentCert{}).
+	return s.db().Model(&model.AgentCert{}).
 		Where("agent_id = ? AND cert_id = ?", agentID, certID).
 		Updates(map[string]interface{}{
 			"last_sync":        &now,
@@ -234,7 +374,7 @@ func (s *AgentService) UpdateSyncStatus(agentID, certID uint, fingerprint, statu
 // GetCertsCount 获取 Agent 绑定的证书数量
 func (s *AgentService) GetCertsCount(agentID uint) int64 {
 	var count int64
-	store.GetDB().Model(&model.AgentCert{}).Where("agent_id = ?", agentID).Count(&count)
+	s.db().Model(&model.AgentCert{}).Where("agent_id = ?", agentID).Count(&count)
 	return count
 }
 
@@ -0,0 +1,506 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/BlakeLiAFK/letsync/internal/server/store"
+	"gorm.io/gorm"
+)
+
+// 批量操作类型
+const (
+	BatchIssue          = "issue"
+	BatchRenew          = "renew"
+	BatchDelete         = "delete"
+	BatchSetWorkspace   = "set_workspace"
+	BatchSetDNSProvider = "set_dns_provider"
+	BatchAttachAgent    = "attach_agent"
+)
+
+// batchActions 批量操作名称，用于日志
+var batchActions = map[string]string{
+	BatchIssue:          "签发",
+	BatchRenew:          "续期",
+	BatchDelete:         "删除",
+	BatchSetWorkspace:   "修改工作区",
+	BatchSetDNSProvider: "修改 DNS 提供商",
+	BatchAttachAgent:    "绑定 Agent",
+}
+
+// CertFilter 批量操作选择证书的条件，设置的条件需同时满足
+type CertFilter struct {
+	IDs           []uint `json:"ids,omitempty"`             // 指定证书 ID
+	All           bool   `json:"all,omitempty"`             // 未设置其他条件时需显式选择全部证书
+	WorkspaceID   *uint  `json:"workspace_id,omitempty"`    // 工作区，0 表示使用全局配置的证书
+	DNSProviderID *uint  `json:"dns_provider_id,omitempty"` // DNS 提供商
+	Domain        string `json:"domain,omitempty"`          // 主域名或 SAN 包含该字符串
+	Status        string `json:"status,omitempty"`          // pending, valid, expired
+	Source        string `json:"source,omitempty"`          // acme, import
+	ChallengeType string `json:"challenge_type,omitempty"`  // dns-01, http-01, tls-alpn-01
+	ExpiresWithin int    `json:"expires_within,omitempty"`  // 指定天数内到期（含已过期）
+}
+
+// empty 是否未设置任何条件
+func (f CertFilter) empty() bool {
+	return !f.All && len(f.IDs) == 0 && f.WorkspaceID == nil && f.DNSProviderID == nil &&
+		f.Domain == "" && f.Status == "" && f.Source == "" && f.ChallengeType == "" && f.ExpiresWithin <= 0
+}
+
+// BatchAgentBinding 批量绑定 Agent 的部署配置，deploy_path 中的 {domain} 替换为证书主域名
+type BatchAgentBinding struct {
+	AgentID     uint              `json:"agent_id"`
+	DeployPath  string            `json:"deploy_path"`
+	FileMapping model.FileMapping `json:"file_mapping"`
+	ReloadCmd   string            `json:"reload_cmd"`
+}
+
+// CertBatchParams 批量操作参数
+type CertBatchParams struct {
+	Action        string             `json:"action"`
+	Filter        CertFilter         `json:"filter"`
+	WorkspaceID   *uint              `json:"workspace_id,omitempty"`    // set_workspace 的目标工作区，为空表示使用全局配置
+	DNSProviderID uint               `json:"dns_provider_id,omitempty"` // set_dns_provider 的目标提供商
+	Agent         *BatchAgentBinding `json:"agent,omitempty"`           // attach_agent 的部署配置
+}
+
+// CertBatchService 证书批量操作，每个批量任务逐个记录证书的执行结果
+type CertBatchService struct {
+	certService *CertService
+	workspaces  *WorkspaceService
+	dnsProvider *DNSProviderService
+	agents      *AgentService
+	acme        *ACMEService
+	taskLog     *TaskLogService
+	logger      *LogService
+}
+
+func NewCertBatchService(dataDir string) *CertBatchService {
+	return &CertBatchService{
+		certService: NewCertService(),
+		workspaces:  NewWorkspaceService(),
+		dnsProvider: NewDNSProviderService(),
+		agents:      NewAgentService(),
+		acme:        NewACMEService(dataDir),
+		taskLog:     NewTaskLogService(),
+		logger:      NewLogService(),
+	}
+}
+
+// Match 获取符合条件的证书，按 ID 排序
+func (s *CertBatchService) Match(filter CertFilter) ([]model.Certificate, error) {
+	if filter.empty() {
+		return nil, fmt.Errorf("请指定证书 ID 或筛选条件，操作全部证书需设置 all")
+	}
+
+	q := store.GetDB().Model(&model.Certificate{})
+	if len(filter.IDs) > 0 {
+		q = q.Where("id IN ?", filter.IDs)
+	}
+	if filter.WorkspaceID != nil {
+		q = q.Where("COALESCE(workspace_id, 0) = ?", *filter.WorkspaceID)
+	}
+	if filter.DNSProviderID != nil {
+		q = q.Where("dns_provider_id = ?", *filter.DNSProviderID)
+	}
+	if domain := strings.ToLower(strings.TrimSpace(filter.Domain)); domain != "" {
+		pattern := "%" + escapeLike(domain) + "%"
+		q = q.Where(`(LOWER(domain) LIKE ? ESCAPE '\' OR LOWER(san) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	switch filter.Status {
+	case "":
+	case "expired":
+		// 过期状态在列表查询时才更新，这里按到期时间判断
+		q = q.Where("(status = ? OR (status = ? AND expires_at < ?))", "expired", "valid", time.Now())
+	default:
+		q = q.Where("status = ?", filter.Status)
+	}
+	if filter.Source != "" {
+		q = q.Where("COALESCE(source, '') = ?", filter.Source)
+	}
+	if filter.ChallengeType != "" {
+		q = q.Where("challenge_type = ?", filter.ChallengeType)
+	}
+	if filter.ExpiresWithin > 0 {
+		q = q.Where("fingerprint <> '' AND expires_at < ?", time.Now().AddDate(0, 0, filter.ExpiresWithin))
+	}
+
+	var certs []model.Certificate
+	if err := q.Order("id").Find(&certs).Error; err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// escapeLike 转义 LIKE 通配符，配合 ESCAPE '\' 使用
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Start 校验参数并创建批量任务，证书在后台逐个处理，进度写入任务日志
+func (s *CertBatchService) Start(params CertBatchParams) (*model.CertBatchJob, error) {
+	label, ok := batchActions[params.Action]
+	if !ok {
+		return nil, fmt.Errorf("不支持的批量操作: %s", params.Action)
+	}
+	if err := s.validate(&params); err != nil {
+		return nil, err
+	}
+
+	certs, err := s.Match(params.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("没有符合条件的证书")
+	}
+	if params.Action == BatchAttachAgent && len(certs) > 1 && !strings.Contains(params.Agent.DeployPath, "{domain}") {
+		return nil, fmt.Errorf("绑定多个证书时部署路径需包含 {domain}，避免证书文件互相覆盖")
+	}
+
+	taskID, err := s.taskLog.CreateTask(0, "batch")
+	if err != nil {
+		return nil, err
+	}
+
+	paramsJSON, _ := json.Marshal(params)
+	job := &model.CertBatchJob{
+		TaskID: taskID,
+		Action: params.Action,
+		Params: string(paramsJSON),
+		Status: "running",
+		Total:  len(certs),
+	}
+	for _, cert := range certs {
+		job.Items = append(job.Items, model.CertBatchItem{
+			CertID: cert.ID,
+			Domain: cert.Domain,
+			Status: "pending",
+		})
+	}
+	if err := store.GetDB().Create(job).Error; err != nil {
+		s.taskLog.CompleteTaskWithTaskID(taskID, 0, "batch", "failed")
+		return nil, err
+	}
+
+	s.taskLog.InfoWithTaskID(taskID, 0, "batch", fmt.Sprintf("批量%s %d 个证书", label, len(certs)), nil)
+	s.logger.Info("cert", fmt.Sprintf("开始批量%s: %d 个证书", label, len(certs)), map[string]interface{}{
+		"job_id": job.ID,
+	})
+
+	// 返回创建时的快照，后台任务只修改 job 本身
+	snapshot := *job
+	snapshot.Items = append([]model.CertBatchItem(nil), job.Items...)
+
+	go s.run(job, params)
+
+	return &snapshot, nil
+}
+
+// validate 校验操作参数并补全默认值
+func (s *CertBatchService) validate(params *CertBatchParams) error {
+	switch params.Action {
+	case BatchSetWorkspace:
+		if params.WorkspaceID != nil && *params.WorkspaceID == 0 {
+			params.WorkspaceID = nil
+		}
+		if params.WorkspaceID != nil {
+			if _, err := s.workspaces.Get(*params.WorkspaceID); err != nil {
+				return fmt.Errorf("工作区不存在")
+			}
+		}
+	case BatchSetDNSProvider:
+		if params.DNSProviderID == 0 {
+			return fmt.Errorf("请指定 DNS 提供商")
+		}
+		if _, err := s.dnsProvider.Get(params.DNSProviderID); err != nil {
+			return fmt.Errorf("DNS 提供商不存在")
+		}
+	case BatchAttachAgent:
+		if params.Agent == nil || params.Agent.AgentID == 0 {
+			return fmt.Errorf("请指定 Agent")
+		}
+		if _, err := s.agents.Get(params.Agent.AgentID); err != nil {
+			return fmt.Errorf("Agent 不存在")
+		}
+		params.Agent.DeployPath = strings.TrimSpace(params.Agent.DeployPath)
+		if params.Agent.DeployPath == "" {
+			return fmt.Errorf("请指定部署路径")
+		}
+		if params.Agent.FileMapping.Cert == "" {
+			params.Agent.FileMapping.Cert = "cert.pem"
+		}
+		if params.Agent.FileMapping.Key == "" {
+			params.Agent.FileMapping.Key = "key.pem"
+		}
+		if params.Agent.FileMapping.Fullchain == "" {
+			params.Agent.FileMapping.Fullchain = "fullchain.pem"
+		}
+	}
+	return nil
+}
+
+// run 执行批量任务；签发和续期并行执行，实际并发数受签发池 (acme.max_concurrent) 限制
+func (s *CertBatchService) run(job *model.CertBatchJob, params CertBatchParams) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+
+	for i := range job.Items {
+		item := &job.Items[i]
+		exec := func() {
+			status, message := s.runItem(params, item)
+
+			mu.Lock()
+			done++
+			n := done
+			switch status {
+			case "success":
+				job.Succeeded++
+			case "failed":
+				job.Failed++
+			default:
+				job.Skipped++
+			}
+			s.finishItem(job, item, status, message, n)
+			mu.Unlock()
+		}
+
+		if params.Action == BatchIssue || params.Action == BatchRenew {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				exec()
+			}()
+		} else {
+			exec()
+		}
+	}
+	wg.Wait()
+
+	status := "completed"
+	if job.Failed > 0 {
+		status = "failed"
+	}
+	now := time.Now()
+	store.GetDB().Model(&model.CertBatchJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"status":      status,
+		"finished_at": &now,
+	})
+
+	summary := fmt.Sprintf("批量%s完成: 成功 %d，失败 %d，跳过 %d", batchActions[job.Action], job.Succeeded, job.Failed, job.Skipped)
+	s.taskLog.InfoWithTaskID(job.TaskID, 0, "batch", summary, nil)
+	s.taskLog.CompleteTaskWithTaskID(job.TaskID, 0, "batch", status)
+	s.logger.Info("cert", summary, map[string]interface{}{
+		"job_id": job.ID,
+	})
+}
+
+// finishItem 保存单个证书的结果并推送进度，调用方持有锁
+func (s *CertBatchService) finishItem(job *model.CertBatchJob, item *model.CertBatchItem, status, message string, n int) {
+	item.Status = status
+	item.Message = message
+	store.GetDB().Model(&model.CertBatchItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+		"status":  status,
+		"message": message,
+	})
+	store.GetDB().Model(&model.CertBatchJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"succeeded": job.Succeeded,
+		"failed":    job.Failed,
+		"skipped":   job.Skipped,
+	})
+
+	level := "info"
+	switch status {
+	case "failed":
+		level = "error"
+	case "skipped":
+		level = "warn"
+	}
+	s.taskLog.LogWithTaskID(job.TaskID, 0, "batch", level, fmt.Sprintf("[%d/%d] %s: %s", n, job.Total, item.Domain, message), nil)
+}
+
+// runItem 处理单个证书，返回 success、failed 或 skipped 及说明
+func (s *CertBatchService) runItem(params CertBatchParams, item *model.CertBatchItem) (string, string) {
+	cert, err := s.certService.Get(item.CertID)
+	if err != nil {
+		return "failed", "证书不存在"
+	}
+
+	switch params.Action {
+	case BatchIssue, BatchRenew:
+		return s.obtainItem(params.Action, cert, item)
+
+	case BatchDelete:
+		if err := s.certService.Delete(cert.ID); err != nil {
+			return "failed", err.Error()
+		}
+		return "success", "已删除"
+
+	case BatchSetWorkspace:
+		return s.setWorkspace(cert, params.WorkspaceID)
+
+	case BatchSetDNSProvider:
+		if cert.IsImported() {
+			return "skipped", ErrImportedCert.Error()
+		}
+		if s.workspaces.IsPrivateCA(cert.WorkspaceID) {
+			return "skipped", "私有 CA 工作区直接签发，无需 DNS 验证"
+		}
+		if cert.ChallengeType != "" && cert.ChallengeType != "dns-01" {
+			return "skipped", fmt.Sprintf("验证方式为 %s", cert.ChallengeType)
+		}
+		if cert.DNSProviderID == params.DNSProviderID {
+			return "skipped", "已使用该 DNS 提供商"
+		}
+		if err := s.certService.SetDNSProvider(cert.ID, params.DNSProviderID); err != nil {
+			return "failed", err.Error()
+		}
+		return "success", "已修改 DNS 提供商"
+
+	case BatchAttachAgent:
+		agent := params.Agent
+		if _, err := s.agents.GetBinding(agent.AgentID, cert.ID); err == nil {
+			return "skipped", "已绑定该 Agent"
+		}
+		deployPath := strings.ReplaceAll(agent.DeployPath, "{domain}", strings.ReplaceAll(cert.Domain, "*", "_"))
+		if _, err := s.agents.AddCertBinding(agent.AgentID, cert.ID, deployPath, agent.FileMapping, agent.ReloadCmd, false); err != nil {
+			return "failed", err.Error()
+		}
+		return "success", fmt.Sprintf("已绑定，部署到 %s", deployPath)
+	}
+
+	return "failed", "不支持的批量操作"
+}
+
+// obtainItem 签发或续期单个证书，详细过程写入证书自己的任务日志
+func (s *CertBatchService) obtainItem(action string, cert *model.Certificate, item *model.CertBatchItem) (string, string) {
+	if cert.IsImported() {
+		return "skipped", ErrImportedCert.Error()
+	}
+	if action == BatchIssue && !cert.UsesCSR() && s.certService.HasAgentKeyBinding(cert.ID) {
+		return "skipped", "私钥由 Agent 生成，等待 Agent 提交 CSR"
+	}
+
+	// 定时续期或其他请求正在签发该证书时跳过
+	release, ok := s.acme.ReserveIssue(cert.ID)
+	if !ok {
+		return "skipped", "证书正在签发或续期"
+	}
+	defer release()
+
+	taskID, err := s.taskLog.CreateTask(cert.ID, action)
+	if err != nil {
+		return "failed", err.Error()
+	}
+	item.TaskID = taskID
+	store.GetDB().Model(&model.CertBatchItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+		"status":  "running",
+		"task_id": taskID,
+	})
+
+	if action == BatchIssue {
+		err = s.acme.IssueCertificateWithTaskID(cert.ID, taskID)
+	} else {
+		_, err = s.acme.RenewCertificateWithTaskID(cert.ID, taskID)
+	}
+	if err != nil {
+		return "failed", err.Error()
+	}
+
+	if updated, err := s.certService.Get(cert.ID); err == nil {
+		return "success", fmt.Sprintf("%s成功，有效期至 %s", batchActions[action], updated.ExpiresAt.Format("2006-01-02 15:04:05"))
+	}
+	return "success", batchActions[action] + "成功"
+}
+
+// setWorkspace 移动证书到目标工作区；移到私有 CA 时清除 DNS 验证配置
+func (s *CertBatchService) setWorkspace(cert *model.Certificate, workspaceID *uint) (string, string) {
+	if cert.IsImported() {
+		return "skipped", ErrImportedCert.Error()
+	}
+
+	current := uint(0)
+	if cert.WorkspaceID != nil {
+		current = *cert.WorkspaceID
+	}
+	target := uint(0)
+	if workspaceID != nil {
+		target = *workspaceID
+	}
+	if current == target {
+		return "skipped", "已在目标工作区"
+	}
+
+	if names := 1 + len(cert.GetSANList()); names > s.workspaces.MaxNames(workspaceID) {
+		return "failed", fmt.Sprintf("证书包含 %d 个域名，超过目标工作区上限 %d", names, s.workspaces.MaxNames(workspaceID))
+	}
+
+	privateCA := s.workspaces.IsPrivateCA(workspaceID)
+	if !privateCA && (cert.ChallengeType == "" || cert.ChallengeType == "dns-01") && cert.DNSProviderID == 0 {
+		return "failed", "证书未设置 DNS 提供商，请先修改 DNS 提供商再移到 ACME 工作区"
+	}
+
+	if err := s.certService.SetWorkspace(cert.ID, workspaceID, privateCA); err != nil {
+		return "failed", err.Error()
+	}
+	if workspaceID == nil {
+		return "success", "已改为使用全局配置"
+	}
+	if workspace, err := s.workspaces.Get(*workspaceID); err == nil {
+		return "success", fmt.Sprintf("已移到工作区 %s", workspace.Name)
+	}
+	return "success", "已修改工作区"
+}
+
+// Get 获取批量任务及每个证书的结果
+func (s *CertBatchService) Get(id uint) (*model.CertBatchJob, error) {
+	var job model.CertBatchJob
+	if err := store.GetDB().Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// List 获取最近的批量任务（不含明细）
+func (s *CertBatchService) List(limit int) ([]model.CertBatchJob, error) {
+	var jobs []model.CertBatchJob
+	if err := store.GetDB().Order("id DESC").Limit(limit).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// MarkInterrupted 启动时将上次未完成的批量任务标记为中断
+func (s *CertBatchService) MarkInterrupted() error {
+	var jobs []model.CertBatchJob
+	if err := store.GetDB().Where("status = ?", "running").Find(&jobs).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, job := range jobs {
+		err := store.GetDB().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&model.CertBatchItem{}).
+				Where("job_id = ? AND status IN ?", job.ID, []string{"pending", "running"}).
+				Updates(map[string]interface{}{"status": "failed", "message": "服务重启，任务中断"}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&model.CertBatchJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+				"status":      "interrupted",
+				"finished_at": &now,
+			}).Error
+		})
+		if err != nil {
+			return err
+		}
+		s.taskLog.CompleteTaskWithTaskID(job.TaskID, 0, "batch", "failed")
+	}
+	return nil
+}
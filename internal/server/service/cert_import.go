@@ -0,0 +1,224 @@
+package service
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ErrImportedCert 导入的证书由外部签发，不能通过 ACME 申请或续期
+var ErrImportedCert = errors.New("该证书为外部导入，不能通过 ACME 申请或续期，请重新导入新证书")
+
+// ImportedCert 解析后的外部证书，证书、私钥和证书链已校验匹配
+type ImportedCert struct {
+	Domain       string
+	SAN          []string
+	CertPEM      []byte
+	KeyPEM       []byte
+	CaPEM        []byte
+	FullchainPEM []byte
+	NotBefore    time.Time
+	NotAfter     time.Time
+}
+
+// ParseImportPEM 解析 PEM 格式的证书、私钥和证书链
+// 证书中可以直接粘贴完整链，与私钥匹配的证书作为叶证书，其余证书与 chainPEM 一起组成证书链
+func ParseImportPEM(certPEM, keyPEM, chainPEM []byte) (*ImportedCert, error) {
+	certs, err := parsePEMCertificates(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("解析证书失败: %w", err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("证书不能为空")
+	}
+	if len(bytes.TrimSpace(chainPEM)) > 0 {
+		chain, err := parsePEMCertificates(chainPEM)
+		if err != nil {
+			return nil, fmt.Errorf("解析证书链失败: %w", err)
+		}
+		certs = append(certs, chain...)
+	}
+
+	keyBlock, err := privateKeyBlock(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	key, err := certcrypto.ParsePEMPrivateKey(pem.EncodeToMemory(keyBlock))
+	if err != nil {
+		return nil, fmt.Errorf("解析私钥失败: %w", err)
+	}
+
+	return newImportedCert(certs, key, pem.EncodeToMemory(keyBlock))
+}
+
+// ParseImportPKCS12 解析 PKCS#12 (PFX) 格式的证书包
+func ParseImportPKCS12(data []byte, password string) (*ImportedCert, error) {
+	key, leaf, caCerts, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("解析 PKCS#12 失败: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("不支持的私钥类型: %w", err)
+	}
+
+	return newImportedCert(append([]*x509.Certificate{leaf}, caCerts...), key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+}
+
+// parsePEMCertificates 解析 PEM 中的所有证书，忽略非证书块
+func parsePEMCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// privateKeyBlock 取出 PEM 中的私钥块（跳过 openssl 生成的 EC PARAMETERS 等）
+func privateKeyBlock(data []byte) (*pem.Block, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("私钥不能为空")
+		}
+		if block.Type == "ENCRYPTED PRIVATE KEY" || block.Headers["Proc-Type"] != "" {
+			return nil, fmt.Errorf("不支持加密的私钥，请先解密")
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			return block, nil
+		}
+	}
+}
+
+// newImportedCert 找出与私钥匹配的叶证书，按签发关系排列证书链并生成 PEM
+func newImportedCert(certs []*x509.Certificate, key crypto.PrivateKey, keyPEM []byte) (*ImportedCert, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("不支持的私钥类型: %T", key)
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil, fmt.Errorf("不支持的私钥类型: %T", key)
+	}
+
+	var leaf *x509.Certificate
+	var rest []*x509.Certificate
+	seen := make(map[string]bool)
+	for _, cert := range certs {
+		if seen[string(cert.Raw)] {
+			continue
+		}
+		seen[string(cert.Raw)] = true
+		if leaf == nil && pub.Equal(cert.PublicKey) {
+			leaf = cert
+			continue
+		}
+		rest = append(rest, cert)
+	}
+	if leaf == nil {
+		return nil, fmt.Errorf("私钥与证书不匹配")
+	}
+
+	if time.Now().After(leaf.NotAfter) {
+		return nil, fmt.Errorf("证书已于 %s 过期", leaf.NotAfter.Format("2006-01-02 15:04:05"))
+	}
+
+	// 从叶证书开始逐级查找签发者
+	var chain []*x509.Certificate
+	for current := leaf; len(rest) > 0; {
+		idx := -1
+		for i, cert := range rest {
+			if bytes.Equal(current.RawIssuer, cert.RawSubject) && current.CheckSignatureFrom(cert) == nil {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			break
+		}
+		current = rest[idx]
+		chain = append(chain, current)
+		rest = append(rest[:idx], rest[idx+1:]...)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("证书链中的 %s 不是该证书的签发者", certName(rest[0]))
+	}
+
+	domains := certificateDomains(leaf)
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("证书不包含域名或 IP 地址")
+	}
+
+	certPEM := certcrypto.PEMEncode(certcrypto.DERCertificateBytes(leaf.Raw))
+	var caPEM []byte
+	for _, cert := range chain {
+		caPEM = append(caPEM, certcrypto.PEMEncode(certcrypto.DERCertificateBytes(cert.Raw))...)
+	}
+
+	return &ImportedCert{
+		Domain:       domains[0],
+		SAN:          domains[1:],
+		CertPEM:      certPEM,
+		KeyPEM:       keyPEM,
+		CaPEM:        caPEM,
+		FullchainPEM: append(append([]byte{}, certPEM...), caPEM...),
+		NotBefore:    leaf.NotBefore,
+		NotAfter:     leaf.NotAfter,
+	}, nil
+}
+
+// certificateDomains 获取证书中的域名和 IP 地址列表（CN 在前，去重）
+func certificateDomains(cert *x509.Certificate) []string {
+	var domains []string
+	seen := make(map[string]bool)
+	add := func(d string) {
+		d = strings.ToLower(d)
+		if d == "" || seen[d] {
+			return
+		}
+		seen[d] = true
+		domains = append(domains, d)
+	}
+
+	// CN 不是域名（如组织名称）时忽略
+	if _, err := NormalizeDomain(cert.Subject.CommonName); err == nil {
+		add(cert.Subject.CommonName)
+	}
+	for _, d := range cert.DNSNames {
+		add(d)
+	}
+	for _, ip := range cert.IPAddresses {
+		add(ip.String())
+	}
+	return domains
+}
+
+// certName 证书的显示名称
+func certName(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return cert.Subject.String()
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/BlakeLiAFK/letsync/internal/server/store"
+)
+
+// ErrAlreadyRevoked 证书已吊销
+var ErrAlreadyRevoked = errors.New("证书已吊销")
+
+// ValidRevocationReason 是否为可用的吊销原因 (RFC 5280 CRLReason)
+// 7 未定义，removeFromCRL (8) 只用于增量 CRL
+func ValidRevocationReason(reason int) bool {
+	return reason >= 0 && reason <= 10 && reason != 7 && reason != 8
+}
+
+// Revoke 吊销证书当前的签发结果：ACME 工作区向 CA 提交吊销请求，私有 CA 工作区记录到 CA 的 CRL
+// 吊销后证书状态为 revoked，不再自动续期；重新申请成功后恢复为 valid
+func (s *ACMEService) Revoke(certID uint, reason int) error {
+	if !ValidRevocationReason(reason) {
+		return fmt.Errorf("不支持的吊销原因: %d", reason)
+	}
+
+	cert, err := s.certService.Get(certID)
+	if err != nil {
+		return err
+	}
+	if cert.IsImported() {
+		return fmt.Errorf("外部导入的证书需要到签发该证书的 CA 吊销")
+	}
+	if len(cert.CertPEM) == 0 {
+		return fmt.Errorf("证书尚未签发")
+	}
+	if cert.RevokedAt != nil {
+		return ErrAlreadyRevoked
+	}
+
+	// 签发中的证书即将被替换，不吊销
+	release, ok := tryBeginIssue(certID)
+	if !ok {
+		return fmt.Errorf("证书正在签发或续期，请稍后再试")
+	}
+	defer release()
+
+	if !NewWorkspaceService().IsPrivateCA(cert.WorkspaceID) {
+		client, err := s.createACMEClientWithWorkspace(cert.WorkspaceID)
+		if err != nil {
+			return fmt.Errorf("创建 ACME 客户端失败: %w", err)
+		}
+		code := uint(reason)
+		if err := client.Certificate.RevokeWithReason(cert.CertPEM, &code); err != nil {
+			s.logger.Error("acme", fmt.Sprintf("吊销证书失败: %s - %v", cert.Domain, err), nil)
+			return fmt.Errorf("吊销证书失败: %w", err)
+		}
+	}
+
+	now := time.Now()
+	if err := store.GetDB().Model(&model.Certificate{}).Where("id = ?", certID).Updates(map[string]interface{}{
+		"status":            "revoked",
+		"revoked_at":        &now,
+		"revocation_reason": reason,
+	}).Error; err != nil {
+		return err
+	}
+
+	s.logger.Info("acme", fmt.Sprintf("吊销证书: %s", cert.Domain), map[string]interface{}{
+		"cert_id":     certID,
+		"fingerprint": cert.Fingerprint,
+		"reason":      reason,
+	})
+	return nil
+}
@@ -1,7 +1,10 @@
 package service
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/BlakeLiAFK/letsync/internal/pkg/crypto"
@@ -13,6 +16,7 @@ import (
 // CertService 证书服务
 type CertService struct {
 	logger *LogService
+	tx     *gorm.DB // 非空时所有读写在该事务中进行
 }
 
 func NewCertService() *CertService {
@@ -21,34 +25,75 @@ func NewCertService() *CertService {
 	}
 }
 
-// CreatePending 创建待申请的证书记录（状态为 pending，默认 DNS-01）
-func (s *CertService) CreatePending(domain string, san []string, dnsProviderID uint) (*model.Certificate, error) {
-	return s.CreatePendingWithChallenge(domain, san, dnsProviderID, "dns-01", nil)
+// WithTx 返回在事务 tx 中读写的副本
+func (s *CertService) WithTx(tx *gorm.DB) *CertService {
+	c := *s
+	c.tx = tx
+	c.logger = s.logger.WithTx(tx)
+	return &c
 }
 
-// CreatePendingWithChallenge 创建待申请的证书记录（支持指定验证方式和工作区）
-func (s *CertService) CreatePendingWithChallenge(domain string, san []string, dnsProviderID uint, challengeType string, workspaceID *uint) (*model.Certificate, error) {
-	if challengeType == "" {
-		challengeType = "dns-01"
-	}
+func (s *CertService) db() *gorm.DB {
+	return store.GetDBOr(s.tx)
+}
 
-	cert := &model.Certificate{
-		Domain:        domain,
-		DNSProviderID: dnsProviderID,
-		ChallengeType: challengeType,
-		WorkspaceID:   workspaceID,
-		Status:        "pending",
+// CertConfig 证书的申请配置，创建和修改时一次写入
+type CertConfig struct {
+	Domain           string
+	SAN              []string
+	ChallengeType    string // dns-01、http-01 或 tls-alpn-01，为空为 dns-01
+	HTTP01Mode       string // HTTP-01 放置方式: 空为服务器监听端口, agent, webroot, proxy
+	HTTP01Webroot    string // webroot 模式写入的目录，其他模式忽略
+	DNSProviderID    uint
+	ChallengeAlias   string
+	DomainChallenges []model.DomainChallenge
+	WorkspaceID      *uint
+	Profile          string
+	PreferredChain   string
+	CSRPEM           []byte // 自带 CSR，为空表示由服务器生成私钥
+	KeepCSR          bool   // 修改时保留原有 CSR，忽略 CSRPEM
+}
+
+// apply 将配置写入证书记录
+func (cfg *CertConfig) apply(cert *model.Certificate) {
+	cert.Domain = cfg.Domain
+	cert.SetSANList(cfg.SAN)
+	cert.ChallengeType = cfg.ChallengeType
+	if cert.ChallengeType == "" {
+		cert.ChallengeType = "dns-01"
 	}
-	cert.SetSANList(san)
+	cert.HTTP01Mode = cfg.HTTP01Mode
+	cert.HTTP01Webroot = ""
+	if cfg.HTTP01Mode == "webroot" {
+		cert.HTTP01Webroot = cfg.HTTP01Webroot
+	}
+	cert.DNSProviderID = cfg.DNSProviderID
+	cert.ChallengeAlias = cfg.ChallengeAlias
+	cert.SetDomainChallenges(cfg.DomainChallenges)
+	cert.WorkspaceID = cfg.WorkspaceID
+	cert.Profile = strings.TrimSpace(cfg.Profile)
+	cert.PreferredChain = strings.TrimSpace(cfg.PreferredChain)
+	if !cfg.KeepCSR {
+		cert.CSRPEM = cfg.CSRPEM
+	}
+}
+
+// CreatePending 创建待申请的证书记录（状态为 pending）
+func (s *CertService) CreatePending(cfg CertConfig) (*model.Certificate, error) {
+	cert := &model.Certificate{Status: "pending"}
+	cfg.apply(cert)
 
-	if err := store.GetDB().Create(cert).Error; err != nil {
+	if err := s.db().Transaction(func(tx *gorm.DB) error {
+		return tx.Create(cert).Error
+	}); err != nil {
 		return nil, err
 	}
 
-	s.logger.Info("cert", fmt.Sprintf("添加证书记录: %s", domain), map[string]interface{}{
+	s.logger.Info("cert", fmt.Sprintf("添加证书记录: %s", cert.Domain), map[string]interface{}{
 		"cert_id":        cert.ID,
-		"challenge_type": challengeType,
-		"workspace_id":   workspaceID,
+		"challenge_type": cert.ChallengeType,
+		"workspace_id":   cert.WorkspaceID,
+		"has_csr":        cert.UsesCSR(),
 		"status":         "pending",
 	})
 
@@ -76,7 +121,7 @@ func (s *CertService) Create(domain string, san []string, dnsProviderID uint, ce
 	}
 	cert.SetSANList(san)
 
-	if err := store.GetDB().Create(cert).Error; err != nil {
+	if err := s.db().Create(cert).Error; err != nil {
 		return nil, err
 	}
 
@@ -89,10 +134,67 @@ func (s *CertService) Create(domain string, san []string, dnsProviderID uint, ce
 	return cert, nil
 }
 
+// Import 保存外部导入的证书，只跟踪到期和下发 Agent，不通过 ACME 续期
+func (s *CertService) Import(imported *ImportedCert, workspaceID *uint) (*model.Certificate, error) {
+	fingerprint, err := crypto.CertFingerprint(imported.CertPEM)
+	if err != nil {
+		return nil, fmt.Errorf("计算证书指纹失败: %w", err)
+	}
+
+	cert := &model.Certificate{
+		Domain:       imported.Domain,
+		CertPEM:      imported.CertPEM,
+		KeyPEM:       imported.KeyPEM,
+		CaPEM:        imported.CaPEM,
+		FullchainPEM: imported.FullchainPEM,
+		Fingerprint:  fingerprint,
+		IssuedAt:     imported.NotBefore,
+		ExpiresAt:    imported.NotAfter,
+		WorkspaceID:  workspaceID,
+		Source:       "import",
+		Status:       "valid",
+	}
+	cert.SetSANList(imported.SAN)
+
+	if err := s.db().Create(cert).Error; err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("cert", fmt.Sprintf("导入证书: %s", imported.Domain), map[string]interface{}{
+		"cert_id":     cert.ID,
+		"fingerprint": fingerprint,
+		"expires_at":  imported.NotAfter,
+	})
+
+	return cert, nil
+}
+
+// Reimport 用新导入的证书替换已导入的证书（如商业证书到期后重新购买），保留 Agent 绑定
+func (s *CertService) Reimport(id uint, imported *ImportedCert) error {
+	cert, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if !cert.IsImported() {
+		return fmt.Errorf("该证书由 ACME 申请，不能导入替换")
+	}
+
+	cert.SetSANList(imported.SAN)
+	if err := s.db().Model(&model.Certificate{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"domain": imported.Domain,
+			"san":    cert.SAN,
+		}).Error; err != nil {
+		return err
+	}
+
+	return s.Update(id, imported.CertPEM, imported.KeyPEM, imported.CaPEM, imported.FullchainPEM, imported.NotBefore, imported.NotAfter)
+}
+
 // Get 获取证书
 func (s *CertService) Get(id uint) (*model.Certificate, error) {
 	var cert model.Certificate
-	if err := store.GetDB().Preload("DNSProvider").Preload("Workspace").First(&cert, id).Error; err != nil {
+	if err := s.db().Preload("DNSProvider").Preload("Workspace").First(&cert, id).Error; err != nil {
 		return nil, err
 	}
 	return &cert, nil
@@ -101,7 +203,7 @@ func (s *CertService) Get(id uint) (*model.Certificate, error) {
 // List 获取所有证书
 func (s *CertService) List() ([]model.Certificate, error) {
 	var certs []model.Certificate
-	if err := store.GetDB().Preload("DNSProvider").Preload("Workspace").Find(&certs).Error; err != nil {
+	if err := s.db().Preload("DNSProvider").Preload("Workspace").Find(&certs).Error; err != nil {
 		return nil, err
 	}
 
@@ -109,7 +211,7 @@ func (s *CertService) List() ([]model.Certificate, error) {
 	for i := range certs {
 		if certs[i].ExpiresAt.Before(time.Now()) && certs[i].Status != "expired" {
 			certs[i].Status = "expired"
-			store.GetDB().Model(&certs[i]).Update("status", "expired")
+			s.db().Model(&certs[i]).Update("status", "expired")
 		}
 	}
 
@@ -120,12 +222,12 @@ func (s *CertService) List() ([]model.Certificate, error) {
 func (s *CertService) Delete(id uint) error {
 	// 检查是否有 Agent 在使用
 	var count int64
-	store.GetDB().Model(&model.AgentCert{}).Where("cert_id = ?", id).Count(&count)
+	s.db().Model(&model.AgentCert{}).Where("cert_id = ?", id).Count(&count)
 	if count > 0 {
 		return fmt.Errorf("该证书有 %d 个 Agent 正在使用，无法删除", count)
 	}
 
-	return store.GetDB().Delete(&model.Certificate{}, id).Error
+	return s.db().Delete(&model.Certificate{}, id).Error
 }
 
 // Update 更新证书
@@ -144,14 +246,22 @@ func (s *CertService) Update(id uint, certPEM, keyPEM, caPEM, fullchainPEM []byt
 		"issued_at":     issuedAt,
 		"expires_at":    expiresAt,
 		"status":        "valid",
+		"last_error":    "",
+		"revoked_at":    nil,
+		// 新证书需要重新查询 ARI 续期窗口
+		"ari_window_start":    nil,
+		"ari_window_end":      nil,
+		"ari_renew_at":        nil,
+		"ari_next_check_at":   nil,
+		"ari_explanation_url": "",
 	}
 
-	if err := store.GetDB().Model(&model.Certificate{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+	if err := s.db().Model(&model.Certificate{}).Where("id = ?", id).Updates(updates).Error; err != nil {
 		return err
 	}
 
 	// 标记所有关联的 Agent 证书绑定为 pending
-	store.GetDB().Model(&model.AgentCert{}).Where("cert_id = ?", id).Update("sync_status", "pending")
+	s.db().Model(&model.AgentCert{}).Where("cert_id = ?", id).Update("sync_status", "pending")
 
 	s.logger.Info("cert", fmt.Sprintf("续期证书 ID: %d", id), map[string]interface{}{
 		"fingerprint": fingerprint,
@@ -166,7 +276,7 @@ func (s *CertService) GetExpiringCerts(days int) ([]model.Certificate, error) {
 	threshold := time.Now().Add(time.Duration(days) * 24 * time.Hour)
 
 	var certs []model.Certificate
-	if err := store.GetDB().
+	if err := s.db().
 		Where("expires_at <= ? AND status = ? AND (next_retry_at IS NULL OR renew_fail_count = 0)", threshold, "valid").
 		Preload("DNSProvider").
 		Preload("Workspace").
@@ -177,12 +287,36 @@ func (s *CertService) GetExpiringCerts(days int) ([]model.Certificate, error) {
 	return certs, nil
 }
 
+// GetRenewalCandidates 获取参与续期检查的证书（排除已有重试计划的）
+func (s *CertService) GetRenewalCandidates() ([]model.Certificate, error) {
+	var certs []model.Certificate
+	if err := s.db().
+		Where("status = ? AND (next_retry_at IS NULL OR renew_fail_count = 0)", "valid").
+		Preload("DNSProvider").
+		Preload("Workspace").
+		Find(&certs).Error; err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
+
+// GetImportedCerts 获取外部导入的证书
+func (s *CertService) GetImportedCerts() ([]model.Certificate, error) {
+	var certs []model.Certificate
+	if err := s.db().Where("source = ?", "import").Find(&certs).Error; err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
+
 // GetCertsNeedRetry 获取需要重试的证书
 func (s *CertService) GetCertsNeedRetry() ([]model.Certificate, error) {
 	now := time.Now()
 
 	var certs []model.Certificate
-	if err := store.GetDB().
+	if err := s.db().
 		Where("next_retry_at IS NOT NULL AND next_retry_at <= ? AND status = ?", now, "valid").
 		Preload("DNSProvider").
 		Preload("Workspace").
@@ -195,29 +329,47 @@ func (s *CertService) GetCertsNeedRetry() ([]model.Certificate, error) {
 
 // UpdateRenewAttempt 更新续期尝试时间
 func (s *CertService) UpdateRenewAttempt(certID uint, t time.Time) {
-	store.GetDB().Model(&model.Certificate{}).Where("id = ?", certID).
+	s.db().Model(&model.Certificate{}).Where("id = ?", certID).
 		Update("last_renew_attempt", t)
 }
 
 // IncrementFailCount 增加失败次数并返回新值
 func (s *CertService) IncrementFailCount(certID uint) int {
-	store.GetDB().Model(&model.Certificate{}).Where("id = ?", certID).
+	s.db().Model(&model.Certificate{}).Where("id = ?", certID).
 		UpdateColumn("renew_fail_count", gorm.Expr("renew_fail_count + 1"))
 
 	var cert model.Certificate
-	store.GetDB().Select("renew_fail_count").First(&cert, certID)
+	s.db().Select("renew_fail_count").First(&cert, certID)
 	return cert.RenewFailCount
 }
 
 // SetNextRetry 设置下次重试时间
 func (s *CertService) SetNextRetry(certID uint, t time.Time) {
-	store.GetDB().Model(&model.Certificate{}).Where("id = ?", certID).
+	s.db().Model(&model.Certificate{}).Where("id = ?", certID).
 		Update("next_retry_at", t)
 }
 
+// UpdateRenewalInfo 保存 ARI 续期窗口
+func (s *CertService) UpdateRenewalInfo(certID uint, windowStart, windowEnd, renewAt, nextCheck time.Time, explanationURL string) {
+	s.db().Model(&model.Certificate{}).Where("id = ?", certID).
+		Updates(map[string]interface{}{
+			"ari_window_start":    windowStart,
+			"ari_window_end":      windowEnd,
+			"ari_renew_at":        renewAt,
+			"ari_next_check_at":   nextCheck,
+			"ari_explanation_url": explanationURL,
+		})
+}
+
+// SetARINextCheck 设置下次查询 ARI 的时间（CA 不支持或查询失败时使用）
+func (s *CertService) SetARINextCheck(certID uint, t time.Time) {
+	s.db().Model(&model.Certificate{}).Where("id = ?", certID).
+		Update("ari_next_check_at", t)
+}
+
 // ResetRetryState 重置重试状态（续期成功后调用）
 func (s *CertService) ResetRetryState(certID uint) {
-	store.GetDB().Model(&model.Certificate{}).Where("id = ?", certID).
+	s.db().Model(&model.Certificate{}).Where("id = ?", certID).
 		Updates(map[string]interface{}{
 			"renew_fail_count": 0,
 			"next_retry_at":    nil,
@@ -228,13 +380,13 @@ func (s *CertService) ResetRetryState(certID uint) {
 func (s *CertService) GetStats() map[string]int64 {
 	var total, expired, expiring, valid, pending int64
 
-	store.GetDB().Model(&model.Certificate{}).Count(&total)
-	store.GetDB().Model(&model.Certificate{}).Where("status = ?", "expired").Count(&expired)
-	store.GetDB().Model(&model.Certificate{}).Where("status = ?", "pending").Count(&pending)
+	s.db().Model(&model.Certificate{}).Count(&total)
+	s.db().Model(&model.Certificate{}).Where("status = ?", "expired").Count(&expired)
+	s.db().Model(&model.Certificate{}).Where("status = ?", "pending").Count(&pending)
 
 	// 30 天内到期
 	threshold := time.Now().Add(30 * 24 * time.Hour)
-	store.GetDB().Model(&model.Certificate{}).
+	s.db().Model(&model.Certificate{}).
 		Where("expires_at <= ? AND status = ?", threshold, "valid").
 		Count(&expiring)
 
@@ -249,61 +401,179 @@ func (s *CertService) GetStats() map[string]int64 {
 	}
 }
 
-// UpdateConfig 更新证书配置（域名、SAN、DNS提供商，默认保持原有验证方式和工作区）
-func (s *CertService) UpdateConfig(id uint, domain string, san []string, dnsProviderID uint) error {
-	cert, err := s.Get(id)
-	if err != nil {
+// UpdateConfig 修改证书的申请配置，所有字段在同一事务中写入
+func (s *CertService) UpdateConfig(id uint, cfg CertConfig) error {
+	var cert model.Certificate
+	if err := s.db().Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&cert, id).Error; err != nil {
+			return err
+		}
+		cfg.apply(&cert)
+
+		updates := map[string]interface{}{
+			"domain":            cert.Domain,
+			"san":               cert.SAN,
+			"challenge_type":    cert.ChallengeType,
+			"http01_mode":       cert.HTTP01Mode,
+			"http01_webroot":    cert.HTTP01Webroot,
+			"dns_provider_id":   cert.DNSProviderID,
+			"challenge_alias":   cert.ChallengeAlias,
+			"domain_challenges": cert.DomainChallenges,
+			"workspace_id":      cert.WorkspaceID,
+			"profile":           cert.Profile,
+			"preferred_chain":   cert.PreferredChain,
+		}
+		if !cfg.KeepCSR {
+			updates["csr_pem"] = cert.CSRPEM
+		}
+		return tx.Model(&model.Certificate{}).Where("id = ?", id).Updates(updates).Error
+	}); err != nil {
 		return err
 	}
-	return s.UpdateConfigWithChallenge(id, domain, san, dnsProviderID, cert.ChallengeType, cert.WorkspaceID)
+
+	s.logger.Info("cert", fmt.Sprintf("更新证书配置: %s", cert.Domain), map[string]interface{}{
+		"cert_id":         id,
+		"challenge_type":  cert.ChallengeType,
+		"dns_provider_id": cert.DNSProviderID,
+		"workspace_id":    cert.WorkspaceID,
+		"has_csr":         cert.UsesCSR(),
+	})
+
+	return nil
+}
+
+// SetWorkspace 设置证书所属的工作区（nil 表示使用全局配置）
+// clearDNS 为 true 时同时清除 DNS 验证配置（移到私有 CA 工作区）
+func (s *CertService) SetWorkspace(id uint, workspaceID *uint, clearDNS bool) error {
+	updates := map[string]interface{}{"workspace_id": workspaceID}
+	if clearDNS {
+		updates["dns_provider_id"] = 0
+		updates["challenge_alias"] = ""
+		updates["domain_challenges"] = ""
+	}
+	return s.db().Model(&model.Certificate{}).Where("id = ?", id).Updates(updates).Error
 }
 
-// UpdateConfigWithChallenge 更新证书配置（包含验证方式和工作区）
-func (s *CertService) UpdateConfigWithChallenge(id uint, domain string, san []string, dnsProviderID uint, challengeType string, workspaceID *uint) error {
-	cert, err := s.Get(id)
-	if err != nil {
+// SetDNSProvider 设置证书 DNS-01 验证使用的 DNS 提供商
+func (s *CertService) SetDNSProvider(id uint, dnsProviderID uint) error {
+	return s.db().Model(&model.Certificate{}).Where("id = ?", id).Update("dns_provider_id", dnsProviderID).Error
+}
+
+// SetLastError 记录最近一次申请或续期失败的原因
+func (s *CertService) SetLastError(id uint, message string) error {
+	return s.db().Model(&model.Certificate{}).Where("id = ?", id).Update("last_error", message).Error
+}
+
+// SetCSR 设置证书使用的 CSR（传入 nil 表示改回由服务器生成私钥）
+func (s *CertService) SetCSR(id uint, csrPEM []byte) error {
+	if err := s.db().Model(&model.Certificate{}).Where("id = ?", id).Update("csr_pem", csrPEM).Error; err != nil {
 		return err
 	}
 
-	if challengeType == "" {
-		challengeType = "dns-01"
+	s.logger.Info("cert", fmt.Sprintf("更新证书 CSR: ID=%d", id), map[string]interface{}{
+		"cert_id": id,
+		"has_csr": len(csrPEM) > 0,
+	})
+
+	return nil
+}
+
+// HasAgentKeyBinding 证书是否绑定了本地生成私钥的 Agent
+func (s *CertService) HasAgentKeyBinding(certID uint) bool {
+	var count int64
+	s.db().Model(&model.AgentCert{}).Where("cert_id = ? AND agent_key = ?", certID, true).Count(&count)
+	return count > 0
+}
+
+// ParseCSR 解析并校验 PEM 格式的 CSR
+func ParseCSR(csrPEM []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || (block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST") {
+		return nil, fmt.Errorf("无效的 CSR：需要 PEM 格式的 CERTIFICATE REQUEST")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析 CSR 失败: %w", err)
 	}
 
-	updates := map[string]interface{}{
-		"domain":          domain,
-		"dns_provider_id": dnsProviderID,
-		"challenge_type":  challengeType,
-		"workspace_id":    workspaceID,
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("CSR 签名校验失败: %w", err)
 	}
 
-	cert.SetSANList(san)
-	updates["san"] = cert.SAN
+	if len(CSRDomains(csr)) == 0 {
+		return nil, fmt.Errorf("CSR 中没有任何域名")
+	}
 
-	if err := store.GetDB().Model(&model.Certificate{}).Where("id = ?", id).Updates(updates).Error; err != nil {
-		return err
+	return csr, nil
+}
+
+// CSRKeyFingerprint 获取 CSR 公钥指纹，解析失败返回空字符串
+func CSRKeyFingerprint(csrPEM []byte) string {
+	if len(csrPEM) == 0 {
+		return ""
+	}
+	csr, err := ParseCSR(csrPEM)
+	if err != nil {
+		return ""
+	}
+	fingerprint, err := crypto.PublicKeyFingerprint(csr.PublicKey)
+	if err != nil {
+		return ""
 	}
+	return fingerprint
+}
 
-	s.logger.Info("cert", fmt.Sprintf("更新证书配置: %s", domain), map[string]interface{}{
-		"cert_id":         id,
-		"challenge_type":  challengeType,
-		"dns_provider_id": dnsProviderID,
-		"workspace_id":    workspaceID,
-	})
+// CertKeyFingerprint 获取证书（链中第一个证书）的公钥指纹，未签发或解析失败返回空字符串
+func CertKeyFingerprint(certPEM []byte) string {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return ""
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return ""
+	}
+	fingerprint, err := crypto.PublicKeyFingerprint(cert.PublicKey)
+	if err != nil {
+		return ""
+	}
+	return fingerprint
+}
 
-	return nil
+// CSRDomains 获取 CSR 中的域名和 IP 地址列表（CN 在前，去重）
+func CSRDomains(csr *x509.CertificateRequest) []string {
+	var domains []string
+	seen := make(map[string]bool)
+	add := func(d string) {
+		if d == "" || seen[d] {
+			return
+		}
+		seen[d] = true
+		domains = append(domains, d)
+	}
+
+	add(csr.Subject.CommonName)
+	for _, d := range csr.DNSNames {
+		add(d)
+	}
+	for _, ip := range csr.IPAddresses {
+		add(ip.String())
+	}
+	return domains
 }
 
 // GetAgents 获取使用该证书的 Agent
 func (s *CertService) GetAgents(certID uint) ([]map[string]interface{}, error) {
 	var bindings []model.AgentCert
-	if err := store.GetDB().Where("cert_id = ?", certID).Find(&bindings).Error; err != nil {
+	if err := s.db().Where("cert_id = ?", certID).Find(&bindings).Error; err != nil {
 		return nil, err
 	}
 
 	var result []map[string]interface{}
 	for _, b := range bindings {
 		var agent model.Agent
-		if err := store.GetDB().First(&agent, b.AgentID).Error; err != nil {
+		if err := s.db().First(&agent, b.AgentID).Error; err != nil {
 			continue
 		}
 
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/BlakeLiAFK/letsync/internal/server/store"
+)
+
+// AgentChallenge 委托给 Agent 放置的 HTTP-01 验证令牌
+type AgentChallenge struct {
+	CertID  uint   `json:"cert_id"`
+	Domain  string `json:"domain"`
+	Token   string `json:"token"`
+	KeyAuth string `json:"key_auth"`
+}
+
+// pendingChallenge 等待 Agent 确认的验证令牌
+type pendingChallenge struct {
+	AgentChallenge
+	bindings  []model.AgentCert // 需要放置令牌的证书绑定
+	confirmed map[uint]bool     // bindingID -> 已确认放置
+	done      chan struct{}     // 全部确认后关闭
+}
+
+// ChallengeService 管理 HTTP-01 验证令牌（仅保存在内存中）
+// 包括委托给 Agent 放置的令牌和由本服务主路由直接提供的令牌
+type ChallengeService struct {
+	challenges  map[string]*pendingChallenge // certID/token -> 令牌
+	proxyTokens map[string]string            // token -> keyAuth
+	mutex       sync.Mutex
+}
+
+// 单例实例
+var (
+	challengeServiceInstance *ChallengeService
+	challengeServiceOnce     sync.Once
+)
+
+// NewChallengeService 获取验证令牌服务单例
+func NewChallengeService() *ChallengeService {
+	challengeServiceOnce.Do(func() {
+		challengeServiceInstance = &ChallengeService{
+			challenges:  make(map[string]*pendingChallenge),
+			proxyTokens: make(map[string]string),
+		}
+	})
+	return challengeServiceInstance
+}
+
+func challengeKey(certID uint, token string) string {
+	return fmt.Sprintf("%d/%s", certID, token)
+}
+
+// Add 登记待放置的令牌，返回全部绑定确认后关闭的通道
+func (s *ChallengeService) Add(challenge AgentChallenge, bindings []model.AgentCert) <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pending := &pendingChallenge{
+		AgentChallenge: challenge,
+		bindings:       bindings,
+		confirmed:      make(map[uint]bool),
+		done:           make(chan struct{}),
+	}
+	s.challenges[challengeKey(challenge.CertID, challenge.Token)] = pending
+
+	return pending.done
+}
+
+// Remove 移除令牌，Agent 下次轮询时会清理已放置的文件
+func (s *ChallengeService) Remove(certID uint, token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.challenges, challengeKey(certID, token))
+}
+
+// ListForAgent 获取需要指定 Agent 放置的令牌及对应绑定
+func (s *ChallengeService) ListForAgent(agentID uint) []AgentChallengeTask {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var tasks []AgentChallengeTask
+	for _, pending := range s.challenges {
+		for _, binding := range pending.bindings {
+			if binding.AgentID != agentID {
+				continue
+			}
+			tasks = append(tasks, AgentChallengeTask{
+				AgentChallenge: pending.AgentChallenge,
+				Webroot:        binding.ChallengeWebroot,
+				Port:           binding.ChallengePort,
+				Confirmed:      pending.confirmed[binding.ID],
+			})
+		}
+	}
+
+	// 保持稳定顺序，方便 Agent 比对
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].CertID != tasks[j].CertID {
+			return tasks[i].CertID < tasks[j].CertID
+		}
+		return tasks[i].Token < tasks[j].Token
+	})
+
+	return tasks
+}
+
+// Confirm 记录 Agent 已放置令牌，全部绑定确认后唤醒等待方
+func (s *ChallengeService) Confirm(agentID, certID uint, token string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pending, ok := s.challenges[challengeKey(certID, token)]
+	if !ok {
+		return fmt.Errorf("验证令牌不存在或已过期")
+	}
+
+	found := false
+	for _, binding := range pending.bindings {
+		if binding.AgentID == agentID {
+			pending.confirmed[binding.ID] = true
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("该 Agent 未绑定此证书")
+	}
+
+	if len(pending.confirmed) == len(pending.bindings) {
+		select {
+		case <-pending.done:
+		default:
+			close(pending.done)
+		}
+	}
+
+	return nil
+}
+
+// unconfirmedAgents 获取尚未确认的 Agent 名称（用于超时提示）
+func (s *ChallengeService) unconfirmedAgents(certID uint, token string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pending, ok := s.challenges[challengeKey(certID, token)]
+	if !ok {
+		return nil
+	}
+
+	var names []string
+	for _, binding := range pending.bindings {
+		if !pending.confirmed[binding.ID] {
+			names = append(names, fmt.Sprintf("binding#%d(agent#%d)", binding.ID, binding.AgentID))
+		}
+	}
+	return names
+}
+
+// AgentChallengeTask 下发给 Agent 的令牌放置任务
+type AgentChallengeTask struct {
+	AgentChallenge
+	Webroot   string `json:"webroot"`   // 写入 {webroot}/.well-known/acme-challenge/{token}
+	Port      int    `json:"port"`      // 未配置 webroot 时在该端口提供验证文件
+	Confirmed bool   `json:"confirmed"` // 服务器是否已收到确认
+}
+
+// AgentHTTP01Provider 通过绑定的 Agent 完成 HTTP-01 验证
+// Present 会等待所有绑定该证书的 Agent 确认放置后才返回，随后 lego 才通知 CA 验证
+type AgentHTTP01Provider struct {
+	certID     uint
+	taskType   string
+	timeout    time.Duration
+	challenges *ChallengeService
+	taskLog    *TaskLogService
+}
+
+// NewAgentHTTP01Provider 创建 Agent 委托的 HTTP-01 Provider
+func NewAgentHTTP01Provider(certID uint, taskType string, timeout time.Duration) (*AgentHTTP01Provider, error) {
+	var count int64
+	store.GetDB().Model(&model.AgentCert{}).Where("cert_id = ?", certID).Count(&count)
+	if count == 0 {
+		return nil, fmt.Errorf("证书未绑定 Agent，无法由 Agent 完成 HTTP-01 验证")
+	}
+
+	return &AgentHTTP01Provider{
+		certID:     certID,
+		taskType:   taskType,
+		timeout:    timeout,
+		challenges: NewChallengeService(),
+		taskLog:    NewTaskLogService(),
+	}, nil
+}
+
+// Present 下发令牌并等待 Agent 确认
+func (p *AgentHTTP01Provider) Present(domain, token, keyAuth string) error {
+	var bindings []model.AgentCert
+	if err := store.GetDB().Where("cert_id = ?", p.certID).Find(&bindings).Error; err != nil {
+		return fmt.Errorf("获取证书绑定失败: %w", err)
+	}
+	if len(bindings) == 0 {
+		return fmt.Errorf("证书未绑定 Agent，无法由 Agent 完成 HTTP-01 验证")
+	}
+
+	done := p.challenges.Add(AgentChallenge{
+		CertID:  p.certID,
+		Domain:  domain,
+		Token:   token,
+		KeyAuth: keyAuth,
+	}, bindings)
+	p.taskLog.Info(p.certID, p.taskType, fmt.Sprintf("等待 %d 个 Agent 放置验证文件: %s", len(bindings), domain), nil)
+
+	select {
+	case <-done:
+		p.taskLog.Info(p.certID, p.taskType, fmt.Sprintf("Agent 已放置验证文件: %s", domain), nil)
+		return nil
+	case <-time.After(p.timeout):
+		pending := p.challenges.unconfirmedAgents(p.certID, token)
+		p.challenges.Remove(p.certID, token)
+		return fmt.Errorf("等待 Agent 放置验证文件超时 (%s): 未确认 %s", domain, strings.Join(pending, ", "))
+	}
+}
+
+// CleanUp 移除令牌
+func (p *AgentHTTP01Provider) CleanUp(domain, token, keyAuth string) error {
+	p.challenges.Remove(p.certID, token)
+	return nil
+}
+
+// GetProxyToken 获取由主路由提供的令牌
+func (s *ChallengeService) GetProxyToken(token string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keyAuth, ok := s.proxyTokens[token]
+	return keyAuth, ok
+}
+
+// ProxyHTTP01Provider 由本服务主路由提供 /.well-known/acme-challenge/，前置代理转发该路径即可
+type ProxyHTTP01Provider struct {
+	challenges *ChallengeService
+}
+
+// NewProxyHTTP01Provider 创建主路由提供验证文件的 Provider
+func NewProxyHTTP01Provider() *ProxyHTTP01Provider {
+	return &ProxyHTTP01Provider{challenges: NewChallengeService()}
+}
+
+// Present 登记令牌
+func (p *ProxyHTTP01Provider) Present(domain, token, keyAuth string) error {
+	p.challenges.mutex.Lock()
+	defer p.challenges.mutex.Unlock()
+
+	p.challenges.proxyTokens[token] = keyAuth
+	return nil
+}
+
+// CleanUp 移除令牌
+func (p *ProxyHTTP01Provider) CleanUp(domain, token, keyAuth string) error {
+	p.challenges.mutex.Lock()
+	defer p.challenges.mutex.Unlock()
+
+	delete(p.challenges.proxyTokens, token)
+	return nil
+}
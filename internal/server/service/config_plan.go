@@ -0,0 +1,955 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/dnsprovider"
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/BlakeLiAFK/letsync/internal/server/store"
+	"gorm.io/gorm"
+)
+
+// 配置变更类型
+const (
+	ConfigCreate = "create"
+	ConfigUpdate = "update"
+	ConfigDelete = "delete"
+)
+
+// configActions 配置变更类型名称
+var configActions = map[string]string{
+	ConfigCreate: "创建",
+	ConfigUpdate: "更新",
+	ConfigDelete: "删除",
+}
+
+// configKinds 配置对象类型名称
+var configKinds = map[string]string{
+	"workspace":    "工作区",
+	"dns_provider": "DNS 提供商",
+	"certificate":  "证书",
+	"agent":        "Agent",
+	"binding":      "证书绑定",
+}
+
+// ConfigChange 计划中的一项变更
+type ConfigChange struct {
+	Action string   // create, update, delete
+	Kind   string   // workspace, dns_provider, certificate, agent, binding
+	Name   string   // 对象名称，证书为 "域名 (工作区)"
+	Fields []string // 更新的字段
+	Result string   // 应用后的附加信息，如新建 Agent 的连接地址
+
+	apply func(s *ConfigService, c *ConfigChange) error // s 的读写都在应用计划的事务中
+}
+
+// String 格式化为 "+ 工作区 name"、"~ 证书 name: 字段"、"- Agent name"
+func (c ConfigChange) String() string {
+	sign := map[string]string{ConfigCreate: "+", ConfigUpdate: "~", ConfigDelete: "-"}[c.Action]
+	s := fmt.Sprintf("%s %s %s", sign, configKinds[c.Kind], c.Name)
+	if len(c.Fields) > 0 {
+		s += ": " + strings.Join(c.Fields, ", ")
+	}
+	return s
+}
+
+// ConfigPlan 配置与数据库的差异，按依赖顺序排列：先创建和更新被引用的对象，再删除引用方
+type ConfigPlan struct {
+	Changes  []ConfigChange
+	Warnings []string
+}
+
+// Count 统计指定类型的变更数量
+func (p *ConfigPlan) Count(action string) int {
+	n := 0
+	for _, c := range p.Changes {
+		if c.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// configRefs 名称到 ID 的映射，应用时新建的对象写入后供后续变更引用
+type configRefs struct {
+	workspaces map[string]uint
+	providers  map[string]uint
+	certs      map[string]uint // certKey
+	agents     map[string]uint
+}
+
+// certKey 证书按工作区名称和主域名对应
+func certKey(workspace, domain string) string {
+	return workspace + "/" + domain
+}
+
+// certLabel 证书的显示名称
+func certLabel(workspace, domain string) string {
+	if workspace == "" {
+		return domain
+	}
+	return fmt.Sprintf("%s (%s)", domain, workspace)
+}
+
+func (r *configRefs) workspaceID(name string) *uint {
+	if name == "" {
+		return nil
+	}
+	id := r.workspaces[name]
+	return &id
+}
+
+func (r *configRefs) domainChallenges(list []DomainChallengeSpec) []model.DomainChallenge {
+	result := make([]model.DomainChallenge, len(list))
+	for i, o := range list {
+		result[i] = model.DomainChallenge{
+			Domain:         o.Domain,
+			ChallengeType:  o.ChallengeType,
+			DNSProviderID:  r.providers[o.DNSProvider],
+			ChallengeAlias: o.ChallengeAlias,
+		}
+	}
+	return result
+}
+
+// pendingProviderID 计划阶段尚未创建的 DNS 提供商使用的临时 ID，仅用于校验
+const pendingProviderID = 1 << 30
+
+// Plan 校验配置并计算与数据库的差异；prune 为 true 时删除配置中未列出的对象
+func (s *ConfigService) Plan(spec *ConfigSpec, prune bool) (*ConfigPlan, error) {
+	db := store.GetDB()
+
+	var workspaces []model.Workspace
+	if err := db.Order("id").Find(&workspaces).Error; err != nil {
+		return nil, err
+	}
+	var providers []model.DNSProvider
+	if err := db.Order("id").Find(&providers).Error; err != nil {
+		return nil, err
+	}
+	var certs []model.Certificate
+	if err := db.Order("id").Find(&certs).Error; err != nil {
+		return nil, err
+	}
+	var agents []model.Agent
+	if err := db.Preload("Certs").Order("id").Find(&agents).Error; err != nil {
+		return nil, err
+	}
+
+	refs := &configRefs{
+		workspaces: map[string]uint{},
+		providers:  map[string]uint{},
+		certs:      map[string]uint{},
+		agents:     map[string]uint{},
+	}
+	plan := &ConfigPlan{}
+
+	workspaceNames := map[uint]string{}
+	dbWorkspaces := map[string]*model.Workspace{}
+	for i, w := range workspaces {
+		workspaceNames[w.ID] = w.Name
+		dbWorkspaces[w.Name] = &workspaces[i]
+		refs.workspaces[w.Name] = w.ID
+	}
+	providerNames := map[uint]string{}
+	dbProviders := map[string]*model.DNSProvider{}
+	for i, p := range providers {
+		providerNames[p.ID] = p.Name
+		dbProviders[p.Name] = &providers[i]
+		refs.providers[p.Name] = p.ID
+	}
+	dbCerts := map[string][]*model.Certificate{}
+	for i, c := range certs {
+		key := certKey(workspaceNames[derefUint(c.WorkspaceID)], c.Domain)
+		dbCerts[key] = append(dbCerts[key], &certs[i])
+		if _, ok := refs.certs[key]; !ok {
+			refs.certs[key] = c.ID
+		}
+	}
+	dbAgents := map[string][]*model.Agent{}
+	for i, a := range agents {
+		dbAgents[a.Name] = append(dbAgents[a.Name], &agents[i])
+		if _, ok := refs.agents[a.Name]; !ok {
+			refs.agents[a.Name] = a.ID
+		}
+	}
+
+	var deletes [5][]ConfigChange // binding, agent, certificate, dns_provider, workspace
+
+	// 工作区
+	specWorkspaces := map[string]*WorkspaceSpec{}
+	defaults := 0
+	for i := range spec.Workspaces {
+		w := &spec.Workspaces[i]
+		w.Name = strings.TrimSpace(w.Name)
+		if w.Name == "" {
+			return nil, fmt.Errorf("workspaces[%d]: 缺少名称", i)
+		}
+		if specWorkspaces[w.Name] != nil {
+			return nil, fmt.Errorf("工作区 %s 重复", w.Name)
+		}
+		specWorkspaces[w.Name] = w
+
+		if err := validateWorkspaceSpec(w); err != nil {
+			return nil, fmt.Errorf("工作区 %s: %w", w.Name, err)
+		}
+		if w.Default {
+			if defaults++; defaults > 1 {
+				return nil, fmt.Errorf("只能有一个默认工作区")
+			}
+		}
+
+		existing := dbWorkspaces[w.Name]
+		if existing == nil {
+			plan.Changes = append(plan.Changes, ConfigChange{
+				Action: ConfigCreate,
+				Kind:   "workspace",
+				Name:   w.Name,
+				apply: func(s *ConfigService, _ *ConfigChange) error {
+					var created *model.Workspace
+					var err error
+					if w.Type == "private_ca" {
+						created, err = s.workspaces.CreatePrivateCA(w.Name, w.Description, w.KeyType, w.MaxNames, w.CertValidityDays)
+						if err == nil && w.ACMEServer {
+							err = s.workspaces.SetACMEServer(created.ID, true)
+						}
+					} else {
+						created, err = s.workspaces.Create(w.Name, w.Description, w.CaURL, w.Email, w.KeyType, w.Profile, w.PreferredChain, w.MaxNames)
+					}
+					if err != nil {
+						return err
+					}
+					refs.workspaces[w.Name] = created.ID
+					if w.Default {
+						return s.workspaces.SetDefault(created.ID)
+					}
+					return nil
+				},
+			})
+			continue
+		}
+
+		existingType := existing.Type
+		if existingType == "" {
+			existingType = "acme"
+		}
+		if existingType != w.Type {
+			return nil, fmt.Errorf("工作区 %s: 类型创建后不可修改 (当前为 %s)", w.Name, existingType)
+		}
+		existingKeyType := existing.KeyType
+		if existingKeyType == "" {
+			existingKeyType = "EC256"
+		}
+
+		var fields []string
+		fields = diffField(fields, "description", existing.Description, w.Description)
+		fields = diffField(fields, "ca_url", existing.CaURL, w.CaURL)
+		fields = diffField(fields, "email", existing.Email, w.Email)
+		fields = diffField(fields, "key_type", existingKeyType, w.KeyType)
+		fields = diffField(fields, "profile", existing.Profile, w.Profile)
+		fields = diffField(fields, "preferred_chain", existing.PreferredChain, w.PreferredChain)
+		fields = diffField(fields, "max_names", existing.MaxNames, w.MaxNames)
+		fields = diffField(fields, "cert_validity_days", existing.CertValidityDays, w.CertValidityDays)
+		fields = diffField(fields, "acme_server", existing.ACMEServer, w.ACMEServer)
+		if w.Default && !existing.IsDefault {
+			fields = append(fields, "default")
+		}
+		if len(fields) > 0 {
+			id := existing.ID
+			plan.Changes = append(plan.Changes, ConfigChange{
+				Action: ConfigUpdate,
+				Kind:   "workspace",
+				Name:   w.Name,
+				Fields: fields,
+				apply: func(s *ConfigService, _ *ConfigChange) error {
+					if err := s.workspaces.Update(id, w.Name, w.Description, w.CaURL, w.Email, w.KeyType, w.Profile, w.PreferredChain, w.MaxNames); err != nil {
+						return err
+					}
+					if w.Type == "private_ca" {
+						if err := s.workspaces.SetCertValidityDays(id, w.CertValidityDays); err != nil {
+							return err
+						}
+						if err := s.workspaces.SetACMEServer(id, w.ACMEServer); err != nil {
+							return err
+						}
+					}
+					if w.Default {
+						return s.workspaces.SetDefault(id)
+					}
+					return nil
+				},
+			})
+		}
+	}
+	if prune {
+		for _, w := range workspaces {
+			if specWorkspaces[w.Name] == nil {
+				id := w.ID
+				deletes[4] = append(deletes[4], ConfigChange{
+					Action: ConfigDelete,
+					Kind:   "workspace",
+					Name:   w.Name,
+					apply:  func(s *ConfigService, _ *ConfigChange) error { return s.workspaces.Delete(id) },
+				})
+			}
+		}
+	}
+
+	// DNS 提供商
+	specProviders := map[string]bool{}
+	for i := range spec.DNSProviders {
+		p := &spec.DNSProviders[i]
+		p.Name = strings.TrimSpace(p.Name)
+		if p.Name == "" {
+			return nil, fmt.Errorf("dns_providers[%d]: 缺少名称", i)
+		}
+		if specProviders[p.Name] {
+			return nil, fmt.Errorf("DNS 提供商 %s 重复", p.Name)
+		}
+		specProviders[p.Name] = true
+
+		t, ok := dnsprovider.Get(p.Type)
+		if !ok {
+			return nil, fmt.Errorf("DNS 提供商 %s: 不支持的类型 %s", p.Name, p.Type)
+		}
+		config := map[string]interface{}{}
+		for key, value := range p.Config {
+			resolved, ref, err := spec.resolveSecret(value)
+			if err != nil {
+				return nil, fmt.Errorf("DNS 提供商 %s 的 %s: %w", p.Name, key, err)
+			}
+			config[key] = resolved
+			if !ref && isSecretField(t, key) && dnsprovider.Config(p.Config).String(key) != "" {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("DNS 提供商 %s 的 %s 为明文，建议使用 env: 或 file: 引用", p.Name, key))
+			}
+		}
+		if err := dnsprovider.Validate(p.Type, config, false); err != nil {
+			return nil, fmt.Errorf("DNS 提供商 %s: %w", p.Name, err)
+		}
+
+		existing := dbProviders[p.Name]
+		if existing == nil {
+			plan.Changes = append(plan.Changes, ConfigChange{
+				Action: ConfigCreate,
+				Kind:   "dns_provider",
+				Name:   p.Name,
+				apply: func(s *ConfigService, _ *ConfigChange) error {
+					created, err := s.dnsProvider.Create(p.Name, p.Type, config)
+					if err != nil {
+						return err
+					}
+					refs.providers[p.Name] = created.ID
+					return nil
+				},
+			})
+			continue
+		}
+
+		current, err := s.dnsProvider.GetDecryptedConfig(existing.ID)
+		if err != nil {
+			return nil, fmt.Errorf("DNS 提供商 %s: %w", p.Name, err)
+		}
+		var fields []string
+		fields = diffField(fields, "type", existing.Type, p.Type)
+		fields = append(fields, diffConfig(current, config)...)
+		if len(fields) > 0 {
+			id := existing.ID
+			plan.Changes = append(plan.Changes, ConfigChange{
+				Action: ConfigUpdate,
+				Kind:   "dns_provider",
+				Name:   p.Name,
+				Fields: fields,
+				apply: func(s *ConfigService, _ *ConfigChange) error {
+					return s.dnsProvider.Update(id, p.Name, p.Type, config)
+				},
+			})
+		}
+	}
+	if prune {
+		for _, p := range providers {
+			if !specProviders[p.Name] {
+				id := p.ID
+				deletes[3] = append(deletes[3], ConfigChange{
+					Action: ConfigDelete,
+					Kind:   "dns_provider",
+					Name:   p.Name,
+					apply:  func(s *ConfigService, _ *ConfigChange) error { return s.dnsProvider.Delete(id) },
+				})
+			}
+		}
+	}
+
+	// 引用的工作区和 DNS 提供商需在配置中列出，未启用 prune 时也可以是数据库中已有的
+	workspaceKnown := func(name string) bool {
+		return name == "" || specWorkspaces[name] != nil || (!prune && dbWorkspaces[name] != nil)
+	}
+	validationProviderIDs := map[string]uint{}
+	for name, p := range dbProviders {
+		if !prune || specProviders[name] {
+			validationProviderIDs[name] = p.ID
+		}
+	}
+	for i, p := range spec.DNSProviders {
+		if _, ok := validationProviderIDs[p.Name]; !ok {
+			validationProviderIDs[p.Name] = pendingProviderID + uint(i)
+		}
+	}
+	isPrivateCA := func(name string) bool {
+		if w := specWorkspaces[name]; w != nil {
+			return w.Type == "private_ca"
+		}
+		if w := dbWorkspaces[name]; w != nil {
+			return w.IsPrivateCA()
+		}
+		return false
+	}
+	maxNames := func(name string) int {
+		if w := specWorkspaces[name]; w != nil && w.MaxNames > 0 {
+			return w.MaxNames
+		}
+		if w := dbWorkspaces[name]; w != nil && specWorkspaces[name] == nil {
+			return s.workspaces.MaxNames(&w.ID)
+		}
+		return s.workspaces.MaxNames(nil)
+	}
+
+	// 证书：先规范化全部配置，再按工作区和主域名对应；找不到时按主域名对应唯一的证书（工作区变更）
+	type desiredCert struct {
+		spec    *CertificateSpec
+		key     string
+		label   string
+		domain  string
+		san     []string
+		imports bool
+		match   *model.Certificate
+	}
+	desired := make([]*desiredCert, 0, len(spec.Certificates))
+	specCerts := map[string]*desiredCert{}
+	for i := range spec.Certificates {
+		c := &spec.Certificates[i]
+		c.Workspace = strings.TrimSpace(c.Workspace)
+		if !workspaceKnown(c.Workspace) {
+			return nil, fmt.Errorf("证书 %s: 工作区 %s 不存在", c.Domain, c.Workspace)
+		}
+		switch c.Source {
+		case "", "acme", "import":
+		default:
+			return nil, fmt.Errorf("证书 %s: 不支持的来源 %s", c.Domain, c.Source)
+		}
+
+		domain, san, err := NormalizeDomains(c.Domain, c.SAN, DomainOptions{MaxNames: maxNames(c.Workspace)})
+		if err != nil {
+			return nil, fmt.Errorf("certificates[%d] %s: %w", i, c.Domain, err)
+		}
+		d := &desiredCert{
+			spec:    c,
+			key:     certKey(c.Workspace, domain),
+			label:   certLabel(c.Workspace, domain),
+			domain:  domain,
+			san:     san,
+			imports: c.Source == "import",
+		}
+		if specCerts[d.key] != nil {
+			return nil, fmt.Errorf("证书 %s 重复", d.label)
+		}
+		specCerts[d.key] = d
+		desired = append(desired, d)
+	}
+
+	claimed := map[uint]bool{}
+	for _, d := range desired {
+		if list := dbCerts[d.key]; len(list) > 0 {
+			if len(list) > 1 {
+				return nil, fmt.Errorf("证书 %s: 数据库中有 %d 个相同的证书，无法对应", d.label, len(list))
+			}
+			d.match = list[0]
+			claimed[d.match.ID] = true
+		}
+	}
+	for _, d := range desired {
+		if d.match != nil {
+			continue
+		}
+		var candidates []*model.Certificate
+		for i, c := range certs {
+			key := certKey(workspaceNames[derefUint(c.WorkspaceID)], c.Domain)
+			if c.Domain == d.domain && !claimed[c.ID] && specCerts[key] == nil {
+				candidates = append(candidates, &certs[i])
+			}
+		}
+		if len(candidates) == 1 {
+			d.match = candidates[0]
+			claimed[d.match.ID] = true
+		}
+	}
+
+	for _, d := range desired {
+		c := d.spec
+		if d.match != nil {
+			refs.certs[d.key] = d.match.ID
+		}
+
+		if d.imports {
+			if d.match == nil || !d.match.IsImported() {
+				return nil, fmt.Errorf("证书 %s: 导入的证书需先通过管理界面或 API 导入", d.label)
+			}
+			if current := workspaceNames[derefUint(d.match.WorkspaceID)]; current != c.Workspace {
+				id := d.match.ID
+				plan.Changes = append(plan.Changes, ConfigChange{
+					Action: ConfigUpdate,
+					Kind:   "certificate",
+					Name:   d.label,
+					Fields: []string{"workspace"},
+					apply: func(s *ConfigService, _ *ConfigChange) error {
+						return s.certService.SetWorkspace(id, refs.workspaceID(c.Workspace), false)
+					},
+				})
+			}
+			continue
+		}
+		if d.match != nil && d.match.IsImported() {
+			return nil, fmt.Errorf("证书 %s: 为导入的证书，需设置 source: import", d.label)
+		}
+
+		challengeType := c.ChallengeType
+		if challengeType == "" {
+			challengeType = "dns-01"
+		}
+		provider, alias := c.DNSProvider, c.ChallengeAlias
+		var overrides []DomainChallengeSpec
+		if isPrivateCA(c.Workspace) {
+			provider, alias = "", ""
+		} else {
+			providerID := uint(0)
+			if provider != "" {
+				id, ok := validationProviderIDs[provider]
+				if !ok {
+					return nil, fmt.Errorf("证书 %s: DNS 提供商 %s 不存在", d.label, provider)
+				}
+				providerID = id
+			}
+
+			list := make([]model.DomainChallenge, len(c.DomainChallenges))
+			idNames := map[uint]string{}
+			for i, o := range c.DomainChallenges {
+				list[i] = model.DomainChallenge{Domain: o.Domain, ChallengeType: o.ChallengeType, ChallengeAlias: o.ChallengeAlias}
+				if o.DNSProvider != "" {
+					id, ok := validationProviderIDs[o.DNSProvider]
+					if !ok {
+						return nil, fmt.Errorf("证书 %s: DNS 提供商 %s 不存在", d.label, o.DNSProvider)
+					}
+					list[i].DNSProviderID = id
+					idNames[id] = o.DNSProvider
+				}
+			}
+			normalized, err := NormalizeDomainChallenges(list, append([]string{d.domain}, d.san...), challengeType, providerID)
+			if err == nil {
+				err = ValidateChallenge(challengeType, providerID, c.HTTP01Mode, c.HTTP01Webroot, normalized)
+			}
+			if err == nil {
+				alias, err = NormalizeChallengeAlias(challengeType, alias)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("证书 %s: %w", d.label, err)
+			}
+			for _, o := range normalized {
+				overrides = append(overrides, DomainChallengeSpec{
+					Domain:         o.Domain,
+					ChallengeType:  o.ChallengeType,
+					DNSProvider:    idNames[o.DNSProviderID],
+					ChallengeAlias: o.ChallengeAlias,
+				})
+			}
+		}
+		http01Webroot := c.HTTP01Webroot
+		if c.HTTP01Mode != "webroot" {
+			http01Webroot = ""
+		}
+		profile, chain := strings.TrimSpace(c.Profile), strings.TrimSpace(c.PreferredChain)
+
+		// 配置文件不管理自带 CSR，修改时保留原有 CSR
+		config := func() CertConfig {
+			return CertConfig{
+				Domain:           d.domain,
+				SAN:              d.san,
+				ChallengeType:    challengeType,
+				HTTP01Mode:       c.HTTP01Mode,
+				HTTP01Webroot:    http01Webroot,
+				DNSProviderID:    refs.providers[provider],
+				ChallengeAlias:   alias,
+				DomainChallenges: refs.domainChallenges(overrides),
+				WorkspaceID:      refs.workspaceID(c.Workspace),
+				Profile:          profile,
+				PreferredChain:   chain,
+				KeepCSR:          true,
+			}
+		}
+
+		if d.match == nil {
+			plan.Changes = append(plan.Changes, ConfigChange{
+				Action: ConfigCreate,
+				Kind:   "certificate",
+				Name:   d.label,
+				apply: func(s *ConfigService, _ *ConfigChange) error {
+					created, err := s.certService.CreatePending(config())
+					if err != nil {
+						return err
+					}
+					refs.certs[d.key] = created.ID
+					return nil
+				},
+			})
+			continue
+		}
+
+		existing := d.match
+		existingType := existing.ChallengeType
+		if existingType == "" {
+			existingType = "dns-01"
+		}
+		existingOverrides := []DomainChallengeSpec{}
+		for _, o := range existing.GetDomainChallenges() {
+			existingOverrides = append(existingOverrides, DomainChallengeSpec{
+				Domain:         o.Domain,
+				ChallengeType:  o.ChallengeType,
+				DNSProvider:    providerNames[o.DNSProviderID],
+				ChallengeAlias: o.ChallengeAlias,
+			})
+		}
+		if overrides == nil {
+			overrides = []DomainChallengeSpec{}
+		}
+
+		var fields []string
+		fields = diffField(fields, "workspace", workspaceNames[derefUint(existing.WorkspaceID)], c.Workspace)
+		fields = diffField(fields, "san", strings.Join(existing.GetSANList(), ","), strings.Join(d.san, ","))
+		fields = diffField(fields, "challenge_type", existingType, challengeType)
+		fields = diffField(fields, "dns_provider", providerNames[existing.DNSProviderID], provider)
+		fields = diffField(fields, "challenge_alias", existing.ChallengeAlias, alias)
+		if !reflect.DeepEqual(existingOverrides, overrides) {
+			fields = append(fields, "domain_challenges")
+		}
+		fields = diffField(fields, "http01_mode", existing.HTTP01Mode, c.HTTP01Mode)
+		fields = diffField(fields, "http01_webroot", existing.HTTP01Webroot, http01Webroot)
+		fields = diffField(fields, "profile", existing.Profile, profile)
+		fields = diffField(fields, "preferred_chain", existing.PreferredChain, chain)
+		if len(fields) > 0 {
+			id := existing.ID
+			plan.Changes = append(plan.Changes, ConfigChange{
+				Action: ConfigUpdate,
+				Kind:   "certificate",
+				Name:   d.label,
+				Fields: fields,
+				apply: func(s *ConfigService, _ *ConfigChange) error {
+					return s.certService.UpdateConfig(id, config())
+				},
+			})
+		}
+	}
+	if prune {
+		for _, c := range certs {
+			if !claimed[c.ID] {
+				id := c.ID
+				deletes[2] = append(deletes[2], ConfigChange{
+					Action: ConfigDelete,
+					Kind:   "certificate",
+					Name:   certLabel(workspaceNames[derefUint(c.WorkspaceID)], c.Domain),
+					apply:  func(s *ConfigService, _ *ConfigChange) error { return s.certService.Delete(id) },
+				})
+			}
+		}
+	}
+
+	// Agent 及证书绑定
+	specAgents := map[string]bool{}
+	for i := range spec.Agents {
+		a := &spec.Agents[i]
+		a.Name = strings.TrimSpace(a.Name)
+		if a.Name == "" {
+			return nil, fmt.Errorf("agents[%d]: 缺少名称", i)
+		}
+		if specAgents[a.Name] {
+			return nil, fmt.Errorf("Agent %s 重复", a.Name)
+		}
+		specAgents[a.Name] = true
+		if a.PollInterval < 0 {
+			return nil, fmt.Errorf("Agent %s: poll_interval 不能为负数", a.Name)
+		}
+
+		var existing *model.Agent
+		switch list := dbAgents[a.Name]; len(list) {
+		case 0:
+			plan.Changes = append(plan.Changes, ConfigChange{
+				Action: ConfigCreate,
+				Kind:   "agent",
+				Name:   a.Name,
+				apply: func(s *ConfigService, change *ConfigChange) error {
+					created, err := s.agents.Create(a.Name, a.PollInterval)
+					if err != nil {
+						return err
+					}
+					refs.agents[a.Name] = created.ID
+					change.Result = "连接地址: " + s.agents.GetConnectURL(created)
+					return nil
+				},
+			})
+		case 1:
+			existing = list[0]
+			if a.PollInterval > 0 && a.PollInterval != existing.PollInterval {
+				id := existing.ID
+				plan.Changes = append(plan.Changes, ConfigChange{
+					Action: ConfigUpdate,
+					Kind:   "agent",
+					Name:   a.Name,
+					Fields: []string{"poll_interval"},
+					apply: func(s *ConfigService, _ *ConfigChange) error {
+						return s.agents.Update(id, a.Name, a.PollInterval)
+					},
+				})
+			}
+		default:
+			return nil, fmt.Errorf("Agent %s: 数据库中有 %d 个同名 Agent，无法对应", a.Name, len(list))
+		}
+
+		bound := map[uint]bool{}
+		specBindings := map[string]bool{}
+		for j := range a.Certs {
+			b := &a.Certs[j]
+			b.Workspace = strings.TrimSpace(b.Workspace)
+			domain, err := NormalizeDomain(b.Domain)
+			if err != nil {
+				return nil, fmt.Errorf("Agent %s 的 certs[%d]: %w", a.Name, j, err)
+			}
+			key, label := certKey(b.Workspace, domain), certLabel(b.Workspace, domain)
+			name := a.Name + " → " + label
+			if specBindings[key] {
+				return nil, fmt.Errorf("证书绑定 %s 重复", name)
+			}
+			specBindings[key] = true
+
+			// 证书需在配置中列出，未启用 prune 时也可以是数据库中已有的
+			certID := uint(0)
+			if d := specCerts[key]; d != nil {
+				if d.match != nil {
+					certID = d.match.ID
+				}
+			} else if list := dbCerts[key]; !prune && len(list) == 1 {
+				certID = list[0].ID
+			} else {
+				return nil, fmt.Errorf("证书绑定 %s: 证书不存在", name)
+			}
+
+			if err := validateBindingSpec(b); err != nil {
+				return nil, fmt.Errorf("证书绑定 %s: %w", name, err)
+			}
+
+			var binding *model.AgentCert
+			if existing != nil && certID != 0 {
+				for k := range existing.Certs {
+					if existing.Certs[k].CertID == certID {
+						binding = &existing.Certs[k]
+						bound[binding.ID] = true
+						break
+					}
+				}
+			}
+
+			if binding == nil {
+				plan.Changes = append(plan.Changes, ConfigChange{
+					Action: ConfigCreate,
+					Kind:   "binding",
+					Name:   name,
+					apply: func(s *ConfigService, _ *ConfigChange) error {
+						created, err := s.agents.AddCertBinding(refs.agents[a.Name], refs.certs[key], b.DeployPath, *b.FileMapping, b.ReloadCmd, b.AgentKey)
+						if err != nil {
+							return err
+						}
+						if b.ChallengeWebroot != "" || b.ChallengePort != 0 {
+							return s.agents.SetBindingChallenge(created.ID, b.ChallengeWebroot, b.ChallengePort)
+						}
+						return nil
+					},
+				})
+				continue
+			}
+
+			var fields []string
+			fields = diffField(fields, "deploy_path", binding.DeployPath, b.DeployPath)
+			fields = diffField(fields, "file_mapping", binding.GetFileMapping(), *b.FileMapping)
+			fields = diffField(fields, "reload_cmd", binding.ReloadCmd, b.ReloadCmd)
+			fields = diffField(fields, "agent_key", binding.AgentKey, b.AgentKey)
+			fields = diffField(fields, "challenge_webroot", binding.ChallengeWebroot, b.ChallengeWebroot)
+			fields = diffField(fields, "challenge_port", binding.ChallengePort, b.ChallengePort)
+			if len(fields) > 0 {
+				id := binding.ID
+				plan.Changes = append(plan.Changes, ConfigChange{
+					Action: ConfigUpdate,
+					Kind:   "binding",
+					Name:   name,
+					Fields: fields,
+					apply: func(s *ConfigService, _ *ConfigChange) error {
+						if err := s.agents.UpdateCertBinding(id, b.DeployPath, *b.FileMapping, b.ReloadCmd, b.AgentKey); err != nil {
+							return err
+						}
+						return s.agents.SetBindingChallenge(id, b.ChallengeWebroot, b.ChallengePort)
+					},
+				})
+			}
+		}
+
+		if prune && existing != nil {
+			certNames := map[uint]string{}
+			for _, c := range certs {
+				certNames[c.ID] = certLabel(workspaceNames[derefUint(c.WorkspaceID)], c.Domain)
+			}
+			for _, binding := range existing.Certs {
+				if !bound[binding.ID] {
+					id := binding.ID
+					deletes[0] = append(deletes[0], ConfigChange{
+						Action: ConfigDelete,
+						Kind:   "binding",
+						Name:   a.Name + " → " + certNames[binding.CertID],
+						apply:  func(s *ConfigService, _ *ConfigChange) error { return s.agents.DeleteCertBinding(id) },
+					})
+				}
+			}
+		}
+	}
+	if prune {
+		for _, a := range agents {
+			if !specAgents[a.Name] {
+				id := a.ID
+				deletes[1] = append(deletes[1], ConfigChange{
+					Action: ConfigDelete,
+					Kind:   "agent",
+					Name:   a.Name,
+					apply:  func(s *ConfigService, _ *ConfigChange) error { return s.agents.Delete(id) },
+				})
+			}
+		}
+	}
+
+	for _, list := range deletes {
+		plan.Changes = append(plan.Changes, list...)
+	}
+	return plan, nil
+}
+
+// Apply 在同一个数据库事务中按顺序应用计划中的变更；任一变更失败时全部回滚，修正配置后重新执行即可
+func (s *ConfigService) Apply(plan *ConfigPlan) error {
+	return store.GetDB().Transaction(func(tx *gorm.DB) error {
+		txService := s.withTx(tx)
+		for i := range plan.Changes {
+			change := &plan.Changes[i]
+			if err := change.apply(txService, change); err != nil {
+				return fmt.Errorf("%s%s %s 失败: %w", configActions[change.Action], configKinds[change.Kind], change.Name, err)
+			}
+		}
+
+		if len(plan.Changes) > 0 {
+			txService.logger.Info("system", fmt.Sprintf("应用声明式配置: 创建 %d，更新 %d，删除 %d",
+				plan.Count(ConfigCreate), plan.Count(ConfigUpdate), plan.Count(ConfigDelete)), nil)
+		}
+		return nil
+	})
+}
+
+// validateWorkspaceSpec 校验工作区配置并补全默认值
+func validateWorkspaceSpec(w *WorkspaceSpec) error {
+	if w.Type == "" {
+		w.Type = "acme"
+	}
+	if w.KeyType == "" {
+		w.KeyType = "EC256"
+	}
+	if w.MaxNames < 0 || w.CertValidityDays < 0 {
+		return fmt.Errorf("max_names 和 cert_validity_days 不能为负数")
+	}
+
+	switch w.Type {
+	case "acme":
+		if w.CaURL == "" || w.Email == "" {
+			return fmt.Errorf("ca_url 和 email 为必填项")
+		}
+		if w.CertValidityDays != 0 || w.ACMEServer {
+			return fmt.Errorf("cert_validity_days 和 acme_server 仅适用于私有 CA 工作区")
+		}
+	case "private_ca":
+		if w.CaURL != "" || w.Email != "" || w.Profile != "" || w.PreferredChain != "" {
+			return fmt.Errorf("私有 CA 工作区不需要 ca_url、email、profile 和 preferred_chain")
+		}
+	default:
+		return fmt.Errorf("不支持的工作区类型: %s", w.Type)
+	}
+	return nil
+}
+
+// validateBindingSpec 校验证书绑定配置并补全默认的文件映射
+func validateBindingSpec(b *BindingSpec) error {
+	b.DeployPath = strings.TrimSpace(b.DeployPath)
+	if b.DeployPath == "" {
+		return fmt.Errorf("缺少部署路径")
+	}
+	if b.ChallengePort < 0 || b.ChallengePort > 65535 {
+		return fmt.Errorf("无效的验证端口: %d", b.ChallengePort)
+	}
+	if b.ChallengeWebroot != "" && !path.IsAbs(b.ChallengeWebroot) {
+		return fmt.Errorf("challenge_webroot 必须是绝对路径")
+	}
+
+	if b.FileMapping == nil {
+		b.FileMapping = &model.FileMapping{}
+	}
+	if b.FileMapping.Cert == "" {
+		b.FileMapping.Cert = "cert.pem"
+	}
+	if b.FileMapping.Key == "" {
+		b.FileMapping.Key = "key.pem"
+	}
+	if b.FileMapping.Fullchain == "" {
+		b.FileMapping.Fullchain = "fullchain.pem"
+	}
+	return nil
+}
+
+// isSecretField 提供商配置字段是否为密钥
+func isSecretField(t *dnsprovider.Type, key string) bool {
+	for _, f := range t.Fields {
+		if f.Key == key {
+			return f.Secret
+		}
+	}
+	return false
+}
+
+// diffField 值不同时追加字段名
+func diffField[T comparable](fields []string, name string, current, desired T) []string {
+	if current != desired {
+		return append(fields, name)
+	}
+	return fields
+}
+
+// diffConfig 比较提供商配置，返回变化的字段（不输出值，避免泄露密钥）
+func diffConfig(current, desired map[string]interface{}) []string {
+	keys := map[string]bool{}
+	for k := range current {
+		keys[k] = true
+	}
+	for k := range desired {
+		keys[k] = true
+	}
+
+	var fields []string
+	for k := range keys {
+		if dnsprovider.Config(current).String(k) != dnsprovider.Config(desired).String(k) {
+			fields = append(fields, "config."+k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
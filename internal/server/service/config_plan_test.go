@@ -0,0 +1,311 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/BlakeLiAFK/letsync/internal/server/store"
+)
+
+// openTestStore 在临时目录中初始化数据库，测试结束后关闭
+func openTestStore(t *testing.T) {
+	t.Helper()
+
+	if err := store.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if db, err := store.GetDB().DB(); err == nil {
+			db.Close()
+		}
+	})
+	if err := NewSettingsService().InitSecuritySettings(); err != nil {
+		t.Fatalf("初始化安全配置失败: %v", err)
+	}
+}
+
+// loadTestConfig 将配置写入 dir 并读取，file: 引用相对于 dir
+func loadTestConfig(t *testing.T, dir, config string) *ConfigSpec {
+	t.Helper()
+
+	path := filepath.Join(dir, "letsync.yaml")
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("读取配置失败: %v", err)
+	}
+	return spec
+}
+
+func planStrings(plan *ConfigPlan) []string {
+	list := []string{}
+	for _, c := range plan.Changes {
+		list = append(list, c.String())
+	}
+	return list
+}
+
+const fullConfig = `
+workspaces:
+  - name: le
+    ca_url: https://acme-staging-v02.api.letsencrypt.org/directory
+    email: ops@example.com
+    default: true
+  - name: internal
+    type: private_ca
+dns_providers:
+  - name: cf
+    type: cloudflare
+    config:
+      api_token: env:LETSYNC_TEST_CF_TOKEN
+certificates:
+  - domain: "*.example.com"
+    workspace: le
+    dns_provider: cf
+  - domain: app.internal.test
+    workspace: internal
+agents:
+  - name: web1
+    certs:
+      - domain: "*.example.com"
+        workspace: le
+        deploy_path: /etc/ssl/example
+  - name: web2
+`
+
+func TestConfigPlanApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []struct {
+			config string
+			prune  bool
+			want   []string
+		}
+	}{
+		{
+			name: "创建后再次计划为空",
+			steps: []struct {
+				config string
+				prune  bool
+				want   []string
+			}{
+				{config: fullConfig, want: []string{
+					"+ 工作区 le",
+					"+ 工作区 internal",
+					"+ DNS 提供商 cf",
+					"+ 证书 *.example.com (le)",
+					"+ 证书 app.internal.test (internal)",
+					"+ Agent web1",
+					"+ 证书绑定 web1 → *.example.com (le)",
+					"+ Agent web2",
+				}},
+			},
+		},
+		{
+			name: "证书移到其他工作区",
+			steps: []struct {
+				config string
+				prune  bool
+				want   []string
+			}{
+				{config: `
+workspaces:
+  - name: ca1
+    type: private_ca
+  - name: ca2
+    type: private_ca
+certificates:
+  - domain: app.internal.test
+    workspace: ca1
+`, want: []string{"+ 工作区 ca1", "+ 工作区 ca2", "+ 证书 app.internal.test (ca1)"}},
+				{config: `
+workspaces:
+  - name: ca1
+    type: private_ca
+  - name: ca2
+    type: private_ca
+certificates:
+  - domain: app.internal.test
+    workspace: ca2
+`, want: []string{"~ 证书 app.internal.test (ca2): workspace"}},
+			},
+		},
+		{
+			name: "prune 按引用顺序删除",
+			steps: []struct {
+				config string
+				prune  bool
+				want   []string
+			}{
+				{config: fullConfig, want: []string{
+					"+ 工作区 le",
+					"+ 工作区 internal",
+					"+ DNS 提供商 cf",
+					"+ 证书 *.example.com (le)",
+					"+ 证书 app.internal.test (internal)",
+					"+ Agent web1",
+					"+ 证书绑定 web1 → *.example.com (le)",
+					"+ Agent web2",
+				}},
+				// web1 保留但解除绑定，web2 删除（删除 Agent 时一并删除其绑定）
+				{config: "agents:\n  - name: web1\n", prune: true, want: []string{
+					"- 证书绑定 web1 → *.example.com (le)",
+					"- Agent web2",
+					"- 证书 *.example.com (le)",
+					"- 证书 app.internal.test (internal)",
+					"- DNS 提供商 cf",
+					"- 工作区 le",
+					"- 工作区 internal",
+				}},
+			},
+		},
+	}
+
+	t.Setenv("LETSYNC_TEST_CF_TOKEN", "token-from-env")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestStore(t)
+			dir := t.TempDir()
+			s := NewConfigService()
+
+			for i, step := range tt.steps {
+				plan, err := s.Plan(loadTestConfig(t, dir, step.config), step.prune)
+				if err != nil {
+					t.Fatalf("第 %d 步计划失败: %v", i+1, err)
+				}
+				if got := planStrings(plan); !reflect.DeepEqual(got, step.want) {
+					t.Fatalf("第 %d 步计划为 %q，期望 %q", i+1, got, step.want)
+				}
+				if err := s.Apply(plan); err != nil {
+					t.Fatalf("第 %d 步应用失败: %v", i+1, err)
+				}
+
+				// 应用后重新计划应没有变更
+				plan, err = s.Plan(loadTestConfig(t, dir, step.config), step.prune)
+				if err != nil {
+					t.Fatalf("第 %d 步重新计划失败: %v", i+1, err)
+				}
+				if got := planStrings(plan); len(got) > 0 {
+					t.Fatalf("第 %d 步应用后重新计划仍有变更: %q", i+1, got)
+				}
+			}
+		})
+	}
+}
+
+// TestConfigSecretRefs env: 和 file: 引用在计划时解析，值变化时更新对应字段
+func TestConfigSecretRefs(t *testing.T) {
+	openTestStore(t)
+	dir := t.TempDir()
+	s := NewConfigService()
+
+	config := `
+dns_providers:
+  - name: cf
+    type: cloudflare
+    config:
+      api_token: env:LETSYNC_TEST_CF_TOKEN
+  - name: cf-file
+    type: cloudflare
+    config:
+      api_token: file:secrets/cf_token
+`
+	if err := os.Mkdir(filepath.Join(dir, "secrets"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	tokenFile := filepath.Join(dir, "secrets", "cf_token")
+	if err := os.WriteFile(tokenFile, []byte("token-from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Unsetenv("LETSYNC_TEST_CF_TOKEN")
+	if _, err := s.Plan(loadTestConfig(t, dir, config), false); err == nil {
+		t.Fatal("环境变量未设置时应返回错误")
+	}
+
+	t.Setenv("LETSYNC_TEST_CF_TOKEN", "token-from-env")
+	plan, err := s.Plan(loadTestConfig(t, dir, config), false)
+	if err != nil {
+		t.Fatalf("计划失败: %v", err)
+	}
+	if len(plan.Warnings) > 0 {
+		t.Errorf("引用的密钥不应有明文警告: %q", plan.Warnings)
+	}
+	if err := s.Apply(plan); err != nil {
+		t.Fatalf("应用失败: %v", err)
+	}
+
+	for name, want := range map[string]string{"cf": "token-from-env", "cf-file": "token-from-file"} {
+		var provider model.DNSProvider
+		if err := store.GetDB().Where("name = ?", name).First(&provider).Error; err != nil {
+			t.Fatalf("DNS 提供商 %s 未创建: %v", name, err)
+		}
+		config, err := s.dnsProvider.GetDecryptedConfig(provider.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := config["api_token"]; got != want {
+			t.Errorf("DNS 提供商 %s 的 api_token 为 %v，期望 %s", name, got, want)
+		}
+	}
+
+	// 文件内容变化时只更新对应的字段
+	if err := os.WriteFile(tokenFile, []byte("rotated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	plan, err = s.Plan(loadTestConfig(t, dir, config), false)
+	if err != nil {
+		t.Fatalf("计划失败: %v", err)
+	}
+	if got, want := planStrings(plan), []string{"~ DNS 提供商 cf-file: config.api_token"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("计划为 %q，期望 %q", got, want)
+	}
+}
+
+// TestConfigApplyRollback 任一变更失败时整个计划回滚，数据库保持应用前的状态
+func TestConfigApplyRollback(t *testing.T) {
+	openTestStore(t)
+	t.Setenv("LETSYNC_TEST_CF_TOKEN", "token-from-env")
+	dir := t.TempDir()
+	s := NewConfigService()
+
+	plan, err := s.Plan(loadTestConfig(t, dir, fullConfig), false)
+	if err != nil {
+		t.Fatalf("计划失败: %v", err)
+	}
+	want := planStrings(plan)
+
+	boom := errors.New("boom")
+	plan.Changes = append(plan.Changes, ConfigChange{
+		Action: ConfigCreate,
+		Kind:   "agent",
+		Name:   "broken",
+		apply:  func(*ConfigService, *ConfigChange) error { return boom },
+	})
+	if err := s.Apply(plan); !errors.Is(err, boom) {
+		t.Fatalf("应用返回 %v，期望包含 %v", err, boom)
+	}
+
+	for _, m := range []interface{}{&model.Workspace{}, &model.DNSProvider{}, &model.Certificate{}, &model.Agent{}, &model.AgentCert{}, &model.Log{}} {
+		var count int64
+		store.GetDB().Model(m).Count(&count)
+		if count > 0 {
+			t.Errorf("回滚后 %T 仍有 %d 条记录", m, count)
+		}
+	}
+
+	// 回滚后重新计划与第一次相同
+	plan, err = s.Plan(loadTestConfig(t, dir, fullConfig), false)
+	if err != nil {
+		t.Fatalf("重新计划失败: %v", err)
+	}
+	if got := planStrings(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("回滚后计划为 %q，期望 %q", got, want)
+	}
+}
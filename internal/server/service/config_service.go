@@ -0,0 +1,322 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/dnsprovider"
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/BlakeLiAFK/letsync/internal/server/store"
+	"github.com/goccy/go-yaml"
+	"gorm.io/gorm"
+)
+
+// ConfigSpec 声明式配置，通过 letsyncd apply 应用到数据库，letsyncd export 从数据库导出
+// 工作区、DNS 提供商和 Agent 按名称对应，证书按工作区和主域名对应
+type ConfigSpec struct {
+	Workspaces   []WorkspaceSpec   `yaml:"workspaces,omitempty"`
+	DNSProviders []DNSProviderSpec `yaml:"dns_providers,omitempty"`
+	Certificates []CertificateSpec `yaml:"certificates,omitempty"`
+	Agents       []AgentSpec       `yaml:"agents,omitempty"`
+
+	dir string // 配置文件所在目录，file: 引用的相对路径以此为准
+}
+
+// WorkspaceSpec 工作区
+type WorkspaceSpec struct {
+	Name             string `yaml:"name"`
+	Type             string `yaml:"type,omitempty"` // acme（默认）, private_ca
+	Description      string `yaml:"description,omitempty"`
+	CaURL            string `yaml:"ca_url,omitempty"`
+	Email            string `yaml:"email,omitempty"`
+	KeyType          string `yaml:"key_type,omitempty"`
+	Profile          string `yaml:"profile,omitempty"`
+	PreferredChain   string `yaml:"preferred_chain,omitempty"`
+	MaxNames         int    `yaml:"max_names,omitempty"`
+	CertValidityDays int    `yaml:"cert_validity_days,omitempty"` // 私有 CA
+	ACMEServer       bool   `yaml:"acme_server,omitempty"`        // 私有 CA
+	Default          bool   `yaml:"default,omitempty"`
+}
+
+// DNSProviderSpec DNS 提供商，配置值可写为 env:变量名 或 file:路径 引用密钥
+type DNSProviderSpec struct {
+	Name   string                 `yaml:"name"`
+	Type   string                 `yaml:"type"`
+	Config map[string]interface{} `yaml:"config,omitempty"`
+}
+
+// CertificateSpec 证书配置，新建的证书为 pending 状态，需另行申请
+type CertificateSpec struct {
+	Domain           string                `yaml:"domain"`
+	SAN              []string              `yaml:"san,omitempty"`
+	Workspace        string                `yaml:"workspace,omitempty"` // 为空则使用全局配置
+	Source           string                `yaml:"source,omitempty"`    // import 表示外部导入的证书，只引用不修改
+	ChallengeType    string                `yaml:"challenge_type,omitempty"`
+	DNSProvider      string                `yaml:"dns_provider,omitempty"`
+	ChallengeAlias   string                `yaml:"challenge_alias,omitempty"`
+	DomainChallenges []DomainChallengeSpec `yaml:"domain_challenges,omitempty"`
+	HTTP01Mode       string                `yaml:"http01_mode,omitempty"`
+	HTTP01Webroot    string                `yaml:"http01_webroot,omitempty"`
+	Profile          string                `yaml:"profile,omitempty"`
+	PreferredChain   string                `yaml:"preferred_chain,omitempty"`
+}
+
+// DomainChallengeSpec 按域名覆盖的验证配置
+type DomainChallengeSpec struct {
+	Domain         string `yaml:"domain"`
+	ChallengeType  string `yaml:"challenge_type,omitempty"`
+	DNSProvider    string `yaml:"dns_provider,omitempty"`
+	ChallengeAlias string `yaml:"challenge_alias,omitempty"`
+}
+
+// AgentSpec Agent 及其证书绑定
+type AgentSpec struct {
+	Name         string        `yaml:"name"`
+	PollInterval int           `yaml:"poll_interval,omitempty"`
+	Certs        []BindingSpec `yaml:"certs,omitempty"`
+}
+
+// BindingSpec Agent 证书绑定，证书按工作区和主域名引用
+type BindingSpec struct {
+	Domain           string             `yaml:"domain"`
+	Workspace        string             `yaml:"workspace,omitempty"`
+	DeployPath       string             `yaml:"deploy_path"`
+	FileMapping      *model.FileMapping `yaml:"file_mapping,omitempty"`
+	ReloadCmd        string             `yaml:"reload_cmd,omitempty"`
+	AgentKey         bool               `yaml:"agent_key,omitempty"`
+	ChallengeWebroot string             `yaml:"challenge_webroot,omitempty"`
+	ChallengePort    int                `yaml:"challenge_port,omitempty"`
+}
+
+// ConfigService 声明式配置的导出、差异计算和应用
+type ConfigService struct {
+	workspaces  *WorkspaceService
+	dnsProvider *DNSProviderService
+	certService *CertService
+	agents      *AgentService
+	logger      *LogService
+}
+
+func NewConfigService() *ConfigService {
+	return &ConfigService{
+		workspaces:  NewWorkspaceService(),
+		dnsProvider: NewDNSProviderService(),
+		certService: NewCertService(),
+		agents:      NewAgentService(),
+		logger:      NewLogService(),
+	}
+}
+
+// withTx 返回所有读写都在事务 tx 中进行的副本
+func (s *ConfigService) withTx(tx *gorm.DB) *ConfigService {
+	return &ConfigService{
+		workspaces:  s.workspaces.WithTx(tx),
+		dnsProvider: s.dnsProvider.WithTx(tx),
+		certService: s.certService.WithTx(tx),
+		agents:      s.agents.WithTx(tx),
+		logger:      s.logger.WithTx(tx),
+	}
+}
+
+// LoadConfigFile 读取 YAML 配置文件，path 为 - 时从标准输入读取
+func LoadConfigFile(path string) (*ConfigSpec, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	spec, err := ParseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if path != "-" {
+		spec.dir = filepath.Dir(path)
+	}
+	return spec, nil
+}
+
+// ParseConfig 解析 YAML 配置，未知字段视为错误以免拼写错误被忽略
+func ParseConfig(data []byte) (*ConfigSpec, error) {
+	var spec ConfigSpec
+	if err := yaml.UnmarshalWithOptions(data, &spec, yaml.DisallowUnknownField()); err != nil {
+		return nil, fmt.Errorf("解析配置失败: %s", yaml.FormatError(err, false, true))
+	}
+	return &spec, nil
+}
+
+// Marshal 输出 YAML
+func (spec *ConfigSpec) Marshal() ([]byte, error) {
+	return yaml.MarshalWithOptions(spec, yaml.IndentSequence(true))
+}
+
+// resolveSecret 解析配置值中的密钥引用：env:NAME 读取环境变量，file:PATH 读取文件内容（去掉末尾换行）
+func (spec *ConfigSpec) resolveSecret(value interface{}) (interface{}, bool, error) {
+	s, ok := value.(string)
+	if !ok {
+		return value, false, nil
+	}
+	switch {
+	case strings.HasPrefix(s, "env:"):
+		name := strings.TrimPrefix(s, "env:")
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, true, fmt.Errorf("环境变量 %s 未设置", name)
+		}
+		return v, true, nil
+	case strings.HasPrefix(s, "file:"):
+		path := strings.TrimPrefix(s, "file:")
+		if !filepath.IsAbs(path) && spec.dir != "" {
+			path = filepath.Join(spec.dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, true, fmt.Errorf("读取密钥文件失败: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+	return value, false, nil
+}
+
+var envNameReplacer = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// secretEnvName 导出时密钥字段使用的环境变量名，如 LETSYNC_CLOUDFLARE_API_TOKEN
+func secretEnvName(provider, key string) string {
+	name := envNameReplacer.ReplaceAllString(strings.ToUpper(provider+"_"+key), "_")
+	return "LETSYNC_" + strings.Trim(name, "_")
+}
+
+// Export 导出当前配置；includeSecrets 为 false 时密钥字段导出为 env: 引用
+func (s *ConfigService) Export(includeSecrets bool) (*ConfigSpec, error) {
+	db := store.GetDB()
+	spec := &ConfigSpec{}
+
+	var workspaces []model.Workspace
+	if err := db.Order("id").Find(&workspaces).Error; err != nil {
+		return nil, err
+	}
+	workspaceNames := make(map[uint]string, len(workspaces))
+	for _, w := range workspaces {
+		workspaceNames[w.ID] = w.Name
+		ws := WorkspaceSpec{
+			Name:        w.Name,
+			Description: w.Description,
+			KeyType:     w.KeyType,
+			MaxNames:    w.MaxNames,
+			Default:     w.IsDefault,
+		}
+		if w.IsPrivateCA() {
+			ws.Type = "private_ca"
+			ws.CertValidityDays = w.CertValidityDays
+			ws.ACMEServer = w.ACMEServer
+		} else {
+			ws.CaURL = w.CaURL
+			ws.Email = w.Email
+			ws.Profile = w.Profile
+			ws.PreferredChain = w.PreferredChain
+		}
+		spec.Workspaces = append(spec.Workspaces, ws)
+	}
+
+	var providers []model.DNSProvider
+	if err := db.Order("id").Find(&providers).Error; err != nil {
+		return nil, err
+	}
+	providerNames := make(map[uint]string, len(providers))
+	for _, p := range providers {
+		providerNames[p.ID] = p.Name
+		config, err := s.dnsProvider.GetDecryptedConfig(p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("DNS 提供商 %s: %w", p.Name, err)
+		}
+		if !includeSecrets {
+			if t, ok := dnsprovider.Get(p.Type); ok {
+				for _, f := range t.Fields {
+					if f.Secret && dnsprovider.Config(config).String(f.Key) != "" {
+						config[f.Key] = "env:" + secretEnvName(p.Name, f.Key)
+					}
+				}
+			}
+		}
+		spec.DNSProviders = append(spec.DNSProviders, DNSProviderSpec{Name: p.Name, Type: p.Type, Config: config})
+	}
+
+	var certs []model.Certificate
+	if err := db.Order("id").Find(&certs).Error; err != nil {
+		return nil, err
+	}
+	certKeys := make(map[uint]CertificateSpec, len(certs))
+	for _, c := range certs {
+		cs := CertificateSpec{
+			Domain:    c.Domain,
+			SAN:       c.GetSANList(),
+			Workspace: workspaceNames[derefUint(c.WorkspaceID)],
+		}
+		certKeys[c.ID] = cs
+		if c.IsImported() {
+			cs.Source = "import"
+		} else {
+			cs.ChallengeType = c.ChallengeType
+			cs.DNSProvider = providerNames[c.DNSProviderID]
+			cs.ChallengeAlias = c.ChallengeAlias
+			cs.HTTP01Mode = c.HTTP01Mode
+			cs.HTTP01Webroot = c.HTTP01Webroot
+			cs.Profile = c.Profile
+			cs.PreferredChain = c.PreferredChain
+			for _, o := range c.GetDomainChallenges() {
+				cs.DomainChallenges = append(cs.DomainChallenges, DomainChallengeSpec{
+					Domain:         o.Domain,
+					ChallengeType:  o.ChallengeType,
+					DNSProvider:    providerNames[o.DNSProviderID],
+					ChallengeAlias: o.ChallengeAlias,
+				})
+			}
+		}
+		spec.Certificates = append(spec.Certificates, cs)
+	}
+
+	var agents []model.Agent
+	if err := db.Preload("Certs").Order("id").Find(&agents).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range agents {
+		as := AgentSpec{Name: a.Name, PollInterval: a.PollInterval}
+		for _, b := range a.Certs {
+			cert, ok := certKeys[b.CertID]
+			if !ok {
+				continue
+			}
+			fm := b.GetFileMapping()
+			as.Certs = append(as.Certs, BindingSpec{
+				Domain:           cert.Domain,
+				Workspace:        cert.Workspace,
+				DeployPath:       b.DeployPath,
+				FileMapping:      &fm,
+				ReloadCmd:        b.ReloadCmd,
+				AgentKey:         b.AgentKey,
+				ChallengeWebroot: b.ChallengeWebroot,
+				ChallengePort:    b.ChallengePort,
+			})
+		}
+		spec.Agents = append(spec.Agents, as)
+	}
+
+	return spec, nil
+}
+
+// derefUint 返回指针指向的值，nil 为 0
+func derefUint(p *uint) uint {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/dnsprovider"
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/BlakeLiAFK/letsync/internal/server/store"
+	"github.com/go-acme/lego/v4/challenge"
+)
+
+// challengeRegistry 进行中的 DNS-01 验证，按记录名登记已写入但尚未清理的 challenge token
+// 并发的订单（续期与手动签发、通配符与主域名）可能共用同一记录名，清理时需跳过仍在使用的记录
+type challengeRegistry struct {
+	mutex  sync.Mutex
+	active map[string]map[string]bool // FQDN -> token
+}
+
+// 全局登记表，所有 DNSProviderService 实例共享
+var activeChallenges = &challengeRegistry{active: make(map[string]map[string]bool)}
+
+// add 登记写入的记录；清理记录名时持有锁，写入会等待清理完成
+func (r *challengeRegistry) add(fqdn, token string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.active[fqdn] == nil {
+		r.active[fqdn] = make(map[string]bool)
+	}
+	r.active[fqdn][token] = true
+}
+
+// remove 验证结束后取消登记，无论 CleanUp 是否成功
+func (r *challengeRegistry) remove(fqdn, token string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.active[fqdn], token)
+	if len(r.active[fqdn]) == 0 {
+		delete(r.active, fqdn)
+	}
+}
+
+// isActive 记录是否属于进行中的验证
+func (r *challengeRegistry) isActive(fqdn, token string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.active[fqdn][token]
+}
+
+// withIdle 记录名下没有进行中的验证时持有锁执行 fn，期间不会有新的记录写入该记录名
+func (r *challengeRegistry) withIdle(fqdn string, fn func()) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.active[fqdn]) > 0 {
+		return false
+	}
+	fn()
+	return true
+}
+
+// Track 包装 DNS Provider，持久化写入的 challenge 记录，CleanUp 成功后删除
+// 进程重启或验证中断后，残留记录仍可根据保存的 token/keyAuth 调用提供商的 CleanUp 删除
+func (s *DNSProviderService) Track(providerID uint, p challenge.Provider) challenge.Provider {
+	present := func(domain, token, keyAuth string) error {
+		record := &model.DNSChallengeRecord{
+			DNSProviderID: providerID,
+			Domain:        domain,
+			Token:         token,
+			KeyAuth:       keyAuth,
+		}
+		if err := store.GetDB().Create(record).Error; err != nil {
+			return err
+		}
+		activeChallenges.add(dnsprovider.ChallengeFQDN(domain), token)
+		return p.Present(domain, token, keyAuth)
+	}
+
+	cleanup := func(domain, token, keyAuth string) error {
+		defer activeChallenges.remove(dnsprovider.ChallengeFQDN(domain), token)
+		if err := p.CleanUp(domain, token, keyAuth); err != nil {
+			return err
+		}
+		return store.GetDB().
+			Where("dns_provider_id = ? AND domain = ? AND token = ?", providerID, domain, token).
+			Delete(&model.DNSChallengeRecord{}).Error
+	}
+
+	return dnsprovider.Wrap(p, present, cleanup)
+}
@@ -1,17 +1,26 @@
 package service
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/BlakeLiAFK/letsync/internal/pkg/crypto"
+	"github.com/BlakeLiAFK/letsync/internal/server/dnsprovider"
 	"github.com/BlakeLiAFK/letsync/internal/server/model"
 	"github.com/BlakeLiAFK/letsync/internal/server/store"
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"gorm.io/gorm"
 )
 
 // DNSProviderService DNS 提供商服务
 type DNSProviderService struct {
 	settings *SettingsService
+	tx       *gorm.DB // 非空时所有读写在该事务中进行
 }
 
 func NewDNSProviderService() *DNSProviderService {
@@ -20,8 +29,23 @@ func NewDNSProviderService() *DNSProviderService {
 	}
 }
 
+// WithTx 返回在事务 tx 中读写的副本
+func (s *DNSProviderService) WithTx(tx *gorm.DB) *DNSProviderService {
+	c := *s
+	c.tx = tx
+	return &c
+}
+
+func (s *DNSProviderService) db() *gorm.DB {
+	return store.GetDBOr(s.tx)
+}
+
 // Create 创建 DNS 提供商
 func (s *DNSProviderService) Create(name, providerType string, config map[string]interface{}) (*model.DNSProvider, error) {
+	if err := dnsprovider.Validate(providerType, config, false); err != nil {
+		return nil, err
+	}
+
 	// 加密配置
 	configJSON, err := json.Marshal(config)
 	if err != nil {
@@ -40,7 +64,7 @@ func (s *DNSProviderService) Create(name, providerType string, config map[string
 		Config: encryptedConfig,
 	}
 
-	if err := store.GetDB().Create(provider).Error; err != nil {
+	if err := s.db().Create(provider).Error; err != nil {
 		return nil, err
 	}
 
@@ -50,7 +74,7 @@ func (s *DNSProviderService) Create(name, providerType string, config map[string
 // Get 获取单个提供商
 func (s *DNSProviderService) Get(id uint) (*model.DNSProvider, error) {
 	var provider model.DNSProvider
-	if err := store.GetDB().First(&provider, id).Error; err != nil {
+	if err := s.db().First(&provider, id).Error; err != nil {
 		return nil, err
 	}
 	return &provider, nil
@@ -59,7 +83,7 @@ func (s *DNSProviderService) Get(id uint) (*model.DNSProvider, error) {
 // List 获取所有提供商
 func (s *DNSProviderService) List() ([]model.DNSProvider, error) {
 	var providers []model.DNSProvider
-	if err := store.GetDB().Find(&providers).Error; err != nil {
+	if err := s.db().Find(&providers).Error; err != nil {
 		return nil, err
 	}
 	return providers, nil
@@ -67,6 +91,20 @@ func (s *DNSProviderService) List() ([]model.DNSProvider, error) {
 
 // Update 更新提供商
 func (s *DNSProviderService) Update(id uint, name, providerType string, config map[string]interface{}) error {
+	current, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+
+	// 修改类型时必须重新填写完整配置
+	if config == nil {
+		if providerType != current.Type {
+			return fmt.Errorf("修改提供商类型时需要重新填写配置")
+		}
+	} else if err := dnsprovider.Validate(providerType, config, false); err != nil {
+		return err
+	}
+
 	updates := map[string]interface{}{
 		"name": name,
 		"type": providerType,
@@ -87,19 +125,345 @@ func (s *DNSProviderService) Update(id uint, name, providerType string, config m
 		updates["config"] = encryptedConfig
 	}
 
-	return store.GetDB().Model(&model.DNSProvider{}).Where("id = ?", id).Updates(updates).Error
+	return s.db().Model(&model.DNSProvider{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// Types 获取支持的提供商类型及配置字段
+func (s *DNSProviderService) Types() []*dnsprovider.Type {
+	return dnsprovider.List()
 }
 
 // Delete 删除提供商
 func (s *DNSProviderService) Delete(id uint) error {
-	// 检查是否有证书在使用
-	var count int64
-	store.GetDB().Model(&model.Certificate{}).Where("dns_provider_id = ?", id).Count(&count)
-	if count > 0 {
-		return fmt.Errorf("该提供商有 %d 个证书正在使用，无法删除", count)
+	// 检查是否有证书在使用，包括只在按域名覆盖中引用该提供商的证书
+	certs, err := providerCertificates(s.db(), id)
+	if err != nil {
+		return err
 	}
+	if len(certs) > 0 {
+		return fmt.Errorf("该提供商有 %d 个证书正在使用，无法删除", len(certs))
+	}
+
+	s.db().Where("dns_provider_id = ?", id).Delete(&model.DNSChallengeRecord{})
+	return s.db().Delete(&model.DNSProvider{}, id).Error
+}
+
+// providerCertificates 获取使用该提供商的证书：证书级配置或任一按域名覆盖引用该提供商
+func providerCertificates(db *gorm.DB, id uint) ([]model.Certificate, error) {
+	var candidates []model.Certificate
+	if err := db.
+		Where("dns_provider_id = ? OR COALESCE(domain_challenges, '') <> ''", id).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	var certs []model.Certificate
+	for _, cert := range candidates {
+		if cert.DNSProviderID == id {
+			certs = append(certs, cert)
+			continue
+		}
+		for _, o := range cert.GetDomainChallenges() {
+			if o.DNSProviderID == id {
+				certs = append(certs, cert)
+				break
+			}
+		}
+	}
+	return certs, nil
+}
+
+// certChallengeDomains 获取证书中由该提供商写入 challenge 记录的域名，设置了验证别名时为别名
+func certChallengeDomains(certs []model.Certificate, id uint) []string {
+	var domains []string
+	for _, cert := range certs {
+		names := append([]string{cert.Domain}, cert.GetSANList()...)
+		plan, _, err := challengePlan(CertRequest{
+			ChallengeType:    cert.ChallengeType,
+			DNSProviderID:    cert.DNSProviderID,
+			ChallengeAlias:   cert.ChallengeAlias,
+			DomainChallenges: cert.GetDomainChallenges(),
+		}, names)
+		if err != nil {
+			continue // 配置无效的证书无法签发，不会写入记录
+		}
+		for _, route := range dnsRoutes(plan, names) {
+			if route.DNSProviderID != id {
+				continue
+			}
+			if route.ChallengeAlias != "" {
+				domains = append(domains, route.ChallengeAlias)
+				continue
+			}
+			domains = append(domains, route.Domains...)
+		}
+	}
+	return domains
+}
+
+// DNSCleanupResult 清理 challenge 记录的结果
+type DNSCleanupResult struct {
+	Removed int      `json:"removed"`
+	Skipped int      `json:"skipped"` // 仍在验证中或写入不足验证超时时间而保留的记录（或记录名）数
+	Errors  []string `json:"errors"`
+}
+
+// Cleanup 清理残留的 _acme-challenge TXT 记录
+// 只清理写入时间超过验证超时且不属于进行中验证的记录，并发订单共用同一记录名时不会删除对方的记录：
+// 支持原生清理的提供商在记录名下没有进行中或未超时的记录时，删除该记录名下的全部 TXT 记录；
+// 其他提供商通过保存的 token/keyAuth 调用 CleanUp 删除本服务写入的记录。
+// domains 为空时清理使用该提供商的所有证书域名及已记录的域名
+func (s *DNSProviderService) Cleanup(id uint, domains []string) (*DNSCleanupResult, error) {
+	provider, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.GetDecryptedConfig(id)
+	if err != nil {
+		return nil, err
+	}
+
+	db := s.db()
+	var records []model.DNSChallengeRecord
+	if err := db.Where("dns_provider_id = ?", id).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	if len(domains) == 0 {
+		certs, err := providerCertificates(s.db(), id)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, certChallengeDomains(certs, id)...)
+		for _, record := range records {
+			domains = append(domains, record.Domain)
+		}
+	}
+
+	// 通配符与主域名共用同一记录名，按记录名去重
+	var fqdns []string
+	targets := make(map[string]bool)
+	for _, domain := range domains {
+		domain = strings.TrimSpace(domain)
+		if domain == "" {
+			continue
+		}
+		fqdn := dnsprovider.ChallengeFQDN(domain)
+		if !targets[fqdn] {
+			targets[fqdn] = true
+			fqdns = append(fqdns, fqdn)
+		}
+	}
+
+	// 写入时间未超过验证超时的记录可能属于其他进程中的订单，一律保留
+	staleBefore := time.Now().Add(-s.challengeTimeout(provider.Type, config))
+	stale := func(record model.DNSChallengeRecord) bool {
+		return record.CreatedAt.Before(staleBefore) &&
+			!activeChallenges.isActive(dnsprovider.ChallengeFQDN(record.Domain), record.Token)
+	}
+
+	result := &DNSCleanupResult{Errors: []string{}}
+
+	if cleaner := dnsprovider.NewCleaner(provider.Type, config); cleaner != nil {
+		// 其他提供商也可能写入同一记录名，检查全部提供商的记录
+		var all []model.DNSChallengeRecord
+		if err := db.Find(&all).Error; err != nil {
+			return nil, err
+		}
+		busy := make(map[string]bool)
+		for _, record := range all {
+			if !stale(record) {
+				busy[dnsprovider.ChallengeFQDN(record.Domain)] = true
+			}
+		}
 
-	return store.GetDB().Delete(&model.DNSProvider{}, id).Error
+		for _, fqdn := range fqdns {
+			if busy[fqdn] {
+				result.Skipped++
+				continue
+			}
+			var n int
+			var err error
+			if !activeChallenges.withIdle(fqdn, func() { n, err = cleaner.CleanupTXT(fqdn) }) {
+				result.Skipped++
+				continue
+			}
+			result.Removed += n
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", fqdn, err))
+				continue
+			}
+			for _, record := range records {
+				if dnsprovider.ChallengeFQDN(record.Domain) == fqdn {
+					db.Delete(&record)
+				}
+			}
+		}
+		return result, nil
+	}
+
+	var pending []model.DNSChallengeRecord
+	for _, record := range records {
+		if !targets[dnsprovider.ChallengeFQDN(record.Domain)] {
+			continue
+		}
+		if !stale(record) {
+			result.Skipped++
+			continue
+		}
+		pending = append(pending, record)
+	}
+	if len(pending) == 0 {
+		return result, nil
+	}
+
+	p, err := dnsprovider.New(provider.Type, config, dnsprovider.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("创建 DNS Provider 失败: %w", err)
+	}
+	for _, record := range pending {
+		if err := p.CleanUp(record.Domain, record.Token, record.KeyAuth); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", dnsprovider.ChallengeFQDN(record.Domain), err))
+			continue
+		}
+		db.Delete(&record)
+		result.Removed++
+	}
+
+	return result, nil
+}
+
+// challengeTimeout 验证记录的最长使用时间：系统验证超时和提供商传播超时中较长者
+func (s *DNSProviderService) challengeTimeout(providerType string, config map[string]interface{}) time.Duration {
+	timeout := time.Duration(s.settings.GetInt("acme.challenge_timeout")) * time.Second
+	if timeout <= 0 {
+		timeout = 300 * time.Second
+	}
+	if t := dnsprovider.PropagationSettings(providerType, config).Timeout; t > timeout {
+		timeout = t
+	}
+	return timeout
+}
+
+// DNSTestDomain 单个域名的测试结果
+type DNSTestDomain struct {
+	Domain     string `json:"domain"`
+	Zone       string `json:"zone,omitempty"`
+	Manageable bool   `json:"manageable"`
+	Error      string `json:"error,omitempty"`
+}
+
+// DNSTestResult 凭据测试结果
+type DNSTestResult struct {
+	Success bool            `json:"success"`
+	Error   string          `json:"error,omitempty"`
+	Zones   []string        `json:"zones"` // 提供商不支持列出区域时为 null
+	Domains []DNSTestDomain `json:"domains"`
+}
+
+// Test 测试提供商凭据
+// 支持列出区域的提供商先调用 API 验证认证并返回可管理的区域；
+// writeTest 为 true 时对每个域名写入并删除一条测试 TXT 记录。
+// domains 为空时测试使用该提供商的所有证书域名
+func (s *DNSProviderService) Test(id uint, domains []string, writeTest bool) (*DNSTestResult, error) {
+	provider, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.GetDecryptedConfig(id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DNSTestResult{Domains: []DNSTestDomain{}}
+
+	p, err := dnsprovider.New(provider.Type, config, dnsprovider.Options{})
+	if err != nil {
+		result.Error = fmt.Sprintf("创建 DNS Provider 失败: %v", err)
+		return result, nil
+	}
+
+	if lister := dnsprovider.NewZoneLister(provider.Type, config); lister != nil {
+		zones, err := lister.ListZones()
+		if err != nil {
+			result.Error = fmt.Sprintf("认证失败: %v", err)
+			return result, nil
+		}
+		result.Zones = zones
+		if result.Zones == nil {
+			result.Zones = []string{}
+		}
+	}
+
+	if len(domains) == 0 {
+		certs, err := providerCertificates(s.db(), id)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, certChallengeDomains(certs, id)...)
+	}
+
+	zones := make(map[string]bool, len(result.Zones))
+	for _, zone := range result.Zones {
+		zones[strings.ToLower(dns01.UnFqdn(zone))] = true
+	}
+	nameservers := dnsprovider.Nameservers(provider.Type, config)
+	tracked := s.Track(id, p)
+
+	result.Success = true
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		// 通配符与主域名使用同一条记录
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "*."))
+		if domain == "" || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+
+		item := DNSTestDomain{Domain: domain}
+		zone, zoneErr := dns01.FindZoneByFqdnCustom(dns01.ToFqdn(domain), nameservers)
+		if zoneErr == nil {
+			item.Zone = dns01.UnFqdn(zone)
+		}
+
+		// 写入测试以提供商实际结果为准，不依赖区域查询
+		switch {
+		case writeTest:
+			item.Manageable, item.Error = testWrite(tracked, domain)
+		case zoneErr != nil:
+			item.Error = fmt.Sprintf("查找 DNS 区域失败: %v", zoneErr)
+		case result.Zones != nil:
+			item.Manageable = zones[strings.ToLower(item.Zone)]
+			if !item.Manageable {
+				item.Error = "凭据无权管理该区域"
+			}
+		default:
+			item.Error = "该类型不支持列出区域，请使用写入测试"
+		}
+
+		if !item.Manageable {
+			result.Success = false
+		}
+		result.Domains = append(result.Domains, item)
+	}
+
+	return result, nil
+}
+
+// testWrite 写入并删除一条测试 TXT 记录
+func testWrite(p challenge.Provider, domain string) (bool, string) {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	token := "letsync-test-" + hex.EncodeToString(buf)
+	keyAuth := token + ".test"
+
+	if err := p.Present(domain, token, keyAuth); err != nil {
+		return false, fmt.Sprintf("写入测试记录失败: %v", err)
+	}
+	if err := p.CleanUp(domain, token, keyAuth); err != nil {
+		return false, fmt.Sprintf("删除测试记录失败: %v", err)
+	}
+	return true, ""
 }
 
 // GetDecryptedConfig 获取解密后的配置
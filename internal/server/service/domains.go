@@ -0,0 +1,297 @@
+package service
+
+import (
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"strings"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"golang.org/x/net/idna"
+)
+
+// DefaultMaxNames 单张证书默认最多包含的域名数（Let's Encrypt 的限制）
+const DefaultMaxNames = 100
+
+// DomainError 域名校验失败，Field 为出错的请求字段（如 domain、san[2]）
+type DomainError struct {
+	Field   string
+	Message string
+}
+
+func (e *DomainError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// DomainOptions 域名规范化选项
+type DomainOptions struct {
+	IncludeApex bool // 申请通配符时自动加入对应的主域名
+	MaxNames    int  // 最多包含的域名数，0 表示不限制
+}
+
+// NormalizeDomain 规范化单个标识符：去除首尾空白和结尾的点，IDN 转为 punycode 并小写
+// 通配符只允许出现在最左侧且独占一个标签（如 *.example.com）；IP 地址统一为标准文本格式
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	if domain == "" {
+		return "", fmt.Errorf("域名不能为空")
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(domain, "["), "]")); err == nil {
+		if addr.Zone() != "" {
+			return "", fmt.Errorf("%s: IP 地址不能包含区域标识", domain)
+		}
+		return addr.Unmap().String(), nil
+	}
+
+	wildcard := strings.HasPrefix(domain, "*.")
+	base := strings.TrimPrefix(domain, "*.")
+	if strings.Contains(base, "*") {
+		return "", fmt.Errorf("%s: 通配符只能作为最左侧的完整标签，如 *.example.com", domain)
+	}
+
+	ascii, err := idna.Lookup.ToASCII(base)
+	if err != nil {
+		return "", fmt.Errorf("%s: 无效的域名: %v", domain, err)
+	}
+	ascii = strings.ToLower(ascii)
+
+	if len(ascii) > 253 {
+		return "", fmt.Errorf("%s: 域名长度超过 253 个字符", domain)
+	}
+	labels := strings.Split(ascii, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("%s: 需要完整的域名，如 example.com", domain)
+	}
+	for _, label := range labels {
+		if err := checkLabel(label); err != nil {
+			return "", fmt.Errorf("%s: %w", domain, err)
+		}
+	}
+	if isNumeric(labels[len(labels)-1]) {
+		return "", fmt.Errorf("%s: 顶级域不能是纯数字", domain)
+	}
+	if wildcard {
+		return "*." + ascii, nil
+	}
+	return ascii, nil
+}
+
+// checkLabel 校验单个标签：1-63 个字符，只包含字母、数字和连字符，且不以连字符开头或结尾
+func checkLabel(label string) error {
+	if label == "" {
+		return fmt.Errorf("包含空标签")
+	}
+	if len(label) > 63 {
+		return fmt.Errorf("标签 %s 超过 63 个字符", label)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("标签 %s 不能以连字符开头或结尾", label)
+	}
+	for _, r := range label {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return fmt.Errorf("标签 %s 包含无效字符", label)
+		}
+	}
+	return nil
+}
+
+// IsIPAddress 判断标识符是否为 IP 地址
+func IsIPAddress(name string) bool {
+	_, err := netip.ParseAddr(name)
+	return err == nil
+}
+
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// NormalizeDomains 规范化证书的主域名和 SAN
+// SAN 中与主域名或前面的 SAN 重复的域名会被去掉；已被通配符覆盖的同级域名（如 *.example.com 与 www.example.com）
+// 会被 CA 拒绝，直接返回错误。返回的错误为 *DomainError，指明出错字段
+func NormalizeDomains(domain string, san []string, opts DomainOptions) (string, []string, error) {
+	primary, err := NormalizeDomain(domain)
+	if err != nil {
+		return "", nil, &DomainError{Field: "domain", Message: err.Error()}
+	}
+
+	names := []string{primary}
+	fields := map[string]string{primary: "domain"}
+	for i, d := range san {
+		if strings.TrimSpace(d) == "" {
+			continue
+		}
+		name, err := NormalizeDomain(d)
+		if err != nil {
+			return "", nil, &DomainError{Field: fmt.Sprintf("san[%d]", i), Message: err.Error()}
+		}
+		if _, ok := fields[name]; ok {
+			continue
+		}
+		fields[name] = fmt.Sprintf("san[%d]", i)
+		names = append(names, name)
+	}
+
+	// 通配符自动加入主域名
+	if opts.IncludeApex {
+		for _, name := range names {
+			apex, ok := strings.CutPrefix(name, "*.")
+			if _, exists := fields[apex]; ok && !exists {
+				fields[apex] = fields[name]
+				names = append(names, apex)
+			}
+		}
+	}
+
+	for _, name := range names {
+		if strings.HasPrefix(name, "*.") || IsIPAddress(name) {
+			continue
+		}
+		if _, parent, ok := strings.Cut(name, "."); ok {
+			if _, covered := fields["*."+parent]; covered {
+				return "", nil, &DomainError{Field: fields[name], Message: fmt.Sprintf("%s 已被 *.%s 覆盖，无需单独申请", name, parent)}
+			}
+		}
+	}
+
+	if opts.MaxNames > 0 && len(names) > opts.MaxNames {
+		return "", nil, &DomainError{Field: "san", Message: fmt.Sprintf("证书最多包含 %d 个域名，当前 %d 个", opts.MaxNames, len(names))}
+	}
+
+	return names[0], names[1:], nil
+}
+
+// ValidateChallenge 校验验证方式及其必填参数
+// overrides 中有域名使用 HTTP-01 时，http01_mode 同样适用于这些域名
+func ValidateChallenge(challengeType string, dnsProviderID uint, http01Mode, http01Webroot string, overrides []model.DomainChallenge) error {
+	switch challengeType {
+	case "dns-01":
+		if dnsProviderID == 0 {
+			return fmt.Errorf("DNS-01 验证方式需要选择 DNS 提供商")
+		}
+	case "http-01", "tls-alpn-01":
+	default:
+		return fmt.Errorf("不支持的验证方式: %s", challengeType)
+	}
+
+	usesHTTP01 := challengeType == "http-01"
+	for _, o := range overrides {
+		if o.ChallengeType == "http-01" {
+			usesHTTP01 = true
+		}
+	}
+	if !usesHTTP01 {
+		if http01Mode != "" {
+			return fmt.Errorf("http01_mode 仅适用于 HTTP-01 验证")
+		}
+		return nil
+	}
+
+	switch http01Mode {
+	case "", "agent", "proxy":
+	case "webroot":
+		if !filepath.IsAbs(http01Webroot) {
+			return fmt.Errorf("webroot 模式需要填写绝对路径")
+		}
+	default:
+		return fmt.Errorf("不支持的 HTTP-01 放置方式: %s", http01Mode)
+	}
+	return nil
+}
+
+// NormalizeDomainChallenges 校验并规范化按域名覆盖的验证配置
+// 域名必须属于证书，未设置任何字段的条目会被丢弃；同时检查通配符和 IP 地址最终使用的验证方式
+func NormalizeDomainChallenges(list []model.DomainChallenge, domains []string, challengeType string, dnsProviderID uint) ([]model.DomainChallenge, error) {
+	known := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		known[domain] = true
+	}
+
+	seen := make(map[string]bool, len(list))
+	result := []model.DomainChallenge{}
+	for i, o := range list {
+		field := fmt.Sprintf("domain_challenges[%d]", i)
+		domain, err := NormalizeDomain(o.Domain)
+		if err != nil {
+			return nil, &DomainError{Field: field, Message: err.Error()}
+		}
+		o.Domain = domain
+		if !known[o.Domain] {
+			return nil, &DomainError{Field: field, Message: fmt.Sprintf("%s 不是证书中的域名", o.Domain)}
+		}
+		if seen[o.Domain] {
+			return nil, &DomainError{Field: field, Message: fmt.Sprintf("%s 重复配置", o.Domain)}
+		}
+		seen[o.Domain] = true
+
+		effective := o.ChallengeType
+		if effective == "" {
+			effective = challengeType
+		}
+		switch effective {
+		case "dns-01":
+			if IsIPAddress(o.Domain) {
+				return nil, &DomainError{Field: field, Message: fmt.Sprintf("IP 地址 %s 不能使用 DNS-01 验证", o.Domain)}
+			}
+			if o.DNSProviderID == 0 && dnsProviderID == 0 {
+				return nil, &DomainError{Field: field, Message: fmt.Sprintf("%s 使用 DNS-01 验证，需要选择 DNS 提供商", o.Domain)}
+			}
+		case "http-01", "tls-alpn-01":
+			if strings.HasPrefix(o.Domain, "*.") {
+				return nil, &DomainError{Field: field, Message: fmt.Sprintf("通配符域名 %s 只能使用 DNS-01 验证", o.Domain)}
+			}
+			if o.DNSProviderID != 0 {
+				return nil, &DomainError{Field: field, Message: fmt.Sprintf("%s: DNS 提供商仅适用于 DNS-01 验证", o.Domain)}
+			}
+		default:
+			return nil, &DomainError{Field: field, Message: fmt.Sprintf("%s: 不支持的验证方式 %s", o.Domain, effective)}
+		}
+
+		alias, err := NormalizeChallengeAlias(effective, o.ChallengeAlias)
+		if err != nil {
+			return nil, &DomainError{Field: field, Message: fmt.Sprintf("%s: %v", o.Domain, err)}
+		}
+		o.ChallengeAlias = alias
+
+		if o.ChallengeType == "" && o.DNSProviderID == 0 && o.ChallengeAlias == "" {
+			continue
+		}
+		result = append(result, o)
+	}
+
+	// 未单独配置的域名使用证书级验证方式：通配符只能用 DNS-01，IP 地址不能用 DNS-01
+	for _, domain := range domains {
+		if seen[domain] {
+			continue
+		}
+		if challengeType != "dns-01" && strings.HasPrefix(domain, "*.") {
+			return nil, &DomainError{Field: "challenge_type", Message: fmt.Sprintf("通配符域名 %s 只能使用 DNS-01 验证", domain)}
+		}
+		if challengeType == "dns-01" && IsIPAddress(domain) {
+			return nil, &DomainError{Field: "challenge_type", Message: fmt.Sprintf("IP 地址 %s 不能使用 DNS-01 验证，请使用 HTTP-01 或 TLS-ALPN-01", domain)}
+		}
+	}
+	return result, nil
+}
+
+// NormalizeChallengeAlias 规范化 DNS-01 验证别名
+// 允许填写 _acme-challenge 记录全名，统一保存为别名域名
+func NormalizeChallengeAlias(challengeType, alias string) (string, error) {
+	alias = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(alias), "."))
+	alias = strings.TrimPrefix(alias, "_acme-challenge.")
+	if alias == "" {
+		return "", nil
+	}
+	if challengeType != "dns-01" {
+		return "", fmt.Errorf("验证别名仅适用于 DNS-01 验证")
+	}
+	if strings.Contains(alias, "*") || !strings.Contains(alias, ".") {
+		return "", fmt.Errorf("无效的验证别名: %s", alias)
+	}
+	return alias, nil
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{in: " Example.COM. ", want: "example.com"},
+		{in: "bücher.example", want: "xn--bcher-kva.example"},
+		{in: "*.Bücher.Example.", want: "*.xn--bcher-kva.example"},
+		{in: "xn--bcher-kva.example", want: "xn--bcher-kva.example"},
+		{in: "a.*.example.com", wantErr: "通配符只能作为最左侧的完整标签"},
+		{in: "*example.com", wantErr: "通配符只能作为最左侧的完整标签"},
+		{in: "*.*.example.com", wantErr: "通配符只能作为最左侧的完整标签"},
+		{in: "example.123", wantErr: "顶级域不能是纯数字"},
+		{in: "123.example", want: "123.example"},
+		{in: "localhost", wantErr: "需要完整的域名"},
+		{in: "a..example.com", wantErr: "包含空标签"},
+		{in: "-a.example.com", wantErr: "无效的域名"},
+		{in: strings.Repeat("a", 64) + ".example.com", wantErr: "超过 63 个字符"},
+		{in: "", wantErr: "域名不能为空"},
+		{in: " . ", wantErr: "域名不能为空"},
+
+		{in: "192.0.2.1", want: "192.0.2.1"},
+		{in: "2001:DB8:0:0::1", want: "2001:db8::1"},
+		{in: "[2001:db8::1]", want: "2001:db8::1"},
+		{in: "::ffff:192.0.2.1", want: "192.0.2.1"},
+		{in: "fe80::1%eth0", wantErr: "IP 地址不能包含区域标识"},
+		{in: "[fe80::1%eth0]", wantErr: "IP 地址不能包含区域标识"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := NormalizeDomain(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NormalizeDomain(%q) 返回错误 %v，期望包含 %q", tt.in, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeDomain(%q) 失败: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeDomain(%q) = %q，期望 %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeDomains(t *testing.T) {
+	tests := []struct {
+		name      string
+		domain    string
+		san       []string
+		opts      DomainOptions
+		want      string
+		wantSAN   []string
+		wantField string // 期望的 DomainError.Field，空表示不出错
+	}{
+		{
+			name:    "SAN 去重并跳过空值",
+			domain:  "Example.com",
+			san:     []string{"", "EXAMPLE.com.", "www.example.com", "WWW.example.com"},
+			want:    "example.com",
+			wantSAN: []string{"www.example.com"},
+		},
+		{
+			name:    "IP 地址与域名混合",
+			domain:  "example.com",
+			san:     []string{"192.0.2.1", "[2001:db8::1]", "2001:DB8::1"},
+			want:    "example.com",
+			wantSAN: []string{"192.0.2.1", "2001:db8::1"},
+		},
+		{
+			name:    "通配符自动加入主域名",
+			domain:  "*.example.com",
+			san:     []string{"*.example.net"},
+			opts:    DomainOptions{IncludeApex: true},
+			want:    "*.example.com",
+			wantSAN: []string{"*.example.net", "example.com", "example.net"},
+		},
+		{
+			name:    "主域名已存在时不重复加入",
+			domain:  "*.example.com",
+			san:     []string{"example.com"},
+			opts:    DomainOptions{IncludeApex: true},
+			want:    "*.example.com",
+			wantSAN: []string{"example.com"},
+		},
+		{
+			name:    "未启用 IncludeApex 时不加入主域名",
+			domain:  "*.example.com",
+			want:    "*.example.com",
+			wantSAN: []string{},
+		},
+		{
+			name:    "通配符不覆盖更深层级",
+			domain:  "*.example.com",
+			san:     []string{"a.b.example.com"},
+			want:    "*.example.com",
+			wantSAN: []string{"a.b.example.com"},
+		},
+		{
+			name:      "SAN 已被通配符覆盖",
+			domain:    "*.example.com",
+			san:       []string{"example.com", "www.example.com"},
+			wantField: "san[1]",
+		},
+		{
+			name:      "主域名已被 SAN 中的通配符覆盖",
+			domain:    "www.example.com",
+			san:       []string{"*.example.com"},
+			wantField: "domain",
+		},
+		{
+			name:      "无效的主域名",
+			domain:    "example.123",
+			wantField: "domain",
+		},
+		{
+			name:      "无效的 SAN",
+			domain:    "example.com",
+			san:       []string{"", "a..example.com"},
+			wantField: "san[1]",
+		},
+		{
+			name:    "未超过域名数量限制",
+			domain:  "a.example.com",
+			san:     []string{"b.example.com", "A.example.com"},
+			opts:    DomainOptions{MaxNames: 2},
+			want:    "a.example.com",
+			wantSAN: []string{"b.example.com"},
+		},
+		{
+			name:      "超过域名数量限制",
+			domain:    "a.example.com",
+			san:       []string{"b.example.com", "c.example.com"},
+			opts:      DomainOptions{MaxNames: 2},
+			wantField: "san",
+		},
+		{
+			name:      "自动加入的主域名计入数量限制",
+			domain:    "*.example.com",
+			opts:      DomainOptions{IncludeApex: true, MaxNames: 1},
+			wantField: "san",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, san, err := NormalizeDomains(tt.domain, tt.san, tt.opts)
+			if tt.wantField != "" {
+				var domainErr *DomainError
+				if !errors.As(err, &domainErr) {
+					t.Fatalf("返回错误 %v，期望 *DomainError", err)
+				}
+				if domainErr.Field != tt.wantField {
+					t.Errorf("出错字段为 %q，期望 %q (%s)", domainErr.Field, tt.wantField, domainErr.Message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("规范化失败: %v", err)
+			}
+			if got != tt.want || !reflect.DeepEqual(san, tt.wantSAN) {
+				t.Errorf("结果为 %q %q，期望 %q %q", got, san, tt.want, tt.wantSAN)
+			}
+		})
+	}
+}
+
+func TestNormalizeDomainChallenges(t *testing.T) {
+	domains := []string{"example.com", "*.example.com", "192.0.2.1"}
+
+	tests := []struct {
+		name          string
+		list          []model.DomainChallenge
+		domains       []string
+		challengeType string
+		dnsProviderID uint
+		want          []model.DomainChallenge
+		wantField     string
+	}{
+		{
+			name:          "IP 地址单独使用 HTTP-01",
+			list:          []model.DomainChallenge{{Domain: "192.0.2.1", ChallengeType: "http-01"}},
+			domains:       domains,
+			challengeType: "dns-01",
+			dnsProviderID: 1,
+			want:          []model.DomainChallenge{{Domain: "192.0.2.1", ChallengeType: "http-01"}},
+		},
+		{
+			name: "域名规范化、别名规范化并丢弃空条目",
+			list: []model.DomainChallenge{
+				{Domain: "Example.COM.", ChallengeAlias: "_acme-challenge.Alias.Example.net."},
+				{Domain: "*.example.com"},
+			},
+			domains:       []string{"example.com", "*.example.com"},
+			challengeType: "dns-01",
+			dnsProviderID: 1,
+			want:          []model.DomainChallenge{{Domain: "example.com", ChallengeAlias: "alias.example.net"}},
+		},
+		{
+			name:          "通配符单独使用 DNS-01",
+			list:          []model.DomainChallenge{{Domain: "*.example.com", ChallengeType: "dns-01", DNSProviderID: 2}},
+			domains:       []string{"example.com", "*.example.com"},
+			challengeType: "http-01",
+			want:          []model.DomainChallenge{{Domain: "*.example.com", ChallengeType: "dns-01", DNSProviderID: 2}},
+		},
+		{
+			name:          "不是证书中的域名",
+			list:          []model.DomainChallenge{{Domain: "www.example.com", ChallengeType: "http-01"}},
+			domains:       domains,
+			challengeType: "dns-01",
+			dnsProviderID: 1,
+			wantField:     "domain_challenges[0]",
+		},
+		{
+			name: "重复配置",
+			list: []model.DomainChallenge{
+				{Domain: "192.0.2.1", ChallengeType: "http-01"},
+				{Domain: "192.0.2.1", ChallengeType: "tls-alpn-01"},
+			},
+			domains:       domains,
+			challengeType: "dns-01",
+			dnsProviderID: 1,
+			wantField:     "domain_challenges[1]",
+		},
+		{
+			name:          "IP 地址不能使用 DNS-01",
+			list:          []model.DomainChallenge{{Domain: "192.0.2.1", ChallengeType: "dns-01", DNSProviderID: 1}},
+			domains:       domains,
+			challengeType: "http-01",
+			wantField:     "domain_challenges[0]",
+		},
+		{
+			name:          "通配符不能使用 HTTP-01",
+			list:          []model.DomainChallenge{{Domain: "*.example.com", ChallengeType: "http-01"}},
+			domains:       domains,
+			challengeType: "dns-01",
+			dnsProviderID: 1,
+			wantField:     "domain_challenges[0]",
+		},
+		{
+			name:          "DNS-01 缺少 DNS 提供商",
+			list:          []model.DomainChallenge{{Domain: "*.example.com", ChallengeType: "dns-01"}},
+			domains:       []string{"example.com", "*.example.com"},
+			challengeType: "http-01",
+			wantField:     "domain_challenges[0]",
+		},
+		{
+			name:          "HTTP-01 不能指定 DNS 提供商",
+			list:          []model.DomainChallenge{{Domain: "example.com", ChallengeType: "http-01", DNSProviderID: 1}},
+			domains:       []string{"example.com"},
+			challengeType: "dns-01",
+			dnsProviderID: 1,
+			wantField:     "domain_challenges[0]",
+		},
+		{
+			name:          "验证别名仅适用于 DNS-01",
+			list:          []model.DomainChallenge{{Domain: "example.com", ChallengeAlias: "alias.example.net"}},
+			domains:       []string{"example.com"},
+			challengeType: "http-01",
+			wantField:     "domain_challenges[0]",
+		},
+		{
+			name:          "未覆盖的通配符沿用 HTTP-01",
+			domains:       []string{"example.com", "*.example.com"},
+			challengeType: "http-01",
+			wantField:     "challenge_type",
+		},
+		{
+			name:          "未覆盖的 IP 地址沿用 DNS-01",
+			domains:       domains,
+			challengeType: "dns-01",
+			dnsProviderID: 1,
+			wantField:     "challenge_type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeDomainChallenges(tt.list, tt.domains, tt.challengeType, tt.dnsProviderID)
+			if tt.wantField != "" {
+				var domainErr *DomainError
+				if !errors.As(err, &domainErr) {
+					t.Fatalf("返回错误 %v，期望 *DomainError", err)
+				}
+				if domainErr.Field != tt.wantField {
+					t.Errorf("出错字段为 %q，期望 %q (%s)", domainErr.Field, tt.wantField, domainErr.Message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("校验失败: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("结果为 %+v，期望 %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"sort"
+	"sync"
+)
+
+// issuePool 限制同时进行的证书签发数量
+// 上限在每次获取时读取，修改 acme.max_concurrent 后无需重启即可生效
+type issuePool struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	running int
+}
+
+// 全局签发池，所有 ACMEService 实例共享
+var globalIssuePool = newIssuePool()
+
+func newIssuePool() *issuePool {
+	p := &issuePool{}
+	p.cond = sync.NewCond(&p.mutex)
+	return p
+}
+
+// acquire 等待空闲名额
+func (p *issuePool) acquire(limit int) {
+	if limit <= 0 {
+		limit = 1
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for p.running >= limit {
+		p.cond.Wait()
+	}
+	p.running++
+}
+
+// release 归还名额
+func (p *issuePool) release() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.running--
+	p.cond.Broadcast()
+}
+
+// 内置 HTTP-01/TLS-ALPN-01 验证服务独占监听端口，同一端口上的签发需要串行
+var (
+	portLocks      = make(map[int]*sync.Mutex)
+	portLocksMutex sync.Mutex
+)
+
+// lockPort 获取指定监听端口的锁，返回解锁函数
+func lockPort(port int) func() {
+	portLocksMutex.Lock()
+	lock, ok := portLocks[port]
+	if !ok {
+		lock = &sync.Mutex{}
+		portLocks[port] = lock
+	}
+	portLocksMutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// lockPorts 按端口号顺序获取多个监听端口的锁，避免任务之间交叉等待，返回解锁函数
+func lockPorts(ports []int) func() {
+	sorted := append([]int(nil), ports...)
+	sort.Ints(sorted)
+
+	unlocks := make([]func(), 0, len(sorted))
+	for i, port := range sorted {
+		if i > 0 && port == sorted[i-1] {
+			continue // HTTP-01 和 TLS-ALPN-01 可能配置为同一端口
+		}
+		unlocks = append(unlocks, lockPort(port))
+	}
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+// 进行中的申请和续期，按证书 ID 计数，避免同一证书重复发起签发
+var (
+	issuingCerts = make(map[uint]int)
+	issuingMutex sync.Mutex
+)
+
+// beginIssue 登记证书的签发，返回结束登记的函数
+func beginIssue(certID uint) func() {
+	end, _ := startIssue(certID, false)
+	return end
+}
+
+// tryBeginIssue 证书没有进行中的签发时登记，否则返回 false
+func tryBeginIssue(certID uint) (func(), bool) {
+	return startIssue(certID, true)
+}
+
+func startIssue(certID uint, exclusive bool) (func(), bool) {
+	issuingMutex.Lock()
+	defer issuingMutex.Unlock()
+
+	if exclusive && issuingCerts[certID] > 0 {
+		return nil, false
+	}
+	issuingCerts[certID]++
+
+	return func() {
+		issuingMutex.Lock()
+		defer issuingMutex.Unlock()
+		if issuingCerts[certID]--; issuingCerts[certID] <= 0 {
+			delete(issuingCerts, certID)
+		}
+	}, true
+}
+
+// isIssuing 证书是否有进行中的签发
+func isIssuing(certID uint) bool {
+	issuingMutex.Lock()
+	defer issuingMutex.Unlock()
+
+	return issuingCerts[certID] > 0
+}
@@ -9,15 +9,29 @@ import (
 	"github.com/BlakeLiAFK/letsync/internal/server/model"
 	"github.com/BlakeLiAFK/letsync/internal/server/store"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // LogService 日志服务
-type LogService struct{}
+type LogService struct {
+	tx *gorm.DB // 非空时日志写入该事务，随事务提交或回滚
+}
 
 func NewLogService() *LogService {
 	return &LogService{}
 }
 
+// WithTx 返回在事务 tx 中读写的副本
+func (s *LogService) WithTx(tx *gorm.DB) *LogService {
+	c := *s
+	c.tx = tx
+	return &c
+}
+
+func (s *LogService) db() *gorm.DB {
+	return store.GetDBOr(s.tx)
+}
+
 // LogContext 日志上下文信息
 type LogContext struct {
 	Operator    string // 操作者
@@ -85,7 +99,7 @@ func (s *LogService) LogWithContext(level, module, message string, metadata map[
 		ForwardedIP: ctx.ForwardedIP,
 	}
 
-	store.GetDB().Create(&logEntry)
+	s.db().Create(&logEntry)
 }
 
 // Info 信息日志
@@ -147,7 +161,7 @@ func (s *LogService) Query(level, module, search string, limit, offset int) ([]m
 	var logs []model.Log
 	var total int64
 
-	db := store.GetDB().Model(&model.Log{})
+	db := s.db().Model(&model.Log{})
 
 	if level != "" && level != "all" {
 		db = db.Where("level = ?", level)
@@ -0,0 +1,363 @@
+package service
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/BlakeLiAFK/letsync/internal/pkg/crypto"
+	"github.com/BlakeLiAFK/letsync/internal/server/model"
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+)
+
+// DefaultCertValidityDays 私有 CA 签发证书的默认有效期（天）
+const DefaultCertValidityDays = 90
+
+// 私有 CA 证书有效期
+const (
+	caRootValidity         = 10 * 365 * 24 * time.Hour
+	caIntermediateValidity = 5 * 365 * 24 * time.Hour
+)
+
+// PrivateCA 已解密的私有 CA 签发者
+type PrivateCA struct {
+	Root            *x509.Certificate
+	RootPEM         []byte
+	Intermediate    *x509.Certificate
+	IntermediatePEM []byte
+
+	key      gocrypto.Signer
+	keyType  certcrypto.KeyType
+	validity time.Duration
+}
+
+// CreatePrivateCA 创建私有 CA 工作区，生成根证书和中间证书，私钥使用 security.encryption_key 加密保存
+func (s *WorkspaceService) CreatePrivateCA(name, description, keyType string, maxNames, validityDays int) (*model.Workspace, error) {
+	if keyType == "" {
+		keyType = "EC256"
+	}
+
+	rootPEM, rootKeyPEM, interPEM, interKeyPEM, err := generatePrivateCA(name)
+	if err != nil {
+		return nil, fmt.Errorf("生成私有 CA 失败: %w", err)
+	}
+
+	encryptionKey := s.settings.Get("security.encryption_key")
+	rootKey, err := crypto.Encrypt(string(rootKeyPEM), encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("加密根证书私钥失败: %w", err)
+	}
+	interKey, err := crypto.Encrypt(string(interKeyPEM), encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("加密中间证书私钥失败: %w", err)
+	}
+
+	workspace := &model.Workspace{
+		Name:               name,
+		Description:        description,
+		KeyType:            keyType,
+		MaxNames:           maxNames,
+		Type:               "private_ca",
+		CertValidityDays:   validityDays,
+		CARootCert:         rootPEM,
+		CARootKey:          []byte(rootKey),
+		CAIntermediateCert: interPEM,
+		CAIntermediateKey:  []byte(interKey),
+	}
+
+	if err := s.db().Create(workspace).Error; err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("workspace", fmt.Sprintf("创建私有 CA 工作区: %s", name), nil)
+	return workspace, nil
+}
+
+// SetCertValidityDays 设置私有 CA 签发证书的有效期（0 表示使用默认值）
+func (s *WorkspaceService) SetCertValidityDays(id uint, days int) error {
+	return s.db().Model(&model.Workspace{}).Where("id = ?", id).Update("cert_validity_days", days).Error
+}
+
+// SetACMEServer 开放或关闭私有 CA 工作区的内置 ACME 服务端
+func (s *WorkspaceService) SetACMEServer(id uint, enabled bool) error {
+	return s.db().Model(&model.Workspace{}).Where("id = ?", id).Update("acme_server", enabled).Error
+}
+
+// IsPrivateCA 工作区是否为私有 CA，未指定工作区时为 false
+func (s *WorkspaceService) IsPrivateCA(workspaceID *uint) bool {
+	if workspaceID == nil || *workspaceID == 0 {
+		return false
+	}
+	workspace, err := s.Get(*workspaceID)
+	return err == nil && workspace.IsPrivateCA()
+}
+
+// LoadPrivateCA 加载并解密私有 CA 工作区的中间证书私钥
+func (s *WorkspaceService) LoadPrivateCA(id uint) (*PrivateCA, error) {
+	workspace, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !workspace.IsPrivateCA() {
+		return nil, fmt.Errorf("工作区 %s 不是私有 CA", workspace.Name)
+	}
+
+	root, err := certcrypto.ParsePEMCertificate(workspace.CARootCert)
+	if err != nil {
+		return nil, fmt.Errorf("解析根证书失败: %w", err)
+	}
+	intermediate, err := certcrypto.ParsePEMCertificate(workspace.CAIntermediateCert)
+	if err != nil {
+		return nil, fmt.Errorf("解析中间证书失败: %w", err)
+	}
+
+	keyPEM, err := crypto.Decrypt(string(workspace.CAIntermediateKey), s.settings.Get("security.encryption_key"))
+	if err != nil {
+		return nil, fmt.Errorf("解密中间证书私钥失败: %w", err)
+	}
+	key, err := certcrypto.ParsePEMPrivateKey([]byte(keyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("解析中间证书私钥失败: %w", err)
+	}
+	signer, ok := key.(gocrypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("不支持的中间证书私钥类型: %T", key)
+	}
+
+	days := workspace.CertValidityDays
+	if days <= 0 {
+		days = DefaultCertValidityDays
+	}
+
+	return &PrivateCA{
+		Root:            root,
+		RootPEM:         workspace.CARootCert,
+		Intermediate:    intermediate,
+		IntermediatePEM: workspace.CAIntermediateCert,
+		key:             signer,
+		keyType:         certKeyType(workspace.KeyType),
+		validity:        time.Duration(days) * 24 * time.Hour,
+	}, nil
+}
+
+// CAInfo 私有 CA 的证书信息，用于接口展示
+func (s *WorkspaceService) CAInfo(workspace *model.Workspace) map[string]interface{} {
+	if !workspace.IsPrivateCA() {
+		return nil
+	}
+
+	info := map[string]interface{}{}
+	if root, err := certcrypto.ParsePEMCertificate(workspace.CARootCert); err == nil {
+		fingerprint, _ := crypto.CertFingerprint(workspace.CARootCert)
+		info["root_subject"] = root.Subject.CommonName
+		info["root_not_after"] = root.NotAfter
+		info["root_fingerprint"] = fingerprint
+	}
+	if intermediate, err := certcrypto.ParsePEMCertificate(workspace.CAIntermediateCert); err == nil {
+		info["intermediate_subject"] = intermediate.Subject.CommonName
+		info["intermediate_not_after"] = intermediate.NotAfter
+	}
+	return info
+}
+
+// Issue 签发证书。csr 为空时按工作区密钥类型生成私钥，否则使用 CSR 中的公钥和域名
+// 私有 CA 由管理员控制，不做域名验证；证书同时用于服务端和客户端认证（如服务网格 mTLS）
+func (ca *PrivateCA) Issue(domains []string, csr *x509.CertificateRequest) (*certificate.Resource, error) {
+	var pub gocrypto.PublicKey
+	var keyPEM []byte
+	if csr != nil {
+		if err := csr.CheckSignature(); err != nil {
+			return nil, fmt.Errorf("CSR 签名无效: %w", err)
+		}
+		domains = CSRDomains(csr)
+		pub = csr.PublicKey
+	} else {
+		key, err := certcrypto.GeneratePrivateKey(ca.keyType)
+		if err != nil {
+			return nil, fmt.Errorf("生成私钥失败: %w", err)
+		}
+		pub = key.(gocrypto.Signer).Public()
+		keyPEM = certcrypto.PEMEncode(key)
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("证书至少需要一个域名")
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tpl := &x509.Certificate{
+		SerialNumber:          serial,
+		NotBefore:             now.Add(-5 * time.Minute), // 容忍客户端时钟偏差
+		NotAfter:              now.Add(ca.validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	if _, ok := pub.(*rsa.PublicKey); ok {
+		tpl.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	if tpl.NotAfter.After(ca.Intermediate.NotAfter) {
+		tpl.NotAfter = ca.Intermediate.NotAfter
+	}
+	for _, d := range domains {
+		if ip := net.ParseIP(d); ip != nil {
+			tpl.IPAddresses = append(tpl.IPAddresses, ip)
+		} else {
+			tpl.DNSNames = append(tpl.DNSNames, d)
+		}
+	}
+	if !IsIPAddress(domains[0]) && len(domains[0]) <= 64 {
+		tpl.Subject.CommonName = domains[0]
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.Intermediate, pub, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("签发证书失败: %w", err)
+	}
+
+	return &certificate.Resource{
+		Domain:            domains[0],
+		Certificate:       certcrypto.PEMEncode(certcrypto.DERCertificateBytes(der)),
+		IssuerCertificate: ca.IntermediatePEM,
+		PrivateKey:        keyPEM,
+	}, nil
+}
+
+// issueFromPrivateCA 使用私有 CA 工作区签发证书，返回与 ACME 申请相同的结构，由调用方保存
+func (s *ACMEService) issueFromPrivateCA(req CertRequest, csr *x509.CertificateRequest, taskType string) (*certificate.Resource, error) {
+	ca, err := NewWorkspaceService().LoadPrivateCA(*req.WorkspaceID)
+	if err != nil {
+		if req.CertID > 0 {
+			s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("加载私有 CA 失败: %v", err), nil)
+		}
+		return nil, fmt.Errorf("加载私有 CA 失败: %w", err)
+	}
+
+	domains := append([]string{req.Domain}, req.SAN...)
+	if req.CertID > 0 {
+		s.taskLog.Info(req.CertID, taskType, "🏛️ 使用私有 CA 签发证书（无需域名验证）", map[string]interface{}{
+			"issuer":  ca.Intermediate.Subject.CommonName,
+			"domains": domains,
+			"has_csr": csr != nil,
+		})
+	}
+
+	resource, err := ca.Issue(domains, csr)
+	if err != nil {
+		s.logger.Error("acme", fmt.Sprintf("私有 CA 签发证书失败: %s", req.Domain), map[string]interface{}{
+			"error": err.Error(),
+		})
+		if req.CertID > 0 {
+			s.taskLog.Error(req.CertID, taskType, fmt.Sprintf("❌ 私有 CA 签发证书失败: %v", err), nil)
+		}
+		return nil, err
+	}
+
+	s.logger.Info("acme", fmt.Sprintf("私有 CA 签发证书成功: %s", req.Domain), nil)
+	if req.CertID > 0 {
+		if leaf, err := certcrypto.ParsePEMCertificate(resource.Certificate); err == nil {
+			s.taskLog.Info(req.CertID, taskType, "✅ 证书签发成功！", map[string]interface{}{
+				"issued_at":  leaf.NotBefore.Format("2006-01-02 15:04:05"),
+				"expires_at": leaf.NotAfter.Format("2006-01-02 15:04:05"),
+				"serial":     fmt.Sprintf("%X", leaf.SerialNumber),
+			})
+		}
+		s.taskLog.Info(req.CertID, taskType, "======= 任务结束（成功） =======", nil)
+	}
+
+	return resource, nil
+}
+
+// generatePrivateCA 生成根证书和中间证书（均为 ECDSA P-384），中间证书不能再签发下级 CA
+func generatePrivateCA(name string) (rootPEM, rootKeyPEM, interPEM, interKeyPEM []byte, err error) {
+	now := time.Now()
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	rootSerial, err := randomSerial()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	rootTpl := &x509.Certificate{
+		SerialNumber:          rootSerial,
+		Subject:               pkix.Name{CommonName: name + " Root CA", Organization: []string{name}},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(caRootValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            1,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTpl, rootTpl, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	interKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	interSerial, err := randomSerial()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	interTpl := &x509.Certificate{
+		SerialNumber:          interSerial,
+		Subject:               pkix.Name{CommonName: name + " Intermediate CA", Organization: []string{name}},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(caIntermediateValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	interDER, err := x509.CreateCertificate(rand.Reader, interTpl, root, &interKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	return certcrypto.PEMEncode(certcrypto.DERCertificateBytes(rootDER)), certcrypto.PEMEncode(rootKey),
+		certcrypto.PEMEncode(certcrypto.DERCertificateBytes(interDER)), certcrypto.PEMEncode(interKey), nil
+}
+
+// randomSerial 生成 128 位随机序列号
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("生成序列号失败: %w", err)
+	}
+	return serial, nil
+}
+
+// certKeyType 将工作区的密钥类型转换为 lego 的密钥类型，默认 EC256
+func certKeyType(keyType string) certcrypto.KeyType {
+	switch keyType {
+	case "EC384":
+		return certcrypto.EC384
+	case "RSA2048":
+		return certcrypto.RSA2048
+	case "RSA4096":
+		return certcrypto.RSA4096
+	default:
+		return certcrypto.EC256
+	}
+}
@@ -6,12 +6,14 @@ import (
 	"github.com/BlakeLiAFK/letsync/internal/pkg/crypto"
 	"github.com/BlakeLiAFK/letsync/internal/server/model"
 	"github.com/BlakeLiAFK/letsync/internal/server/store"
+	"gorm.io/gorm"
 )
 
 // WorkspaceService 工作区服务
 type WorkspaceService struct {
 	settings *SettingsService
 	logger   *LogService
+	tx       *gorm.DB // 非空时所有读写在该事务中进行
 }
 
 func NewWorkspaceService() *WorkspaceService {
@@ -21,21 +23,36 @@ func NewWorkspaceService() *WorkspaceService {
 	}
 }
 
+// WithTx 返回在事务 tx 中读写的副本
+func (s *WorkspaceService) WithTx(tx *gorm.DB) *WorkspaceService {
+	c := *s
+	c.tx = tx
+	c.logger = s.logger.WithTx(tx)
+	return &c
+}
+
+func (s *WorkspaceService) db() *gorm.DB {
+	return store.GetDBOr(s.tx)
+}
+
 // Create 创建工作区
-func (s *WorkspaceService) Create(name, description, caURL, email, keyType string) (*model.Workspace, error) {
+func (s *WorkspaceService) Create(name, description, caURL, email, keyType, profile, preferredChain string, maxNames int) (*model.Workspace, error) {
 	if keyType == "" {
 		keyType = "EC256"
 	}
 
 	workspace := &model.Workspace{
-		Name:        name,
-		Description: description,
-		CaURL:       caURL,
-		Email:       email,
-		KeyType:     keyType,
+		Name:           name,
+		Description:    description,
+		CaURL:          caURL,
+		Email:          email,
+		KeyType:        keyType,
+		Profile:        profile,
+		PreferredChain: preferredChain,
+		MaxNames:       maxNames,
 	}
 
-	if err := store.GetDB().Create(workspace).Error; err != nil {
+	if err := s.db().Create(workspace).Error; err != nil {
 		return nil, err
 	}
 
@@ -46,7 +63,7 @@ func (s *WorkspaceService) Create(name, description, caURL, email, keyType strin
 // Get 获取单个工作区
 func (s *WorkspaceService) Get(id uint) (*model.Workspace, error) {
 	var workspace model.Workspace
-	if err := store.GetDB().First(&workspace, id).Error; err != nil {
+	if err := s.db().First(&workspace, id).Error; err != nil {
 		return nil, err
 	}
 	return &workspace, nil
@@ -55,7 +72,7 @@ func (s *WorkspaceService) Get(id uint) (*model.Workspace, error) {
 // List 获取所有工作区（带证书计数）
 func (s *WorkspaceService) List() ([]map[string]interface{}, error) {
 	var workspaces []model.Workspace
-	if err := store.GetDB().Order("created_at DESC").Find(&workspaces).Error; err != nil {
+	if err := s.db().Order("created_at DESC").Find(&workspaces).Error; err != nil {
 		return nil, err
 	}
 
@@ -63,19 +80,26 @@ func (s *WorkspaceService) List() ([]map[string]interface{}, error) {
 	for i, w := range workspaces {
 		// 统计使用该工作区的证书数量
 		var certCount int64
-		store.GetDB().Model(&model.Certificate{}).Where("workspace_id = ?", w.ID).Count(&certCount)
+		s.db().Model(&model.Certificate{}).Where("workspace_id = ?", w.ID).Count(&certCount)
 
 		result[i] = map[string]interface{}{
-			"id":          w.ID,
-			"name":        w.Name,
-			"description": w.Description,
-			"ca_url":      w.CaURL,
-			"email":       w.Email,
-			"key_type":    w.KeyType,
-			"is_default":  w.IsDefault,
-			"cert_count":  certCount,
-			"created_at":  w.CreatedAt,
-			"updated_at":  w.UpdatedAt,
+			"id":                 w.ID,
+			"name":               w.Name,
+			"description":        w.Description,
+			"ca_url":             w.CaURL,
+			"email":              w.Email,
+			"key_type":           w.KeyType,
+			"profile":            w.Profile,
+			"preferred_chain":    w.PreferredChain,
+			"max_names":          w.MaxNames,
+			"type":               w.Type,
+			"cert_validity_days": w.CertValidityDays,
+			"ca":                 s.CAInfo(&w),
+			"acme_server":        w.ACMEServer,
+			"is_default":         w.IsDefault,
+			"cert_count":         certCount,
+			"created_at":         w.CreatedAt,
+			"updated_at":         w.UpdatedAt,
 		}
 	}
 
@@ -83,16 +107,19 @@ func (s *WorkspaceService) List() ([]map[string]interface{}, error) {
 }
 
 // Update 更新工作区
-func (s *WorkspaceService) Update(id uint, name, description, caURL, email, keyType string) error {
+func (s *WorkspaceService) Update(id uint, name, description, caURL, email, keyType, profile, preferredChain string, maxNames int) error {
 	updates := map[string]interface{}{
-		"name":        name,
-		"description": description,
-		"ca_url":      caURL,
-		"email":       email,
-		"key_type":    keyType,
+		"name":            name,
+		"description":     description,
+		"ca_url":          caURL,
+		"email":           email,
+		"key_type":        keyType,
+		"profile":         profile,
+		"preferred_chain": preferredChain,
+		"max_names":       maxNames,
 	}
 
-	if err := store.GetDB().Model(&model.Workspace{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+	if err := s.db().Model(&model.Workspace{}).Where("id = ?", id).Updates(updates).Error; err != nil {
 		return err
 	}
 
@@ -100,11 +127,24 @@ func (s *WorkspaceService) Update(id uint, name, description, caURL, email, keyT
 	return nil
 }
 
+// MaxNames 获取单张证书最多包含的域名数，工作区未设置时使用全局配置
+func (s *WorkspaceService) MaxNames(workspaceID *uint) int {
+	if workspaceID != nil && *workspaceID > 0 {
+		if workspace, err := s.Get(*workspaceID); err == nil && workspace.MaxNames > 0 {
+			return workspace.MaxNames
+		}
+	}
+	if n := s.settings.GetInt("acme.max_names"); n > 0 {
+		return n
+	}
+	return DefaultMaxNames
+}
+
 // Delete 删除工作区
 func (s *WorkspaceService) Delete(id uint) error {
 	// 检查是否有证书在使用
 	var count int64
-	store.GetDB().Model(&model.Certificate{}).Where("workspace_id = ?", id).Count(&count)
+	s.db().Model(&model.Certificate{}).Where("workspace_id = ?", id).Count(&count)
 	if count > 0 {
 		return fmt.Errorf("该工作区有 %d 个证书正在使用，无法删除", count)
 	}
@@ -116,7 +156,7 @@ func (s *WorkspaceService) Delete(id uint) error {
 		name = workspace.Name
 	}
 
-	if err := store.GetDB().Delete(&model.Workspace{}, id).Error; err != nil {
+	if err := s.db().Delete(&model.Workspace{}, id).Error; err != nil {
 		return err
 	}
 
@@ -127,7 +167,7 @@ func (s *WorkspaceService) Delete(id uint) error {
 // GetDefault 获取默认工作区
 func (s *WorkspaceService) GetDefault() (*model.Workspace, error) {
 	var workspace model.Workspace
-	if err := store.GetDB().Where("is_default = ?", true).First(&workspace).Error; err != nil {
+	if err := s.db().Where("is_default = ?", true).First(&workspace).Error; err != nil {
 		return nil, err
 	}
 	return &workspace, nil
@@ -136,12 +176,12 @@ func (s *WorkspaceService) GetDefault() (*model.Workspace, error) {
 // SetDefault 设置默认工作区
 func (s *WorkspaceService) SetDefault(id uint) error {
 	// 先取消所有默认
-	if err := store.GetDB().Model(&model.Workspace{}).Where("is_default = ?", true).Update("is_default", false).Error; err != nil {
+	if err := s.db().Model(&model.Workspace{}).Where("is_default = ?", true).Update("is_default", false).Error; err != nil {
 		return err
 	}
 
 	// 设置新的默认
-	if err := store.GetDB().Model(&model.Workspace{}).Where("id = ?", id).Update("is_default", true).Error; err != nil {
+	if err := s.db().Model(&model.Workspace{}).Where("id = ?", id).Update("is_default", true).Error; err != nil {
 		return err
 	}
 
@@ -177,12 +217,12 @@ func (s *WorkspaceService) SetAccountKey(id uint, key []byte) error {
 		return fmt.Errorf("加密账号私钥失败: %w", err)
 	}
 
-	return store.GetDB().Model(&model.Workspace{}).Where("id = ?", id).Update("account_key", []byte(encrypted)).Error
+	return s.db().Model(&model.Workspace{}).Where("id = ?", id).Update("account_key", []byte(encrypted)).Error
 }
 
 // GetCertCount 获取工作区关联的证书数量
 func (s *WorkspaceService) GetCertCount(id uint) int64 {
 	var count int64
-	store.GetDB().Model(&model.Certificate{}).Where("workspace_id = ?", id).Count(&count)
+	s.db().Model(&model.Certificate{}).Where("workspace_id = ?", id).Count(&count)
 	return count
 }
@@ -34,6 +34,7 @@ func InitDB(dataDir string) error {
 		&model.Workspace{},
 		&model.Certificate{},
 		&model.DNSProvider{},
+		&model.DNSChallengeRecord{},
 		&model.Agent{},
 		&model.AgentCert{},
 		&model.Notification{},
@@ -41,6 +42,12 @@ func InitDB(dataDir string) error {
 		&model.Setting{},
 		&model.TaskLog{},
 		&model.TaskLogStatus{},
+		&model.ACMEAccount{},
+		&model.ACMEOrder{},
+		&model.ACMEAuthorization{},
+		&model.ACMEChallenge{},
+		&model.CertBatchJob{},
+		&model.CertBatchItem{},
 	)
 	if err != nil {
 		return fmt.Errorf("数据库迁移失败: %w", err)
@@ -73,3 +80,11 @@ func initDefaultSettings(db *gorm.DB) error {
 func GetDB() *gorm.DB {
 	return DB
 }
+
+// GetDBOr 返回事务连接 tx，为 nil 时返回全局连接
+func GetDBOr(tx *gorm.DB) *gorm.DB {
+	if tx != nil {
+		return tx
+	}
+	return DB
+}
@@ -42,18 +42,74 @@ export const authApi = {
     api.post('/auth/password', { old_password: oldPassword, new_password: newPassword }),
 }
 
+// 按域名覆盖的验证配置
+export interface DomainChallenge {
+  domain: string
+  challenge_type?: string
+  dns_provider_id?: number
+  challenge_alias?: string
+}
+
+// 导入外部证书：PEM（cert/key/chain）或 PKCS#12（Base64 编码）二选一
+export interface CertImport {
+  cert?: string
+  key?: string
+  chain?: string
+  pkcs12?: string
+  password?: string
+  workspace_id?: number | null
+}
+
+// 批量操作选择证书的条件，设置的条件需同时满足
+export interface CertFilter {
+  ids?: number[]
+  all?: boolean
+  workspace_id?: number // 0 表示使用全局配置的证书
+  dns_provider_id?: number
+  domain?: string
+  status?: string
+  source?: string
+  challenge_type?: string
+  expires_within?: number
+}
+
+// 批量操作：issue, renew, delete, set_workspace, set_dns_provider, attach_agent
+export interface CertBatch {
+  action: string
+  filter: CertFilter
+  dry_run?: boolean
+  workspace_id?: number | null
+  dns_provider_id?: number
+  agent?: {
+    agent_id: number
+    deploy_path: string // {domain} 替换为证书主域名
+    file_mapping?: { cert: string; key: string; fullchain: string }
+    reload_cmd?: string
+  }
+}
+
 // 证书 API
 export const certsApi = {
   list: () => api.get('/certs'),
   stats: () => api.get('/certs/stats'),
   get: (id: number) => api.get(`/certs/${id}`),
-  create: (data: { domain: string; san: string[]; challenge_type?: string; dns_provider_id: number; workspace_id?: number | null }) =>
+  create: (data: { domain: string; san: string[]; challenge_type?: string; dns_provider_id: number; challenge_alias?: string; domain_challenges?: DomainChallenge[]; include_apex?: boolean; workspace_id?: number | null }) =>
     api.post('/certs', data),
-  update: (id: number, data: { domain: string; san: string[]; challenge_type?: string; dns_provider_id: number; workspace_id?: number | null }) =>
+  update: (id: number, data: { domain: string; san: string[]; challenge_type?: string; dns_provider_id: number; challenge_alias?: string; domain_challenges?: DomainChallenge[]; include_apex?: boolean; workspace_id?: number | null; csr?: string; clear_csr?: boolean }) =>
     api.put(`/certs/${id}`, data),
   delete: (id: number) => api.delete(`/certs/${id}`),
   issue: (id: number) => api.post(`/certs/${id}/issue`),
   renew: (id: number) => api.post(`/certs/${id}/renew`),
+  import: (data: CertImport) => api.post('/certs/import', data),
+  reimport: (id: number, data: CertImport) => api.post(`/certs/${id}/import`, data),
+  batch: (data: CertBatch) => api.post('/certs/batch', data),
+  batchJobs: (limit?: number) => api.get('/certs/batch', { params: { limit } }),
+  batchJob: (id: number) => api.get(`/certs/batch/${id}`),
+  // 创建 EventSource 连接用于批量任务进度
+  createBatchStream: (id: number) => {
+    const token = localStorage.getItem('token')
+    return new EventSource(`/api/certs/batch/${id}/stream${token ? `?token=${token}` : ''}`)
+  },
 }
 
 // Agent API
@@ -83,12 +139,17 @@ export const agentsApi = {
 // DNS 提供商 API
 export const dnsProvidersApi = {
   list: () => api.get('/dns-providers'),
+  types: () => api.get('/dns-providers/types'),
   get: (id: number) => api.get(`/dns-providers/${id}`),
   create: (data: { name: string; type: string; config: Record<string, string> }) =>
     api.post('/dns-providers', data),
   update: (id: number, data: { name: string; type: string; config?: Record<string, string> }) =>
     api.put(`/dns-providers/${id}`, data),
   delete: (id: number) => api.delete(`/dns-providers/${id}`),
+  test: (id: number, data: { domains?: string[]; write_test?: boolean } = {}) =>
+    api.post(`/dns-providers/${id}/test`, data),
+  cleanup: (id: number, domains?: string[]) =>
+    api.post(`/dns-providers/${id}/cleanup`, domains ? { domains } : {}),
 }
 
 // 通知 API
@@ -121,12 +182,15 @@ export const workspacesApi = {
   list: () => api.get('/workspaces'),
   presets: () => api.get('/workspaces/presets'),
   get: (id: number) => api.get(`/workspaces/${id}`),
-  create: (data: { name: string; description?: string; ca_url: string; email: string; key_type?: string }) =>
+  create: (data: { name: string; description?: string; type?: string; ca_url: string; email: string; key_type?: string; cert_validity_days?: number; acme_server?: boolean }) =>
     api.post('/workspaces', data),
-  update: (id: number, data: { name: string; description?: string; ca_url: string; email: string; key_type?: string }) =>
+  update: (id: number, data: { name: string; description?: string; ca_url: string; email: string; key_type?: string; cert_validity_days?: number; acme_server?: boolean }) =>
     api.put(`/workspaces/${id}`, data),
   delete: (id: number) => api.delete(`/workspaces/${id}`),
   setDefault: (id: number) => api.post(`/workspaces/${id}/default`),
+  // 下载私有 CA 证书 (root / intermediate / chain)
+  downloadCA: (id: number, type: string) =>
+    api.get(`/workspaces/${id}/ca/${type}`, { responseType: 'text' }),
 }
 
 // 任务日志 API